@@ -0,0 +1,614 @@
+package main
+
+import (
+	"clitools/fss"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// cliConfig holds the flag values of a command
+type cliConfig struct {
+	arg             string
+	args            []string
+	rootFlags       stringList
+	failFast        bool
+	dir             string
+	log             string
+	presets         string
+	filterChain     string
+	watch           bool
+	version         bool
+	json            bool
+	configFile      string
+	profile         string
+	printConfig     bool
+	every           time.Duration
+	jitter          percent
+	errOut          io.Writer
+	tui             bool
+	addr            string
+	allowActions    bool
+	planOut         string
+	snapshotOut     string
+	force           string
+	applyHash       string
+	mailTo          stringList
+	mailFrom        string
+	smtpHost        string
+	mailOn          string
+	mailAttachLimit int64
+	gzipLevel       int
+	cfg             fss.Config
+}
+
+// command is a subcommand with its own flag set
+type command struct {
+	name       string
+	args       string
+	short      string
+	profileArg bool // the argument is a profile, not the root
+	multiRoot  bool // any number of roots can be given
+	flags      []func(*flag.FlagSet, *cliConfig)
+	run        func(*cliConfig, io.Writer) error
+}
+
+// commands lists the subcommands in the order shown in the help. It's
+// set in init as some of the commands read it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:      "list",
+			args:      "[root...]",
+			multiRoot: true,
+			short:     "List the matched files",
+			flags:     []func(*flag.FlagSet, *cliConfig){addFilterFlags, addListFlags, addSampleFlags, addHashCacheFlags, addWatchFlags, addScheduleFlags, addMailFlags, addConfigFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				c.cfg.List = true
+				return scan(c, out)
+			},
+		},
+		{
+			name:      "delete",
+			args:      "[root...]",
+			multiRoot: true,
+			short:     "Delete the matched files",
+			flags:     []func(*flag.FlagSet, *cliConfig){addFilterFlags, addDeleteFlags, addWatchFlags, addScheduleFlags, addMailFlags, addConfigFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				c.cfg.Del = true
+				return scan(c, out)
+			},
+		},
+		{
+			name:      "archive",
+			args:      "[root...]",
+			multiRoot: true,
+			short:     "Compress the matched files into an archive directory",
+			flags:     []func(*flag.FlagSet, *cliConfig){addFilterFlags, addArchiveFlags, addDedupeFlags, addHashCacheFlags, addWatchFlags, addScheduleFlags, addMailFlags, addConfigFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				if c.cfg.Arc == "" {
+					return errors.New("archive needs an -arc directory")
+				}
+				return scan(c, out)
+			},
+		},
+		{
+			name:      "replace",
+			args:      "[root...]",
+			multiRoot: true,
+			short:     "Replace a string in the matched text files",
+			flags:     []func(*flag.FlagSet, *cliConfig){addFilterFlags, addReplaceFlags, addScheduleFlags, addMailFlags, addConfigFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				if c.cfg.ReplaceOld == "" {
+					return errors.New("replace needs a -replace-old string")
+				}
+				return scan(c, out)
+			},
+		},
+		{
+			name:      "exec",
+			args:      "[root...]",
+			multiRoot: true,
+			short:     "Run a command on each matched file",
+			flags:     []func(*flag.FlagSet, *cliConfig){addFilterFlags, addExecFlags, addScheduleFlags, addMailFlags, addConfigFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				if strings.TrimSpace(c.cfg.Exec) == "" && strings.TrimSpace(c.cfg.ExecOnMatchDir) == "" {
+					return errors.New("exec needs an -exec or -exec-on-match-dir command")
+				}
+				return scan(c, out)
+			},
+		},
+		{
+			name:      "rename",
+			args:      "[root...]",
+			multiRoot: true,
+			short:     "Rename the matched files adding or removing a suffix of their name",
+			flags:     []func(*flag.FlagSet, *cliConfig){addFilterFlags, addRenameFlags, addRenameLogFlag, addScheduleFlags, addMailFlags, addConfigFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				if c.cfg.AppendSuffix == "" && c.cfg.StripSuffix == "" {
+					return errors.New("rename needs an -append-suffix or -strip-suffix")
+				}
+				return scan(c, out)
+			},
+		},
+		{
+			name:      "report",
+			args:      "[root...]",
+			multiRoot: true,
+			short:     "Report on the matched files, totals by default",
+			flags:     []func(*flag.FlagSet, *cliConfig){addFilterFlags, addReportFlags, addSampleFlags, addScheduleFlags, addMailFlags, addConfigFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				if !hasReport(c.cfg) {
+					c.cfg.ReportTotals = true
+				}
+				c.cfg.List = true
+				return scan(c, out)
+			},
+		},
+		{
+			name:  "restore",
+			args:  "[dest]",
+			short: "Restore the files of an archive directory",
+			flags: []func(*flag.FlagSet, *cliConfig){addRestoreFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				if c.cfg.Arc == "" {
+					return errors.New("restore needs an -arc directory")
+				}
+				return fss.Restore(c.cfg.Arc, c.root(), out)
+			},
+		},
+		{
+			name:  "plan",
+			args:  "[root]",
+			short: "Write the delete and archive actions of a scan to a plan file",
+			flags: []func(*flag.FlagSet, *cliConfig){addFilterFlags, addPlanFlags, addHashCacheFlags, addConfigFlags},
+			run:   plan,
+		},
+		{
+			name:  "apply",
+			args:  "PLAN",
+			short: "Apply the actions of a plan file to the unchanged files",
+			flags: []func(*flag.FlagSet, *cliConfig){addApplyFlags},
+			run:   apply,
+		},
+		{
+			name:  "snapshot",
+			args:  "[root]",
+			short: "Record the entries of a tree to a snapshot file for query",
+			flags: []func(*flag.FlagSet, *cliConfig){addSnapshotFlags},
+			run:   snapshot,
+		},
+		{
+			name:      "query",
+			args:      "SNAPSHOT...",
+			multiRoot: true,
+			short:     "List and report the matched files of snapshot files",
+			flags:     []func(*flag.FlagSet, *cliConfig){addFilterFlags, addListFlags, addReportFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				if len(c.args) == 0 && len(c.rootFlags) == 0 {
+					return errors.New("query needs a snapshot file")
+				}
+				c.cfg.FromSnapshot = true
+				c.cfg.List = true
+				return scan(c, out)
+			},
+		},
+		{
+			name:  "serve",
+			args:  "[root]",
+			short: "Serve scan results over HTTP",
+			flags: []func(*flag.FlagSet, *cliConfig){addFilterFlags, addListFlags, addHashCacheFlags, addServeFlags, addScheduleFlags, addConfigFlags},
+			run:   serve,
+		},
+		{
+			name:  "rpc",
+			args:  "[root]",
+			short: "Answer JSON-RPC scan requests on the standard input",
+			flags: []func(*flag.FlagSet, *cliConfig){addRPCFlags},
+			run:   rpc,
+		},
+		{
+			name:       "run",
+			args:       "PROFILE",
+			short:      "Run a profile of the config file",
+			profileArg: true,
+			flags:      legacyFlags,
+			run: func(c *cliConfig, out io.Writer) error {
+				return scan(c, out)
+			},
+		},
+		{
+			name:  "profiles",
+			short: "List the profiles of the config file",
+			flags: []func(*flag.FlagSet, *cliConfig){addConfigFileFlag},
+			run: func(c *cliConfig, out io.Writer) error {
+				return listProfiles(out, c.configFile)
+			},
+		},
+		{
+			name:  "version",
+			short: "Print the version and build details",
+			flags: []func(*flag.FlagSet, *cliConfig){addVersionFlags},
+			run: func(c *cliConfig, out io.Writer) error {
+				return printVersion(out, c.json)
+			},
+		},
+		{
+			name:  "completion",
+			args:  "bash|zsh|fish",
+			short: "Print the shell completion script",
+			run: func(c *cliConfig, out io.Writer) error {
+				return writeCompletion(c.arg, out)
+			},
+		},
+	}
+}
+
+// legacyFlags are the flags of the bare fss command, kept for scripts
+// written before the subcommands
+var legacyFlags = []func(*flag.FlagSet, *cliConfig){
+	addFilterFlags, addListFlags, addSampleFlags, addReportFlags, addDeleteFlags, addArchiveFlags, addDedupeFlags,
+	addHashCacheFlags, addReplaceFlags, addExecFlags, addRenameFlags, addLegacyFlags, addTUIFlags, addWatchFlags, addScheduleFlags, addMailFlags, addConfigFlags,
+}
+
+// hasReport reports whether a report flag is set in cfg
+func hasReport(cfg fss.Config) bool {
+	return cfg.ReportBrokenUTF8 || cfg.ReportUnusualChars || cfg.ReportLargestDir || cfg.ReportLargestDirN > 0 ||
+		cfg.ReportHardlinkTrees || cfg.ReportDuplicateInodes || cfg.ReportDuplicateNames || cfg.ReportIdenticalDirs || cfg.ReportByOwner || cfg.BigDirs > 0 ||
+		cfg.ReportFileAge || cfg.ReportContentType || cfg.ReportFSType || cfg.ReportGitStatus || cfg.ReportJSONValidity ||
+		cfg.ReportLineCount || cfg.ReportWordCount || cfg.ReportFirstLine || cfg.ReportPkgType ||
+		cfg.ReportShebang || cfg.ReportNullBytes || cfg.ReportFileEncoding || cfg.ReportEntropy ||
+		cfg.ReportNumericNames || cfg.ReportZipContents || cfg.ReportTarContents || cfg.ReportZip64 ||
+		cfg.ReportPartialGzip || cfg.ReportYAMLValidity || cfg.ReportTOMLValidity || cfg.ReportCSVValidity || cfg.ReportINIValidity || cfg.ReportFileSignature || cfg.WC
+}
+
+// root returns the directory given as argument, or with -dir
+func (c *cliConfig) root() string {
+	if c.arg != "" {
+		return c.arg
+	}
+	return c.dir
+}
+
+// roots returns the directories given with -root and as arguments, or
+// the one of -dir
+func (c *cliConfig) roots() []string {
+	roots := append(append([]string{}, c.rootFlags...), c.args...)
+	if len(roots) == 0 {
+		return []string{c.dir}
+	}
+	return roots
+}
+
+// singleRoot returns the root of the commands scanning a single tree
+func (c *cliConfig) singleRoot() (string, error) {
+	roots := c.roots()
+	if len(roots) > 1 {
+		return "", fmt.Errorf("only one root can be given, got %d", len(roots))
+	}
+	return roots[0], nil
+}
+
+// stringList is a flag value collecting every value it's given
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// excludeFrom is a flag value reading the exclude patterns of each file
+// it's given into patterns
+type excludeFrom struct {
+	files    []string
+	patterns *[]string
+}
+
+func (e *excludeFrom) String() string {
+	if e == nil {
+		return ""
+	}
+	return strings.Join(e.files, ",")
+}
+
+func (e *excludeFrom) Set(file string) error {
+	patterns, err := fss.ReadExcludeFile(file)
+	if err != nil {
+		return err
+	}
+	e.files = append(e.files, file)
+	*e.patterns = append(*e.patterns, patterns...)
+	return nil
+}
+
+// prefixPair is an old:new prefix flag value
+type prefixPair [2]string
+
+func (p *prefixPair) String() string {
+	if p == nil || p[0] == "" {
+		return ""
+	}
+	return p[0] + ":" + p[1]
+}
+
+// Set splits the value on the first colon
+func (p *prefixPair) Set(s string) error {
+	i := strings.Index(s, ":")
+	if i < 1 {
+		return errors.New("expected old:new with a non empty old prefix")
+	}
+	p[0], p[1] = s[:i], s[i+1:]
+	return nil
+}
+
+// fileFlags take a file or directory name
+var fileFlags = map[string]bool{
+	"dir": true, "root": true, "arc": true, "log": true, "presets": true, "write-file-list": true,
+}
+
+// flagAliases maps the other names of a flag to its canonical one. They
+// share the canonical source, so an environment or config file value of
+// either name never overrides the other given on the command line.
+var flagAliases = map[string]string{
+	"fsnotify": "watch",
+}
+
+// flagValues are the values accepted by the enumerated flags
+var flagValues = map[string][]string{
+	"sort":             {"path", "size", "mtime"},
+	"walk-order":       {"pre", "post", "breadth"},
+	"level":            {"auto", "-2", "-1", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9"},
+	"gzip-level":       {"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"},
+	"output-encoding":  {"utf-8", "utf-16le", "utf-16be", "latin-1"},
+	"mail-on":          {"failure", "always"},
+	"rename-collision": {"error", "number", "overwrite"},
+}
+
+// findCommand returns the subcommand called name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// newFlagSet registers flags on a new flag set writing into c
+func newFlagSet(name string, flags []func(*flag.FlagSet, *cliConfig), c *cliConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	for _, add := range flags {
+		add(fs, c)
+	}
+	return fs
+}
+
+// addFilterFlags registers the filters shared by the scanning commands
+func addFilterFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.dir, "dir", ".", "Root directory to start")
+	fs.Var(&c.rootFlags, "root", "Root directory to scan, can be repeated")
+	fs.BoolVar(&c.failFast, "fail-fast", false, "Stop at the first root that fails instead of scanning the others")
+	fs.StringVar(&c.cfg.Ext, "ext", "", "File extension to filter out")
+	fs.Int64Var(&c.cfg.Size, "size", 0, "Minimum file size")
+	fs.Int64Var(&c.cfg.MaxFileSize, "max-file-size", 0, "Skip files larger than this many bytes")
+	fs.BoolVar(&c.cfg.ReportNumericNames, "report-numeric-names", false, "Match only the files named with digits only, listed as NUMERIC")
+	fs.StringVar(&c.cfg.GoBuildTag, "go-build-tag", "", "Match only the Go files with a build constraint naming this tag")
+	fs.StringVar(&c.cfg.RequireEncoding, "require-encoding", "", "Match only the files detected in this encoding: ascii, utf-8, utf-16le, utf-16be, iso-8859-1 or windows-1252")
+	fs.Float64Var(&c.cfg.MinEntropy, "min-entropy", 0, "Match only the files with at least this entropy in bits per byte, 0 to 8")
+	fs.Float64Var(&c.cfg.MaxEntropy, "max-entropy", 0, "Match only the files with at most this entropy in bits per byte, 0 to 8")
+	fs.IntVar(&c.cfg.EntropyKiB, "entropy-kib", fss.DefaultEntropyKiB, "KiB read from the start of each file to estimate its entropy")
+	fs.DurationVar(&c.cfg.CNewer, "cnewer", 0, "Match only the files whose inode changed less than this long ago")
+	fs.DurationVar(&c.cfg.COlder, "colder", 0, "Match only the files whose inode changed more than this long ago")
+	fs.BoolVar(&c.cfg.ScanArchives, "scan-archives", false, "Match the members of the zip and tar archives too, listed as archive!/member")
+	fs.IntVar(&c.cfg.ArchiveDepth, "archive-depth", 1, "Levels of archives inside archives scanned with -scan-archives")
+	fs.BoolVar(&c.cfg.ExcludeSymlinks, "exclude-symlinks", false, "Skip the symbolic links instead of matching them as files")
+	fs.BoolVar(&c.cfg.UniqueExtPerDir, "unique-ext-per-dir", false, "Match only the first file of each extension in every directory")
+	fs.Var((*stringList)(&c.cfg.Exclude), "exclude", "Skip the paths matching this rsync style pattern, can be repeated")
+	fs.Var(&excludeFrom{patterns: &c.cfg.Exclude}, "exclude-from", "Skip the paths matching the patterns of this file, one per line, can be repeated")
+	fs.Var((*stringList)(&c.cfg.ExcludeMounts), "exclude-mount", "Skip the directory at this path, like a mount point, can be repeated")
+	fs.Var((*stringList)(&c.cfg.ExcludeMountPrefixes), "exclude-mount-prefix", "Skip the directories whose path starts with this prefix, can be repeated")
+	fs.BoolVar(&c.cfg.NoIgnore, "no-ignore", false, "Don't skip the paths matched by the .fssignore files")
+	fs.BoolVar(&c.cfg.NoStat, "no-stat", false, "Skip stat calls when only path based filters are used")
+	fs.StringVar(&c.cfg.WalkOrder, "walk-order", "", "Order of the walk: pre, post or breadth, pre by default")
+	fs.StringVar(&c.presets, "presets", "", "JSON file with named filter presets")
+	fs.StringVar(&c.filterChain, "filter-chain", "", "Comma separated filter presets to apply in order")
+	fs.StringVar(&c.cfg.FilterCmd, "filter-cmd", "", "External command accepting or rejecting the matched files, see the README")
+	fs.BoolVar(&c.cfg.FilterCmdNUL, "filter-cmd-nul", false, "End the -filter-cmd records and answers with NUL bytes")
+	fs.Float64Var(&c.cfg.Pace, "pace", 0, "Limit filesystem operations per second")
+	fs.StringVar(&c.cfg.WriteFileList, "write-file-list", "", "Write every scanned file to this file, matches prefixed with *")
+	fs.StringVar(&c.cfg.OutputEncoding, "output-encoding", "utf-8", "Output encoding: utf-8, utf-16le, utf-16be or latin-1")
+}
+
+// addListFlags registers the flags of the listing
+func addListFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.cfg.Sort, "sort", "", "Sort listed files by path, size or mtime")
+	fs.BoolVar(&c.cfg.GroupByExt, "group-by-ext", false, "List the matched files grouped under a [.ext] header per extension")
+	fs.IntVar(&c.cfg.MaxInMemory, "max-in-memory", fss.DefaultMaxInMemory, "Buffered files kept in memory before spilling to disk")
+	fs.BoolVar(&c.cfg.Checksum, "checksum", false, "List the checksums of matched files, hashed with -hash")
+	fs.IntVar(&c.cfg.HashWorkers, "hash-workers", runtime.NumCPU(), "Files hashed concurrently")
+	fs.StringVar(&c.cfg.StripPrefix, "strip-prefix", "", "Remove this prefix from the listed paths")
+	fs.BoolVar(&c.cfg.StrictStrip, "strict-strip", false, "Skip listed paths that don't start with -strip-prefix")
+	fs.Var((*prefixPair)(&c.cfg.ReplacePrefix), "replace-prefix", "Replace a prefix of the listed paths, as old:new")
+	fs.BoolVar(&c.cfg.ResolveSymlinks, "resolve-symlinks-in-output", false, "List the real path of the matched files, resolving the symbolic links")
+}
+
+// addSampleFlags registers the flags sampling the listed files
+func addSampleFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.IntVar(&c.cfg.SieveN, "sieve-n", 0, "List a sample of about N files keeping the per directory proportions")
+	fs.StringVar(&c.cfg.Sample, "sample", "", "List a uniform random sample of the matched files, N files or P% of them")
+	fs.Int64Var(&c.cfg.RandSeed, "rand-seed", 1, "Seed of the -sieve-n and -sample samples")
+}
+
+// addHashCacheFlags registers the flags of the hash algorithm and the
+// checksum cache
+func addHashCacheFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.cfg.Hash, "hash", fss.HashSHA256, "Hash algorithm of the checksums, dedupe and plans: "+strings.Join(fss.HashAlgos(), ", "))
+	fs.BoolVar(&c.cfg.XattrCache, "xattr-cache", false, "Cache the checksums in the user.fss.<hash> extended attribute of the files")
+	fs.BoolVar(&c.cfg.RefreshCache, "refresh-cache", false, "Hash the files again with -xattr-cache, replacing the cached checksums")
+}
+
+// addWatchFlags registers the flags of the watch mode
+func addWatchFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.BoolVar(&c.watch, "watch", false, "Keep running and apply the filters and actions to files as they change")
+	fs.BoolVar(&c.watch, "fsnotify", false, "Same as -watch")
+	fs.DurationVar(&c.cfg.Debounce, "debounce", 100*time.Millisecond, "Window used to batch rapid filesystem events")
+	fs.DurationVar(&c.cfg.Settle, "settle", 0, "Wait until a watched file had no events for this long")
+	fs.BoolVar(&c.cfg.WatchInitialScan, "watch-initial-scan", false, "Scan the whole tree once when watching starts")
+}
+
+// addReportFlags registers the reports
+func addReportFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.BoolVar(&c.cfg.ReportBrokenUTF8, "report-broken-utf8", false, "Report file names with invalid UTF-8 encoding")
+	fs.BoolVar(&c.cfg.ReportUnusualChars, "report-unusual-chars", false, "Report file names with characters outside printable ASCII, hex encoded")
+	fs.BoolVar(&c.cfg.ReportTotals, "report-totals", false, "Print the total files and directories scanned")
+	fs.BoolVar(&c.cfg.ReportLargestDir, "report-largest-dir", false, "Report the directory with the most matched files")
+	fs.IntVar(&c.cfg.ReportLargestDirN, "report-largest-dir-n", 0, "Report the N directories with the most matched files")
+	fs.BoolVar(&c.cfg.ReportFileAge, "report-file-age", false, "List the age of the matched files before their path")
+	fs.BoolVar(&c.cfg.ReportContentType, "report-content-type", false, "List the MIME type sniffed from the content of the matched files")
+	fs.BoolVar(&c.cfg.ReportFSType, "report-fs-type", false, "List the type of the filesystem of the matched files, like ext4 or tmpfs")
+	fs.BoolVar(&c.cfg.ReportGitStatus, "report-git-status", false, "List the git status of the matched files before their path, .. when unchanged")
+	fs.BoolVar(&c.cfg.ReportJSONValidity, "report-json-validity", false, "Label the matched files VALID or INVALID JSON")
+	fs.BoolVar(&c.cfg.ReportYAMLValidity, "report-yaml-validity", false, "Label the matched .yml and .yaml files VALID or INVALID YAML, with the parse error")
+	fs.BoolVar(&c.cfg.ReportTOMLValidity, "report-toml-validity", false, "Label the matched .toml files VALID or INVALID TOML, with the parse error")
+	fs.BoolVar(&c.cfg.ReportCSVValidity, "report-csv-validity", false, "Label the matched .csv files VALID or INVALID CSV, with the parse error and its line")
+	fs.BoolVar(&c.cfg.ReportINIValidity, "report-ini-validity", false, "Label the matched .ini and .cfg files VALID or INVALID INI, with the section and key at fault")
+	fs.IntVar(&c.cfg.CSVColumnCount, "csv-column-count", 0, "Columns every row must have with -report-csv-validity, 0 for as many as the first row")
+	fs.BoolVar(&c.cfg.WC, "wc", false, "List the newlines, words and bytes of the matched text files like wc, with their totals")
+	fs.BoolVar(&c.cfg.LinesOnly, "lines-only", false, "Count the newlines only with -wc, faster on big files")
+	fs.BoolVar(&c.cfg.ReportLineCount, "report-line-count", false, "List the number of lines of the matched files before their path")
+	fs.BoolVar(&c.cfg.ReportWordCount, "report-word-count", false, "List the number of words of the matched files before their path")
+	fs.BoolVar(&c.cfg.ReportFirstLine, "report-first-line", false, "List the first line of the matched files before their path")
+	fs.BoolVar(&c.cfg.ReportShebang, "report-shebang", false, "List the interpreter of the #! line of the matched files before their path")
+	fs.BoolVar(&c.cfg.ReportNullBytes, "report-null-bytes", false, "List the matched files holding a NUL byte as BINARY")
+	fs.BoolVar(&c.cfg.ReportFileEncoding, "report-file-encoding", false, "List the text encoding detected for the matched files before their path")
+	fs.BoolVar(&c.cfg.ReportEntropy, "report-entropy", false, "List the entropy of the matched files in bits per byte before their path")
+	fs.BoolVar(&c.cfg.ReportPkgType, "report-pkg-type", false, "List the executable format of the matched files, ELF, PE, Mach-O, SCRIPT or UNKNOWN")
+	fs.BoolVar(&c.cfg.ReportFileSignature, "report-file-signature", false, "List the matched files whose magic bytes don't agree with their extension as MISMATCH")
+	fs.BoolVar(&c.cfg.ReportZipContents, "report-zip-contents", false, "List the entries of the matched zip files with their size")
+	fs.IntVar(&c.cfg.ZipEntryLimit, "zip-entry-limit", 1000, "Entries listed per zip file with -report-zip-contents, 0 for all")
+	fs.BoolVar(&c.cfg.ReportZip64, "report-zip64", false, "Label the matched zip files ZIP64 when they use the Zip64 extensions, ZIP32 otherwise")
+	fs.BoolVar(&c.cfg.ReportPartialGzip, "report-partial-gzip", false, "Label the matched .gz files PARTIAL_GZIP when they don't decompress to their end")
+	fs.BoolVar(&c.cfg.ReportTarContents, "report-tar-contents", false, "List the entries of the matched tar archives with their size and mode")
+	fs.BoolVar(&c.cfg.ReportHardlinkTrees, "report-hardlink-trees", false, "Report the matched files sharing an inode across directories")
+	fs.BoolVar(&c.cfg.ReportDuplicateInodes, "report-duplicate-inodes", false, "Report the matched files sharing an inode, one HARDLINK_GROUP line per inode")
+	fs.BoolVar(&c.cfg.ReportDuplicateNames, "report-duplicate-names", false, "Report the file names matched in more than one directory")
+	fs.BoolVar(&c.cfg.ReportIdenticalDirs, "report-identical-dirs", false, "Report the directories whose matched files have the same names, sizes and modification times")
+	fs.BoolVar(&c.cfg.ReportByOwner, "by-owner", false, "Report the number and size of the matched files per owner, the largest first")
+	fs.IntVar(&c.cfg.BigDirs, "big-dirs", 0, "Report the directories with more direct entries than this")
+	fs.BoolVar(&c.cfg.ApparentSize, "apparent-size", false, "Count the size of every hard link of a file in the reports, not the first one only")
+	fs.BoolVar(&c.cfg.HumanSizes, "human", false, "Print the sizes of -by-owner and -big-dirs in human readable units")
+	fs.BoolVar(&c.cfg.JSONReport, "json", false, "Write the -by-owner, -big-dirs and -wc reports as one JSON object")
+}
+
+// addDeleteFlags registers the flags of the delete action
+func addDeleteFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.log, "log", "", "Log delete to this file")
+	fs.BoolVar(&c.cfg.XDGTrash, "xdg-trash", false, "Move the deleted files to the XDG trash instead of removing them")
+	fs.IntVar(&c.cfg.DeleteWorkers, "delete-workers", 0, "Files deleted concurrently, 0 to delete them one at a time")
+}
+
+// addArchiveFlags registers the flags of the archive action
+func addArchiveFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.cfg.Arc, "arc", "", "Archive directory, or the URL of a registered archive sink")
+	fs.StringVar(&c.cfg.Level, "level", "", "Archive gzip level: 0-9, -1 for default, -2 for Huffman only, or auto")
+	fs.IntVar(&c.gzipLevel, "gzip-level", gzip.DefaultCompression, "Archive gzip level from 0 to 9, -level wins when given at the same or a higher precedence")
+	fs.BoolVar(&c.cfg.Verbose, "verbose", false, "Log extra details about actions")
+	fs.IntVar(&c.cfg.MaxArchiveFiles, "max-archive-files", 0, "Bundle archived files into numbered zip files of at most N files")
+	fs.StringVar(&c.cfg.ArcName, "arc-name", "", "Archive names template with {name}, {ext}, {date:LAYOUT}, {hash8} and {seq}")
+	fs.StringVar(&c.cfg.ArcNameTime, "arc-name-time", "mtime", "Time of the {date} of -arc-name: mtime of the file, or run")
+	fs.BoolVar(&c.cfg.TouchArchiveStamp, "touch-archive-stamp", false, "Write the archive time to a .last_archive file in each directory with archived files")
+	fs.BoolVar(&c.cfg.SplitByMonth, "split-by-month", false, "Archive the files in a YYYY-MM directory, or bundle, per month of their modification time")
+}
+
+// addExecFlags registers the flags of exec
+func addExecFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.cfg.Exec, "exec", "", "Command run on each matched file, {} standing for its path, appended if missing")
+	fs.StringVar(&c.cfg.ExecOnMatchDir, "exec-on-match-dir", "", "Command run after the walk once per directory with matched files, {} standing for its path")
+	fs.IntVar(&c.cfg.ExecParallel, "exec-parallel", 1, "Commands run at once, at most 64, their output still in walk order")
+}
+
+// addReplaceFlags registers the flags of replace
+func addReplaceFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.cfg.ReplaceOld, "replace-old", "", "String to replace in the matched text files")
+	fs.StringVar(&c.cfg.ReplaceNew, "replace-new", "", "String replacing the -replace-old string")
+	fs.BoolVar(&c.cfg.ReplaceDryRun, "replace-dry-run", false, "Show the changed lines without writing the files")
+	fs.IntVar(&c.cfg.ReplaceCount, "replace-count", 0, "Replace at most N times per file, 0 for no limit")
+}
+
+// addRenameFlags registers the flags of rename
+func addRenameFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.cfg.AppendSuffix, "append-suffix", "", "Rename the matched files adding this suffix to their name")
+	fs.StringVar(&c.cfg.StripSuffix, "strip-suffix", "", "Rename the matched files whose name ends with this suffix, removing it")
+	fs.StringVar(&c.cfg.RenameCollision, "rename-collision", "", "When the new name is taken: error, number or overwrite, error by default")
+}
+
+// addRenameLogFlag registers the -log flag of rename, the one of the bare
+// command being registered with the delete flags
+func addRenameLogFlag(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.log, "log", "", "Log the renames to this file")
+}
+
+// addDedupeFlags registers the flags replacing duplicates by hard links
+func addDedupeFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.BoolVar(&c.cfg.HardlinkDups, "hardlink-dups", false, "Replace matched files with the same content by hard links")
+	fs.Int64Var(&c.cfg.DedupeLinkThreshold, "dedupe-threshold", 0, "Only hard link duplicates larger than this many bytes, report the others")
+}
+
+// addRestoreFlags registers the flags of restore
+func addRestoreFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.cfg.Arc, "arc", "", "Archive directory to restore from")
+	fs.StringVar(&c.dir, "dir", ".", "Directory to restore the files into")
+}
+
+// addVersionFlags registers the flags of version
+func addVersionFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.BoolVar(&c.json, "json", false, "Print the build details as JSON")
+}
+
+// addLegacyFlags registers the action switches of the bare fss command
+func addLegacyFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.BoolVar(&c.cfg.List, "list", false, "List files only")
+	fs.BoolVar(&c.cfg.Del, "del", false, "Delete files")
+	fs.BoolVar(&c.version, "version", false, "Print the version and exit")
+}
+
+// commandUsage prints the help of a subcommand
+func commandUsage(cmd command, fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: fss %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.short)
+		fs.PrintDefaults()
+	}
+}
+
+// usage prints the help of the bare fss command
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "Usage: fss <command> [flags] [root...]\n       fss [flags] [root...]\n\nCommands:\n")
+		width := 0
+		for _, cmd := range commands {
+			if len(cmd.name) > width {
+				width = len(cmd.name)
+			}
+		}
+		for _, cmd := range commands {
+			fmt.Fprintf(w, "  %-*s %s\n", width, cmd.name, cmd.short)
+		}
+		fmt.Fprintf(w, "\nRun 'fss <command> -h' for the flags of a command. Without a command\nfss lists the files and accepts all the flags:\n")
+		fs.PrintDefaults()
+	}
+}
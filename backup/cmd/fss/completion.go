@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// shellNames are the shells with a completion script
+var shellNames = []string{"bash", "fish", "zsh"}
+
+// writeCompletion writes the completion script of shell
+func writeCompletion(shell string, w io.Writer) error {
+	switch shell {
+	case "bash":
+		return bashCompletion(w)
+	case "zsh":
+		return zshCompletion(w)
+	case "fish":
+		return fishCompletion(w)
+	}
+	return fmt.Errorf("unknown shell %q: use bash, zsh or fish", shell)
+}
+
+// completionFlags returns the flags of a command sorted by name, the bare
+// fss command for an empty name
+func completionFlags(name string) []*flag.Flag {
+	var c cliConfig
+	var fs *flag.FlagSet
+	if cmd, ok := findCommand(name); ok {
+		fs = newFlagSet(cmd.name, cmd.flags, &c)
+	} else {
+		fs = newFlagSet("fss", legacyFlags, &c)
+	}
+
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// isBoolFlag reports whether f takes no value
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// commandNames returns the names accepted as first argument
+func commandNames() []string {
+	names := make([]string, 0, len(commands)+1)
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	return append(names, "help")
+}
+
+func flagNames(flags []*flag.Flag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.Name
+	}
+	return strings.Join(names, " ")
+}
+
+func bashCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# bash completion for fss\n_fss() {\n")
+	b.WriteString("    local cur prev cmd flags\n")
+	b.WriteString("    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("    prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("    cmd=\"${COMP_WORDS[1]}\"\n\n")
+
+	b.WriteString("    case \"${prev}\" in\n")
+	var files []string
+	for name := range fileFlags {
+		files = append(files, "-"+name)
+	}
+	sort.Strings(files)
+	fmt.Fprintf(&b, "    %s)\n        COMPREPLY=($(compgen -f -- \"${cur}\"))\n        return ;;\n",
+		strings.Join(files, "|"))
+	var enums []string
+	for name := range flagValues {
+		enums = append(enums, name)
+	}
+	sort.Strings(enums)
+	for _, name := range enums {
+		fmt.Fprintf(&b, "    -%s)\n        COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n        return ;;\n",
+			name, strings.Join(flagValues[name], " "))
+	}
+	b.WriteString("    esac\n\n")
+
+	b.WriteString("    case \"${cmd}\" in\n")
+	for _, cmd := range commands {
+		if cmd.name == "completion" {
+			fmt.Fprintf(&b, "    completion)\n        COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n        return ;;\n",
+				strings.Join(shellNames, " "))
+			continue
+		}
+		fmt.Fprintf(&b, "    %s)\n        flags=\"%s\" ;;\n", cmd.name, flagNames(completionFlags(cmd.name)))
+	}
+	fmt.Fprintf(&b, "    *)\n        flags=\"%s\" ;;\n    esac\n\n", flagNames(completionFlags("")))
+
+	fmt.Fprintf(&b, "    if [[ ${COMP_CWORD} -eq 1 && \"${cur}\" != -* ]]; then\n"+
+		"        COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n", strings.Join(commandNames(), " "))
+	b.WriteString("    elif [[ \"${cur}\" == -* ]]; then\n" +
+		"        COMPREPLY=($(compgen -W \"${flags}\" -- \"${cur}\"))\n" +
+		"    else\n" +
+		"        COMPREPLY=($(compgen -f -- \"${cur}\"))\n" +
+		"    fi\n}\n")
+	b.WriteString("complete -o filenames -F _fss fss\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// zshSpec returns the _arguments spec of a flag
+func zshSpec(f *flag.Flag) string {
+	usage := strings.NewReplacer("'", "", "[", "\\[", "]", "\\]").Replace(f.Usage)
+	spec := fmt.Sprintf("-%s[%s]", f.Name, usage)
+	switch {
+	case isBoolFlag(f):
+	case fileFlags[f.Name]:
+		spec += ":file:_files"
+	case flagValues[f.Name] != nil:
+		spec += fmt.Sprintf(":value:(%s)", strings.Join(flagValues[f.Name], " "))
+	default:
+		spec += ":value:"
+	}
+	return "'" + spec + "'"
+}
+
+func zshArguments(b *strings.Builder, flags []*flag.Flag, indent string) {
+	b.WriteString(indent + "_arguments \\\n")
+	for _, f := range flags {
+		fmt.Fprintf(b, "%s    %s \\\n", indent, zshSpec(f))
+	}
+	fmt.Fprintf(b, "%s    '*:file:_files'\n", indent)
+}
+
+func zshCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("#compdef fss\n\n_fss() {\n    local -a commands\n    commands=(\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "        '%s:%s'\n", cmd.name, strings.ReplaceAll(cmd.short, "'", ""))
+	}
+	b.WriteString("        'help:Print the help of a command'\n    )\n\n")
+
+	b.WriteString("    case ${words[2]} in\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "    %s)\n        shift words\n        (( CURRENT-- ))\n", cmd.name)
+		if cmd.name == "completion" {
+			fmt.Fprintf(&b, "        _arguments '1:shell:(%s)'\n        ;;\n", strings.Join(shellNames, " "))
+			continue
+		}
+		zshArguments(&b, completionFlags(cmd.name), "        ")
+		b.WriteString("        ;;\n")
+	}
+	b.WriteString("    *)\n        if (( CURRENT == 2 )) && [[ ${words[2]} != -* ]]; then\n" +
+		"            _describe 'command' commands\n        fi\n")
+	zshArguments(&b, completionFlags(""), "        ")
+	b.WriteString("        ;;\n    esac\n}\n\ncompdef _fss fss\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fishFlag writes the complete line of a flag shown when cond holds
+func fishFlag(b *strings.Builder, f *flag.Flag, cond string) {
+	desc := strings.ReplaceAll(f.Usage, "'", "\\'")
+	fmt.Fprintf(b, "complete -c fss -n '%s' -o %s", cond, f.Name)
+	switch {
+	case isBoolFlag(f):
+	case fileFlags[f.Name]:
+		b.WriteString(" -r -F")
+	case flagValues[f.Name] != nil:
+		fmt.Fprintf(b, " -x -a '%s'", strings.Join(flagValues[f.Name], " "))
+	default:
+		b.WriteString(" -x")
+	}
+	fmt.Fprintf(b, " -d '%s'\n", desc)
+}
+
+func fishCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# fish completion for fss\ncomplete -c fss -f\n")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "complete -c fss -n __fish_use_subcommand -a %s -d '%s'\n",
+			cmd.name, strings.ReplaceAll(cmd.short, "'", "\\'"))
+	}
+	b.WriteString("complete -c fss -n __fish_use_subcommand -a help -d 'Print the help of a command'\n")
+
+	for _, cmd := range commands {
+		cond := "__fish_seen_subcommand_from " + cmd.name
+		if cmd.name == "completion" {
+			fmt.Fprintf(&b, "complete -c fss -n '%s' -a '%s'\n", cond, strings.Join(shellNames, " "))
+			continue
+		}
+		for _, f := range completionFlags(cmd.name) {
+			fishFlag(&b, f, cond)
+		}
+		fmt.Fprintf(&b, "complete -c fss -n '%s' -F\n", cond)
+	}
+	for _, f := range completionFlags("") {
+		fishFlag(&b, f, "__fish_use_subcommand")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestCompletionFlags checks that every registered flag and command is
+// in the completion script of each shell
+func TestCompletionFlags(t *testing.T) {
+	patterns := map[string]string{
+		"bash": `[ "|]-%s[ "|)]`,
+		"zsh":  `'-%s\[`,
+		"fish": ` -o %s `,
+	}
+
+	names := []string{""}
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+
+	for _, shell := range shellNames {
+		t.Run(shell, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := writeCompletion(shell, &buffer); err != nil {
+				t.Fatal(err)
+			}
+			script := buffer.String()
+
+			for _, name := range names {
+				if name != "" && !strings.Contains(script, name) {
+					t.Errorf("expected command %q in the script\n", name)
+				}
+				for _, f := range completionFlags(name) {
+					re := regexp.MustCompile(strings.ReplaceAll(patterns[shell], "%s", regexp.QuoteMeta(f.Name)))
+					if !re.MatchString(script) {
+						t.Errorf("expected flag -%s of %q in the script\n", f.Name, name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompletionValues(t *testing.T) {
+	var c cliConfig
+	fs := newFlagSet("fss", legacyFlags, &c)
+
+	// File and value hints must name registered flags
+	for name := range fileFlags {
+		if fs.Lookup(name) == nil {
+			t.Errorf("file flag -%s is not registered\n", name)
+		}
+	}
+	for name := range flagValues {
+		if fs.Lookup(name) == nil {
+			t.Errorf("enumerated flag -%s is not registered\n", name)
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := writeCompletion("bash", &buffer); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), `-W "path size mtime"`) {
+		t.Errorf("expected -sort values in %q\n", buffer.String())
+	}
+
+	if err := writeCompletion("tcsh", &buffer); err == nil {
+		t.Error("expected error for unknown shell")
+	}
+}
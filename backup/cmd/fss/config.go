@@ -0,0 +1,398 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileValue is a flag value set in the config file
+type fileValue struct {
+	name  string
+	value string
+	line  int
+}
+
+// profile is a named set of flag values of the config file
+type profile struct {
+	description string
+	line        int
+	values      []fileValue
+}
+
+// fileConfig holds the flag values and profiles of a config file
+type fileConfig struct {
+	file     string
+	values   []fileValue
+	profiles map[string]profile
+}
+
+// defaultConfigFile returns ~/.config/fss/config.yaml, or the same file
+// under $XDG_CONFIG_HOME when it's set
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fss", "config.yaml")
+}
+
+// addConfigFlags registers the flags selecting the config file
+func addConfigFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.configFile, "config", "", "Config file, ~/.config/fss/config.yaml by default")
+	fs.StringVar(&c.profile, "profile", "", "Apply this profile of the config file")
+	fs.BoolVar(&c.printConfig, "print-config", false, "Print the effective configuration and exit")
+}
+
+// addConfigFileFlag registers only the config file flag
+func addConfigFileFlag(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.configFile, "config", "", "Config file, ~/.config/fss/config.yaml by default")
+}
+
+// configFlags are the flags about the config file itself, they can't be
+// set in it
+var configFlags = map[string]bool{"config": true, "profile": true, "print-config": true}
+
+// knownFlags returns the names of the flags of every command
+func knownFlags() map[string]bool {
+	known := map[string]bool{}
+	visit := func(fs *flag.FlagSet) {
+		fs.VisitAll(func(f *flag.Flag) {
+			if !configFlags[f.Name] {
+				known[f.Name] = true
+			}
+		})
+	}
+
+	var c cliConfig
+	visit(newFlagSet("fss", legacyFlags, &c))
+	for _, cmd := range commands {
+		visit(newFlagSet(cmd.name, cmd.flags, &c))
+	}
+	return known
+}
+
+// loadConfigFile reads a YAML config file with one key per flag and an
+// optional profiles mapping of named flag sets:
+//
+//	ext: .log
+//	size: 1024
+//	profiles:
+//	  big:
+//	    size: 10485760
+func loadConfigFile(file string) (*fileConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	fc := &fileConfig{file: file, profiles: map[string]profile{}}
+	if len(doc.Content) == 0 {
+		return fc, nil
+	}
+
+	known := knownFlags()
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: expected a mapping of flag names to values", file, root.Line)
+	}
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value != "profiles" {
+			v, err := readValue(file, key, value, known)
+			if err != nil {
+				return nil, err
+			}
+			fc.values = append(fc.values, v)
+			continue
+		}
+
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s:%d: expected a mapping of profiles", file, value.Line)
+		}
+		for j := 0; j < len(value.Content); j += 2 {
+			name, node := value.Content[j], value.Content[j+1]
+			if node.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%s:%d: expected a mapping for profile %q", file, node.Line, name.Value)
+			}
+			p := profile{line: name.Line}
+			for k := 0; k < len(node.Content); k += 2 {
+				key, value := node.Content[k], node.Content[k+1]
+				if key.Value == "description" {
+					p.description = value.Value
+					continue
+				}
+				v, err := readValue(file, key, value, known)
+				if err != nil {
+					return nil, err
+				}
+				p.values = append(p.values, v)
+			}
+			fc.profiles[name.Value] = p
+		}
+	}
+
+	for name, p := range fc.profiles {
+		if err := checkProfile(fc, p); err != nil {
+			return nil, fmt.Errorf("%s:%d: profile %q: %w", file, p.line, name, err)
+		}
+	}
+	return fc, nil
+}
+
+// checkProfile makes sure the values of the profile over the top level
+// ones make a valid scan configuration
+func checkProfile(fc *fileConfig, p profile) error {
+	var c cliConfig
+	fs := newFlagSet("fss", legacyFlags, &c)
+	for _, v := range overrideValues(fc.values, p.values) {
+		if fs.Lookup(v.name) == nil {
+			continue
+		}
+		if err := fs.Set(v.name, v.value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", v.value, v.name, err)
+		}
+	}
+	c.cfg.LogWriter = io.Discard
+	return c.cfg.Validate()
+}
+
+// readValue returns the flag value of a key of the config file
+func readValue(file string, key, value *yaml.Node, known map[string]bool) (fileValue, error) {
+	if !known[key.Value] {
+		return fileValue{}, fmt.Errorf("%s:%d: unknown key %q", file, key.Line, key.Value)
+	}
+	if value.Kind != yaml.ScalarNode {
+		return fileValue{}, fmt.Errorf("%s:%d: expected a single value for %q", file, value.Line, key.Value)
+	}
+	return fileValue{name: key.Value, value: value.Value, line: key.Line}, nil
+}
+
+// envName returns the environment variable overriding a flag
+func envName(flag string) string {
+	return "FSS_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// resolveFlags sets the flags of fs that weren't given on the command line
+// from the FSS_* environment variables, then from the selected profile and
+// the config file. Keys for flags of other commands are ignored. It
+// returns the source of the value of each flag.
+func resolveFlags(fs *flag.FlagSet, c *cliConfig, lookupEnv func(string) (string, bool)) (map[string]string, error) {
+	sources := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) { sources[canonicalFlag(f.Name)] = "default" })
+	fs.Visit(func(f *flag.Flag) { sources[canonicalFlag(f.Name)] = "flag" })
+
+	// The environment variables of the canonical names come first, those
+	// of the aliases only fill in for them
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := flagAliases[f.Name]; ok {
+			return
+		}
+		name := envName(f.Name)
+		value, ok := lookupEnv(name)
+		for alias, canonical := range flagAliases {
+			if !ok && canonical == f.Name && fs.Lookup(alias) != nil {
+				name = envName(alias)
+				value, ok = lookupEnv(name)
+			}
+		}
+		if err != nil || !ok || sources[f.Name] != "default" {
+			return
+		}
+		if isBoolFlag(f) {
+			value = envBool(value)
+		}
+		if serr := fs.Set(f.Name, value); serr != nil {
+			err = fmt.Errorf("%s: invalid value %q for -%s: %v", name, value, f.Name, serr)
+			return
+		}
+		sources[f.Name] = "env " + name
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file := c.configFile
+	if file == "" {
+		file = defaultConfigFile()
+	}
+
+	// Only the default config file may be missing
+	fc := &fileConfig{file: file}
+	if file != "" {
+		loaded, err := loadConfigFile(file)
+		switch {
+		case err == nil:
+			fc = loaded
+		case c.configFile != "" || !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+	}
+
+	values := fc.values
+	if c.profile != "" {
+		p, ok := fc.profiles[c.profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q", c.profile)
+		}
+		values = overrideValues(fc.values, p.values)
+	}
+
+	// Profile values replace the top level ones
+	for _, v := range values {
+		name := canonicalFlag(v.name)
+		if fs.Lookup(v.name) == nil || (sources[name] != "default" && !strings.HasPrefix(sources[name], fc.file+":")) {
+			continue
+		}
+		if err := fs.Set(v.name, v.value); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid value %q for %s: %v", fc.file, v.line, v.value, v.name, err)
+		}
+		sources[name] = fmt.Sprintf("%s:%d", fc.file, v.line)
+	}
+	for alias, canonical := range flagAliases {
+		if fs.Lookup(alias) != nil {
+			sources[alias] = sources[canonical]
+		}
+	}
+	if err := resolveGzipLevel(fs, c, sources); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// overrideValues returns the top level values without those of the flags
+// set by the profile, followed by the profile values. Setting a list flag
+// twice would add to it instead of replacing it.
+func overrideValues(top, profile []fileValue) []fileValue {
+	set := map[string]bool{}
+	for _, v := range profile {
+		set[canonicalFlag(v.name)] = true
+	}
+	values := make([]fileValue, 0, len(top)+len(profile))
+	for _, v := range top {
+		if !set[canonicalFlag(v.name)] {
+			values = append(values, v)
+		}
+	}
+	return append(values, profile...)
+}
+
+// sourceRank orders the sources of resolveFlags, a flag over the
+// environment over the config file over the default
+func sourceRank(source string) int {
+	switch {
+	case source == "flag":
+		return 3
+	case strings.HasPrefix(source, "env "):
+		return 2
+	case source == "default":
+		return 0
+	}
+	return 1
+}
+
+// resolveGzipLevel checks the -gzip-level that was set and makes it the
+// archive level, unless -level comes from a higher source. Both set from
+// the same source must agree.
+func resolveGzipLevel(fs *flag.FlagSet, c *cliConfig, sources map[string]string) error {
+	if fs.Lookup("gzip-level") == nil || sources["gzip-level"] == "default" {
+		return nil
+	}
+	if c.gzipLevel < gzip.NoCompression || c.gzipLevel > gzip.BestCompression {
+		return fmt.Errorf("%s: invalid -gzip-level %d, expected %d to %d",
+			sources["gzip-level"], c.gzipLevel, gzip.NoCompression, gzip.BestCompression)
+	}
+
+	level := strconv.Itoa(c.gzipLevel)
+	switch gz, lv := sourceRank(sources["gzip-level"]), sourceRank(sources["level"]); {
+	case gz > lv:
+		c.cfg.Level = level
+		sources["level"] = sources["gzip-level"]
+	case gz == lv && c.cfg.Level != level:
+		return fmt.Errorf("%s: -level %s and -gzip-level %d disagree", sources["level"], c.cfg.Level, c.gzipLevel)
+	}
+	return nil
+}
+
+// canonicalFlag returns the canonical name of the flag called name
+func canonicalFlag(name string) string {
+	if canonical, ok := flagAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// envBool maps the yes and no spellings of booleans to the ones known by
+// the flag package
+func envBool(value string) string {
+	switch strings.ToLower(value) {
+	case "yes", "y", "on":
+		return "true"
+	case "no", "n", "off":
+		return "false"
+	}
+	return value
+}
+
+// listProfiles writes the profiles of the config file with their
+// description
+func listProfiles(out io.Writer, file string) error {
+	if file == "" {
+		file = defaultConfigFile()
+	}
+	fc, err := loadConfigFile(file)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(fc.profiles))
+	for name := range fc.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%s\n", name, fc.profiles[name].description)
+	}
+	return tw.Flush()
+}
+
+// printConfig writes the value of every flag of fs in the config file
+// format, commented with its source
+func printConfig(out io.Writer, fs *flag.FlagSet, sources map[string]string) error {
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		if !configFlags[f.Name] {
+			flags = append(flags, f)
+		}
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+
+	for _, f := range flags {
+		value := f.Value.String()
+		if value == "" || strings.ContainsAny(value, ":#'\"") {
+			value = fmt.Sprintf("%q", value)
+		}
+		if _, err := fmt.Fprintf(out, "%s: %s # %s\n", f.Name, value, sources[f.Name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
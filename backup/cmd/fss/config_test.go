@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `ext: .log
+size: 100
+sort: size
+profiles:
+  big:
+    size: 1000
+    checksum: true
+`
+
+// printedConfig runs fss with -print-config and returns the printed values
+// and their sources
+func printedConfig(t *testing.T, args ...string) (values, sources map[string]string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	if code := run(append(args, "-print-config"), &out, &errOut); code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut.String())
+	}
+
+	values, sources = map[string]string{}, map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		kv := strings.SplitN(line, ": ", 2)
+		vs := strings.SplitN(kv[1], " # ", 2)
+		values[kv[0]], sources[kv[0]] = vs[0], vs[1]
+	}
+	return values, sources
+}
+
+func writeConfig(t *testing.T, dir, data string) string {
+	t.Helper()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// TestConfigPrecedence checks default < file < profile < flag
+func TestConfigPrecedence(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	file := writeConfig(t, t.TempDir(), testConfig)
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected map[string]string
+	}{
+		{"Default", []string{"list"},
+			map[string]string{"ext": `""`, "size": "0", "sort": `""`, "checksum": "false"}},
+		{"File", []string{"list", "-config", file},
+			map[string]string{"ext": ".log", "size": "100", "sort": "size", "checksum": "false"}},
+		{"Flag", []string{"list", "-ext", ".gz", "-size", "5"},
+			map[string]string{"ext": ".gz", "size": "5", "sort": `""`}},
+		{"FlagOverFile", []string{"list", "-config", file, "-ext", ".gz"},
+			map[string]string{"ext": ".gz", "size": "100", "sort": "size"}},
+		{"Profile", []string{"list", "-config", file, "-profile", "big"},
+			map[string]string{"ext": ".log", "size": "1000", "checksum": "true"}},
+		{"FlagOverProfile", []string{"list", "-config", file, "-profile", "big", "-size", "7"},
+			map[string]string{"ext": ".log", "size": "7", "checksum": "true"}},
+		{"Legacy", []string{"-config", file, "-sort", "path"},
+			map[string]string{"ext": ".log", "size": "100", "sort": "path"}},
+		{"OtherCommandKeys", []string{"delete", "-config", file},
+			map[string]string{"ext": ".log", "size": "100"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			values, _ := printedConfig(t, tc.args...)
+			for name, exp := range tc.expected {
+				if values[name] != exp {
+					t.Errorf("expected %s %s, got %s instead\n", name, exp, values[name])
+				}
+			}
+		})
+	}
+}
+
+// TestConfigEnv checks default < file < env < flag and the printed sources
+func TestConfigEnv(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	file := writeConfig(t, t.TempDir(), testConfig)
+
+	testCases := []struct {
+		name       string
+		env        map[string]string
+		args       []string
+		expected   map[string]string
+		expSources map[string]string
+	}{
+		{"EnvOverDefault", map[string]string{"FSS_EXT": ".gz", "FSS_NO_STAT": "yes"}, []string{"list"},
+			map[string]string{"ext": ".gz", "no-stat": "true", "size": "0"},
+			map[string]string{"ext": "env FSS_EXT", "no-stat": "env FSS_NO_STAT", "size": "default"}},
+		{"EnvOverFile", map[string]string{"FSS_SIZE": "42"}, []string{"list", "-config", file},
+			map[string]string{"ext": ".log", "size": "42"},
+			map[string]string{"ext": file + ":1", "size": "env FSS_SIZE"}},
+		{"EnvOverProfile", map[string]string{"FSS_CHECKSUM": "0"}, []string{"list", "-config", file, "-profile", "big"},
+			map[string]string{"size": "1000", "checksum": "false"},
+			map[string]string{"size": file + ":6", "checksum": "env FSS_CHECKSUM"}},
+		{"FlagOverEnv", map[string]string{"FSS_EXT": ".gz"}, []string{"list", "-config", file, "-ext", ".sh"},
+			map[string]string{"ext": ".sh", "size": "100"},
+			map[string]string{"ext": "flag"}},
+		{"EnvConfigFile", map[string]string{"FSS_CONFIG": file, "FSS_PROFILE": "big"}, []string{"list"},
+			map[string]string{"ext": ".log", "size": "1000"},
+			map[string]string{"size": file + ":6"}},
+		{"EnvOtherCommand", map[string]string{"FSS_ARC": "/tmp"}, []string{"list"},
+			map[string]string{"ext": `""`}, nil},
+		{"FlagOverAliasEnv", map[string]string{"FSS_FSNOTIFY": "false"}, []string{"list", "-watch"},
+			map[string]string{"watch": "true", "fsnotify": "true"},
+			map[string]string{"watch": "flag", "fsnotify": "flag"}},
+		{"AliasFlagOverEnv", map[string]string{"FSS_WATCH": "false"}, []string{"list", "-fsnotify"},
+			map[string]string{"watch": "true"},
+			map[string]string{"watch": "flag"}},
+		{"AliasEnv", map[string]string{"FSS_FSNOTIFY": "yes"}, []string{"list"},
+			map[string]string{"watch": "true"},
+			map[string]string{"watch": "env FSS_FSNOTIFY", "fsnotify": "env FSS_FSNOTIFY"}},
+		{"EnvOverAliasEnv", map[string]string{"FSS_WATCH": "no", "FSS_FSNOTIFY": "yes"}, []string{"list"},
+			map[string]string{"watch": "false"},
+			map[string]string{"watch": "env FSS_WATCH"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			values, sources := printedConfig(t, tc.args...)
+			for name, exp := range tc.expected {
+				if values[name] != exp {
+					t.Errorf("expected %s %s, got %s instead\n", name, exp, values[name])
+				}
+			}
+			for name, exp := range tc.expSources {
+				if sources[name] != exp {
+					t.Errorf("expected %s from %q, got %q instead\n", name, exp, sources[name])
+				}
+			}
+		})
+	}
+
+	t.Run("FlagOverAliasFile", func(t *testing.T) {
+		aliasFile := writeConfig(t, t.TempDir(), "fsnotify: false\n")
+		values, sources := printedConfig(t, "list", "-config", aliasFile, "-watch")
+		if values["watch"] != "true" || sources["watch"] != "flag" {
+			t.Errorf("expected watch true from the flag, got %s from %q instead\n", values["watch"], sources["watch"])
+		}
+	})
+
+	t.Run("InvalidValue", func(t *testing.T) {
+		t.Setenv("FSS_SIZE", "big")
+		var out, errOut bytes.Buffer
+		if code := run([]string{"list"}, &out, &errOut); code == 0 {
+			t.Fatal("expected non zero exit code")
+		}
+		expected := `FSS_SIZE: invalid value "big" for -size`
+		if !strings.Contains(errOut.String(), expected) {
+			t.Errorf("expected %q, got %q instead\n", expected, errOut.String())
+		}
+	})
+}
+
+// TestConfigGzipLevel checks -gzip-level sets the archive level unless
+// -level comes from a higher source, and both from the same source agree
+func TestConfigGzipLevel(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name      string
+		data      string
+		env       map[string]string
+		args      []string
+		expLevel  string
+		expSource string
+		expErr    string
+	}{
+		{name: "Default", args: []string{"archive"}, expLevel: `""`, expSource: "default"},
+		{name: "GzipFlag", args: []string{"archive", "-gzip-level", "1"}, expLevel: "1", expSource: "flag"},
+		{name: "LevelFlagOverGzipFile", data: "gzip-level: 1\n", args: []string{"archive", "-level", "9"},
+			expLevel: "9", expSource: "flag"},
+		{name: "GzipFlagOverLevelFile", data: "level: 9\n", args: []string{"archive", "-gzip-level", "1"},
+			expLevel: "1", expSource: "flag"},
+		{name: "GzipEnvOverLevelFile", data: "level: 9\n", env: map[string]string{"FSS_GZIP_LEVEL": "1"},
+			args: []string{"archive"}, expLevel: "1", expSource: "env FSS_GZIP_LEVEL"},
+		{name: "LevelEnvOverGzipFile", data: "gzip-level: 1\n", env: map[string]string{"FSS_LEVEL": "auto"},
+			args: []string{"archive"}, expLevel: "auto", expSource: "env FSS_LEVEL"},
+		{name: "SameFlags", args: []string{"archive", "-level", "1", "-gzip-level", "1"}, expLevel: "1", expSource: "flag"},
+		{name: "Disagree", args: []string{"archive", "-level", "9", "-gzip-level", "1"},
+			expErr: "-level 9 and -gzip-level 1 disagree"},
+		{name: "DisagreeInFile", data: "level: 9\ngzip-level: 1\n", args: []string{"archive"},
+			expErr: "-level 9 and -gzip-level 1 disagree"},
+		{name: "OutOfRange", args: []string{"archive", "-gzip-level", "10"},
+			expErr: "invalid -gzip-level 10, expected 0 to 9"},
+		{name: "Huffman", args: []string{"archive", "-gzip-level", "-2"},
+			expErr: "invalid -gzip-level -2, expected 0 to 9"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			args := append(tc.args, "-config", writeConfig(t, dir, tc.data))
+			if tc.expErr != "" {
+				var out, errOut bytes.Buffer
+				if code := run(append(args, "-print-config"), &out, &errOut); code == 0 {
+					t.Fatal("expected non zero exit code")
+				}
+				if !strings.Contains(errOut.String(), tc.expErr) {
+					t.Errorf("expected %q, got %q instead\n", tc.expErr, errOut.String())
+				}
+				return
+			}
+			values, sources := printedConfig(t, args...)
+			if values["level"] != tc.expLevel || sources["level"] != tc.expSource {
+				t.Errorf("expected level %s from %q, got %s from %q instead\n",
+					tc.expLevel, tc.expSource, values["level"], sources["level"])
+			}
+		})
+	}
+}
+
+func TestConfigDefaultFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	writeConfig(t, filepath.Join(dir, "fss"), "ext: .sh\n")
+
+	if values, _ := printedConfig(t, "list"); values["ext"] != ".sh" {
+		t.Errorf("expected ext .sh, got %s instead\n", values["ext"])
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name     string
+		data     string
+		args     []string
+		expected string
+	}{
+		{"UnknownKey", "ext: .log\nextension: .gz\n", nil,
+			`config.yaml:2: unknown key "extension"`},
+		{"UnknownProfileKey", "profiles:\n  big:\n    sizes: 10\n", nil,
+			`config.yaml:3: unknown key "sizes"`},
+		{"InvalidValue", "size: big\n", nil,
+			`config.yaml:1: invalid value "big" for size`},
+		{"NotAValue", "ext:\n  - .log\n", nil,
+			`config.yaml:2: expected a single value for "ext"`},
+		{"UnknownProfile", "ext: .log\n", []string{"-profile", "nightly"},
+			`unknown profile "nightly"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := writeConfig(t, dir, tc.data)
+			var out, errOut bytes.Buffer
+			args := append([]string{"list", "-config", file, "-print-config"}, tc.args...)
+			if code := run(args, &out, &errOut); code == 0 {
+				t.Fatal("expected non zero exit code")
+			}
+			if !strings.Contains(errOut.String(), tc.expected) {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, errOut.String())
+			}
+		})
+	}
+
+	t.Run("MissingFile", func(t *testing.T) {
+		var out, errOut bytes.Buffer
+		if code := run([]string{"list", "-config", filepath.Join(dir, "missing.yaml")}, &out, &errOut); code == 0 {
+			t.Error("expected non zero exit code")
+		}
+	})
+}
+
+// TestProfileListFlags checks a repeatable flag of the profile replaces
+// the top level one instead of adding to it
+func TestProfileListFlags(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	file := writeConfig(t, t.TempDir(), `exclude: "*.tmp"
+exclude-mount: /proc
+profiles:
+  logs:
+    exclude: "*.gz"
+  mounts:
+    exclude-mount: /sys
+`)
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected map[string]string
+	}{
+		{"TopLevel", []string{"list", "-config", file},
+			map[string]string{"exclude": "*.tmp", "exclude-mount": "/proc"}},
+		{"ProfileExclude", []string{"list", "-config", file, "-profile", "logs"},
+			map[string]string{"exclude": "*.gz", "exclude-mount": "/proc"}},
+		{"ProfileExcludeMount", []string{"list", "-config", file, "-profile", "mounts"},
+			map[string]string{"exclude": "*.tmp", "exclude-mount": "/sys"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			values, _ := printedConfig(t, tc.args...)
+			for name, exp := range tc.expected {
+				if values[name] != exp {
+					t.Errorf("expected %s %s, got %s instead\n", name, exp, values[name])
+				}
+			}
+		})
+	}
+}
+
+// TestProfiles lists and runs the profiles of a config file
+func TestProfiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	root := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log": "dummy",
+		"b.log": "dummy",
+		"c.tmp": "dummy",
+	}))
+	file := writeConfig(t, t.TempDir(), `profiles:
+  tmp-purge:
+    description: Remove temporary files
+    dir: `+root+`
+    ext: .tmp
+    list: true
+  nightly-logs:
+    description: List the logs
+    dir: `+root+`
+    ext: .log
+`)
+
+	t.Run("List", func(t *testing.T) {
+		var out, errOut bytes.Buffer
+		if code := run([]string{"profiles", "-config", file}, &out, &errOut); code != 0 {
+			t.Fatalf("exit code %d: %s", code, errOut.String())
+		}
+		expected := "nightly-logs  List the logs\ntmp-purge     Remove temporary files\n"
+		if expected != out.String() {
+			t.Errorf("expected %q, got %q instead\n", expected, out.String())
+		}
+	})
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"Run", []string{"run", "-config", file, "nightly-logs"},
+			filepath.Join(root, "a.log") + "\n" + filepath.Join(root, "b.log") + "\n"},
+		{"RunOverride", []string{"run", "-config", file, "-ext", ".tmp", "nightly-logs"},
+			filepath.Join(root, "c.tmp") + "\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			if code := run(tc.args, &out, &errOut); code != 0 {
+				t.Fatalf("exit code %d: %s", code, errOut.String())
+			}
+			if tc.expected != out.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, out.String())
+			}
+		})
+	}
+
+	t.Run("NoProfile", func(t *testing.T) {
+		var out, errOut bytes.Buffer
+		if code := run([]string{"run", "-config", file}, &out, &errOut); code == 0 {
+			t.Error("expected non zero exit code")
+		}
+	})
+}
+
+// TestProfileInconsistent checks the actions of profiles are checked
+// when the config file is loaded
+func TestProfileInconsistent(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	file := writeConfig(t, t.TempDir(), `ext: .log
+profiles:
+  ok:
+    list: true
+  cleanup:
+    list: true
+    del: true
+`)
+
+	var out, errOut bytes.Buffer
+	if code := run([]string{"run", "-config", file, "ok"}, &out, &errOut); code == 0 {
+		t.Fatal("expected non zero exit code")
+	}
+	expected := `config.yaml:5: profile "cleanup": invalid List: can't be combined with delete or archive`
+	if !strings.Contains(errOut.String(), expected) {
+		t.Errorf("expected %q, got %q instead\n", expected, errOut.String())
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"clitools/fss"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// smtpPasswordEnv holds the password of -mail-from on the relay, it has
+// no flag so it never shows in the process list or the config file
+const smtpPasswordEnv = "FSS_SMTP_PASSWORD"
+
+// addMailFlags registers the flags mailing the report of each run
+func addMailFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.Var(&c.mailTo, "mail-to", "Mail the report of the run to this address, can be repeated")
+	fs.StringVar(&c.mailFrom, "mail-from", "", "Sender of the -mail-to report, also the SMTP user with "+smtpPasswordEnv)
+	fs.StringVar(&c.smtpHost, "smtp-host", "localhost:25", "SMTP relay of the -mail-to report, as host:port")
+	fs.StringVar(&c.mailOn, "mail-on", "failure", "Mail the report on failure or always")
+	fs.Int64Var(&c.mailAttachLimit, "mail-attach-limit", 1<<20, "Attach the listed files to the report up to this many bytes, 0 never")
+}
+
+// checkMail rejects incomplete mail settings before the scan starts
+func checkMail(c *cliConfig) error {
+	if len(c.mailTo) == 0 {
+		return nil
+	}
+	if c.mailFrom == "" {
+		return errors.New("-mail-to needs a -mail-from address")
+	}
+	if c.mailOn != "failure" && c.mailOn != "always" {
+		return fmt.Errorf("-mail-on must be failure or always, not %q", c.mailOn)
+	}
+	if c.watch {
+		return errors.New("-mail-to can't be used in watch mode")
+	}
+	return nil
+}
+
+// runReport sums up a run for the mail, it is also the JSON attachment
+type runReport struct {
+	Host     string         `json:"host"`
+	Version  string         `json:"version"`
+	Commit   string         `json:"commit"`
+	Roots    []string       `json:"roots"`
+	Started  time.Time      `json:"started"`
+	Duration string         `json:"duration"`
+	Actions  map[string]int `json:"actions"`
+	Error    string         `json:"error,omitempty"`
+
+	// Listed names, dropped past limit bytes
+	limit   int64
+	listed  bytes.Buffer
+	dropped bool
+}
+
+func newRunReport(roots []string, limit int64) *runReport {
+	host, _ := os.Hostname()
+	build := readBuildInfo()
+	return &runReport{Host: host, Version: build.Version, Commit: build.Commit, Roots: roots,
+		Started: time.Now(), Actions: map[string]int{}, limit: limit}
+}
+
+// record returns an OnAction hook counting the actions and keeping the
+// listed names before calling next
+func (r *runReport) record(next func(action, path, dest string, err error)) func(action, path, dest string, err error) {
+	return func(action, path, dest string, err error) {
+		if err == nil {
+			r.Actions[action]++
+			if action == "list" && !r.dropped {
+				if int64(r.listed.Len()+len(dest)+1) > r.limit {
+					r.dropped = true
+					r.listed = bytes.Buffer{}
+				} else {
+					r.listed.WriteString(dest + "\n")
+				}
+			}
+		}
+		if next != nil {
+			next(action, path, dest, err)
+		}
+	}
+}
+
+func (r *runReport) finish(err error) {
+	r.Duration = time.Since(r.Started).Round(time.Millisecond).String()
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// text is the plain text body of the mail
+func (r *runReport) text() string {
+	var b strings.Builder
+	status := "succeeded"
+	if r.Error != "" {
+		status = "failed"
+	}
+	fmt.Fprintf(&b, "fss run on %s %s\n\n", r.Host, status)
+	fmt.Fprintf(&b, "Version: %s (commit %s)\n", r.Version, r.Commit)
+	fmt.Fprintf(&b, "Roots: %s\nStarted: %s\nDuration: %s\n", strings.Join(r.Roots, " "),
+		r.Started.Format(time.RFC3339), r.Duration)
+
+	actions := make([]string, 0, len(r.Actions))
+	for action := range r.Actions {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		fmt.Fprintf(&b, "Files %s: %d\n", action, r.Actions[action])
+	}
+	if r.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", r.Error)
+	}
+	if r.dropped && r.limit > 0 {
+		fmt.Fprintf(&b, "\nThe listed files are over the %d bytes attach limit, they are not attached.\n", r.limit)
+	}
+	return b.String()
+}
+
+// mailMessage builds the report mail with its plain text body, the JSON
+// summary and, when kept, the listed files attached
+func mailMessage(from string, to []string, r *runReport) ([]byte, error) {
+	summary, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	subject := "fss: run on " + r.Host + " succeeded"
+	if r.Error != "" {
+		subject = "fss: run on " + r.Host + " failed"
+	}
+	fmt.Fprintf(&buf, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n"+
+		"Content-Type: multipart/mixed; boundary=%s\r\n\r\n",
+		from, strings.Join(to, ", "), subject, time.Now().Format(time.RFC1123Z), mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := io.WriteString(qp, r.text()); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := attach(mw, "summary.json", "application/json", summary); err != nil {
+		return nil, err
+	}
+	if !r.dropped && r.listed.Len() > 0 {
+		if err := attach(mw, "listed.txt", "text/plain; charset=utf-8", r.listed.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// attach adds data as a base64 encoded attachment called name
+func attach(mw *multipart.Writer, name, contentType string, data []byte) error {
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", name)},
+	})
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(part, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(part, encoded+"\r\n")
+	return err
+}
+
+// sendReport mails r through the -smtp-host relay. The connection is
+// upgraded with STARTTLS when the relay offers it, and authenticated as
+// -mail-from when FSS_SMTP_PASSWORD is set.
+func sendReport(c *cliConfig, r *runReport) error {
+	msg, err := mailMessage(c.mailFrom, c.mailTo, r)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if password := os.Getenv(smtpPasswordEnv); password != "" {
+		host, _, err := net.SplitHostPort(c.smtpHost)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", c.mailFrom, password, host)
+	}
+	return smtp.SendMail(c.smtpHost, auth, c.mailFrom, c.mailTo, msg)
+}
+
+// runRoots scans roots, and mails the report of the run as set by
+// -mail-on when -mail-to is set. A failed mail is written to the error
+// output, the result of the run is left as it is.
+func runRoots(c *cliConfig, roots []string, cfg fss.Config, out io.Writer) error {
+	if len(c.mailTo) == 0 {
+		return fss.RunRoots(roots, cfg, c.failFast, out)
+	}
+
+	r := newRunReport(roots, c.mailAttachLimit)
+	cfg.OnAction = r.record(cfg.OnAction)
+	err := fss.RunRoots(roots, cfg, c.failFast, out)
+	r.finish(err)
+	if err != nil || c.mailOn == "always" {
+		if merr := sendReport(c, r); merr != nil {
+			fmt.Fprintf(c.errOut, "mail to %s: %v\n", strings.Join(c.mailTo, ", "), merr)
+		}
+	}
+	return err
+}
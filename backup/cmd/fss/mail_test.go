@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"clitools/fss/testsupport"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts SMTP sessions on a local port and sends the data of
+// each mail to the returned channel
+func fakeSMTP(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	mails := make(chan []byte, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, mails)
+		}
+	}()
+	return ln.Addr().String(), mails
+}
+
+func serveSMTP(conn net.Conn, mails chan<- []byte) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+		case "EHLO", "HELO":
+			reply("250 fake")
+		case "DATA":
+			reply("354 go ahead")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			mails <- data.Bytes()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// mailParts returns the subject of msg and its parts by file name, the
+// body under ""
+func mailParts(t *testing.T, msg []byte) (string, map[string]string) {
+	t.Helper()
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := map[string]string{}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = p
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			r = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[p.FileName()] = string(data)
+	}
+	return m.Header.Get("Subject"), parts
+}
+
+func TestRunMail(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log":     "dummy",
+		"b.log":     "dummy",
+		"notes.txt": "dummy",
+	}))
+	addr, mails := fakeSMTP(t)
+	mailArgs := []string{"-mail-to", "ops@example.com", "-mail-from", "fss@example.com", "-smtp-host", addr}
+
+	testCases := []struct {
+		name       string
+		args       []string
+		expCode    int
+		expMail    bool
+		expSubject string
+		expListed  string
+	}{
+		{"Always", []string{"list", "-mail-on", "always", "-ext", ".log", tempDir}, 0, true, "succeeded",
+			filepath.Join(tempDir, "a.log") + "\n" + filepath.Join(tempDir, "b.log") + "\n"},
+		{"OverLimit", []string{"list", "-mail-on", "always", "-mail-attach-limit", "10", tempDir}, 0, true, "succeeded", ""},
+		{"NoMailOnSuccess", []string{"list", tempDir}, 0, false, "", ""},
+		{"Failure", []string{"list", filepath.Join(tempDir, "missing")}, 1, true, "failed", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			args := append(append([]string{tc.args[0]}, mailArgs...), tc.args[1:]...)
+			if code := run(args, &out, &errOut); code != tc.expCode {
+				t.Fatalf("expected exit code %d, got %d instead: %s\n", tc.expCode, code, errOut.String())
+			}
+
+			var msg []byte
+			select {
+			case msg = <-mails:
+			default:
+			}
+			if !tc.expMail {
+				if msg != nil {
+					t.Errorf("expected no mail, got %q instead\n", msg)
+				}
+				return
+			}
+			if msg == nil {
+				t.Fatalf("expected a mail, got none: %s\n", errOut.String())
+			}
+
+			subject, parts := mailParts(t, msg)
+			if !strings.HasSuffix(subject, tc.expSubject) {
+				t.Errorf("expected a subject ending in %q, got %q instead\n", tc.expSubject, subject)
+			}
+			if !strings.Contains(parts[""], "Roots: ") {
+				t.Errorf("expected a plain text summary, got %q instead\n", parts[""])
+			}
+			build := readBuildInfo()
+			if exp := "Version: " + build.Version + " (commit " + build.Commit + ")"; !strings.Contains(parts[""], exp) {
+				t.Errorf("expected %q in the summary, got %q instead\n", exp, parts[""])
+			}
+			var summary runReport
+			if err := json.Unmarshal([]byte(parts["summary.json"]), &summary); err != nil {
+				t.Fatal(err)
+			}
+			if len(summary.Roots) != 1 || (summary.Error != "") != (tc.expCode != 0) ||
+				summary.Version != build.Version || summary.Commit != build.Commit {
+				t.Errorf("unexpected summary %+v\n", summary)
+			}
+			if tc.expListed != parts["listed.txt"] {
+				t.Errorf("expected %q, got %q instead\n", tc.expListed, parts["listed.txt"])
+			}
+		})
+	}
+}
+
+// TestRunMailFailure checks a mail that can't be sent is reported without
+// changing the exit code
+func TestRunMailFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{"a.log": "dummy"}))
+	var out, errOut bytes.Buffer
+	args := []string{"list", "-mail-to", "ops@example.com", "-mail-from", "fss@example.com",
+		"-smtp-host", addr, "-mail-on", "always", tempDir}
+	if code := run(args, &out, &errOut); code != 0 {
+		t.Fatalf("expected exit code 0, got %d instead: %s\n", code, errOut.String())
+	}
+	if !strings.Contains(errOut.String(), "mail to ops@example.com") {
+		t.Errorf("expected the mail failure, got %q instead\n", errOut.String())
+	}
+	if exp := filepath.Join(tempDir, "a.log") + "\n"; out.String() != exp {
+		t.Errorf("expected %q, got %q instead\n", exp, out.String())
+	}
+}
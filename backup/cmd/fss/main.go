@@ -0,0 +1,246 @@
+package main
+
+import (
+	"clitools/fss"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// program entry
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run parses the command line and runs the subcommand, or the bare fss
+// command when args don't start with one. It returns the exit code.
+func run(args []string, out, errOut io.Writer) int {
+	var (
+		c   = cliConfig{errOut: errOut}
+		fs  *flag.FlagSet
+		cmd command
+	)
+
+	if len(args) > 0 && args[0] == "help" {
+		args = append(args[1:], "-h")
+	}
+
+	if len(args) > 0 {
+		cmd, _ = findCommand(args[0])
+	}
+	if cmd.name != "" {
+		fs = newFlagSet(cmd.name, cmd.flags, &c)
+		fs.Usage = commandUsage(cmd, fs)
+		args = args[1:]
+	} else {
+		// Bare fss is an alias of list with all the flags
+		cmd.multiRoot = true
+		fs = newFlagSet("fss", legacyFlags, &c)
+		fs.Usage = usage(fs)
+		cmd.run = func(c *cliConfig, out io.Writer) error {
+			if c.version {
+				return printVersion(out, false)
+			}
+			if c.tui {
+				return runTUI(c, out)
+			}
+			return scan(c, out)
+		}
+	}
+	fs.SetOutput(errOut)
+
+	// Parsing commend line flags
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 1 && !cmd.multiRoot {
+		fmt.Fprintf(errOut, "too many arguments: %v\n", fs.Args())
+		return 2
+	}
+	if fs.NArg() > 0 {
+		c.arg, c.args = fs.Arg(0), fs.Args()
+	}
+	if cmd.profileArg {
+		if c.arg == "" {
+			fmt.Fprintf(errOut, "%s needs a %s argument\n", cmd.name, cmd.args)
+			return 2
+		}
+		c.profile, c.arg, c.args = c.arg, "", nil
+	}
+
+	// Commands that scan take the flags they weren't given from the
+	// environment and the config file
+	if fs.Lookup("config") != nil {
+		sources, err := resolveFlags(fs, &c, os.LookupEnv)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 2
+		}
+		if c.printConfig {
+			if err := printConfig(out, fs, sources); err != nil {
+				fmt.Fprintln(errOut, err)
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if err := cmd.run(&c, out); err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	return 0
+}
+
+// filterConfig returns the scan configuration of c with its filter chain
+// applied
+func filterConfig(c *cliConfig) (fss.Config, error) {
+	cfg := c.cfg
+	if c.filterChain == "" {
+		return cfg, nil
+	}
+	if c.presets == "" {
+		return cfg, errors.New("-filter-chain needs a -presets file")
+	}
+	p, err := loadPresets(c.presets)
+	if err != nil {
+		return cfg, err
+	}
+	return applyFilterChain(cfg, p, c.filterChain)
+}
+
+// stopOnSignal returns a channel closed on SIGINT or SIGTERM, and a
+// function to stop listening for them
+func stopOnSignal() (<-chan struct{}, func()) {
+	done := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-sig; ok {
+			close(done)
+		}
+	}()
+	return done, func() {
+		signal.Stop(sig)
+		close(sig)
+	}
+}
+
+// scan runs the Scanner configured by c over each root, repeatedly with
+// -every, or watches the root with -watch
+func scan(c *cliConfig, out io.Writer) error {
+	cfg, err := filterConfig(c)
+	if err != nil {
+		return err
+	}
+
+	// The listing is written by the OnAction hook, so the output is
+	// encoded here rather than by the Scanner
+	enc, err := fss.NewEncodedWriter(out, cfg.OutputEncoding)
+	if err != nil {
+		return err
+	}
+	defer enc.Close()
+	cfg.OutputEncoding = ""
+	out = enc
+
+	cfg.LogWriter = out
+	if c.log != "" {
+		f, err := os.OpenFile(c.log, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cfg.LogWriter = f
+		build := readBuildInfo()
+		cfg.Build = "fss " + build.Version + " (commit " + build.Commit + ")"
+	}
+	var listErr func() error
+	cfg.OnAction, listErr = printActions(out, cfg.LogWriter, cfg.ArcName != "")
+
+	roots := fss.CleanRoots(c.roots(), c.errOut)
+	if c.watch && c.every > 0 {
+		return errors.New("-every can't be used in watch mode")
+	}
+	if c.watch && len(roots) > 1 {
+		return errors.New("watch mode takes a single root")
+	}
+	if err := checkMail(c); err != nil {
+		return err
+	}
+	if !c.watch && c.every <= 0 {
+		if err := runRoots(c, roots, cfg, out); err != nil {
+			return err
+		}
+		if err := listErr(); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	// Long running modes stop on SIGINT and SIGTERM
+	done, stop := stopOnSignal()
+	defer stop()
+
+	if c.watch {
+		if err := fss.NewScanner(roots[0], cfg).Watch(out, done); err != nil {
+			return err
+		}
+		return listErr()
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	schedule(c.every, float64(c.jitter), rnd, out, done, func(run int) {
+		fmt.Fprintf(out, "Run %d started at %s\n", run, time.Now().Format(time.RFC3339))
+		if err := runRoots(c, roots, cfg, out); err != nil {
+			fmt.Fprintf(c.errOut, "run %d: %v\n", run, err)
+		}
+	})
+	return listErr()
+}
+
+// printActions returns the OnAction hook listing the matched files to out
+// and logging the deleted ones to logW, and a function returning the first
+// error writing the listing. The hook runs on the goroutine of the scan.
+func printActions(out, logW io.Writer, logArchives bool) (func(action, path, dest string, err error), func() error) {
+	var werr error
+	delLogger := log.New(logW, "DELETED FILE: ", log.LstdFlags)
+	trashLogger := log.New(logW, "TRASHED FILE: ", log.LstdFlags)
+	arcLogger := log.New(logW, "ARCHIVED FILE: ", log.LstdFlags)
+	pendLogger := log.New(logW, "PENDING DELETE: ", log.LstdFlags)
+	renLogger := log.New(logW, "RENAMED FILE: ", log.LstdFlags)
+	hook := func(action, path, dest string, err error) {
+		if err != nil {
+			return
+		}
+		switch action {
+		case "list":
+			if _, err := fmt.Fprintln(out, dest); err != nil && werr == nil {
+				werr = err
+			}
+		case "delete":
+			delLogger.Println(path)
+		case "trash":
+			trashLogger.Println(path)
+		case "copy":
+			pendLogger.Printf("%s -> %s (copied across filesystems)", path, dest)
+		case "rename":
+			renLogger.Printf("%s -> %s", path, dest)
+		case "archive":
+			if logArchives {
+				arcLogger.Printf("%s -> %s", path, dest)
+			}
+		}
+	}
+	return hook, func() error { return werr }
+}
@@ -0,0 +1,472 @@
+package main_test
+
+import (
+	"clitools/fss/testsupport"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var binName = "fss"
+
+// TestMain builds the tool into a temporary directory so the checked in
+// binary is left alone
+func TestMain(m *testing.M) {
+	tempDir, err := os.MkdirTemp("", "fssbuild")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	binName = filepath.Join(tempDir, binName)
+
+	build := exec.Command("go", "build", "-o", binName)
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot build tool %s: %s", binName, err)
+		os.Exit(1)
+	}
+	result := m.Run()
+	os.RemoveAll(tempDir)
+	os.Exit(result)
+}
+
+// TestCLI
+func TestCLI(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "ListAll",
+			args:     []string{"-dir", "../../fss/testdata", "-list"},
+			expected: "../../fss/testdata/dir.log\n../../fss/testdata/dir2/script.sh\n../../fss/testdata/log.gz\n",
+		},
+		{
+			name:     "FilterExtension",
+			args:     []string{"-dir", "../../fss/testdata", "-ext", ".log"},
+			expected: "../../fss/testdata/dir.log\n",
+		},
+		{
+			name:     "LegacyRootFlag",
+			args:     []string{"-root", "../../fss/testdata", "-ext", ".log", "-size", "10", "-list"},
+			expected: "../../fss/testdata/dir.log\n",
+		},
+		{
+			name:     "LegacySizeNoMatch",
+			args:     []string{"-root", "../../fss/testdata", "-ext", ".log", "-size", "20"},
+			expected: "",
+		},
+		{
+			name:     "Totals",
+			args:     []string{"-dir", "../../fss/testdata", "-ext", ".sh", "-report-totals"},
+			expected: "../../fss/testdata/dir2/script.sh\nTotal files scanned: 3\nTotal directories scanned: 2\n",
+		},
+		{
+			name:     "BareRoot",
+			args:     []string{"-ext", ".gz", "../../fss/testdata"},
+			expected: "../../fss/testdata/log.gz\n",
+		},
+		{
+			name:     "ListCommand",
+			args:     []string{"list", "-ext", ".log", "../../fss/testdata"},
+			expected: "../../fss/testdata/dir.log\n",
+		},
+		{
+			name:     "StripPrefix",
+			args:     []string{"list", "-strip-prefix", "../../fss/testdata/dir2", "../../fss/testdata"},
+			expected: "../../fss/testdata/dir.log\nscript.sh\n../../fss/testdata/log.gz\n",
+		},
+		{
+			name:     "StrictStrip",
+			args:     []string{"list", "-strip-prefix", "../../fss/testdata/dir2", "-strict-strip", "../../fss/testdata"},
+			expected: "script.sh\n",
+		},
+		{
+			name:     "ReplacePrefix",
+			args:     []string{"list", "-replace-prefix", "../../fss/testdata/dir2:/srv/scripts", "../../fss/testdata"},
+			expected: "../../fss/testdata/dir.log\n/srv/scripts/script.sh\n../../fss/testdata/log.gz\n",
+		},
+		{
+			name:     "ReportCommand",
+			args:     []string{"report", "-dir", "../../fss/testdata", "-ext", ".log"},
+			expected: "../../fss/testdata/dir.log\nTotal files scanned: 3\nTotal directories scanned: 2\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := exec.Command(binName, tc.args...).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			if tc.expected != string(out) {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, string(out))
+			}
+		})
+	}
+
+	t.Run("InvalidSort", func(t *testing.T) {
+		out, err := exec.Command(binName, "-dir", "../../fss/testdata", "-sort", "name").CombinedOutput()
+		if err == nil {
+			t.Fatal("expected exit error")
+		}
+		expected := "invalid sort key \"name\": use path, size or mtime\n"
+		if expected != string(out) {
+			t.Errorf("expected %q, got %q instead\n", expected, string(out))
+		}
+	})
+
+	t.Run("CommandFlags", func(t *testing.T) {
+		out, err := exec.Command(binName, "list", "-del", "../../fss/testdata").CombinedOutput()
+		if err == nil {
+			t.Fatal("expected exit error")
+		}
+		if !strings.Contains(string(out), "flag provided but not defined: -del") {
+			t.Errorf("expected undefined flag error, got %q instead\n", string(out))
+		}
+	})
+
+	t.Run("MultipleRoots", func(t *testing.T) {
+		out, err := exec.Command(binName, "list", "-root", "../../fss/testdata/dir2",
+			"../../fss/testdata", "../../fss/testdata/").CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		expected := "warning: skipping root ../../fss/testdata/dir2 inside ../../fss/testdata\n" +
+			"warning: skipping duplicate root ../../fss/testdata/\n" +
+			"../../fss/testdata/dir.log\n../../fss/testdata/dir2/script.sh\n../../fss/testdata/log.gz\n"
+		if expected != string(out) {
+			t.Errorf("expected %q, got %q instead\n", expected, string(out))
+		}
+	})
+
+	t.Run("InvalidReplacePrefix", func(t *testing.T) {
+		out, err := exec.Command(binName, "list", "-replace-prefix", ":/srv", "../../fss/testdata").CombinedOutput()
+		if err == nil {
+			t.Fatal("expected exit error")
+		}
+		if !strings.Contains(string(out), "expected old:new") {
+			t.Errorf("expected prefix error, got %q instead\n", string(out))
+		}
+	})
+
+	t.Run("Help", func(t *testing.T) {
+		out, err := exec.Command(binName, "help").CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		for _, name := range []string{"list", "delete", "archive", "report", "restore"} {
+			if !strings.Contains(string(out), "  "+name+" ") {
+				t.Errorf("expected command %q in help, got %q\n", name, string(out))
+			}
+		}
+		// The descriptions line up after the longest command name
+		column := -1
+		cmds := strings.SplitN(string(out), "Commands:\n", 2)[1]
+		for _, line := range strings.Split(strings.SplitN(cmds, "\n\n", 2)[0], "\n") {
+			col := strings.Index(line, strings.Fields(line)[1])
+			if column == -1 {
+				column = col
+			}
+			if col != column {
+				t.Errorf("expected the description at column %d, got %q instead\n", column, line)
+			}
+		}
+
+		out, err = exec.Command(binName, "help", "archive").CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		if !strings.HasPrefix(string(out), "Usage: fss archive [flags] [root...]") ||
+			!strings.Contains(string(out), "-arc") || strings.Contains(string(out), "-sort") {
+			t.Errorf("unexpected archive help %q\n", string(out))
+		}
+	})
+}
+
+// TestCLILegacyDelete runs the delete of the fssv1.x copies with the
+// same flags
+func TestCLILegacyDelete(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 5, ".gz": 5}, "dummy"))
+	logFile := filepath.Join(t.TempDir(), "deleted.log")
+
+	out, err := exec.Command(binName, "-root", tempDir, "-ext", ".log", "-del", "-log", logFile).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if len(out) != 0 {
+		t.Errorf("expected no output, got %q instead\n", string(out))
+	}
+
+	left, err := filepath.Glob(filepath.Join(tempDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 5 {
+		t.Errorf("expected 5 files left, got %d instead\n", len(left))
+	}
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "DELETED FILE: "); n != 5 {
+		t.Errorf("expected 5 deletes logged, got %q instead\n", string(data))
+	}
+	exp := tempDir + ": 10 files, 1 directories, 5 deleted, 0 deletes failed, fss "
+	if !strings.Contains(string(data), "RUN SUMMARY: ") || !strings.Contains(string(data), exp) {
+		t.Errorf("expected the run summary %q, got %q instead\n", exp, string(data))
+	}
+}
+
+// TestCLIListWriteError checks a listing that can't be written fails the
+// run
+func TestCLIListWriteError(t *testing.T) {
+	full, err := os.OpenFile("/dev/full", os.O_WRONLY, 0)
+	if err != nil {
+		t.Skip("no /dev/full:", err)
+	}
+	defer full.Close()
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{"a.log": "dummy"}))
+
+	var errOut strings.Builder
+	cmd := exec.Command(binName, "list", tempDir)
+	cmd.Stdout, cmd.Stderr = full, &errOut
+	if err := cmd.Run(); err == nil {
+		t.Error("expected the run to fail, got nil instead")
+	}
+	if !strings.Contains(errOut.String(), "no space left on device") {
+		t.Errorf("expected the write error, got %q instead\n", errOut.String())
+	}
+}
+
+// TestCLIPlanApply plans a delete, changes one of the files and applies
+// the plan
+func TestCLIPlanApply(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log": "dummy",
+		"b.log": "dummy",
+		"c.txt": "dummy",
+	}))
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+
+	out, err := exec.Command(binName, "plan", "-ext", ".log", "-del", "-out", planFile, tempDir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	expected := fmt.Sprintf("Planned 2 files, written to %s\n", planFile)
+	if expected != string(out) {
+		t.Errorf("expected %q, got %q instead\n", expected, string(out))
+	}
+	data, err := os.ReadFile(planFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"build": "`) {
+		t.Errorf("expected the build in the plan header, got %s instead\n", data)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "b.log"), []byte("dummy, grown"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = exec.Command(binName, "apply", "-log", os.DevNull, planFile).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !strings.Contains(string(out), "SKIPPED (drift: size, ") ||
+		!strings.HasSuffix(string(out), "Applied: 1, skipped due to drift: 1, failed: 0\n") {
+		t.Errorf("expected b.log skipped, got %q instead\n", string(out))
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "a.log")); !os.IsNotExist(err) {
+		t.Errorf("expected a.log to be deleted, got %v instead\n", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "b.log")); err != nil {
+		t.Errorf("expected b.log to stay, got %v instead\n", err)
+	}
+}
+
+// TestCLIArchiveRestore archives the test data and restores it into an
+// empty directory
+func TestCLIExcludeFrom(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log":       "dummy",
+		"b.tmp":       "dummy",
+		"c.bak":       "dummy",
+		"cache/d.log": "dummy",
+	}))
+	lists := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"tmp.txt":   "# scratch\n*.tmp\n",
+		"cache.txt": "cache/\n",
+		"empty.txt": "",
+	}))
+
+	out, err := exec.Command(binName, "list", "-exclude", "*.bak",
+		"-exclude-from", filepath.Join(lists, "tmp.txt"), "-exclude-from", filepath.Join(lists, "cache.txt"),
+		"-exclude-from", filepath.Join(lists, "empty.txt"), tempDir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	expected := filepath.Join(tempDir, "a.log") + "\n"
+	if expected != string(out) {
+		t.Errorf("expected %q, got %q instead\n", expected, string(out))
+	}
+
+	out, err = exec.Command(binName, "list", "-exclude-from", filepath.Join(lists, "missing.txt"), tempDir).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "missing.txt: no such file or directory") {
+		t.Errorf("expected the missing file to fail, got %v: %q instead\n", err, string(out))
+	}
+}
+
+func TestCLIReplace(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.conf": "port=8080\nadmin_port=8080\n",
+		"b.log":  "port=8080\n",
+	}))
+
+	out, err := exec.Command(binName, "replace", "-ext", ".conf", "-replace-old", "8080", "-replace-new", "9090", tempDir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	expected := "2\t" + filepath.Join(tempDir, "a.conf") + "\n"
+	if expected != string(out) {
+		t.Errorf("expected %q, got %q instead\n", expected, string(out))
+	}
+	for name, exp := range map[string]string{"a.conf": "port=9090\nadmin_port=9090\n", "b.log": "port=8080\n"} {
+		data, err := os.ReadFile(filepath.Join(tempDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp != string(data) {
+			t.Errorf("expected %q, got %q instead\n", exp, string(data))
+		}
+	}
+
+	out, err = exec.Command(binName, "replace", "-replace-new", "9090", tempDir).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "replace needs a -replace-old string") {
+		t.Errorf("expected a missing -replace-old to fail, got %v: %q instead\n", err, string(out))
+	}
+}
+
+func TestCLIExec(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("the cat command is needed")
+	}
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log": "first\n",
+		"b.log": "second\n",
+		"c.txt": "third\n",
+	}))
+
+	out, err := exec.Command(binName, "exec", "-ext", ".log", "-exec", "cat", "-exec-parallel", "4", tempDir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	expected := "first\nsecond\n"
+	if expected != string(out) {
+		t.Errorf("expected %q, got %q instead\n", expected, string(out))
+	}
+
+	out, err = exec.Command(binName, "exec", tempDir).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "exec needs an -exec or -exec-on-match-dir command") {
+		t.Errorf("expected a missing -exec to fail, got %v: %q instead\n", err, string(out))
+	}
+}
+
+func TestCLIRename(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.csv":           "first",
+		"b.csv":           "second",
+		"b.csv.processed": "old",
+	}))
+
+	out, err := exec.Command(binName, "rename", "-ext", ".csv", "-append-suffix", ".processed", "-rename-collision", "number", tempDir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	for _, line := range []string{
+		filepath.Join(tempDir, "a.csv") + " -> " + filepath.Join(tempDir, "a.csv.processed"),
+		filepath.Join(tempDir, "b.csv") + " -> " + filepath.Join(tempDir, "b.csv.2.processed"),
+	} {
+		if !strings.Contains(string(out), "RENAMED FILE: ") || !strings.Contains(string(out), line+"\n") {
+			t.Errorf("expected %q to be logged, got %q instead\n", line, string(out))
+		}
+	}
+	for _, name := range []string{"a.csv", "b.csv"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be renamed, got %v instead\n", name, err)
+		}
+	}
+
+	out, err = exec.Command(binName, "rename", tempDir).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "rename needs an -append-suffix or -strip-suffix") {
+		t.Errorf("expected a missing suffix to fail, got %v: %q instead\n", err, string(out))
+	}
+}
+
+func TestCLISnapshotQuery(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log":   "dummy",
+		"b/c.log": "dummy",
+		"d.txt":   "dummy",
+	}))
+	snapFile := filepath.Join(t.TempDir(), "scan.fss")
+
+	out, err := exec.Command(binName, "snapshot", "-out", snapFile, tempDir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if err := os.RemoveAll(filepath.Join(tempDir, "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = exec.Command(binName, "query", "-ext", ".log", snapFile).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	expected := filepath.Join(tempDir, "a.log") + "\n" + filepath.Join(tempDir, "b", "c.log") + "\n"
+	if expected != string(out) {
+		t.Errorf("expected %q, got %q instead\n", expected, string(out))
+	}
+
+	out, err = exec.Command(binName, "query", "-checksum", snapFile).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "can't be used on a snapshot") {
+		t.Errorf("expected -checksum to be refused, got %v: %q instead\n", err, string(out))
+	}
+}
+
+func TestCLIArchiveRestore(t *testing.T) {
+	arcDir := t.TempDir()
+	dest := t.TempDir()
+
+	out, err := exec.Command(binName, "archive", "-arc", arcDir, "-ext", ".log", "../../fss/testdata").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	out, err = exec.Command(binName, "restore", "-arc", arcDir, dest).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	expected := filepath.Join(dest, "dir.log") + "\n"
+	if expected != string(out) {
+		t.Errorf("expected %q, got %q instead\n", expected, string(out))
+	}
+
+	orig, err := os.ReadFile("../../fss/testdata/dir.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := os.ReadFile(filepath.Join(dest, "dir.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(orig) != string(restored) {
+		t.Errorf("expected %q, got %q instead\n", orig, restored)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"clitools/fss"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// addPlanFlags registers the actions and the output of plan
+func addPlanFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.BoolVar(&c.cfg.Del, "del", false, "Plan to delete the matched files")
+	fs.StringVar(&c.cfg.Arc, "arc", "", "Plan to archive the matched files into this directory")
+	fs.StringVar(&c.cfg.Level, "level", "", "Archive gzip level: 0-9, -1 for default, -2 for Huffman only, or auto")
+	fs.IntVar(&c.gzipLevel, "gzip-level", gzip.DefaultCompression, "Archive gzip level from 0 to 9, -level wins when given at the same or a higher precedence")
+	fs.StringVar(&c.planOut, "out", "", "Write the plan to this file instead of the standard output")
+}
+
+// addApplyFlags registers the flags of apply
+func addApplyFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.force, "force", "", "Comma separated drift categories to apply anyway: size, mtime, hash")
+	fs.StringVar(&c.applyHash, "hash", "", "Refuse the plan unless its files were hashed with this algorithm")
+	fs.StringVar(&c.log, "log", "", "Log delete to this file")
+}
+
+// plan writes the actions a scan would apply to a plan file
+func plan(c *cliConfig, out io.Writer) error {
+	root, err := c.singleRoot()
+	if err != nil {
+		return err
+	}
+	cfg, err := filterConfig(c)
+	if err != nil {
+		return err
+	}
+	p, err := fss.NewScanner(root, cfg).Plan()
+	if err != nil {
+		return err
+	}
+	build := readBuildInfo()
+	p.SetBuild(build.Version + " (commit " + build.Commit + ")")
+	if c.planOut == "" {
+		return fss.WritePlan(out, p)
+	}
+
+	f, err := os.Create(c.planOut)
+	if err != nil {
+		return err
+	}
+	if err := fss.WritePlan(f, p); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Planned %d files, written to %s\n", len(p.Entries), c.planOut)
+	return err
+}
+
+// apply runs the actions of the plan file given as argument
+func apply(c *cliConfig, out io.Writer) error {
+	if c.arg == "" {
+		return errors.New("apply needs a plan file")
+	}
+	f, err := os.Open(c.arg)
+	if err != nil {
+		return err
+	}
+	p, err := fss.ReadPlan(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	opts := fss.ApplyOptions{LogWriter: out, Hash: c.applyHash}
+	if c.force != "" {
+		opts.Force = strings.Split(c.force, ",")
+	}
+	if c.log != "" {
+		lf, err := os.OpenFile(c.log, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+		defer lf.Close()
+		opts.LogWriter = lf
+	}
+
+	sum, err := fss.ApplyPlan(p, opts, out)
+	if err != nil {
+		return err
+	}
+	if sum.Failed > 0 {
+		return fmt.Errorf("%d of %d planned files failed", sum.Failed, len(p.Entries))
+	}
+	return nil
+}
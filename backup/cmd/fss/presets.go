@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"clitools/fss"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// loadPresets reads named filter presets from a JSON file. Each preset
+// is a partial config object keyed by the config field names, e.g.
+//
+//	{"large-logs": {"ext": ".log", "size": 10485760}}
+func loadPresets(file string) (map[string]fss.Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	presets := map[string]fss.Config{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&presets); err != nil {
+		return nil, fmt.Errorf("cannot read presets from %s: %w", file, err)
+	}
+	return presets, nil
+}
+
+// mergeConfigs returns base with every field set in overlay copied over it
+func mergeConfigs(base, overlay fss.Config) fss.Config {
+	b := reflect.ValueOf(&base).Elem()
+	o := reflect.ValueOf(overlay)
+	for i := 0; i < o.NumField(); i++ {
+		if !o.Field(i).IsZero() {
+			b.Field(i).Set(o.Field(i))
+		}
+	}
+	return base
+}
+
+// applyFilterChain merges the comma separated presets in chain over cfg
+// in order
+func applyFilterChain(cfg fss.Config, presets map[string]fss.Config, chain string) (fss.Config, error) {
+	for _, name := range strings.Split(chain, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p, ok := presets[name]
+		if !ok {
+			return cfg, fmt.Errorf("unknown filter preset %q", name)
+		}
+		cfg = mergeConfigs(cfg, p)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"clitools/fss"
+	"clitools/fss/testsupport"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const presetsJSON = `{
+	"logs": {"ext": ".log"},
+	"large": {"size": 100},
+	"sorted": {"sort": "path", "maxInMemory": 10}
+}`
+
+func writePresets(t *testing.T, data string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "presets.json")
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadPresets(t *testing.T) {
+	presets, err := loadPresets(writePresets(t, presetsJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(presets) != 3 {
+		t.Fatalf("expected 3 presets, got %d instead", len(presets))
+	}
+	if presets["logs"].Ext != ".log" || presets["large"].Size != 100 ||
+		presets["sorted"].MaxInMemory != 10 {
+		t.Errorf("presets not decoded: %+v\n", presets)
+	}
+
+	if _, err := loadPresets(writePresets(t, `{"logs": {"extension": ".log"}}`)); err == nil {
+		t.Error("expected error for unknown preset field")
+	}
+}
+
+func TestMergeConfigs(t *testing.T) {
+	base := fss.Config{Ext: ".gz", Size: 10, List: true}
+	overlay := fss.Config{Ext: ".log", Sort: "size"}
+
+	res := mergeConfigs(base, overlay)
+	expected := fss.Config{Ext: ".log", Size: 10, List: true, Sort: "size"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %+v, got %+v instead\n", expected, res)
+	}
+}
+
+func TestApplyFilterChainUnknown(t *testing.T) {
+	presets := map[string]fss.Config{"logs": {Ext: ".log"}}
+	if _, err := applyFilterChain(fss.Config{}, presets, "logs,missing"); err == nil {
+		t.Error("expected error for unknown preset")
+	}
+}
+
+// TestFilterChainIntersection checks that chaining two presets matches
+// only the files both presets match on their own
+func TestFilterChainIntersection(t *testing.T) {
+	root := testsupport.Tree(t, map[string]testsupport.Spec{
+		"small.log": {Size: 10},
+		"big.log":   {Size: 500},
+		"small.gz":  {Size: 10},
+		"big.gz":    {Size: 500},
+	})
+
+	presets, err := loadPresets(writePresets(t, presetsJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(chain string) []string {
+		cfg, err := applyFilterChain(fss.Config{List: true}, presets, chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buffer bytes.Buffer
+		if err := fss.NewScanner(root, cfg).Run(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Fields(buffer.String())
+	}
+
+	logs := scan("logs")
+	large := scan("large")
+	chained := scan("logs, large")
+
+	var expected []string
+	for _, p := range logs {
+		for _, q := range large {
+			if p == q {
+				expected = append(expected, p)
+			}
+		}
+	}
+	sort.Strings(expected)
+	sort.Strings(chained)
+
+	if strings.Join(expected, " ") != strings.Join(chained, " ") || len(chained) != 1 {
+		t.Errorf("expected %v, got %v instead\n", expected, chained)
+	}
+}
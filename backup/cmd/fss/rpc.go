@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"clitools/fss"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// rpcVersion is the version of the protocol of fss rpc, reported by the
+// status method
+const rpcVersion = 1
+
+// stdin is where fss rpc reads its requests from
+var stdin io.Reader = os.Stdin
+
+// JSON-RPC 2.0 error codes, the standard ones and those of fss rpc
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcBusy           = -32000
+	rpcForbidden      = -32001
+)
+
+// addRPCFlags registers the flags of rpc
+func addRPCFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.BoolVar(&c.allowActions, "allow-actions", false, "Allow scan requests to delete, archive or hard link files, or run commands")
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// rpcScanParams are the params of the scan method
+type rpcScanParams struct {
+	Root   string          `json:"root"`
+	Config json.RawMessage `json:"config"`
+}
+
+// rpcMatch is a match notification, one per action on a matched file
+type rpcMatch struct {
+	Scan   int    `json:"scan"`
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Dest   string `json:"dest,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// rpcOutput is an output notification, a line of the reports of a scan
+type rpcOutput struct {
+	Scan int    `json:"scan"`
+	Line string `json:"line"`
+}
+
+// rpcPathError is an error notification, the scan goes on without path
+type rpcPathError struct {
+	Scan  int    `json:"scan"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// rpcDone is the done notification ending each scan
+type rpcDone struct {
+	Scan     int    `json:"scan"`
+	Matches  int    `json:"matches"`
+	Canceled bool   `json:"canceled"`
+	Error    string `json:"error,omitempty"`
+}
+
+// rpcStatus is the result of the status method
+type rpcStatus struct {
+	Protocol int  `json:"protocol"`
+	Running  bool `json:"running"`
+	Scan     int  `json:"scan"`
+	Matches  int  `json:"matches"`
+}
+
+// rpcServer answers the requests of fss rpc. Only one scan runs at a time,
+// in its own goroutine, so status and cancel are answered meanwhile.
+type rpcServer struct {
+	root         string
+	allowActions bool
+
+	wmu sync.Mutex // guards enc
+	enc *json.Encoder
+
+	mu       sync.Mutex
+	running  bool
+	canceled bool
+	stop     context.CancelFunc // cancels the context of the running scan
+	scans    int
+	matches  int
+	wg       sync.WaitGroup
+}
+
+func newRPCServer(root string, allowActions bool, out io.Writer) *rpcServer {
+	return &rpcServer{root: root, allowActions: allowActions, enc: json.NewEncoder(out)}
+}
+
+// serve answers the requests read from in, one per line, until its end.
+// A scan still running then is canceled and waited for.
+func (s *rpcServer) serve(in io.Reader) error {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		if line := bytes.TrimSpace(sc.Bytes()); len(line) > 0 {
+			s.handle(line)
+		}
+	}
+	s.cancel()
+	s.wg.Wait()
+	return sc.Err()
+}
+
+func (s *rpcServer) write(v interface{}) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.enc.Encode(v)
+}
+
+func (s *rpcServer) notify(method string, params interface{}) {
+	s.write(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle answers a request. Requests without an id get no response.
+func (s *rpcServer) handle(line []byte) {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		s.write(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &rpcError{rpcParseError, err.Error()}})
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		s.write(rpcResponse{JSONRPC: "2.0", ID: nullID(req.ID),
+			Error: &rpcError{rpcInvalidRequest, `requests need "jsonrpc": "2.0" and a method`}})
+		return
+	}
+
+	var (
+		result interface{}
+		rerr   *rpcError
+		start  func()
+	)
+	switch req.Method {
+	case "scan":
+		result, start, rerr = s.scan(req.Params)
+	case "cancel":
+		result = map[string]bool{"canceled": s.cancel()}
+	case "status":
+		result = s.status()
+	default:
+		rerr = &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method %q", req.Method)}
+	}
+	if req.ID != nil {
+		s.write(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rerr})
+	}
+
+	// The scan starts once its response is written, so its notifications
+	// come after it
+	if start != nil {
+		start()
+	}
+}
+
+func nullID(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+// scan checks the params of a scan request and returns the function
+// starting it, or an error when a scan is already running
+func (s *rpcServer) scan(params json.RawMessage) (interface{}, func(), *rpcError) {
+	var p rpcScanParams
+	if len(params) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(params))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p); err != nil {
+			return nil, nil, &rpcError{rpcInvalidParams, fmt.Sprintf("invalid params: %v", err)}
+		}
+	}
+	var cfg fss.Config
+	if len(p.Config) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(p.Config))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, nil, &rpcError{rpcInvalidParams, fmt.Sprintf("invalid config: %v", err)}
+		}
+	}
+	if p.Root == "" {
+		p.Root = s.root
+	}
+
+	if cfg.WriteFileList != "" {
+		return nil, nil, &rpcError{rpcInvalidParams, "writeFileList can't be set in a request"}
+	}
+	if !s.allowActions && destructive(cfg) {
+		return nil, nil, &rpcError{rpcForbidden, "actions are disabled, start fss rpc with -allow-actions"}
+	}
+	if enc := strings.ToLower(cfg.OutputEncoding); enc != "" && enc != "utf-8" && enc != "utf8" {
+		return nil, nil, &rpcError{rpcInvalidParams, "the output of fss rpc is always UTF-8"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return nil, nil, &rpcError{rpcBusy, errBusy.Error()}
+	}
+	scan := s.scans + 1
+	s.hooks(&cfg, scan)
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	s.scans, s.running, s.canceled, s.matches, s.stop = scan, true, false, 0, stop
+	s.wg.Add(1)
+	start := func() {
+		go func() {
+			defer s.wg.Done()
+			defer stop()
+			s.run(ctx, scan, p.Root, cfg)
+		}()
+	}
+	return map[string]int{"scan": scan}, start, nil
+}
+
+// hooks sets the hooks of cfg sending the notifications of the scan
+func (s *rpcServer) hooks(cfg *fss.Config, scan int) {
+	cfg.OnMatch = func(path string, info os.FileInfo) bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.matches++
+		return true
+	}
+	cfg.OnAction = func(action, path, dest string, err error) {
+		m := rpcMatch{Scan: scan, Action: action, Path: path, Dest: dest}
+		if err != nil {
+			m.Error = err.Error()
+		}
+		s.notify("match", m)
+	}
+	cfg.OnError = func(path string, err error) bool {
+		s.notify("error", rpcPathError{Scan: scan, Path: path, Error: err.Error()})
+		return true
+	}
+}
+
+// run runs a scan until ctx is canceled and sends its done notification.
+// A canceled scan reports canceled rather than the error of ctx.
+func (s *rpcServer) run(ctx context.Context, scan int, root string, cfg fss.Config) {
+	out := &rpcLines{s: s, scan: scan}
+	err := fss.NewScanner(root, cfg).RunContext(ctx, out)
+	out.flush()
+
+	s.mu.Lock()
+	done := rpcDone{Scan: scan, Matches: s.matches, Canceled: s.canceled}
+	s.running, s.stop = false, nil
+	s.mu.Unlock()
+	if err != nil && !(done.Canceled && errors.Is(err, context.Canceled)) {
+		done.Error = err.Error()
+	}
+	s.notify("done", done)
+}
+
+// cancel stops the walk of the running scan. It reports whether a scan
+// was running.
+func (s *rpcServer) cancel() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return false
+	}
+	s.canceled = true
+	s.stop()
+	return true
+}
+
+func (s *rpcServer) status() rpcStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return rpcStatus{Protocol: rpcVersion, Running: s.running, Scan: s.scans, Matches: s.matches}
+}
+
+// rpcLines sends each line written to it as an output notification
+type rpcLines struct {
+	s    *rpcServer
+	scan int
+	buf  []byte
+}
+
+func (w *rpcLines) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.s.notify("output", rpcOutput{Scan: w.scan, Line: string(w.buf[:i])})
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// flush sends the last line if it isn't ended by a newline
+func (w *rpcLines) flush() {
+	if len(w.buf) > 0 {
+		w.s.notify("output", rpcOutput{Scan: w.scan, Line: string(w.buf)})
+		w.buf = nil
+	}
+}
+
+// rpc answers JSON-RPC requests on stdin until its end
+func rpc(c *cliConfig, out io.Writer) error {
+	root := c.arg
+	if root == "" {
+		root = "."
+	}
+	return newRPCServer(root, c.allowActions, out).serve(stdin)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"clitools/fss/testsupport"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rpcClient drives run with the rpc command through in-memory pipes. The
+// output is read as it comes, so the server never blocks on it.
+type rpcClient struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  chan []byte
+	code chan int
+}
+
+func startRPC(t *testing.T, args ...string) *rpcClient {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	saved := stdin
+	stdin = inR
+	t.Cleanup(func() { stdin = saved })
+
+	c := &rpcClient{t: t, in: inW, out: make(chan []byte, 100), code: make(chan int, 1)}
+	go func() {
+		sc := bufio.NewScanner(outR)
+		for sc.Scan() {
+			c.out <- append([]byte{}, sc.Bytes()...)
+		}
+		close(c.out)
+	}()
+	go func() {
+		var errOut bytes.Buffer
+		code := run(append([]string{"rpc"}, args...), outW, &errOut)
+		outW.Close()
+		c.code <- code
+	}()
+	return c
+}
+
+func (c *rpcClient) send(line string) {
+	c.t.Helper()
+	if _, err := fmt.Fprintln(c.in, line); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next returns the next response or notification
+func (c *rpcClient) next() map[string]interface{} {
+	c.t.Helper()
+	var line []byte
+	select {
+	case l, ok := <-c.out:
+		if !ok {
+			c.t.Fatal("expected a message, got the end of the output")
+		}
+		line = l
+	case <-time.After(10 * time.Second):
+		c.t.Fatal("expected a message, got none in 10s")
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(line, &v); err != nil {
+		c.t.Fatalf("invalid message %q: %v", line, err)
+	}
+	return v
+}
+
+// close ends the input and checks the exit code
+func (c *rpcClient) close() {
+	c.t.Helper()
+	c.in.Close()
+	for range c.out {
+	}
+	if code := <-c.code; code != 0 {
+		c.t.Errorf("expected exit code 0, got %d instead\n", code)
+	}
+}
+
+// errorCode returns the error code of a response, 0 without error
+func errorCode(v map[string]interface{}) int {
+	e, ok := v["error"].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	return int(e["code"].(float64))
+}
+
+func TestRPCScan(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log": "dummy",
+		"b.log": "dummy",
+		"c.txt": "dummy",
+	}))
+	c := startRPC(t, tempDir)
+
+	c.send(`{"jsonrpc": "2.0", "id": 1, "method": "status"}`)
+	v := c.next()
+	status := v["result"].(map[string]interface{})
+	if v["id"] != 1.0 || status["protocol"] != float64(rpcVersion) || status["running"] != false {
+		t.Errorf("expected the idle status, got %v instead\n", v)
+	}
+
+	c.send(`{"jsonrpc": "2.0", "id": 2, "method": "scan", "params": {"config": {"ext": ".log", "list": true, "reportTotals": true}}}`)
+	v = c.next()
+	if v["id"] != 2.0 || v["result"].(map[string]interface{})["scan"] != 1.0 {
+		t.Fatalf("expected scan 1 to start, got %v instead\n", v)
+	}
+
+	var matched, lines []string
+	for {
+		v = c.next()
+		params := v["params"].(map[string]interface{})
+		if v["method"] == "done" {
+			if params["matches"] != 2.0 || params["canceled"] != false || params["error"] != nil {
+				t.Errorf("expected 2 matches, got %v instead\n", params)
+			}
+			break
+		}
+		switch v["method"] {
+		case "match":
+			matched = append(matched, params["dest"].(string))
+		case "output":
+			lines = append(lines, params["line"].(string))
+		default:
+			t.Fatalf("unexpected message %v", v)
+		}
+	}
+	expMatched := []string{filepath.Join(tempDir, "a.log"), filepath.Join(tempDir, "b.log")}
+	if fmt.Sprint(matched) != fmt.Sprint(expMatched) {
+		t.Errorf("expected matches %v, got %v instead\n", expMatched, matched)
+	}
+	expLines := []string{"Total files scanned: 3", "Total directories scanned: 1"}
+	if fmt.Sprint(lines) != fmt.Sprint(expLines) {
+		t.Errorf("expected output %q, got %q instead\n", expLines, lines)
+	}
+	c.close()
+}
+
+func TestRPCErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		request string
+		expCode int
+	}{
+		{"ParseError", `{"jsonrpc": "2.0", "id": 1`, rpcParseError},
+		{"NoVersion", `{"id": 1, "method": "status"}`, rpcInvalidRequest},
+		{"UnknownMethod", `{"jsonrpc": "2.0", "id": 1, "method": "delete"}`, rpcMethodNotFound},
+		{"UnknownField", `{"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"config": {"extension": ".log"}}}`,
+			rpcInvalidParams},
+		{"InvalidConfig", `{"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"config": {"size": -1}}}`,
+			rpcInvalidParams},
+		{"ActionsDisabled", `{"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"config": {"del": true}}}`,
+			rpcForbidden},
+		{"ExecDisabled", `{"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"config": {"exec": "touch /tmp/x"}}}`,
+			rpcForbidden},
+		{"WriteFileList", `{"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"config": {"writeFileList": "/tmp/list"}}}`,
+			rpcInvalidParams},
+		{"FilterCmdDisabled", `{"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"config": {"filterCmd": "touch /tmp/x"}}}`,
+			rpcForbidden},
+		{"AppendSuffixDisabled", `{"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"config": {"appendSuffix": ".bak"}}}`,
+			rpcForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := startRPC(t, t.TempDir())
+			c.send(tc.request)
+			if v := c.next(); errorCode(v) != tc.expCode {
+				t.Errorf("expected error code %d, got %v instead\n", tc.expCode, v)
+			}
+			c.close()
+		})
+	}
+}
+
+func TestRPCBusyCancel(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 10}, "dummy"))
+	c := startRPC(t, tempDir)
+
+	// The pace keeps the scan running while the other requests come in
+	c.send(`{"jsonrpc": "2.0", "id": 1, "method": "scan", "params": {"config": {"list": true, "reportTotals": true, "pace": 20}}}`)
+	if v := c.next(); errorCode(v) != 0 {
+		t.Fatalf("expected the scan to start, got %v instead\n", v)
+	}
+	if v := c.next(); v["method"] != "match" {
+		t.Fatalf("expected a match, got %v instead\n", v)
+	}
+
+	c.send(`{"jsonrpc": "2.0", "id": 2, "method": "scan", "params": {}}`)
+	c.send(`{"jsonrpc": "2.0", "id": 3, "method": "cancel"}`)
+	var done map[string]interface{}
+	for done == nil {
+		v := c.next()
+		switch {
+		case v["id"] == 2.0:
+			if errorCode(v) != rpcBusy {
+				t.Errorf("expected error code %d, got %v instead\n", rpcBusy, v)
+			}
+		case v["id"] == 3.0:
+			if v["result"].(map[string]interface{})["canceled"] != true {
+				t.Errorf("expected the scan to be canceled, got %v instead\n", v)
+			}
+		case v["method"] == "output":
+			// A walk left early never gets to the totals
+			line := v["params"].(map[string]interface{})["line"].(string)
+			if strings.HasPrefix(line, "Total files scanned") {
+				t.Errorf("expected the walk to stop, got %q instead\n", line)
+			}
+		case v["method"] == "done":
+			done = v["params"].(map[string]interface{})
+		}
+	}
+	if done["canceled"] != true || done["matches"].(float64) >= 10 || done["error"] != nil {
+		t.Errorf("expected a canceled scan, got %v instead\n", done)
+	}
+	c.close()
+}
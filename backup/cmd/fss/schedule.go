@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// percent is a flag value like 10% stored as a fraction
+type percent float64
+
+func (p *percent) String() string {
+	if p == nil || *p == 0 {
+		return "0%"
+	}
+	return strconv.FormatFloat(float64(*p)*100, 'f', -1, 64) + "%"
+}
+
+// Set accepts 10% or 10
+func (p *percent) Set(s string) error {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return err
+	}
+	if v < 0 || v > 100 {
+		return errors.New("must be between 0% and 100%")
+	}
+	*p = percent(v / 100)
+	return nil
+}
+
+// addScheduleFlags registers the flags of the periodic mode
+func addScheduleFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.DurationVar(&c.every, "every", 0, "Run the scan again on this interval until SIGTERM")
+	fs.Var(&c.jitter, "jitter", "Delay each -every run by up to this part of the interval, like 10%")
+}
+
+// schedule calls fn with the run number right away and then at every
+// interval boundary until done is closed. Runs never overlap: boundaries
+// passed during a run are skipped and reported to out. Each run is
+// delayed by a random part of jitter times the interval.
+func schedule(every time.Duration, jitter float64, rnd *rand.Rand, out io.Writer, done <-chan struct{}, fn func(run int)) {
+	start := time.Now()
+	slot := time.Duration(0)
+	for run := 1; ; run++ {
+		fn(run)
+
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		// Boundaries passed during the run are skipped
+		next := time.Since(start)/every + 1
+		if skipped := next - slot - 1; skipped > 0 {
+			fmt.Fprintf(out, "Skipped %d intervals while run %d was going\n", int(skipped), run)
+		}
+		slot = next
+		delay := time.Until(start.Add(slot * every))
+		if jitter > 0 {
+			delay += time.Duration(rnd.Float64() * jitter * float64(every))
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-done:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
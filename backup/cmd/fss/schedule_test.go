@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercent(t *testing.T) {
+	testCases := []struct {
+		name   string
+		value  string
+		expect float64
+		err    bool
+	}{
+		{"Percent", "10%", 0.1, false},
+		{"Number", "25", 0.25, false},
+		{"Zero", "0%", 0, false},
+		{"TooLarge", "150%", 0, true},
+		{"Negative", "-5%", 0, true},
+		{"Invalid", "ten", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var p percent
+			err := p.Set(tc.value)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error for %q, got nil instead\n", tc.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if float64(p) != tc.expect {
+				t.Errorf("expected %v, got %v instead\n", tc.expect, float64(p))
+			}
+		})
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	testCases := []struct {
+		name    string
+		runTime time.Duration
+		stopAt  int
+		skipped bool
+	}{
+		{"Interval", 0, 3, false},
+		{"LongRun", 25 * time.Millisecond, 2, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			done := make(chan struct{})
+			var runs []int
+			starts := []time.Time{}
+
+			schedule(10*time.Millisecond, 0, rand.New(rand.NewSource(1)), &out, done, func(run int) {
+				runs = append(runs, run)
+				starts = append(starts, time.Now())
+				time.Sleep(tc.runTime)
+				if run == tc.stopAt {
+					close(done)
+				}
+			})
+
+			if len(runs) != tc.stopAt {
+				t.Fatalf("expected %d runs, got %v instead\n", tc.stopAt, runs)
+			}
+			for i, run := range runs {
+				if run != i+1 {
+					t.Errorf("expected run %d, got %d instead\n", i+1, run)
+				}
+			}
+			for i := 1; i < len(starts); i++ {
+				if gap := starts[i].Sub(starts[i-1]); gap < tc.runTime {
+					t.Errorf("run %d started %v after the previous one\n", i+1, gap)
+				}
+			}
+			if skipped := strings.Contains(out.String(), "Skipped"); skipped != tc.skipped {
+				t.Errorf("expected skipped %t, got output %q instead\n", tc.skipped, out.String())
+			}
+		})
+	}
+}
+
+func TestScheduleStop(t *testing.T) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	runs := 0
+	go func() {
+		schedule(time.Hour, 0.1, rand.New(rand.NewSource(1)), &bytes.Buffer{}, done, func(int) { runs++ })
+		close(finished)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(done)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("schedule didn't stop")
+	}
+	if runs != 1 {
+		t.Errorf("expected 1 run, got %d instead\n", runs)
+	}
+}
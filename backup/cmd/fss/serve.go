@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"clitools/fss"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errBusy is returned by server.scan while another scan is running
+var errBusy = errors.New("a scan is already running")
+
+// addServeFlags registers the flags of serve
+func addServeFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.addr, "addr", ":8080", "Address to listen on")
+	fs.BoolVar(&c.allowActions, "allow-actions", false, "Allow scan requests to delete, archive or hard link files, or run commands")
+}
+
+// scanResult is the outcome of a scan run by the server
+type scanResult struct {
+	Run      int       `json:"run"`
+	Root     string    `json:"root"`
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	Lines    []string  `json:"lines"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// scanSummary is a scanResult without its lines
+type scanSummary struct {
+	Run      int       `json:"run"`
+	Root     string    `json:"root"`
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	Lines    int       `json:"lines"`
+	Error    string    `json:"error,omitempty"`
+	Running  bool      `json:"running"`
+}
+
+// server runs scans of root and keeps the result of the latest one. Only
+// one scan runs at a time.
+type server struct {
+	root         string
+	base         fss.Config
+	allowActions bool
+
+	mu      sync.Mutex
+	running bool
+	runs    int
+	latest  *scanResult
+}
+
+func newServer(root string, base fss.Config, allowActions bool) *server {
+	return &server{root: root, base: base, allowActions: allowActions}
+}
+
+// scan runs a scan with cfg and stores its result, or returns errBusy
+func (s *server) scan(cfg fss.Config) (*scanResult, error) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return nil, errBusy
+	}
+	s.running = true
+	s.runs++
+	r := &scanResult{Run: s.runs, Root: s.root, Started: time.Now()}
+	s.mu.Unlock()
+
+	var out bytes.Buffer
+	cfg.LogWriter = &out
+	if err := fss.NewScanner(s.root, cfg).Run(&out); err != nil {
+		r.Error = err.Error()
+	}
+	r.Duration = time.Since(r.Started).String()
+	r.Lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if out.Len() == 0 {
+		r.Lines = []string{}
+	}
+
+	s.mu.Lock()
+	s.running = false
+	s.latest = r
+	s.mu.Unlock()
+	return r, nil
+}
+
+// destructive reports whether cfg changes the tree or runs commands,
+// which the servers only allow with -allow-actions
+func destructive(cfg fss.Config) bool {
+	return cfg.Del || cfg.Arc != "" || cfg.HardlinkDups || cfg.Exec != "" || cfg.ExecOnMatchDir != "" ||
+		cfg.AppendSuffix != "" || cfg.StripSuffix != "" || cfg.FilterCmd != "" ||
+		cfg.ReplaceOld != "" && !cfg.ReplaceDryRun
+}
+
+// requestConfig decodes the filters of a scan request over the base
+// configuration and checks them like the command line ones
+func (s *server) requestConfig(body io.Reader) (fss.Config, int, error) {
+	cfg := s.base
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return cfg, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err)
+	}
+
+	// The file list is the one of the command line, a request could
+	// overwrite any file the server can write
+	if cfg.WriteFileList != s.base.WriteFileList {
+		return cfg, http.StatusBadRequest, errors.New("WriteFileList can't be set in a request")
+	}
+	if !s.allowActions && destructive(cfg) {
+		return cfg, http.StatusForbidden, errors.New("actions are disabled, start the server with -allow-actions")
+	}
+	cfg.LogWriter = io.Discard
+	if err := cfg.Validate(); err != nil {
+		return cfg, http.StatusBadRequest, err
+	}
+	return cfg, http.StatusOK, nil
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scan", s.handleScan)
+	mux.HandleFunc("/results", s.handleResults)
+	mux.HandleFunc("/summary", s.handleSummary)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return mux
+}
+
+func (s *server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+	cfg, status, err := s.requestConfig(r.Body)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	res, err := s.scan(cfg)
+	switch {
+	case errors.Is(err, errBusy):
+		writeError(w, http.StatusConflict, err)
+	case res.Error != "":
+		writeJSON(w, http.StatusInternalServerError, res)
+	default:
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (s *server) handleResults(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	latest := s.latest
+	s.mu.Unlock()
+
+	if latest == nil {
+		writeError(w, http.StatusNotFound, errors.New("no scan has run yet"))
+		return
+	}
+	writeJSON(w, http.StatusOK, latest)
+}
+
+func (s *server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	sum := scanSummary{Root: s.root, Running: s.running}
+	if l := s.latest; l != nil {
+		sum.Run, sum.Started, sum.Duration = l.Run, l.Started, l.Duration
+		sum.Lines, sum.Error = len(l.Lines), l.Error
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, sum)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// serve runs the HTTP server until SIGINT or SIGTERM, scanning on the
+// -every schedule when it's set
+func serve(c *cliConfig, out io.Writer) error {
+	cfg, err := filterConfig(c)
+	if err != nil {
+		return err
+	}
+	if !c.allowActions && destructive(cfg) {
+		return errors.New("actions are disabled, use -allow-actions")
+	}
+	cfg.LogWriter = io.Discard
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	root, err := c.singleRoot()
+	if err != nil {
+		return err
+	}
+	srv := newServer(root, cfg, c.allowActions)
+	hs := &http.Server{Addr: c.addr, Handler: srv.handler()}
+	done, stop := stopOnSignal()
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- hs.ListenAndServe()
+	}()
+	fmt.Fprintf(out, "Serving %s on %s\n", root, c.addr)
+
+	if c.every > 0 {
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		go schedule(c.every, float64(c.jitter), rnd, out, done, func(run int) {
+			if _, err := srv.scan(cfg); err != nil {
+				fmt.Fprintf(c.errOut, "run %d: %v\n", run, err)
+			}
+		})
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-done:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return hs.Shutdown(ctx)
+}
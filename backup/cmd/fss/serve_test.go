@@ -0,0 +1,164 @@
+package main
+
+import (
+	"clitools/fss"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func postScan(t *testing.T, url, body string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	resp, err := http.Post(url+"/scan", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var v map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return resp, v
+}
+
+func getJSON(t *testing.T, url string, v interface{}) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestServeHealthz(t *testing.T) {
+	ts := httptest.NewServer(newServer("../../fss/testdata", fss.Config{}, false).handler())
+	defer ts.Close()
+
+	var v map[string]string
+	if status := getJSON(t, ts.URL+"/healthz", &v); status != http.StatusOK || v["status"] != "ok" {
+		t.Errorf("expected ok, got %d %v instead\n", status, v)
+	}
+}
+
+func TestServeScan(t *testing.T) {
+	ts := httptest.NewServer(newServer("../../fss/testdata", fss.Config{}, false).handler())
+	defer ts.Close()
+
+	var v map[string]string
+	if status := getJSON(t, ts.URL+"/results", &v); status != http.StatusNotFound {
+		t.Errorf("expected status %d before any scan, got %d instead\n", http.StatusNotFound, status)
+	}
+
+	resp, res := postScan(t, ts.URL, `{"Ext": ".log"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d %v instead\n", http.StatusOK, resp.StatusCode, res)
+	}
+
+	var latest scanResult
+	if status := getJSON(t, ts.URL+"/results", &latest); status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d instead\n", http.StatusOK, status)
+	}
+	expected := []string{"../../fss/testdata/dir.log"}
+	if latest.Run != 1 || strings.Join(latest.Lines, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected run 1 with %v, got %+v instead\n", expected, latest)
+	}
+
+	var sum scanSummary
+	getJSON(t, ts.URL+"/summary", &sum)
+	if sum.Run != 1 || sum.Lines != 1 || sum.Running {
+		t.Errorf("expected summary of run 1 with 1 line, got %+v instead\n", sum)
+	}
+}
+
+func TestServeScanErrors(t *testing.T) {
+	srv := newServer("../../fss/testdata", fss.Config{}, false)
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"UnknownField", `{"Extension": ".log"}`, http.StatusBadRequest},
+		{"InvalidJSON", `{"Ext":`, http.StatusBadRequest},
+		{"InvalidConfig", `{"Size": -1}`, http.StatusBadRequest},
+		{"DeleteDisabled", `{"Del": true}`, http.StatusForbidden},
+		{"ArchiveDisabled", `{"Arc": "/tmp/arc"}`, http.StatusForbidden},
+		{"ExecDisabled", `{"Exec": "touch /tmp/x"}`, http.StatusForbidden},
+		{"ExecOnMatchDirDisabled", `{"ExecOnMatchDir": "touch {}/x"}`, http.StatusForbidden},
+		{"AppendSuffixDisabled", `{"AppendSuffix": ".bak"}`, http.StatusForbidden},
+		{"StripSuffixDisabled", `{"StripSuffix": ".bak"}`, http.StatusForbidden},
+		{"FilterCmdDisabled", `{"FilterCmd": "touch /tmp/x"}`, http.StatusForbidden},
+		{"WriteFileList", `{"WriteFileList": "/tmp/list"}`, http.StatusBadRequest},
+		{"ReplaceDisabled", `{"ReplaceOld": "a", "ReplaceNew": "b"}`, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, v := postScan(t, ts.URL, tc.body)
+			if resp.StatusCode != tc.status {
+				t.Errorf("expected status %d, got %d %v instead\n", tc.status, resp.StatusCode, v)
+			}
+		})
+	}
+
+	// A dry run writes nothing, it is allowed
+	t.Run("ReplaceDryRun", func(t *testing.T) {
+		resp, v := postScan(t, ts.URL, `{"ReplaceOld": "a", "ReplaceNew": "b", "ReplaceDryRun": true}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status %d, got %d %v instead\n", http.StatusOK, resp.StatusCode, v)
+		}
+	})
+
+	t.Run("Busy", func(t *testing.T) {
+		srv.mu.Lock()
+		srv.running = true
+		srv.mu.Unlock()
+		defer func() {
+			srv.mu.Lock()
+			srv.running = false
+			srv.mu.Unlock()
+		}()
+
+		resp, v := postScan(t, ts.URL, `{}`)
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("expected status %d, got %d %v instead\n", http.StatusConflict, resp.StatusCode, v)
+		}
+	})
+
+	t.Run("GetScan", func(t *testing.T) {
+		var v map[string]string
+		if status := getJSON(t, ts.URL+"/scan", &v); status != http.StatusMethodNotAllowed {
+			t.Errorf("expected status %d, got %d instead\n", http.StatusMethodNotAllowed, status)
+		}
+	})
+}
+
+func TestServeAllowActions(t *testing.T) {
+	tempDir := t.TempDir()
+	fpath := filepath.Join(tempDir, "old.log")
+	if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(newServer(tempDir, fss.Config{}, true).handler())
+	defer ts.Close()
+
+	resp, v := postScan(t, ts.URL, `{"Ext": ".log", "Del": true}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d %v instead\n", http.StatusOK, resp.StatusCode, v)
+	}
+	if _, err := os.Stat(fpath); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be deleted, got %v instead\n", fpath, err)
+	}
+}
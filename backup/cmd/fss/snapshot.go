@@ -0,0 +1,44 @@
+package main
+
+import (
+	"clitools/fss"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// addSnapshotFlags registers the flags of snapshot
+func addSnapshotFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.StringVar(&c.snapshotOut, "out", "", "Write the snapshot to this file")
+	fs.Var((*stringList)(&c.cfg.Exclude), "exclude", "Leave out the paths matching this rsync style pattern, can be repeated")
+	fs.BoolVar(&c.cfg.NoIgnore, "no-ignore", false, "Record the paths matched by the .fssignore files too")
+	fs.Float64Var(&c.cfg.Pace, "pace", 0, "Limit filesystem operations per second")
+}
+
+// snapshot records every entry of the root to the -out file, to be
+// queried later with query
+func snapshot(c *cliConfig, out io.Writer) error {
+	if c.snapshotOut == "" {
+		return errors.New("snapshot needs an -out file")
+	}
+	root, err := c.singleRoot()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(c.snapshotOut)
+	if err != nil {
+		return err
+	}
+	if err := fss.NewScanner(root, c.cfg).Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Snapshot of %s written to %s\n", root, c.snapshotOut)
+	return err
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"clitools/fss"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// addTUIFlags registers the flags of the interactive mode
+func addTUIFlags(fs *flag.FlagSet, c *cliConfig) {
+	fs.BoolVar(&c.tui, "tui", false, "Select the matched files to delete or archive in an interactive list")
+}
+
+// tuiSortKeys are the orders the list cycles through
+var tuiSortKeys = []string{"path", "size", "age"}
+
+// tuiActions are the texts of the actions of the list, for the
+// confirmation and once done
+var tuiActions = map[string][2]string{
+	"delete":  {"Delete", "Deleted"},
+	"archive": {"Archive", "Archived"},
+}
+
+// tuiModel is the state of the interactive list. It's driven by key
+// names so it can be tested without a terminal.
+type tuiModel struct {
+	files    []fss.Match
+	view     []int // indexes of files shown, filtered and sorted
+	selected map[int]bool
+
+	cursor    int
+	offset    int
+	height    int
+	sortKey   int
+	filter    string
+	filtering bool
+	confirm   string // action waiting for confirmation
+	canArc    bool
+	now       time.Time
+}
+
+func newTUIModel(files []fss.Match, height int, canArc bool) *tuiModel {
+	m := &tuiModel{files: files, selected: map[int]bool{}, height: height, canArc: canArc, now: time.Now()}
+	m.update()
+	return m
+}
+
+// update rebuilds the view after the filter or the sort changed
+func (m *tuiModel) update() {
+	m.view = m.view[:0]
+	for i, f := range m.files {
+		if strings.Contains(f.Path, m.filter) {
+			m.view = append(m.view, i)
+		}
+	}
+
+	less := func(a, b fss.Match) bool { return a.Path < b.Path }
+	switch tuiSortKeys[m.sortKey] {
+	case "size":
+		less = func(a, b fss.Match) bool { return a.Info.Size() > b.Info.Size() }
+	case "age":
+		less = func(a, b fss.Match) bool { return a.Info.ModTime().Before(b.Info.ModTime()) }
+	}
+	sort.SliceStable(m.view, func(i, j int) bool {
+		return less(m.files[m.view[i]], m.files[m.view[j]])
+	})
+	m.move(0)
+}
+
+// move moves the cursor by n rows and scrolls to keep it shown
+func (m *tuiModel) move(n int) {
+	m.cursor += n
+	if m.cursor >= len(m.view) {
+		m.cursor = len(m.view) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+	rows := m.rows()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+}
+
+// rows is the number of files shown, the header and footer take 3 lines
+func (m *tuiModel) rows() int {
+	if m.height <= 4 {
+		return 1
+	}
+	return m.height - 3
+}
+
+// chosen returns the selected files in walk order with their total size
+func (m *tuiModel) chosen() ([]fss.Match, int64) {
+	var files []fss.Match
+	var size int64
+	for i, f := range m.files {
+		if m.selected[i] {
+			files = append(files, f)
+			size += f.Info.Size()
+		}
+	}
+	return files, size
+}
+
+// key handles a key press. It returns the confirmed action, "quit" or
+// an empty string to keep going.
+func (m *tuiModel) key(k string) string {
+	if m.confirm != "" {
+		action := m.confirm
+		m.confirm = ""
+		if k == "y" {
+			return action
+		}
+		return ""
+	}
+
+	if m.filtering {
+		switch k {
+		case "enter":
+			m.filtering = false
+		case "esc":
+			m.filtering, m.filter = false, ""
+		case "backspace":
+			if m.filter != "" {
+				m.filter = m.filter[:len(m.filter)-1]
+			}
+		default:
+			if len(k) == 1 {
+				m.filter += k
+			}
+		}
+		m.update()
+		return ""
+	}
+
+	switch k {
+	case "q", "ctrl-c", "esc":
+		return "quit"
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-m.rows())
+	case "pgdown":
+		m.move(m.rows())
+	case " ":
+		if len(m.view) > 0 {
+			i := m.view[m.cursor]
+			m.selected[i] = !m.selected[i]
+			m.move(1)
+		}
+	case "a":
+		// Select all the files shown, or clear them if they all are
+		all := true
+		for _, i := range m.view {
+			all = all && m.selected[i]
+		}
+		for _, i := range m.view {
+			m.selected[i] = !all
+		}
+	case "s":
+		m.sortKey = (m.sortKey + 1) % len(tuiSortKeys)
+		m.update()
+	case "/":
+		m.filtering = true
+	case "d":
+		if files, _ := m.chosen(); len(files) > 0 {
+			m.confirm = "delete"
+		}
+	case "r":
+		if files, _ := m.chosen(); len(files) > 0 && m.canArc {
+			m.confirm = "archive"
+		}
+	}
+	return ""
+}
+
+// render draws the whole screen
+func (m *tuiModel) render(w io.Writer) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+
+	files, size := m.chosen()
+	if m.confirm != "" {
+		fmt.Fprintf(&b, "%s %d files, %d bytes? [y/N]\r\n", tuiActions[m.confirm][0], len(files), size)
+		io.WriteString(w, b.String())
+		return
+	}
+
+	fmt.Fprintf(&b, "    %12s  %-12s  %s\r\n", "SIZE", "AGE", "PATH")
+	for row := m.offset; row < len(m.view) && row < m.offset+m.rows(); row++ {
+		i := m.view[row]
+		f := m.files[i]
+		cursor, mark := " ", " "
+		if row == m.cursor {
+			cursor = ">"
+		}
+		if m.selected[i] {
+			mark = "x"
+		}
+		fmt.Fprintf(&b, "%s[%s] %12d  %-12s  %s\r\n", cursor, mark, f.Info.Size(),
+			fss.HumanAge(m.now.Sub(f.Info.ModTime())), f.Path)
+	}
+
+	filter := m.filter
+	if m.filtering {
+		filter += "_"
+	}
+	fmt.Fprintf(&b, "%d/%d shown, %d selected (%d bytes) | sort: %s | filter: %s\r\n",
+		len(m.view), len(m.files), len(files), size, tuiSortKeys[m.sortKey], filter)
+	help := "space select, a all, s sort, / filter, d delete"
+	if m.canArc {
+		help += ", r archive"
+	}
+	b.WriteString(help + ", q quit")
+	io.WriteString(w, b.String())
+}
+
+// tuiKeys maps the escape sequences of the special keys to key names
+var tuiKeys = map[string]string{
+	"\x1b[A":  "up",
+	"\x1b[B":  "down",
+	"\x1b[5~": "pgup",
+	"\x1b[6~": "pgdown",
+	"\x1b":    "esc",
+	"\r":      "enter",
+	"\n":      "enter",
+	"\x7f":    "backspace",
+	"\b":      "backspace",
+	"\x03":    "ctrl-c",
+}
+
+// keyName returns the name of the key read from the terminal
+func keyName(seq []byte) string {
+	if k, ok := tuiKeys[string(seq)]; ok {
+		return k
+	}
+	return string(seq)
+}
+
+// runTUI lets the user pick the matched files and applies the chosen
+// action to them with the same code as the batch mode
+func runTUI(c *cliConfig, out io.Writer) error {
+	if c.watch || c.every > 0 {
+		return errors.New("-tui can't be used with -watch or -every")
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("-tui needs a terminal, use -list to print the matched files instead")
+	}
+
+	cfg, err := filterConfig(c)
+	if err != nil {
+		return err
+	}
+	root, err := c.singleRoot()
+	if err != nil {
+		return err
+	}
+	s := fss.NewScanner(root, cfg)
+	files, err := s.Collect()
+	if err != nil {
+		return err
+	}
+
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return err
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+
+	m := newTUIModel(files, height, cfg.Arc != "")
+	action := ""
+	buf := make([]byte, 16)
+	io.WriteString(out, "\x1b[?1049h")
+	for action == "" {
+		m.render(out)
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			action = "quit"
+			break
+		}
+		action = m.key(keyName(buf[:n]))
+	}
+	io.WriteString(out, "\x1b[?1049l")
+	term.Restore(fd, state)
+
+	if action == "quit" {
+		return nil
+	}
+
+	// The actions log like the batch mode
+	chosen, _ := m.chosen()
+	cfg.List, cfg.Del = false, action == "delete"
+	if action != "archive" {
+		cfg.Arc = ""
+	}
+	cfg.LogWriter = out
+	if c.log != "" {
+		f, err := os.OpenFile(c.log, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cfg.LogWriter = f
+	}
+	s.Config = cfg
+	if err := s.Apply(chosen); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s %d files\n", tuiActions[action][1], len(chosen))
+	return nil
+}
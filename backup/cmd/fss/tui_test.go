@@ -0,0 +1,125 @@
+package main
+
+import (
+	"clitools/fss"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeInfo is the os.FileInfo of a file shown in the list
+type fakeInfo struct {
+	size  int64
+	mtime time.Time
+}
+
+func (i fakeInfo) Name() string       { return "" }
+func (i fakeInfo) Size() int64        { return i.size }
+func (i fakeInfo) Mode() os.FileMode  { return 0644 }
+func (i fakeInfo) ModTime() time.Time { return i.mtime }
+func (i fakeInfo) IsDir() bool        { return false }
+func (i fakeInfo) Sys() interface{}   { return nil }
+
+func tuiFiles() []fss.Match {
+	now := time.Now()
+	return []fss.Match{
+		{Path: "logs/a.log", Info: fakeInfo{size: 10, mtime: now.Add(-time.Hour)}},
+		{Path: "logs/b.log", Info: fakeInfo{size: 300, mtime: now.Add(-3 * time.Hour)}},
+		{Path: "tmp/c.tmp", Info: fakeInfo{size: 20, mtime: now.Add(-2 * time.Hour)}},
+	}
+}
+
+func viewPaths(m *tuiModel) string {
+	var paths []string
+	for _, i := range m.view {
+		paths = append(paths, m.files[i].Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestTUIModel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		keys     []string
+		view     string
+		selected string
+		action   string
+	}{
+		{"Initial", nil, "logs/a.log,logs/b.log,tmp/c.tmp", "", ""},
+		{"SortBySize", []string{"s"}, "logs/b.log,tmp/c.tmp,logs/a.log", "", ""},
+		{"SortByAge", []string{"s", "s"}, "logs/b.log,tmp/c.tmp,logs/a.log", "", ""},
+		{"Filter", []string{"/", "t", "m", "p", "enter"}, "tmp/c.tmp", "", ""},
+		{"FilterBackspace", []string{"/", "t", "m", "p", "backspace", "backspace", "backspace", "l", "enter"},
+			"logs/a.log,logs/b.log", "", ""},
+		{"FilterEsc", []string{"/", "t", "esc"}, "logs/a.log,logs/b.log,tmp/c.tmp", "", ""},
+		{"Toggle", []string{" ", " ", "up", " "}, "logs/a.log,logs/b.log,tmp/c.tmp", "logs/a.log", ""},
+		{"SelectFiltered", []string{"/", "l", "o", "g", "enter", "a"}, "logs/a.log,logs/b.log",
+			"logs/a.log,logs/b.log", ""},
+		{"Delete", []string{"down", " ", "d", "y"}, "logs/a.log,logs/b.log,tmp/c.tmp", "logs/b.log", "delete"},
+		{"DeleteCancelled", []string{" ", "d", "n"}, "logs/a.log,logs/b.log,tmp/c.tmp", "logs/a.log", ""},
+		{"DeleteNothing", []string{"d", "y"}, "logs/a.log,logs/b.log,tmp/c.tmp", "", ""},
+		{"ArchiveWithoutArc", []string{" ", "r", "y"}, "logs/a.log,logs/b.log,tmp/c.tmp", "logs/a.log", ""},
+		{"Quit", []string{"q"}, "logs/a.log,logs/b.log,tmp/c.tmp", "", "quit"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTUIModel(tuiFiles(), 10, false)
+			action := ""
+			for _, k := range tc.keys {
+				if action = m.key(k); action != "" {
+					break
+				}
+			}
+
+			if action != tc.action {
+				t.Errorf("expected action %q, got %q instead\n", tc.action, action)
+			}
+			if view := viewPaths(m); view != tc.view {
+				t.Errorf("expected view %q, got %q instead\n", tc.view, view)
+			}
+			files, _ := m.chosen()
+			var selected []string
+			for _, f := range files {
+				selected = append(selected, f.Path)
+			}
+			if res := strings.Join(selected, ","); res != tc.selected {
+				t.Errorf("expected selected %q, got %q instead\n", tc.selected, res)
+			}
+		})
+	}
+}
+
+func TestTUIRender(t *testing.T) {
+	m := newTUIModel(tuiFiles(), 4, true)
+	m.key(" ")
+
+	var b strings.Builder
+	m.render(&b)
+	screen := b.String()
+	for _, s := range []string{">[ ]          300  3h", "logs/b.log", "3/3 shown, 1 selected (10 bytes)", "r archive"} {
+		if !strings.Contains(screen, s) {
+			t.Errorf("expected %q on screen, got %q instead\n", s, screen)
+		}
+	}
+	// One row fits, the cursor scrolled to the second file
+	if strings.Contains(screen, "logs/a.log") {
+		t.Errorf("expected a single row, got %q instead\n", screen)
+	}
+
+	m.key("r")
+	b.Reset()
+	m.render(&b)
+	if expected := "Archive 1 files, 10 bytes? [y/N]"; !strings.Contains(b.String(), expected) {
+		t.Errorf("expected %q, got %q instead\n", expected, b.String())
+	}
+}
+
+func TestKeyName(t *testing.T) {
+	for seq, expected := range map[string]string{"\x1b[A": "up", "\r": "enter", "x": "x", "\x7f": "backspace"} {
+		if res := keyName([]byte(seq)); res != expected {
+			t.Errorf("expected %q, got %q instead\n", expected, res)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"testing"
+)
+
+func TestPrintVersion(t *testing.T) {
+	version, commit, date = "1.3.0", "abc123", "2024-01-02T03:04:05Z"
+	defer func() { version, commit, date = "", "", "" }()
+
+	var buffer bytes.Buffer
+	if err := printVersion(&buffer, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := "fss 1.3.0\ncommit: abc123\nbuilt: 2024-01-02T03:04:05Z\ngo: " + runtime.Version() + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+
+	buffer.Reset()
+	if err := printVersion(&buffer, true); err != nil {
+		t.Fatal(err)
+	}
+	var info buildInfo
+	if err := json.Unmarshal(buffer.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	exp := buildInfo{Version: "1.3.0", Commit: "abc123", Date: "2024-01-02T03:04:05Z", GoVersion: runtime.Version()}
+	if info != exp {
+		t.Errorf("expected %+v, got %+v instead\n", exp, info)
+	}
+}
+
+func TestReadBuildInfoFallback(t *testing.T) {
+	info := readBuildInfo()
+	if info.Version == "" || info.Commit == "" || info.Date == "" {
+		t.Errorf("expected all fields set, got %+v\n", info)
+	}
+}
@@ -0,0 +1,705 @@
+package fss
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// match is a file that passed the filters. It carries the FileInfo from
+// the walk so the actions don't need to stat the file again.
+type match struct {
+	path string
+	info os.FileInfo
+}
+
+// dirEntryInfo is the os.FileInfo used in no-stat mode. Only the name
+// and the type bits of the mode are known, there is no size or time.
+type dirEntryInfo struct {
+	d fs.DirEntry
+}
+
+func (i dirEntryInfo) Name() string       { return i.d.Name() }
+func (i dirEntryInfo) Size() int64        { return 0 }
+func (i dirEntryInfo) Mode() os.FileMode  { return i.d.Type() }
+func (i dirEntryInfo) ModTime() time.Time { return time.Time{} }
+func (i dirEntryInfo) IsDir() bool        { return i.d.IsDir() }
+func (i dirEntryInfo) Sys() interface{}   { return nil }
+
+// checkNoStat rejects options that need a file's size or times when
+// the walk runs without stat calls
+func checkNoStat(cfg Config) error {
+	switch {
+	case cfg.Size > 0:
+		return fmt.Errorf("-size %w", ErrNeedsStat)
+	case cfg.MaxFileSize > 0:
+		return fmt.Errorf("-max-file-size %w", ErrNeedsStat)
+	case cfg.Sort != "" && cfg.Sort != "path":
+		return fmt.Errorf("-sort %s %w", cfg.Sort, ErrNeedsStat)
+	case cfg.ReportHardlinkTrees:
+		return fmt.Errorf("-report-hardlink-trees %w", ErrNeedsStat)
+	case cfg.ReportDuplicateInodes:
+		return fmt.Errorf("-report-duplicate-inodes %w", ErrNeedsStat)
+	case cfg.ReportByOwner:
+		return fmt.Errorf("-by-owner %w", ErrNeedsStat)
+	case cfg.ReportFileAge:
+		return fmt.Errorf("-report-file-age %w", ErrNeedsStat)
+	case cfg.HardlinkDups:
+		return fmt.Errorf("-hardlink-dups %w", ErrNeedsStat)
+	case cfg.FilterCmd != "":
+		return fmt.Errorf("-filter-cmd %w", ErrNeedsStat)
+	case cfg.CNewer > 0:
+		return fmt.Errorf("-cnewer %w", ErrNeedsStat)
+	case cfg.COlder > 0:
+		return fmt.Errorf("-colder %w", ErrNeedsStat)
+	case cfg.ReplaceOld != "":
+		return fmt.Errorf("-replace-old %w", ErrNeedsStat)
+	case cfg.AppendSuffix != "":
+		return fmt.Errorf("-append-suffix %w", ErrNeedsStat)
+	case cfg.StripSuffix != "":
+		return fmt.Errorf("-strip-suffix %w", ErrNeedsStat)
+	case cfg.List:
+		return nil
+	case cfg.Del:
+		return fmt.Errorf("-del %w", ErrNeedsStat)
+	case cfg.Arc != "":
+		return fmt.Errorf("-arc %w", ErrNeedsStat)
+	}
+	return nil
+}
+
+func filterOut(path, ext string, minSize, maxSize int64, info os.FileInfo) bool {
+	if info.IsDir() || info.Size() < minSize {
+		return true
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		return true
+	}
+
+	if ext != "" && filepath.Ext(path) != ext {
+		return true
+	}
+	return false
+}
+
+// extSeen holds the extensions already matched in each directory
+type extSeen map[string]map[string]bool
+
+// first reports whether path is the first file with its extension in its
+// directory, and marks the extension as seen there
+func (s extSeen) first(path string) bool {
+	dir, ext := filepath.Dir(path), filepath.Ext(path)
+	if s[dir] == nil {
+		s[dir] = map[string]bool{}
+	}
+	if s[dir][ext] {
+		return false
+	}
+	s[dir][ext] = true
+	return true
+}
+
+func listFile(path string, out io.Writer) error {
+	_, err := fmt.Fprintln(out, path)
+	return err
+}
+
+// listFileAge writes the age of the file and its path, tab separated
+func listFileAge(path string, age time.Duration, out io.Writer) error {
+	_, err := fmt.Fprintf(out, "%s\t%s\n", HumanAge(age), path)
+	return err
+}
+
+// contentTypes caches the MIME type sniffed for each path during a run
+type contentTypes map[string]string
+
+// of returns the MIME type of the file at path detected from its first
+// 512 bytes
+func (c contentTypes) of(path string) (string, error) {
+	if typ, ok := c[path]; ok {
+		return typ, nil
+	}
+
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	typ := http.DetectContentType(buf[:n])
+	c[path] = typ
+	return typ, nil
+}
+
+// listContentType writes the MIME type of the file and its path, tab
+// separated
+func listContentType(path, typ string, out io.Writer) error {
+	_, err := fmt.Fprintf(out, "%s\t%s\n", typ, path)
+	return err
+}
+
+// ageUnits are the units of HumanAge, largest first
+var ageUnits = []struct {
+	d      time.Duration
+	suffix string
+}{
+	{24 * time.Hour, "d"},
+	{time.Hour, "h"},
+	{time.Minute, "m"},
+	{time.Second, "s"},
+}
+
+// HumanAge formats d with up to three units starting at the largest one
+// that isn't zero, like 2d 3h 14m or 5m 30s. Negative ages are
+// formatted as 0s.
+func HumanAge(d time.Duration) string {
+	i := 0
+	for i < len(ageUnits)-1 && d < ageUnits[i].d {
+		i++
+	}
+
+	var parts []string
+	for _, u := range ageUnits[i:] {
+		if len(parts) == 3 {
+			break
+		}
+		n := d / u.d
+		if n < 0 {
+			n = 0
+		}
+		parts = append(parts, fmt.Sprintf("%d%s", n, u.suffix))
+		d -= n * u.d
+	}
+	return strings.Join(parts, " ")
+}
+
+// hasPathPrefix reports whether path is prefix or lies under it, prefix
+// ending at a separator of path: /data is a prefix of /data/x but not of
+// /database/x
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, string(filepath.Separator)) ||
+		path[len(prefix)] == filepath.Separator
+}
+
+// stripPrefix removes prefix and any leading separator left after it from
+// path. Paths without the prefix are returned as they are, or with an
+// ErrNoPrefix error when strict is set. The prefix only matches whole
+// path elements, see hasPathPrefix.
+func stripPrefix(path, prefix string, strict bool) (string, error) {
+	if prefix == "" {
+		return path, nil
+	}
+	if !hasPathPrefix(path, prefix) {
+		if strict {
+			return "", fmt.Errorf("%q %w %q", path, ErrNoPrefix, prefix)
+		}
+		return path, nil
+	}
+	return strings.TrimLeft(strings.TrimPrefix(path, prefix), string(filepath.Separator)), nil
+}
+
+// replacePrefix substitutes r[1] for the prefix r[0] of path. Paths
+// without the prefix are returned as they are.
+func replacePrefix(path string, r [2]string) string {
+	if r[0] == "" || !strings.HasPrefix(path, r[0]) {
+		return path
+	}
+	return r[1] + strings.TrimPrefix(path, r[0])
+}
+
+// outputPath returns path as it's written in the listing, with the
+// symbolic links resolved and the prefix replaced and stripped as set in
+// cfg. A path that can't be resolved is written as it is after an
+// UNRESOLVED: label.
+func outputPath(path string, cfg Config) (string, error) {
+	label := ""
+	if cfg.ResolveSymlinks {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			path = real
+		} else {
+			label = "UNRESOLVED: "
+		}
+	}
+	name, err := stripPrefix(replacePrefix(path, cfg.ReplacePrefix), cfg.StripPrefix, cfg.StrictStrip)
+	return label + name, err
+}
+
+// listChecksum writes the checksum line in the sha256sum format
+func listChecksum(path, sum string, out io.Writer) error {
+	_, err := fmt.Fprintf(out, "%s  %s\n", sum, path)
+	return err
+}
+
+// reportBrokenUTF8 writes the hex encoded path when the file name is not valid UTF-8
+func reportBrokenUTF8(path string, out io.Writer) error {
+	if utf8.ValidString(filepath.Base(path)) {
+		return nil
+	}
+	_, err := fmt.Fprintf(out, "INVALID_UTF8: %s\n", hex.EncodeToString([]byte(path)))
+	return err
+}
+
+// hasUnusualChars reports whether name has a byte outside printable
+// ASCII, space aside: control characters such as tabs and newlines, DEL
+// and any non ASCII character
+func hasUnusualChars(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < ' ' || name[i] > '~' {
+			return true
+		}
+	}
+	return false
+}
+
+// reportUnusualChars writes the hex encoded path when the file name has
+// unusual characters
+func reportUnusualChars(path string, out io.Writer) error {
+	if !hasUnusualChars(filepath.Base(path)) {
+		return nil
+	}
+	_, err := fmt.Fprintf(out, "UNUSUAL: %s\n", hex.EncodeToString([]byte(path)))
+	return err
+}
+
+// writeListEntry writes a scanned file to the file list, matches prefixed with *
+func writeListEntry(w io.Writer, path string, matched bool) error {
+	prefix := ""
+	if matched {
+		prefix = "*"
+	}
+	_, err := fmt.Fprintf(w, "%s%s\n", prefix, path)
+	return err
+}
+
+// delFile removes the matched file with remove. It re-stats the file
+// right before removing it so a file replaced since the walk is never
+// deleted.
+func delFile(m match, remove func(string) error, delLogger *log.Logger) error {
+	cur, err := fsys.Lstat(m.path)
+	if err != nil {
+		return err
+	}
+	if !sameFile(m.info, cur) || cur.Size() != m.info.Size() ||
+		!cur.ModTime().Equal(m.info.ModTime()) {
+		return fmt.Errorf("%s %w, not deleting", m.path, ErrChanged)
+	}
+
+	if err := remove(m.path); err != nil {
+		return err
+	}
+	if delLogger != nil {
+		delLogger.Println(m.path)
+	}
+	return nil
+}
+
+// archiveStampName is the file holding the time of the last archive of
+// its directory with Config.TouchArchiveStamp
+const archiveStampName = ".last_archive"
+
+// writeArchiveStamps writes when, in RFC 3339, to the stamp file of each
+// of dirs, replacing the previous stamp
+func writeArchiveStamps(dirs map[string]bool, when time.Time) error {
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+	for _, dir := range sorted {
+		f, err := fsys.Create(filepath.Join(dir, archiveStampName), false)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, when.Format(time.RFC3339)+"\n")
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// actor archives and deletes the matches as set in its Config
+type actor struct {
+	ctx   context.Context
+	root  string
+	cfg   Config
+	level int
+	auto  bool
+	p     *pacer
+
+	// sink takes the archives of cfg.Arc, bundled or not
+	sink        ArchiveSink
+	bundle      *zipBundle
+	months      map[string]*zipBundle // bundles by month with SplitByMonth
+	levelLogger *log.Logger
+	delLogger   *log.Logger
+	pendLogger  *log.Logger
+	renLogger   *log.Logger
+	hookMu      sync.Mutex
+
+	// arcName names the archives, with the dates of runTime when they
+	// aren't the modification times. seq counts the archived files.
+	arcName   *arcNameTemplate
+	runTime   time.Time
+	seq       int
+	arcLogger *log.Logger
+
+	// stamps holds the directories with archived files, stamped on Close
+	stamps map[string]bool
+
+	// dels deletes the files on cfg.DeleteWorkers goroutines, nil to
+	// delete them one at a time in apply
+	dels     *deletePool
+	nDeleted int64
+	nFailed  int64
+}
+
+// newActor checks the archive settings and returns an actor sharing the
+// pacer p. Nothing is done to the matches with cfg.List set. The archives
+// are put to their sink with ctx.
+func newActor(ctx context.Context, root string, cfg Config, p *pacer) (*actor, error) {
+	level, auto, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	a := &actor{ctx: ctx, root: root, cfg: cfg, level: level, auto: auto, p: p}
+	if cfg.List {
+		return a, nil
+	}
+
+	if cfg.Arc != "" {
+		if a.arcName, err = checkArcName(cfg); err != nil {
+			return nil, err
+		}
+		if a.sink, err = openSink(cfg.Arc); err != nil {
+			return nil, err
+		}
+		// Archives are one gzip file per match unless they are bundled
+		switch {
+		case cfg.MaxArchiveFiles > 0 && cfg.SplitByMonth:
+			a.months = map[string]*zipBundle{}
+		case cfg.MaxArchiveFiles > 0:
+			a.bundle = a.newBundle("archive")
+		}
+		a.runTime = time.Now()
+		if cfg.TouchArchiveStamp {
+			a.stamps = map[string]bool{}
+		}
+		// Templated names can't be derived from the paths, they are logged
+		if a.arcName != nil && cfg.LogWriter != nil && !cfg.hooked() {
+			a.arcLogger = log.New(cfg.LogWriter, "ARCHIVED FILE: ", log.LstdFlags)
+		}
+	}
+	if cfg.Verbose && cfg.LogWriter != nil {
+		a.levelLogger = log.New(cfg.LogWriter, "ARCHIVE LEVEL: ", log.LstdFlags)
+	}
+	// Deletes are reported to OnAction instead of the log when it is set
+	prefix := "DELETED FILE: "
+	if cfg.XDGTrash {
+		prefix = "TRASHED FILE: "
+	}
+	if cfg.LogWriter != nil && !cfg.hooked() {
+		a.delLogger = log.New(cfg.LogWriter, prefix, log.LstdFlags)
+		a.pendLogger = log.New(cfg.LogWriter, "PENDING DELETE: ", log.LstdFlags)
+		a.renLogger = log.New(cfg.LogWriter, "RENAMED FILE: ", log.LstdFlags)
+	}
+	if cfg.Del && cfg.DeleteWorkers > 1 {
+		a.dels = newDeletePool(cfg.DeleteWorkers, a.remove, a.pending, func(m match, err error) error {
+			// The walk only sees the first error kept, the others are
+			// passed to OnError here
+			err = a.report(m, err)
+			if err != nil && cfg.OnError != nil && cfg.OnError(m.path, err) {
+				return nil
+			}
+			return err
+		})
+	}
+	return a, nil
+}
+
+// apply archives and then renames or deletes the file of m. It reports
+// whether the file is still there to be listed.
+func (a *actor) apply(m match) (bool, error) {
+	if a.cfg.List {
+		return true, nil
+	}
+
+	// Archive files and continue if successful
+	if a.cfg.Arc != "" {
+		a.p.wait()
+		level := a.level
+		if a.auto {
+			var err error
+			if level, err = autoLevel(m.path, m.info.Size()); err != nil {
+				return false, err
+			}
+		}
+		if a.levelLogger != nil {
+			a.levelLogger.Printf("%s %d", m.path, level)
+		}
+		var dest string
+		var err error
+		if b := a.bundleOf(m); b != nil {
+			if err = b.add(m, level); err == nil {
+				dest = sinkDest(a.cfg.Arc, b.relPath)
+			}
+		} else {
+			var rel string
+			if rel, err = a.archiveDest(m); err == nil {
+				dest = sinkDest(a.cfg.Arc, rel)
+				err = putArchive(a.ctx, a.sink, rel, m, level)
+			}
+		}
+		if err == nil && a.arcLogger != nil {
+			a.arcLogger.Printf("%s -> %s", m.path, dest)
+		}
+		a.done("archive", m, dest, err)
+		if err != nil {
+			return false, err
+		}
+		if a.stamps != nil {
+			a.stamps[filepath.Dir(m.path)] = true
+		}
+	}
+
+	// Renamed files aren't listed, their new name is logged
+	if a.cfg.AppendSuffix != "" || a.cfg.StripSuffix != "" {
+		dest, ok := renamedPath(m.path, a.cfg)
+		if !ok {
+			return false, nil
+		}
+		a.p.wait()
+		dest, err := renameFile(m, dest, a.cfg.RenameCollision)
+		if err == nil && a.renLogger != nil {
+			a.renLogger.Printf("%s -> %s", m.path, dest)
+		}
+		a.done("rename", m, dest, err)
+		return false, err
+	}
+
+	// Delete Files
+	if a.cfg.Del {
+		if a.dels != nil {
+			return false, a.dels.Submit(m)
+		}
+		return false, a.report(m, a.remove(m, func(dst string) { a.pending(m, dst) }))
+	}
+	return true, nil
+}
+
+// remove deletes or trashes the file of m, without logging it. pending is
+// called with the trashed copy of a file moved across filesystems, before
+// the file is removed.
+func (a *actor) remove(m match, pending func(dst string)) error {
+	a.p.wait()
+	if a.cfg.XDGTrash {
+		moved := func(src, dst string) { pending(dst) }
+		return delFile(m, func(path string) error { return trashFile(path, moved) }, nil)
+	}
+	return delFile(m, fsys.Remove, nil)
+}
+
+// report logs and counts the outcome of deleting the file of m. With a
+// delete pool it is only called from its reporting goroutine, one file at
+// a time, so the log lines are never interleaved.
+func (a *actor) report(m match, err error) error {
+	if err != nil {
+		atomic.AddInt64(&a.nFailed, 1)
+	} else {
+		atomic.AddInt64(&a.nDeleted, 1)
+		if a.delLogger != nil {
+			a.delLogger.Println(m.path)
+		}
+	}
+	action := "delete"
+	if a.cfg.XDGTrash {
+		action = "trash"
+	}
+	a.done(action, m, "", err)
+	return err
+}
+
+// pending logs the copy of a file moved across filesystems, before the
+// file itself is removed. With a delete pool it is only called from its
+// reporting goroutine, just before the report of the same file.
+func (a *actor) pending(m match, dst string) {
+	if a.pendLogger != nil {
+		a.pendLogger.Printf("%s -> %s (copied across filesystems)", m.path, dst)
+	}
+	a.done("copy", m, dst, nil)
+}
+
+// done passes the outcome of an action on the file of m to the hooks, if
+// set, one call at a time
+func (a *actor) done(action string, m match, dest string, err error) {
+	if a.cfg.hooked() {
+		a.hookMu.Lock()
+		defer a.hookMu.Unlock()
+		a.cfg.notify(Result{Path: m.path, Info: m.info, Action: action, Dest: dest, Err: err})
+	}
+}
+
+// deleteCounts returns the number of files deleted and failed so far
+func (a *actor) deleteCounts() (deleted, failed int64) {
+	return atomic.LoadInt64(&a.nDeleted), atomic.LoadInt64(&a.nFailed)
+}
+
+// Close waits for the pending deletes and finishes the bundled archive,
+// if any, then writes the archive stamps once the archives are done. It
+// can be called more than once.
+func (a *actor) Close() error {
+	var err error
+	if a.dels != nil {
+		err = a.dels.Wait()
+		a.dels = nil
+	}
+	if a.bundle != nil {
+		if cerr := a.bundle.Close(); err == nil {
+			err = cerr
+		}
+	}
+	for _, b := range a.months {
+		if cerr := b.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if a.sink != nil {
+		if cerr := a.sink.Close(); err == nil {
+			err = cerr
+		}
+		a.sink = nil
+	}
+	if a.stamps != nil && err == nil {
+		err = writeArchiveStamps(a.stamps, time.Now())
+		a.stamps = nil
+	}
+	return err
+}
+
+// archiveMonth is the YYYY-MM month of the modification time of info, the
+// bucket of the file with SplitByMonth
+func archiveMonth(info os.FileInfo) string {
+	return info.ModTime().Format("2006-01")
+}
+
+// newBundle returns the bundles called name of the matches, put to the
+// sink of the actor
+func (a *actor) newBundle(name string) *zipBundle {
+	return newZipBundle(a.ctx, a.sink, a.root, name, a.cfg.MaxArchiveFiles)
+}
+
+// bundleOf returns the bundle the file of m is archived to, nil when the
+// archives are one gzip file per match. With SplitByMonth each month gets
+// its own archive-YYYY-MM bundles.
+func (a *actor) bundleOf(m match) *zipBundle {
+	if a.months == nil {
+		return a.bundle
+	}
+	month := archiveMonth(m.info)
+	b, ok := a.months[month]
+	if !ok {
+		b = a.newBundle("archive-" + month)
+		a.months[month] = b
+	}
+	return b
+}
+
+// archivePath returns the slash separated path of the gzip file the file
+// at path is archived to, keeping its directory relative to root
+func archivePath(root, path string) (string, error) {
+	relDir, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(filepath.Join(relDir, filepath.Base(path)+".gz")), nil
+}
+
+// archiveDest returns the path of the gzip file the file of m is archived
+// to in the sink, named after the ArcName template when there is one.
+// With SplitByMonth it is under the YYYY-MM directory of the file.
+func (a *actor) archiveDest(m match) (string, error) {
+	var month string
+	if a.cfg.SplitByMonth {
+		month = archiveMonth(m.info)
+	}
+	if a.arcName == nil {
+		rel, err := archivePath(a.root, m.path)
+		return path.Join(month, rel), err
+	}
+	relDir, err := filepath.Rel(a.root, filepath.Dir(m.path))
+	if err != nil {
+		return "", err
+	}
+	when := m.info.ModTime()
+	if a.cfg.ArcNameTime == "run" {
+		when = a.runTime
+	}
+	a.seq++
+	name, err := a.arcName.expand(m.path, when, a.seq)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(month, filepath.ToSlash(relDir), name), nil
+}
+
+// checkArchiveDir makes sure the archive destination is a directory,
+// once per run rather than once per archived file
+func checkArchiveDir(desDir string) error {
+	info, err := fsys.Stat(desDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is %w", desDir, ErrNotDir)
+	}
+	return nil
+}
+
+// acrchiveFile archives the file of m to the directory desDir
+func acrchiveFile(desDir, root string, m match, level int) error {
+	rel, err := archivePath(root, m.path)
+	if err != nil {
+		return err
+	}
+	return putArchive(context.Background(), dirSink{dir: desDir}, rel, m, level)
+}
+
+// compressTo writes the file of m, read from in, to w as a gzip stream
+// with the level
+func compressTo(w io.Writer, in io.Reader, m match, level int) error {
+	zw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return err
+	}
+	zw.Name = filepath.Base(m.path)
+	zw.ModTime = m.info.ModTime()
+	if _, err = io.Copy(zw, in); err != nil {
+		return err
+	}
+	return zw.Close()
+}
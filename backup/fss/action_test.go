@@ -0,0 +1,206 @@
+package fss
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilterOut(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		ext      string
+		minSize  int64
+		maxSize  int64
+		expected bool
+	}{
+		{"FilterNoExtension", "testdata/dir.log", "", 0, 0, false},
+		{"FilterExtensionMatch", "testdata/dir.log", ".log", 0, 0, false},
+		{"FilterExtensionNoMatch", "testdata/dir.log", ".sh", 0, 0, true},
+		{"FinterExtensionSizeMatch", "testdata/dir.log", ".log", 10, 0, false},
+		{"FilterExtensionSizeNoMatch", "testdata/dir.log", ".log", 20, 0, true},
+		{"FilterMaxSizeMatch", "testdata/dir.log", ".log", 0, 20, false},
+		{"FilterMaxSizeNoMatch", "testdata/dir.log", ".log", 0, 10, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := os.Stat(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f := filterOut(tc.file, tc.ext, tc.minSize, tc.maxSize, info)
+			if f != tc.expected {
+				t.Errorf("expected '%t', got '%t' instead\n", tc.expected, f)
+			}
+		})
+	}
+}
+
+func TestHumanAge(t *testing.T) {
+	testCases := []struct {
+		name     string
+		age      time.Duration
+		expected string
+	}{
+		{"Days", 2*24*time.Hour + 3*time.Hour + 14*time.Minute + 50*time.Second, "2d 3h 14m"},
+		{"DaysRound", 24 * time.Hour, "1d 0h 0m"},
+		{"Hours", 5*time.Hour + 2*time.Minute + 9*time.Second, "5h 2m 9s"},
+		{"Minutes", 5*time.Minute + 30*time.Second + 400*time.Millisecond, "5m 30s"},
+		{"Seconds", 42 * time.Second, "42s"},
+		{"Zero", 0, "0s"},
+		{"Future", -time.Hour, "0s"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := HumanAge(tc.age); res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		prefix   string
+		strict   bool
+		expected string
+		expErr   error
+	}{
+		{"Match", "/data/logs/app.log", "/data/", false, "logs/app.log", nil},
+		{"MatchNoSeparator", "/data/logs/app.log", "/data", false, "logs/app.log", nil},
+		{"MatchStrict", "/data/logs/app.log", "/data/", true, "logs/app.log", nil},
+		{"NoMatch", "/var/logs/app.log", "/data/", false, "/var/logs/app.log", nil},
+		{"PartialElement", "/database/x", "/data", false, "/database/x", nil},
+		{"PartialElementStrict", "/database/x", "/data", true, "", ErrNoPrefix},
+		{"WholePath", "/data", "/data", false, "", nil},
+		{"NoMatchStrict", "/var/logs/app.log", "/data/", true, "", ErrNoPrefix},
+		{"NoPrefix", "/var/logs/app.log", "", true, "/var/logs/app.log", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := stripPrefix(tc.path, tc.prefix, tc.strict)
+			if !errors.Is(err, tc.expErr) {
+				t.Fatalf("expected error %v, got %v instead\n", tc.expErr, err)
+			}
+			if res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestReplacePrefix(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		replace  [2]string
+		expected string
+	}{
+		{"Match", "/data/app.log", [2]string{"/data", "/mnt"}, "/mnt/app.log"},
+		{"MultiComponent", "/mnt/backup/data/logs/app.log", [2]string{"/mnt/backup/data/", "/srv/archive/"}, "/srv/archive/logs/app.log"},
+		{"ToRelative", "/mnt/backup/logs/app.log", [2]string{"/mnt/backup/", ""}, "logs/app.log"},
+		{"NoMatch", "/var/logs/app.log", [2]string{"/mnt/backup/", "/srv/"}, "/var/logs/app.log"},
+		{"NoPrefix", "/var/logs/app.log", [2]string{"", "/srv/"}, "/var/logs/app.log"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := replacePrefix(tc.path, tc.replace)
+			if res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestReportBrokenUTF8(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"ValidASCII", "testdata/dir.log", ""},
+		{"ValidUnicode", "testdata/tệp.log", ""},
+		{"InvalidName", "testdata/\xffname.log", "INVALID_UTF8: 74657374646174612fff6e616d652e6c6f67\n"},
+		{"InvalidParentOnly", "test\xff/name.log", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := reportBrokenUTF8(tc.path, &buffer); err != nil {
+				t.Fatal(err)
+			}
+			if buffer.String() != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+func TestHasUnusualChars(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fileName string
+		expected bool
+	}{
+		{"Plain", "app-2024_01.log", false},
+		{"Space", "my notes.txt", false},
+		{"Punctuation", "a~b!c#.log", false},
+		{"Tab", "a\tb.log", true},
+		{"Newline", "a\nb.log", true},
+		{"Delete", "a\x7fb.log", true},
+		{"Unicode", "tệp.log", true},
+		{"Empty", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := hasUnusualChars(tc.fileName); got != tc.expected {
+				t.Errorf("expected %t, got %t instead\n", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDelFileChanged(t *testing.T) {
+	tempDir := t.TempDir()
+	fpath := filepath.Join(tempDir, "file.log")
+	if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// File grows between the scan and the delete
+	if err := os.WriteFile(fpath, []byte("dummy and more"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var logBuffer bytes.Buffer
+	delLogger := log.New(&logBuffer, "DELETED FILE: ", log.LstdFlags)
+	if err := delFile(match{path: fpath, info: info}, os.Remove, delLogger); !errors.Is(err, ErrChanged) {
+		t.Fatalf("expected error %q, got %v instead", ErrChanged, err)
+	}
+
+	if _, err := os.Stat(fpath); err != nil {
+		t.Errorf("expected changed file to be kept: %v\n", err)
+	}
+	if logBuffer.Len() != 0 {
+		t.Errorf("expected no log entry, got %q\n", logBuffer.String())
+	}
+}
@@ -0,0 +1,450 @@
+package fss
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// errNotTar is returned by openTarReader for the files that aren't tar
+// archives, compressed or not
+var errNotTar = errors.New("not a tar archive")
+
+// reportZipContents writes a line per entry of the zip file at path, at
+// most limit lines when limit is above 0. Files without the .zip
+// extension are skipped.
+func reportZipContents(path, name string, limit int, out io.Writer) error {
+	if !strings.EqualFold(filepath.Ext(path), ".zip") {
+		return nil
+	}
+	zr, c, err := openZip(path)
+	if err != nil {
+		_, err = fmt.Fprintf(out, "%s: %v\n", name, err)
+		return err
+	}
+	defer c.Close()
+
+	for i, f := range zr.File {
+		if limit > 0 && i == limit {
+			_, err := fmt.Fprintf(out, "%s: %d more entries\n", name, len(zr.File)-limit)
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "%s:%s (%d)\n", name, f.Name, f.UncompressedSize64); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openReaderAt opens the file at path for random access, as zip needs,
+// and returns its size. The closer releases the file.
+func openReaderAt(path string) (io.ReaderAt, int64, io.Closer, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	info, err := f.Stat()
+	r, ok := f.(io.ReaderAt)
+	if err == nil && !ok {
+		err = fmt.Errorf("%s: no random access to the file", path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, nil, err
+	}
+	return r, info.Size(), f, nil
+}
+
+// openZip opens the zip file at path, the closer releases it
+func openZip(path string) (*zip.Reader, io.Closer, error) {
+	r, size, c, err := openReaderAt(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	return zr, c, nil
+}
+
+// zip32 limits, an archive past them needs the Zip64 extensions
+const (
+	zip32MaxSize    = 0xFFFFFFFF
+	zip32MaxEntries = 0xFFFF
+)
+
+// zip64Locator is the signature of the Zip64 end of central directory
+// locator, right before the end of central directory record
+var zip64Locator = []byte("PK\x06\x07")
+
+// usesZip64 reports whether the zip file at path has an entry or more
+// entries than zip32 allows, or a Zip64 end of central directory written
+// by a tool using it for every archive
+func usesZip64(path string) (bool, error) {
+	zr, c, err := openZip(path)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	if len(zr.File) > zip32MaxEntries {
+		return true, nil
+	}
+	for _, f := range zr.File {
+		if f.CompressedSize64 > zip32MaxSize || f.UncompressedSize64 > zip32MaxSize {
+			return true, nil
+		}
+	}
+	return hasZip64Locator(path)
+}
+
+// hasZip64Locator looks for the Zip64 locator before the end of central
+// directory record, found in the last 64 KiB of the file with its
+// comment
+func hasZip64Locator(path string) (bool, error) {
+	r, size, c, err := openReaderAt(path)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	const eocdLen, locatorLen, maxComment = 22, 20, 0xFFFF
+	tailLen := int64(eocdLen + locatorLen + maxComment)
+	if tailLen > size {
+		tailLen = size
+	}
+	tail := make([]byte, tailLen)
+	if _, err := r.ReadAt(tail, size-tailLen); err != nil {
+		return false, err
+	}
+	i := bytes.LastIndex(tail, []byte("PK\x05\x06"))
+	return i >= locatorLen && bytes.Equal(tail[i-locatorLen:i-locatorLen+4], zip64Locator), nil
+}
+
+// reportZip64 labels the zip file at path ZIP64 or ZIP32. Files without
+// the .zip extension are skipped.
+func reportZip64(path, name string, out io.Writer) error {
+	if !strings.EqualFold(filepath.Ext(path), ".zip") {
+		return nil
+	}
+	zip64, err := usesZip64(path)
+	if err != nil {
+		_, err = fmt.Fprintf(out, "%s: %v\n", name, err)
+		return err
+	}
+	label := "ZIP32"
+	if zip64 {
+		label = "ZIP64"
+	}
+	_, err = fmt.Fprintf(out, "%s: %s\n", label, name)
+	return err
+}
+
+// reportPartialGzip labels PARTIAL_GZIP the gzip file at path that fails
+// to decompress to its end, like a copy cut short or a stream still being
+// written. Files without the .gz extension are skipped.
+func reportPartialGzip(path, name string, out io.Writer) error {
+	if !strings.EqualFold(filepath.Ext(path), ".gz") {
+		return nil
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err == nil {
+		_, err = io.Copy(io.Discard, zr)
+	}
+	if err == nil {
+		return nil
+	}
+	_, err = fmt.Fprintf(out, "PARTIAL_GZIP: %s\n", name)
+	return err
+}
+
+// closers closes its members in reverse order
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var err error
+	for i := len(c) - 1; i >= 0; i-- {
+		if cerr := c[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// openTarReader opens the tar archive at path, decompressing it when
+// its magic bytes are the ones of gzip, bzip2 or xz. The closer releases
+// the file and the decompressor. Files without the ustar magic of a tar
+// header once decompressed fail with errNotTar.
+func openTarReader(path string) (*tar.Reader, io.Closer, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	tr, c, err := newTarReader(f)
+	if errors.Is(err, errNotTar) {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return tr, closers{f, c}, nil
+}
+
+// newTarReader reads a tar archive from r like openTarReader, the closer
+// only releases the decompressor
+func newTarReader(r io.Reader) (*tar.Reader, io.Closer, error) {
+	var c closers
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(6)
+
+	r = br
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		r, c = zr, append(c, zr)
+	case bytes.HasPrefix(head, []byte("BZh")):
+		r = bzip2.NewReader(br)
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0}):
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		r = xr
+	}
+
+	tb := bufio.NewReaderSize(r, 512)
+	block, err := tb.Peek(512)
+	if err != nil || !bytes.Equal(block[257:262], []byte("ustar")) {
+		c.Close()
+		return nil, nil, errNotTar
+	}
+	return tar.NewReader(tb), c, nil
+}
+
+// reportTarContents writes a line per entry of the tar archive at path
+// with its size and mode. Files that aren't tar archives are skipped.
+func reportTarContents(path, name string, out io.Writer) error {
+	tr, c, err := openTarReader(path)
+	if errors.Is(err, errNotTar) {
+		return nil
+	}
+	if err != nil {
+		_, err = fmt.Fprintf(out, "%s: %v\n", name, err)
+		return err
+	}
+	defer c.Close()
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			_, err = fmt.Fprintf(out, "%s: %v\n", name, err)
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "%s:%s (%d, %s)\n",
+			name, hdr.Name, hdr.Size, hdr.FileInfo().Mode()); err != nil {
+			return err
+		}
+	}
+}
+
+// ArchiveSep separates the path of an archive from the path of a member in
+// the paths of ScanArchives
+const ArchiveSep = "!/"
+
+// maxNestedZip is the size of the largest zip inside another archive that
+// is scanned, they are read in memory as zip needs random access
+const maxNestedZip = 64 << 20
+
+// archiveKind returns "zip" or "tar" for the names of the archives walked
+// by ScanArchives, "" for the other files
+func archiveKind(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".tgz"),
+		strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tar.bz2"),
+		strings.HasSuffix(name, ".tbz2"), strings.HasSuffix(name, ".tar.xz"),
+		strings.HasSuffix(name, ".txz"):
+		return "tar"
+	}
+	return ""
+}
+
+// scanArchive calls fn with the path and stored details of each member of
+// the archive at path, going down depth levels of archives inside it. Tar
+// archives are streamed, nothing is extracted. Errors of fn are returned
+// as is.
+func scanArchive(path string, depth int, fn func(member string, info os.FileInfo) error) error {
+	switch archiveKind(path) {
+	case "zip":
+		zr, c, err := openZip(path)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return scanZip(path, zr, depth, fn)
+	case "tar":
+		f, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		tr, c, err := newTarReader(f)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return scanTar(path, tr, depth, fn)
+	}
+	return nil
+}
+
+func scanZip(name string, zr *zip.Reader, depth int, fn func(string, os.FileInfo) error) error {
+	for _, f := range zr.File {
+		member := name + ArchiveSep + f.Name
+		info := f.FileInfo()
+		if err := fn(member, info); err != nil {
+			return err
+		}
+		if depth == 0 || !info.Mode().IsRegular() || archiveKind(f.Name) == "" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = scanNested(member, rc, info.Size(), depth-1, fn)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanTar(name string, tr *tar.Reader, depth int, fn func(string, os.FileInfo) error) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		member := name + ArchiveSep + hdr.Name
+		info := hdr.FileInfo()
+		if err := fn(member, info); err != nil {
+			return err
+		}
+		if depth > 0 && info.Mode().IsRegular() && archiveKind(hdr.Name) != "" {
+			if err := scanNested(member, tr, hdr.Size, depth-1, fn); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// scanNested scans the members of the archive member read from r. Zip
+// files larger than maxNestedZip are not opened.
+func scanNested(member string, r io.Reader, size int64, depth int, fn func(string, os.FileInfo) error) error {
+	switch archiveKind(member) {
+	case "zip":
+		if size > maxNestedZip {
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", member, err)
+		}
+		return scanZip(member, zr, depth, fn)
+	case "tar":
+		tr, c, err := newTarReader(r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", member, err)
+		}
+		defer c.Close()
+		return scanTar(member, tr, depth, fn)
+	}
+	return nil
+}
+
+// checkScanArchives rejects the options ScanArchives can't apply to the
+// archive members: the actions, and the reports opening the files
+func checkScanArchives(cfg Config) error {
+	for _, o := range []struct {
+		set  bool
+		flag string
+	}{
+		{cfg.Del, "-del"},
+		{cfg.Arc != "", "-arc"},
+		{cfg.HardlinkDups, "-hardlink-dups"},
+		{cfg.Checksum, "-checksum"},
+		{cfg.ReportContentType, "-report-content-type"},
+		{cfg.ReportFSType, "-report-fs-type"},
+		{cfg.ReportGitStatus, "-report-git-status"},
+		{cfg.ReportJSONValidity, "-report-json-validity"},
+		{cfg.WC, "-wc"},
+		{cfg.ReportYAMLValidity, "-report-yaml-validity"},
+		{cfg.ReportTOMLValidity, "-report-toml-validity"},
+		{cfg.ReportCSVValidity, "-report-csv-validity"},
+		{cfg.ReportINIValidity, "-report-ini-validity"},
+		{cfg.ReportLineCount, "-report-line-count"},
+		{cfg.ReportWordCount, "-report-word-count"},
+		{cfg.ReportFirstLine, "-report-first-line"},
+		{cfg.ReportPkgType, "-report-pkg-type"},
+		{cfg.ReportFileSignature, "-report-file-signature"},
+		{cfg.ReportShebang, "-report-shebang"},
+		{cfg.ReportNullBytes, "-report-null-bytes"},
+		{cfg.ReportFileEncoding, "-report-file-encoding"},
+		{cfg.RequireEncoding != "", "-require-encoding"},
+		{cfg.MinEntropy > 0, "-min-entropy"},
+		{cfg.MaxEntropy > 0, "-max-entropy"},
+		{cfg.ReportEntropy, "-report-entropy"},
+		{cfg.ReportZipContents, "-report-zip-contents"},
+		{cfg.ReportTarContents, "-report-tar-contents"},
+		{cfg.ReportZip64, "-report-zip64"},
+		{cfg.ReportPartialGzip, "-report-partial-gzip"},
+		{cfg.GoBuildTag != "", "-go-build-tag"},
+		{cfg.ReplaceOld != "", "-replace-old"},
+		{cfg.Exec != "", "-exec"},
+		{cfg.ExecOnMatchDir != "", "-exec-on-match-dir"},
+		{cfg.AppendSuffix != "", "-append-suffix"},
+		{cfg.StripSuffix != "", "-strip-suffix"},
+		{cfg.CNewer > 0, "-cnewer"},
+		{cfg.COlder > 0, "-colder"},
+	} {
+		if o.set {
+			return fmt.Errorf("%s %w", o.flag, ErrArchiveMembers)
+		}
+	}
+	return nil
+}
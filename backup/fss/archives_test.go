@@ -0,0 +1,320 @@
+package fss
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeZip writes a zip file at path with the entries in order
+func writeZip(t *testing.T, path string, entries []string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, name := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("content of " + name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRunReportZip64 checks a zip with more entries than zip32 allows is
+// labeled ZIP64, with the Zip64 locator Go writes for it
+func TestRunReportZip64(t *testing.T) {
+	tempDir := t.TempDir()
+	writeZip(t, filepath.Join(tempDir, "small.zip"), []string{"a.txt", "docs/b.md"})
+	writeFiles(t, tempDir, map[string]string{
+		"broken.zip": "not a zip",
+		"notes.txt":  "dummy",
+	})
+
+	many := filepath.Join(tempDir, "many.zip")
+	f, err := os.Create(many)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for i := 0; i <= zip32MaxEntries; i++ {
+		if _, err := zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("%05d", i), Method: zip.Store}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{ReportZip64: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Join(tempDir, "broken.zip") + ": zip: not a valid zip file\n" +
+		"ZIP64: " + many + "\n" +
+		"ZIP32: " + filepath.Join(tempDir, "small.zip") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+
+	for path, exp := range map[string]bool{many: true, filepath.Join(tempDir, "small.zip"): false} {
+		if got, err := hasZip64Locator(path); err != nil || got != exp {
+			t.Errorf("expected a Zip64 locator %t in %s, got %t instead: %v\n", exp, path, got, err)
+		}
+	}
+}
+
+// TestRunReportPartialGzip checks the gzip fixture cut 10 bytes short, in
+// its trailer, and a file that isn't gzip are labeled, and the complete
+// gzip file is not
+func TestRunReportPartialGzip(t *testing.T) {
+	dir := filepath.Join("testdata", "fixtures", "gzip")
+	complete, err := os.ReadFile(filepath.Join(dir, "complete.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated, err := os.ReadFile(filepath.Join(dir, "truncated.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(complete)-len(truncated) != 10 || !bytes.HasPrefix(complete, truncated) {
+		t.Fatal("expected truncated.gz to be complete.gz without its last 10 bytes")
+	}
+
+	var buffer bytes.Buffer
+	if err := NewScanner(dir, Config{ReportPartialGzip: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "PARTIAL_GZIP: " + filepath.Join(dir, "plain.gz") + "\n" +
+		"PARTIAL_GZIP: " + filepath.Join(dir, "truncated.gz") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunReportZipContents lists the entries of the zip fixture, a.txt,
+// docs/b.md and docs/c.log each holding "content of " and its name, next
+// to a broken zip and a text file
+func TestRunReportZipContents(t *testing.T) {
+	dir := filepath.Join("testdata", "fixtures", "zip")
+	bundle := filepath.Join(dir, "bundle.zip")
+	broken := filepath.Join(dir, "broken.zip")
+
+	testCases := []struct {
+		name     string
+		limit    int
+		expected string
+	}{
+		{
+			name: "AllEntries",
+			expected: broken + ": zip: not a valid zip file\n" +
+				bundle + ":a.txt (16)\n" +
+				bundle + ":docs/b.md (20)\n" +
+				bundle + ":docs/c.log (21)\n",
+		},
+		{
+			name:  "Limit",
+			limit: 2,
+			expected: broken + ": zip: not a valid zip file\n" +
+				bundle + ":a.txt (16)\n" +
+				bundle + ":docs/b.md (20)\n" +
+				bundle + ": 1 more entries\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{List: true, ReportZipContents: true, ZipEntryLimit: tc.limit}
+			if err := NewScanner(dir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+// writeTar writes a tar file at path with the entries in order, through
+// compress when it's not nil
+func writeTar(t *testing.T, path string, entries []string, compress func(io.Writer) (io.WriteCloser, error)) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if compress != nil {
+		cw, err := compress(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := cw.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}()
+		w = cw
+	}
+	tw := tar.NewWriter(w)
+	for _, name := range entries {
+		content := "content of " + name
+		hdr := &tar.Header{Name: name, Mode: 0640, Size: int64(len(content))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRunReportTarContents lists the entries of the tar fixtures, plain,
+// gzip and xz compressed, each with a.txt and docs/b.md. The names don't
+// tell the compression, only the content does. A gzip file that isn't a
+// tar archive and a text file are skipped.
+func TestRunReportTarContents(t *testing.T) {
+	dir := filepath.Join("testdata", "fixtures", "tar")
+	var expected string
+	for _, name := range []string{"bundle-gz.tar", "bundle-xz.tar", "bundle.tar"} {
+		bundle := filepath.Join(dir, name)
+		expected += bundle + ":a.txt (16, -rw-r-----)\n" +
+			bundle + ":docs/b.md (20, -rw-r-----)\n"
+	}
+
+	var buffer bytes.Buffer
+	cfg := Config{List: true, ReportTarContents: true}
+	if err := NewScanner(dir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunScanArchives
+func TestRunScanArchives(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a.log":       "dummy",
+		"broken.tgz":  "not a tarball",
+		"corrupt.zip": "not a zip",
+	})
+	inner := filepath.Join(t.TempDir(), "inner.zip")
+	writeZip(t, inner, []string{"z.log"})
+	innerData, err := os.ReadFile(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := filepath.Join(tempDir, "bundle.zip")
+	f, err := os.Create(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, e := range []struct {
+		name string
+		data []byte
+	}{
+		{"x.log", []byte("content of x.log")},
+		{"docs/y.txt", []byte("y")},
+		{"inner.zip", innerData},
+	} {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	logs := filepath.Join(tempDir, "logs.tar.gz")
+	writeTar(t, logs, []string{"t.log", "big/u.log"}, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	})
+
+	warnings := "WARNING: skipping corrupt archive " + filepath.Join(tempDir, "broken.tgz") + ": not a tar archive\n"
+	corrupt := "WARNING: skipping corrupt archive " + filepath.Join(tempDir, "corrupt.zip") + ": zip: not a valid zip file\n"
+	testCases := []struct {
+		name     string
+		size     int64
+		depth    int
+		expected string
+	}{
+		{
+			name:  "Nested",
+			depth: 1,
+			expected: filepath.Join(tempDir, "a.log") + "\n" + warnings +
+				bundle + "!/x.log\n" +
+				bundle + "!/inner.zip!/z.log\n" +
+				corrupt +
+				logs + "!/t.log\n" +
+				logs + "!/big/u.log\n",
+		},
+		{
+			name: "NoNesting",
+			expected: filepath.Join(tempDir, "a.log") + "\n" + warnings +
+				bundle + "!/x.log\n" +
+				corrupt +
+				logs + "!/t.log\n" +
+				logs + "!/big/u.log\n",
+		},
+		{
+			name:  "Size",
+			size:  17,
+			depth: 1,
+			expected: warnings + corrupt +
+				logs + "!/big/u.log\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{List: true, Ext: ".log", Size: tc.size, ScanArchives: true, ArchiveDepth: tc.depth}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+
+	t.Run("Delete", func(t *testing.T) {
+		cfg := Config{Del: true, LogWriter: &bytes.Buffer{}, ScanArchives: true}
+		err := NewScanner(tempDir, cfg).Run(&bytes.Buffer{})
+		if !errors.Is(err, ErrArchiveMembers) {
+			t.Errorf("expected %v, got %v instead\n", ErrArchiveMembers, err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package fss
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultDateLayout is the layout of a {date} placeholder without one
+const defaultDateLayout = "2006-01-02"
+
+// arcNamePart is a literal piece of an archive name template, or one of
+// its placeholders
+type arcNamePart struct {
+	literal string
+	field   string // name, ext, date, hash8 or seq, empty for a literal
+	layout  string // time layout of date
+}
+
+// arcNameTemplate builds the names of the archived files from a template
+// with the placeholders {name}, the file name without its extension,
+// {ext}, the extension with its dot, {date:LAYOUT}, {hash8}, the first 8
+// hex digits of the SHA-256 of the file, and {seq}, the number of the
+// file in the run.
+type arcNameTemplate struct {
+	parts []arcNamePart
+}
+
+// parseArcName checks the template and splits it into its parts. The
+// names are given a .gz extension when the template doesn't end with it.
+func parseArcName(template string) (*arcNameTemplate, error) {
+	t := &arcNameTemplate{}
+	rest := template
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if close := strings.IndexByte(rest, '}'); close >= 0 && (open < 0 || close < open) {
+			return nil, fmt.Errorf("%w %q: unexpected }", ErrInvalidTemplate, template)
+		}
+		if open < 0 {
+			t.parts = append(t.parts, arcNamePart{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, arcNamePart{literal: rest[:open]})
+		}
+		close := strings.IndexByte(rest[open:], '}')
+		if close < 0 {
+			return nil, fmt.Errorf("%w %q: unclosed {", ErrInvalidTemplate, template)
+		}
+		field := rest[open+1 : open+close]
+		rest = rest[open+close+1:]
+
+		part := arcNamePart{field: field}
+		if strings.HasPrefix(field, "date") {
+			part.field, part.layout = "date", defaultDateLayout
+			if layout := strings.TrimPrefix(field, "date"); layout != "" {
+				if layout[0] != ':' || len(layout) == 1 {
+					return nil, fmt.Errorf("%w %q: unknown placeholder {%s}", ErrInvalidTemplate, template, field)
+				}
+				part.layout = layout[1:]
+			}
+		}
+		switch part.field {
+		case "name", "ext", "date", "hash8", "seq":
+		default:
+			return nil, fmt.Errorf("%w %q: unknown placeholder {%s}", ErrInvalidTemplate, template, field)
+		}
+		t.parts = append(t.parts, part)
+	}
+
+	// The names can't climb out of the directory of the file
+	if strings.ContainsAny(template, `/\`) {
+		return nil, fmt.Errorf("%w %q: names can't hold a path separator", ErrInvalidTemplate, template)
+	}
+	if len(t.parts) == 0 {
+		return nil, fmt.Errorf("%w: empty template", ErrInvalidTemplate)
+	}
+	if !strings.HasSuffix(template, ".gz") {
+		t.parts = append(t.parts, arcNamePart{literal: ".gz"})
+	}
+	return t, nil
+}
+
+// expand returns the archive name of the file at path, with its date
+// taken from when and seq its number in the run
+func (t *arcNameTemplate) expand(path string, when time.Time, seq int) (string, error) {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+
+	var sb strings.Builder
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			sb.WriteString(p.literal)
+		case "name":
+			sb.WriteString(strings.TrimSuffix(base, ext))
+		case "ext":
+			sb.WriteString(ext)
+		case "date":
+			sb.WriteString(when.Format(p.layout))
+		case "hash8":
+			sum, err := hashFile(path)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(sum[:8])
+		case "seq":
+			sb.WriteString(strconv.Itoa(seq))
+		}
+	}
+
+	name := sb.String()
+	if name == ".gz" {
+		return "", fmt.Errorf("%w: %s expands to %q", ErrInvalidTemplate, path, name)
+	}
+	return name, nil
+}
+
+// checkArcName parses the ArcName template of cfg, nil when it has none
+func checkArcName(cfg Config) (*arcNameTemplate, error) {
+	switch cfg.ArcNameTime {
+	case "", "mtime", "run":
+	default:
+		return nil, fmt.Errorf("%w: unknown date source %q, use mtime or run", ErrInvalidTemplate, cfg.ArcNameTime)
+	}
+	if cfg.ArcName == "" {
+		return nil, nil
+	}
+	if cfg.MaxArchiveFiles > 0 {
+		return nil, fmt.Errorf("%w: the bundles of -max-archive-files have their own names", ErrInvalidTemplate)
+	}
+	return parseArcName(cfg.ArcName)
+}
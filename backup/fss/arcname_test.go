@@ -0,0 +1,138 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArcName(t *testing.T) {
+	mtime := time.Date(2024, 3, 2, 10, 30, 0, 0, time.UTC)
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{"app.log": "dummy"}))
+	path := filepath.Join(tempDir, "app.log")
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+		expErr   bool
+	}{
+		{name: "Default", template: "{name}{ext}.gz", expected: "app.log.gz"},
+		{name: "Date", template: "{name}{ext}.{date:2006-01-02}.gz", expected: "app.log.2024-03-02.gz"},
+		{name: "DefaultDate", template: "{name}-{date}{ext}", expected: "app-2024-03-02.log.gz"},
+		{name: "Hash", template: "{hash8}-{name}{ext}.gz", expected: "b5a2c962-app.log.gz"},
+		{name: "Seq", template: "{seq}_{name}{ext}", expected: "7_app.log.gz"},
+		{name: "Literal", template: "archive", expected: "archive.gz"},
+		{name: "Unknown", template: "{size}.gz", expErr: true},
+		{name: "EmptyLayout", template: "{date:}.gz", expErr: true},
+		{name: "Unclosed", template: "{name.gz", expErr: true},
+		{name: "UnexpectedClose", template: "name}.gz", expErr: true},
+		{name: "Separator", template: "{date:2006/01}/{name}.gz", expErr: true},
+		{name: "Empty", template: "", expErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseArcName(tc.template)
+			if tc.expErr {
+				if !errors.Is(err, ErrInvalidTemplate) {
+					t.Fatalf("expected error %q, got %v instead\n", ErrInvalidTemplate, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			name, err := tmpl.expand(path, mtime, 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, name)
+			}
+		})
+	}
+}
+
+// TestRunArcName
+func TestRunArcName(t *testing.T) {
+	root := testsupport.Tree(t, map[string]testsupport.Spec{
+		"app.log":     {Content: "first"},
+		"sub/app.log": {Content: "second"},
+	})
+	mtime := time.Date(2024, 3, 2, 10, 30, 0, 0, time.Local)
+	for _, name := range []string{"app.log", "sub/app.log"} {
+		if err := os.Chtimes(filepath.Join(root, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	arcDir := t.TempDir()
+	var logBuffer bytes.Buffer
+	cfg := Config{Arc: arcDir, ArcName: "{name}{ext}.{date:2006-01-02}.{seq}.gz", LogWriter: &logBuffer}
+	if err := NewScanner(root, cfg).Run(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var archives []string
+	err := filepath.Walk(arcDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(arcDir, path)
+			archives = append(archives, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(archives)
+	expected := "app.log.2024-03-02.1.gz sub/app.log.2024-03-02.2.gz"
+	if res := strings.Join(archives, " "); res != expected {
+		t.Errorf("expected %q, got %q instead\n", expected, res)
+	}
+
+	// The log tells which archive holds each file
+	expLog := filepath.Join(root, "app.log") + " -> " + filepath.Join(arcDir, "app.log.2024-03-02.1.gz")
+	if !strings.Contains(logBuffer.String(), "ARCHIVED FILE: ") || !strings.Contains(logBuffer.String(), expLog) {
+		t.Errorf("expected %q in the log, got %q instead\n", expLog, logBuffer.String())
+	}
+
+	// Restores use the name kept in the gzip header
+	dest := t.TempDir()
+	var buffer bytes.Buffer
+	if err := Restore(arcDir, dest, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	expOut := filepath.Join(dest, "app.log") + "\n" + filepath.Join(dest, "sub", "app.log") + "\n"
+	if expOut != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expOut, buffer.String())
+	}
+}
+
+func TestRunArcNameInvalid(t *testing.T) {
+	root := testsupport.Tree(t, testsupport.Files(map[string]string{"app.log": "dummy"}))
+	testCases := []struct {
+		name string
+		cfg  Config
+	}{
+		{"Template", Config{ArcName: "{size}.gz"}},
+		{"Time", Config{ArcName: "{date}.gz", ArcNameTime: "ctime"}},
+		{"Bundle", Config{ArcName: "{name}.gz", MaxArchiveFiles: 10}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.Arc = t.TempDir()
+			err := NewScanner(root, tc.cfg).Run(&bytes.Buffer{})
+			if !errors.Is(err, ErrInvalidTemplate) {
+				t.Errorf("expected error %q, got %v instead\n", ErrInvalidTemplate, err)
+			}
+		})
+	}
+}
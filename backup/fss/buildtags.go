@@ -0,0 +1,85 @@
+package fss
+
+import (
+	"bufio"
+	"go/build/constraint"
+	"path/filepath"
+	"strings"
+)
+
+// parseGoBuildTags returns the tags named by the //go:build and // +build
+// lines of the Go source file at path, in order and without duplicates.
+// Only the comments before the package clause are read.
+func parseGoBuildTags(path string) ([]string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tags []string
+	seen := map[string]bool{}
+	var add func(x constraint.Expr)
+	add = func(x constraint.Expr) {
+		switch x := x.(type) {
+		case *constraint.TagExpr:
+			if !seen[x.Tag] {
+				seen[x.Tag] = true
+				tags = append(tags, x.Tag)
+			}
+		case *constraint.NotExpr:
+			add(x.X)
+		case *constraint.AndExpr:
+			add(x.X)
+			add(x.Y)
+		case *constraint.OrExpr:
+			add(x.X)
+			add(x.Y)
+		}
+	}
+
+	sc := bufio.NewScanner(f)
+	inBlock := false
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case inBlock:
+			inBlock = !strings.Contains(line, "*/")
+			continue
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "/*"):
+			inBlock = !strings.Contains(line[2:], "*/")
+			continue
+		case !strings.HasPrefix(line, "//"):
+			return tags, nil
+		}
+		if !constraint.IsGoBuild(line) && !constraint.IsPlusBuild(line) {
+			continue
+		}
+		x, err := constraint.Parse(line)
+		if err != nil {
+			return nil, err
+		}
+		add(x)
+	}
+	return tags, sc.Err()
+}
+
+// hasGoBuildTag reports whether path is a Go source file whose build
+// constraints name tag
+func hasGoBuildTag(path, tag string) (bool, error) {
+	if filepath.Ext(path) != ".go" {
+		return false, nil
+	}
+	tags, err := parseGoBuildTags(path)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tags {
+		if t == tag {
+			return true, nil
+		}
+	}
+	return false, nil
+}
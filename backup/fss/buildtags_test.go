@@ -0,0 +1,89 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// goFiles are Go sources with various build constraints
+var goFiles = map[string]string{
+	"gobuild.go":   "//go:build linux && (amd64 || arm64)\n\npackage a\n",
+	"plusbuild.go": "// Copyright notice\n\n// +build windows,!cgo darwin\n\npackage a\n",
+	"both.go":      "//go:build !linux\n// +build !linux\n\npackage a\n",
+	"none.go":      "// Package a does things\npackage a\n",
+	"late.go":      "package a\n\n//go:build linux\n",
+	"block.go":     "/* License\n   text */\n//go:build integration\n\npackage a\n",
+	"invalid.go":   "//go:build linux &&\n\npackage a\n",
+	"linux.txt":    "//go:build linux\n",
+}
+
+func TestParseGoBuildTags(t *testing.T) {
+	dir := testsupport.Tree(t, testsupport.Files(goFiles))
+
+	testCases := []struct {
+		file     string
+		expected string
+		expErr   bool
+	}{
+		{file: "gobuild.go", expected: "[linux amd64 arm64]"},
+		{file: "plusbuild.go", expected: "[windows cgo darwin]"},
+		{file: "both.go", expected: "[linux]"},
+		{file: "none.go", expected: "[]"},
+		{file: "late.go", expected: "[]"},
+		{file: "block.go", expected: "[integration]"},
+		{file: "invalid.go", expErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			tags, err := parseGoBuildTags(filepath.Join(dir, tc.file))
+			if (err != nil) != tc.expErr {
+				t.Fatalf("expected error %t, got %v instead\n", tc.expErr, err)
+			}
+			if res := fmt.Sprint(tags); !tc.expErr && res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunGoBuildTag
+func TestRunGoBuildTag(t *testing.T) {
+	files := map[string]string{}
+	for name, content := range goFiles {
+		if name != "invalid.go" {
+			files[name] = content
+		}
+	}
+	tempDir := testsupport.Tree(t, testsupport.Files(files))
+
+	testCases := []struct {
+		tag      string
+		expected []string
+	}{
+		{"linux", []string{"both.go", "gobuild.go"}},
+		{"cgo", []string{"plusbuild.go"}},
+		{"integration", []string{"block.go"}},
+		{"plan9", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{List: true, GoBuildTag: tc.tag}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			expected := ""
+			for _, name := range tc.expected {
+				expected += filepath.Join(tempDir, name) + "\n"
+			}
+			if expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+			}
+		})
+	}
+}
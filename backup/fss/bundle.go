@@ -0,0 +1,110 @@
+package fss
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// zipBundle archives the matched files into numbered zip files put to
+// sink, name.001.zip, name.002.zip and so on, with at most max files each.
+// Each zip is streamed to the sink as it is written.
+type zipBundle struct {
+	ctx  context.Context
+	sink ArchiveSink
+	root string
+	name string
+	max  int
+
+	seq     int
+	count   int
+	relPath string // of the current zip in the sink
+	pw      *io.PipeWriter
+	put     chan error
+	zw      *zip.Writer
+}
+
+func newZipBundle(ctx context.Context, sink ArchiveSink, root, name string, max int) *zipBundle {
+	return &zipBundle{ctx: ctx, sink: sink, root: root, name: name, max: max}
+}
+
+// add writes the file of m to the current archive with the gzip level,
+// starting the next archive when the current one is full
+func (b *zipBundle) add(m match, level int) error {
+	if b.zw == nil || b.count == b.max {
+		if err := b.next(); err != nil {
+			return err
+		}
+	}
+
+	name, err := filepath.Rel(b.root, m.path)
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(m.info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(name)
+	hdr.Method = zip.Deflate
+
+	// The compressor is looked up per entry, so each file gets its level
+	b.zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+	w, err := b.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	in, err := fsys.Open(m.path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	b.count++
+	return nil
+}
+
+// next closes the current archive and creates the next one
+func (b *zipBundle) next() error {
+	if err := b.Close(); err != nil {
+		return err
+	}
+	b.seq++
+	b.relPath = fmt.Sprintf("%s.%03d.zip", b.name, b.seq)
+	pr, pw := io.Pipe()
+	put := make(chan error, 1)
+	meta := FileMeta{Name: b.relPath, Size: -1, ModTime: time.Now(), Mode: 0644}
+	go func() {
+		err := b.sink.Put(b.ctx, b.relPath, pr, meta)
+		// Fails the writes left when the sink gave up before the end
+		pr.CloseWithError(io.ErrClosedPipe)
+		put <- err
+	}()
+	b.pw, b.put, b.zw, b.count = pw, put, zip.NewWriter(pw), 0
+	return nil
+}
+
+// Close finishes the current archive, if any, and waits for the sink to
+// take it
+func (b *zipBundle) Close() error {
+	if b.zw == nil {
+		return nil
+	}
+	zw, pw := b.zw, b.pw
+	b.zw, b.pw = nil, nil
+	err := zw.Close()
+	pw.CloseWithError(err)
+	if perr := <-b.put; perr != nil {
+		return perr
+	}
+	return err
+}
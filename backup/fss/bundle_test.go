@@ -0,0 +1,73 @@
+package fss
+
+import (
+	"archive/zip"
+	"bytes"
+	"clitools/fss/testsupport"
+	"io"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestRunMaxArchiveFiles checks 12 matches with a limit of 5 make 3 zips
+func TestRunMaxArchiveFiles(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 12, ".gz": 3}, "dummy"))
+	arcDir := t.TempDir()
+
+	var buffer bytes.Buffer
+	cfg := Config{Ext: ".log", Arc: arcDir, MaxArchiveFiles: 5}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	archives, err := filepath.Glob(filepath.Join(arcDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expArchives := []string{
+		filepath.Join(arcDir, "archive.001.zip"),
+		filepath.Join(arcDir, "archive.002.zip"),
+		filepath.Join(arcDir, "archive.003.zip"),
+	}
+	if len(archives) != len(expArchives) {
+		t.Fatalf("expected %v, got %v instead\n", expArchives, archives)
+	}
+
+	var names []string
+	for i, counts := range []int{5, 5, 2} {
+		if archives[i] != expArchives[i] {
+			t.Errorf("expected %q, got %q instead\n", expArchives[i], archives[i])
+		}
+		zr, err := zip.OpenReader(archives[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(zr.File) != counts {
+			t.Errorf("expected %d files in %s, got %d instead\n", counts, archives[i], len(zr.File))
+		}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "dummy" {
+				t.Errorf("expected %q in %s, got %q instead\n", "dummy", f.Name, data)
+			}
+			names = append(names, f.Name)
+		}
+		zr.Close()
+	}
+
+	sort.Strings(names)
+	for i := 1; i < len(names); i++ {
+		if names[i] == names[i-1] {
+			t.Errorf("file %s archived twice\n", names[i])
+		}
+	}
+}
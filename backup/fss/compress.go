@@ -0,0 +1,78 @@
+package fss
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// autoSpeedSize is the file size from which auto level uses BestSpeed
+	autoSpeedSize = 1 << 30
+	// autoSampleSize is how much of the file auto level test compresses
+	autoSampleSize = 64 << 10
+	// autoMinSaving is the smallest saving on the sample worth the default level
+	autoMinSaving = 0.1
+)
+
+// parseLevel parses the -level flag, either "auto" or a gzip level
+func parseLevel(s string) (level int, auto bool, err error) {
+	if s == "" {
+		return gzip.DefaultCompression, false, nil
+	}
+	if s == "auto" {
+		return gzip.DefaultCompression, true, nil
+	}
+
+	level, err = strconv.Atoi(s)
+	if err != nil || level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return 0, false, fmt.Errorf("%w %q: use auto or %d to %d", ErrInvalidLevel,
+			s, gzip.HuffmanOnly, gzip.BestCompression)
+	}
+	return level, false, nil
+}
+
+// chooseLevel picks the gzip level for a file of the given size from a
+// sample of its first bytes. Huge files and files that barely compress
+// use BestSpeed since the default level would cost a lot for little gain.
+func chooseLevel(size int64, sample []byte) int {
+	if size >= autoSpeedSize {
+		return gzip.BestSpeed
+	}
+	if len(sample) == 0 {
+		return gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(sample)
+	zw.Close()
+
+	saving := 1 - float64(buf.Len())/float64(len(sample))
+	if saving < autoMinSaving {
+		return gzip.BestSpeed
+	}
+	return gzip.DefaultCompression
+}
+
+// autoLevel samples the file at path and returns the level to use
+func autoLevel(path string, size int64) (int, error) {
+	if size >= autoSpeedSize {
+		return gzip.BestSpeed, nil
+	}
+
+	f, err := fsys.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sample := make([]byte, autoSampleSize)
+	n, err := io.ReadFull(f, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	return chooseLevel(size, sample[:n]), nil
+}
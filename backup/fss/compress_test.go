@@ -0,0 +1,152 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expLevel int
+		expAuto  bool
+		expErr   bool
+	}{
+		{"Unset", "", gzip.DefaultCompression, false, false},
+		{"Auto", "auto", gzip.DefaultCompression, true, false},
+		{"Best", "9", gzip.BestCompression, false, false},
+		{"HuffmanOnly", "-2", gzip.HuffmanOnly, false, false},
+		{"TooHigh", "10", 0, false, true},
+		{"NotANumber", "fast", 0, false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			level, auto, err := parseLevel(tc.value)
+			if tc.expErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if level != tc.expLevel || auto != tc.expAuto {
+				t.Errorf("expected %d/%t, got %d/%t instead\n", tc.expLevel, tc.expAuto, level, auto)
+			}
+		})
+	}
+}
+
+func TestChooseLevel(t *testing.T) {
+	random := make([]byte, autoSampleSize)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	text := []byte(strings.Repeat("2024-01-02 10:00:00 INFO request served\n", 2000))
+
+	testCases := []struct {
+		name     string
+		size     int64
+		sample   []byte
+		expected int
+	}{
+		{"SmallText", int64(len(text)), text, gzip.DefaultCompression},
+		{"EmptyFile", 0, nil, gzip.DefaultCompression},
+		{"RandomData", autoSampleSize, random, gzip.BestSpeed},
+		{"HugeText", autoSpeedSize, text, gzip.BestSpeed},
+		{"JustBelowHuge", autoSpeedSize - 1, text, gzip.DefaultCompression},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			level := chooseLevel(tc.size, tc.sample)
+			if level != tc.expected {
+				t.Errorf("expected level %d, got %d instead\n", tc.expected, level)
+			}
+		})
+	}
+}
+
+// TestRunArchiveAutoLevel
+func TestRunArchiveAutoLevel(t *testing.T) {
+	tempDir := t.TempDir()
+	arcDir := t.TempDir()
+
+	random := make([]byte, 4096)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"random.log": random,
+		"text.log":   []byte(strings.Repeat("INFO request served\n", 500)),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buffer, logBuffer bytes.Buffer
+	cfg := Config{Ext: ".log", Arc: arcDir, Level: "auto", Verbose: true, LogWriter: &logBuffer}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := logBuffer.String()
+	for _, exp := range []string{
+		filepath.Join(tempDir, "random.log") + " 1\n",
+		filepath.Join(tempDir, "text.log") + " -1\n",
+	} {
+		if !strings.Contains(logs, exp) {
+			t.Errorf("expected log to contain %q, got %q\n", exp, logs)
+		}
+	}
+}
+
+// TestRunArchiveLevels checks the archive written at level 9 is not
+// larger than the one at level 1
+func TestRunArchiveLevels(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&text, "%d INFO request %d served in %dms\n", i*7919%1000, i, i*31%97)
+	}
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{"app.log": text.String()}))
+
+	sizes := map[string]int64{}
+	for _, level := range []string{"1", "9"} {
+		arcDir := t.TempDir()
+		cfg := Config{Ext: ".log", Arc: arcDir, Level: level}
+		if err := NewScanner(tempDir, cfg).Run(io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(arcDir, "app.log.gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[level] = info.Size()
+	}
+	if sizes["9"] > sizes["1"] {
+		t.Errorf("expected level 9 to be at most %d bytes, got %d instead\n", sizes["1"], sizes["9"])
+	}
+}
+
+// TestRunArchiveInvalidLevel
+func TestRunArchiveInvalidLevel(t *testing.T) {
+	var buffer bytes.Buffer
+	err := NewScanner("testdata", Config{Level: "11"}).Run(&buffer)
+	if !errors.Is(err, ErrInvalidLevel) {
+		t.Errorf("expected error %q, got %v instead", ErrInvalidLevel, err)
+	}
+}
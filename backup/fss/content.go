@@ -0,0 +1,391 @@
+package fss
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// reportJSONValidity writes whether the file at path holds valid JSON
+func reportJSONValidity(path, name string, out io.Writer) error {
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	label := "VALID"
+	if !json.Valid(data) {
+		label = "INVALID"
+	}
+	_, err = fmt.Fprintf(out, "%s: %s\n", label, name)
+	return err
+}
+
+// reportYAMLValidity writes whether the file at path holds valid YAML,
+// with the parse error when it doesn't. Every document of the file is
+// parsed. Files without the .yml or .yaml extension are skipped.
+func reportYAMLValidity(path, name string, out io.Writer) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+	default:
+		return nil
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	for {
+		var doc interface{}
+		if err = dec.Decode(&doc); err != nil {
+			break
+		}
+	}
+	if err != io.EOF {
+		_, err = fmt.Fprintf(out, "INVALID: %s: %v\n", name, err)
+		return err
+	}
+	_, err = fmt.Fprintf(out, "VALID: %s\n", name)
+	return err
+}
+
+// reportTOMLValidity writes whether the file at path holds valid TOML,
+// with the parse error when it doesn't. Files without the .toml extension
+// are skipped.
+func reportTOMLValidity(path, name string, out io.Writer) error {
+	if !strings.EqualFold(filepath.Ext(path), ".toml") {
+		return nil
+	}
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		_, err = fmt.Fprintf(out, "INVALID: %s: %v\n", name, err)
+		return err
+	}
+	_, err = fmt.Fprintf(out, "VALID: %s\n", name)
+	return err
+}
+
+// reportCSVValidity writes whether the file at path holds valid CSV, with
+// the parse error and its line when it doesn't. Every row must have
+// columns fields, or as many as the first row when columns is 0. Files
+// without the .csv extension are skipped.
+func reportCSVValidity(path, name string, columns int, out io.Writer) error {
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		return nil
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = columns
+	r.ReuseRecord = true
+	for {
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			_, err = fmt.Fprintf(out, "INVALID: %s: %v: line %d\n", name, perr.Err, perr.Line)
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	_, err = fmt.Fprintf(out, "VALID: %s\n", name)
+	return err
+}
+
+// reportINIValidity writes whether the file at path holds valid INI. A
+// parse error is written as the parser words it, with the line at fault,
+// and a key set twice in a section with the section and the key. Files
+// without the .ini or .cfg extension are skipped.
+func reportINIValidity(path, name string, out io.Writer) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ini", ".cfg":
+	default:
+		return nil
+	}
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Shadows keep every value of a repeated key, duplicates included
+	opts := ini.LoadOptions{AllowShadows: true, AllowDuplicateShadowValues: true}
+	f, err := ini.LoadSources(opts, data)
+	if err != nil {
+		// The quoted line keeps its newline
+		_, err = fmt.Fprintf(out, "INVALID: %s: %s\n", name, strings.TrimSpace(err.Error()))
+		return err
+	}
+	for _, section := range f.Sections() {
+		for _, key := range section.Keys() {
+			if len(key.ValueWithShadows()) > 1 {
+				_, err = fmt.Fprintf(out, "INVALID: %s: section [%s]: duplicate key %q\n", name, section.Name(), key.Name())
+				return err
+			}
+		}
+	}
+	_, err = fmt.Fprintf(out, "VALID: %s\n", name)
+	return err
+}
+
+// maxLineLength is the longest line reportCounts can count
+const maxLineLength = 16 << 20
+
+// countText returns the number of lines read from r, a last line
+// without a newline included, and the number of words
+func countText(r io.Reader) (lines, words int64, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLineLength)
+	for sc.Scan() {
+		lines++
+		words += countWords(sc.Bytes())
+	}
+	return lines, words, sc.Err()
+}
+
+// countWords returns the number of space separated words of line
+func countWords(line []byte) int64 {
+	sc := bufio.NewScanner(bytes.NewReader(line))
+	sc.Buffer(make([]byte, 0, 64), maxLineLength)
+	sc.Split(bufio.ScanWords)
+	var n int64
+	for sc.Scan() {
+		n++
+	}
+	return n
+}
+
+// reportCounts writes the number of lines and or words of the file at
+// path and its name, tab separated like wc
+func reportCounts(path, name string, lines, words bool, out io.Writer) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	nl, nw, err := countText(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if lines {
+		if _, err := fmt.Fprintf(out, "%d\t", nl); err != nil {
+			return err
+		}
+	}
+	if words {
+		if _, err := fmt.Fprintf(out, "%d\t", nw); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(out, name)
+	return err
+}
+
+// firstLineLength is the number of characters of reportFirstLine
+const firstLineLength = 200
+
+// firstLine returns the first line read from r cut to firstLineLength
+// characters, (empty) for an empty line and (binary) for one with NUL
+// bytes or invalid UTF-8
+func firstLine(r io.Reader) (string, error) {
+	// A first line longer than the buffer is cut at its end
+	sc := bufio.NewScanner(io.LimitReader(r, 64*1024))
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return "", err
+		}
+		return "(empty)", nil
+	}
+
+	line := sc.Bytes()
+	switch {
+	case len(line) == 0:
+		return "(empty)", nil
+	case bytes.IndexByte(line, 0) >= 0:
+		return "(binary)", nil
+	}
+	if n := firstLineLength; utf8.RuneCount(line) > n {
+		i := 0
+		for ; n > 0; n-- {
+			_, size := utf8.DecodeRune(line[i:])
+			i += size
+		}
+		line = line[:i]
+	}
+	if !utf8.Valid(line) {
+		return "(binary)", nil
+	}
+	return string(line), nil
+}
+
+// reportFirstLine writes the first line of the file at path and its name,
+// tab separated
+func reportFirstLine(path, name string, out io.Writer) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := firstLine(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	_, err = fmt.Fprintf(out, "%s\t%s\n", line, name)
+	return err
+}
+
+// pkgTypes are the magic numbers of the executable formats of
+// reportPkgType, in the order they are checked
+var pkgTypes = []struct {
+	typ   string
+	magic []byte
+}{
+	{"ELF", []byte("\x7fELF")},
+	{"Mach-O", []byte("\xfe\xed\xfa")},
+	{"Mach-O", []byte("\xce\xfa\xed\xfe")},
+	{"Mach-O", []byte("\xcf\xfa\xed\xfe")},
+	{"PE", []byte("MZ")},
+	{"SCRIPT", []byte("#!")},
+}
+
+// pkgType returns the executable format of the head of a file, ELF, PE,
+// Mach-O or SCRIPT for the ones starting with #!, UNKNOWN for the others
+func pkgType(head []byte) string {
+	for _, t := range pkgTypes {
+		if bytes.HasPrefix(head, t.magic) {
+			return t.typ
+		}
+	}
+	return "UNKNOWN"
+}
+
+// reportPkgType writes the executable format of the file at path and its
+// name, tab separated
+func reportPkgType(path, name string, out io.Writer) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, 4)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	_, err = fmt.Fprintf(out, "%s\t%s\n", pkgType(head[:n]), name)
+	return err
+}
+
+// shebangLength is the number of bytes extractShebang reads
+const shebangLength = 80
+
+// extractShebang returns the interpreter of the #! line of the file at
+// path, "" when it has none. With env the program it runs is kept, like
+// "/usr/bin/env python3", flags of env left out.
+func extractShebang(path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, shebangLength)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+	if !bytes.HasPrefix(head, []byte("#!")) {
+		return "", nil
+	}
+	if i := bytes.IndexAny(head, "\r\n"); i >= 0 {
+		head = head[:i]
+	}
+
+	fields := strings.Fields(string(head[2:]))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	if filepath.Base(fields[0]) == "env" {
+		for _, arg := range fields[1:] {
+			if !strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") {
+				return fields[0] + " " + arg, nil
+			}
+		}
+	}
+	return fields[0], nil
+}
+
+// reportShebang writes the interpreter of the file at path and its name,
+// tab separated
+func reportShebang(path, name string, out io.Writer) error {
+	interp, err := extractShebang(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if interp == "" {
+		interp = "(no shebang)"
+	}
+	_, err = fmt.Fprintf(out, "%s\t%s\n", interp, name)
+	return err
+}
+
+// containsNullByte reports whether data holds a NUL byte, which text
+// files never do
+func containsNullByte(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// reportNullBytes writes name marked as BINARY if the file at path holds a
+// NUL byte in its first limit bytes, the whole file when limit is 0. Text
+// files are not written.
+func reportNullBytes(path, name string, limit int64, out io.Writer) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limit > 0 {
+		r = io.LimitReader(f, limit)
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if containsNullByte(buf[:n]) {
+			_, err = fmt.Fprintf(out, "BINARY: %s\n", name)
+			return err
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+}
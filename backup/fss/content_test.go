@@ -0,0 +1,422 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the files of name to content under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	testsupport.Build(t, dir, testsupport.Files(files))
+}
+
+// TestRunReportJSONValidity
+func TestRunReportJSONValidity(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"broken.json": `{"level": "info", "msg": `,
+		"good.json":   `{"level": "info", "msg": "started"}`,
+		"notes.txt":   `not json`,
+	})
+
+	var buffer bytes.Buffer
+	cfg := Config{List: true, Ext: ".json", ReportJSONValidity: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "INVALID: " + filepath.Join(tempDir, "broken.json") + "\n" +
+		"VALID: " + filepath.Join(tempDir, "good.json") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunReportYAMLValidity checks every document of the .yml and .yaml
+// fixtures is parsed, an error in the second document of second.yaml
+// included, and notes.txt, broken YAML too, is skipped
+func TestRunReportYAMLValidity(t *testing.T) {
+	dir := filepath.Join("testdata", "fixtures", "yaml")
+
+	var buffer bytes.Buffer
+	if err := NewScanner(dir, Config{ReportYAMLValidity: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "INVALID: " + filepath.Join(dir, "broken.yaml") + ": yaml: line 1: did not find expected ',' or ']'\n" +
+		"VALID: " + filepath.Join(dir, "empty.yml") + "\n" +
+		"VALID: " + filepath.Join(dir, "good.yml") + "\n" +
+		"INVALID: " + filepath.Join(dir, "second.yaml") + ": yaml: line 3: found unexpected end of stream\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunReportTOMLValidity checks a manifest like Cargo.toml is valid, a
+// broken table header and a duplicate key are not, and the other files
+// are skipped
+func TestRunReportTOMLValidity(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"Cargo.toml": "[package]\nname = \"fss\"\nversion = \"0.1.0\"\n\n" +
+			"[dependencies]\nserde = { version = \"1\", features = [\"derive\"] }\n",
+		"broken.toml": "[package\nname = \"fss\"\n",
+		"dupe.toml":   "name = \"a\"\nname = \"b\"\n",
+		"notes.txt":   "[not toml",
+	})
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{ReportTOMLValidity: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "VALID: " + filepath.Join(tempDir, "Cargo.toml") + "\n" +
+		"INVALID: " + filepath.Join(tempDir, "broken.toml") + ": toml: line 2: expected '.' or ']' to end table name, but got '\\n' instead\n" +
+		"INVALID: " + filepath.Join(tempDir, "dupe.toml") + ": toml: line 2 (last key \"name\"): Key 'name' has already been defined.\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunReportCSVValidity checks a bare quote and a row of another
+// width are reported with their line, the width being the one of the
+// first row or CSVColumnCount
+func TestRunReportCSVValidity(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"good.csv":   "id,name,size\n1,\"a, b\",10\n2,c,20\n",
+		"quote.csv":  "id,name\n1,a \"b\" c\n",
+		"ragged.csv": "id,name\n1,a\n2,b,extra\n",
+		"notes.txt":  "not,\"csv",
+	})
+	path := func(name string) string { return filepath.Join(tempDir, name) }
+
+	testCases := []struct {
+		name     string
+		columns  int
+		expected string
+	}{
+		{
+			name: "FirstRowWidth",
+			expected: "VALID: " + path("good.csv") + "\n" +
+				"INVALID: " + path("quote.csv") + ": bare \" in non-quoted-field: line 2\n" +
+				"INVALID: " + path("ragged.csv") + ": wrong number of fields: line 3\n",
+		},
+		{
+			name:    "ColumnCount",
+			columns: 3,
+			expected: "VALID: " + path("good.csv") + "\n" +
+				"INVALID: " + path("quote.csv") + ": wrong number of fields: line 1\n" +
+				"INVALID: " + path("ragged.csv") + ": wrong number of fields: line 1\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{ReportCSVValidity: true, CSVColumnCount: tc.columns}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunReportINIValidity checks a key set twice in a section is
+// reported with both, even with the same value, and so is an unclosed
+// section header
+func TestRunReportINIValidity(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"app.ini":      "; app settings\nname = fss\n\n[server]\nhost = localhost\nport = 8080\n\n[log]\nlevel = info\n",
+		"dupe.cfg":     "[server]\nhost = a\nport = 80\n\n[server]\nport = 80\n",
+		"unclosed.ini": "[server\nhost = a\n",
+		"notes.txt":    "[not ini",
+	})
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{ReportINIValidity: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "VALID: " + filepath.Join(tempDir, "app.ini") + "\n" +
+		"INVALID: " + filepath.Join(tempDir, "dupe.cfg") + ": section [server]: duplicate key \"port\"\n" +
+		"INVALID: " + filepath.Join(tempDir, "unclosed.ini") + ": unclosed section: [server\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunReportLineCount
+func TestRunReportLineCount(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"empty.log":   "",
+		"hundred.log": strings.Repeat("line\n", 100),
+		"huge.log":    strings.Repeat("line\n", 1000),
+		"one.log":     "no newline at the end",
+	})
+
+	var buffer bytes.Buffer
+	cfg := Config{List: true, MaxFileSize: 1000, ReportLineCount: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "0\t" + filepath.Join(tempDir, "empty.log") + "\n" +
+		"100\t" + filepath.Join(tempDir, "hundred.log") + "\n" +
+		"1\t" + filepath.Join(tempDir, "one.log") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunReportWordCount
+func TestRunReportWordCount(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"empty.md":  "",
+		"notes.md":  "one two  three\n\tfour\n\nfive six",
+		"spaces.md": "   \n  \n",
+	})
+	path := func(name string) string { return filepath.Join(tempDir, name) }
+
+	testCases := []struct {
+		name     string
+		lines    bool
+		expected string
+	}{
+		{"Words", false, "0\t" + path("empty.md") + "\n6\t" + path("notes.md") + "\n0\t" + path("spaces.md") + "\n"},
+		{"LinesAndWords", true, "0\t0\t" + path("empty.md") + "\n4\t6\t" + path("notes.md") + "\n" +
+			"2\t0\t" + path("spaces.md") + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{List: true, ReportWordCount: true, ReportLineCount: tc.lines}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	long := strings.Repeat("é", 250)
+	testCases := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{"Shebang", "#!/bin/sh\necho hello\n", "#!/bin/sh"},
+		{"NoNewline", "single line", "single line"},
+		{"CRLF", "first\r\nsecond\r\n", "first"},
+		{"Empty", "", "(empty)"},
+		{"EmptyLine", "\nsecond\n", "(empty)"},
+		{"NUL", "\x1f\x8b\x08\x00\x00", "(binary)"},
+		{"InvalidUTF8", "\xff\xfe log", "(binary)"},
+		{"Truncated", long + "\n", long[:2*firstLineLength]},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := firstLine(strings.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunReportFirstLine
+func TestRunReportFirstLine(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"app.log":   "2024-01-02 10:00:00 INFO started\n2024-01-02 10:00:01 INFO ready\n",
+		"deploy.sh": "#!/usr/bin/env bash\nset -e\n",
+	})
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{List: true, ReportFirstLine: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "2024-01-02 10:00:00 INFO started\t" + filepath.Join(tempDir, "app.log") + "\n" +
+		"#!/usr/bin/env bash\t" + filepath.Join(tempDir, "deploy.sh") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+func TestPkgType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		head     string
+		expected string
+	}{
+		{"ELF", "\x7fELF", "ELF"},
+		{"PE", "MZ\x90\x00", "PE"},
+		{"MachOBigEndian", "\xfe\xed\xfa\xcf", "Mach-O"},
+		{"MachOLittleEndian", "\xcf\xfa\xed\xfe", "Mach-O"},
+		{"Script", "#!/b", "SCRIPT"},
+		{"Text", "hell", "UNKNOWN"},
+		{"Short", "M", "UNKNOWN"},
+		{"Empty", "", "UNKNOWN"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := pkgType([]byte(tc.head)); res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestRunReportPkgType(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go tool is needed to build a binary")
+	}
+	src := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"go.mod":  "module hello\n\ngo 1.17\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}))
+	tempDir := t.TempDir()
+	build := exec.Command(goTool, "build", "-o", filepath.Join(tempDir, "hello"))
+	build.Dir = src
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	writeFiles(t, tempDir, map[string]string{
+		"notes.txt": "hello",
+		"run.sh":    "#!/bin/sh\n",
+	})
+
+	native := map[string]string{"linux": "ELF", "windows": "PE", "darwin": "Mach-O"}[runtime.GOOS]
+	if native == "" {
+		native = "ELF"
+	}
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{List: true, ReportPkgType: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := native + "\t" + filepath.Join(tempDir, "hello") + "\n" +
+		"UNKNOWN\t" + filepath.Join(tempDir, "notes.txt") + "\n" +
+		"SCRIPT\t" + filepath.Join(tempDir, "run.sh") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+func TestExtractShebang(t *testing.T) {
+	tempDir := t.TempDir()
+	testCases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"Bash", "#!/bin/bash\necho hi\n", "/bin/bash"},
+		{"Args", "#!/usr/bin/perl -w\n", "/usr/bin/perl"},
+		{"Space", "#! /bin/sh\n", "/bin/sh"},
+		{"Env", "#!/usr/bin/env python3\n", "/usr/bin/env python3"},
+		{"EnvFlags", "#!/usr/bin/env -S ruby --disable-gems\n", "/usr/bin/env ruby"},
+		{"CRLF", "#!/bin/sh\r\n", "/bin/sh"},
+		{"NoNewline", "#!/bin/sh", "/bin/sh"},
+		{"Empty", "", ""},
+		{"NoShebang", "echo hi\n#!/bin/sh\n", ""},
+		{"BareShebang", "#!\n", ""},
+		{"Long", "#!" + strings.Repeat("/x", 50) + "\n", strings.Repeat("/x", 39)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, tc.name)
+			writeFiles(t, tempDir, map[string]string{tc.name: tc.content})
+			res, err := extractShebang(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestRunReportShebang(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"build":     "#!/usr/bin/env python3\nprint('hi')\n",
+		"deploy.sh": "#!/bin/bash\nset -e\n",
+		"notes.txt": "hello\n",
+	})
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{List: true, ReportShebang: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "/usr/bin/env python3\t" + filepath.Join(tempDir, "build") + "\n" +
+		"/bin/bash\t" + filepath.Join(tempDir, "deploy.sh") + "\n" +
+		"(no shebang)\t" + filepath.Join(tempDir, "notes.txt") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+func TestContainsNullByte(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected bool
+	}{
+		{"Empty", "", false},
+		{"Text", "hello\nworld\n", false},
+		{"UTF8", "héllo\n", false},
+		{"Null", "ELF\x00\x01", true},
+		{"TrailingNull", "hello\x00", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := containsNullByte([]byte(tc.data)); res != tc.expected {
+				t.Errorf("expected %t, got %t instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunReportNullBytes
+func TestRunReportNullBytes(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"image.bin": "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"late.dat":  strings.Repeat("x", 100*1024) + "\x00",
+		"notes.txt": "hello\n",
+	})
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{List: true, ReportNullBytes: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "BINARY: " + filepath.Join(tempDir, "image.bin") + "\n" +
+		"BINARY: " + filepath.Join(tempDir, "late.dat") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
@@ -0,0 +1,39 @@
+package fss
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// checkCtime rejects the inode change time filters where the system
+// doesn't report them
+func checkCtime(cfg Config) error {
+	if ctimeSupported {
+		return nil
+	}
+	switch {
+	case cfg.CNewer > 0:
+		return fmt.Errorf("-cnewer %w", ErrNoCtime)
+	case cfg.COlder > 0:
+		return fmt.Errorf("-colder %w", ErrNoCtime)
+	}
+	return nil
+}
+
+// ctimeOut reports whether the inode of info changed outside the window
+// set by cfg.CNewer and cfg.COlder, relative to now
+func ctimeOut(cfg Config, info os.FileInfo, now time.Time) (bool, error) {
+	if cfg.CNewer <= 0 && cfg.COlder <= 0 {
+		return false, nil
+	}
+	ctime, err := fileCtime(info)
+	if err != nil {
+		return false, err
+	}
+	age := now.Sub(ctime)
+	if cfg.CNewer > 0 && age > cfg.CNewer {
+		return true, nil
+	}
+	return cfg.COlder > 0 && age < cfg.COlder, nil
+}
@@ -0,0 +1,21 @@
+//go:build linux || openbsd
+
+package fss
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+const ctimeSupported = true
+
+// fileCtime returns the inode change time of info
+func fileCtime(info os.FileInfo) (time.Time, error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s: %w", info.Name(), ErrNoCtime)
+	}
+	return time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec)), nil
+}
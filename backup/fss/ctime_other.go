@@ -0,0 +1,16 @@
+//go:build !linux && !openbsd && !darwin && !freebsd && !netbsd
+
+package fss
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Windows and the other systems have no inode change time
+const ctimeSupported = false
+
+func fileCtime(info os.FileInfo) (time.Time, error) {
+	return time.Time{}, fmt.Errorf("%s: %w", info.Name(), ErrNoCtime)
+}
@@ -0,0 +1,58 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRunCtime
+func TestRunCtime(t *testing.T) {
+	if !ctimeSupported {
+		t.Skip("no inode change times on this system")
+	}
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"chmoded.log":   "dummy",
+		"untouched.log": "dummy",
+	}))
+	// A chmod changes the inode only, the modification time stays
+	time.Sleep(600 * time.Millisecond)
+	if err := os.Chmod(filepath.Join(tempDir, "chmoded.log"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{"CNewer", Config{CNewer: 300 * time.Millisecond}, "chmoded.log"},
+		{"COlder", Config{COlder: 300 * time.Millisecond}, "untouched.log"},
+		{"Both", Config{CNewer: time.Hour, COlder: 300 * time.Millisecond}, "untouched.log"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			tc.cfg.List = true
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			expected := filepath.Join(tempDir, tc.expected) + "\n"
+			if expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+			}
+		})
+	}
+}
+
+func TestRunCtimeNoStat(t *testing.T) {
+	err := NewScanner(t.TempDir(), Config{List: true, NoStat: true, CNewer: time.Hour}).Run(&bytes.Buffer{})
+	if !errors.Is(err, ErrNeedsStat) {
+		t.Errorf("expected error %q, got %v instead\n", ErrNeedsStat, err)
+	}
+}
@@ -0,0 +1,179 @@
+package fss
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// dupeFinder collects the matched files by size, only files of the same
+// size are hashed to find duplicates
+type dupeFinder map[int64][]match
+
+func (d dupeFinder) add(m match) {
+	size := m.info.Size()
+	d[size] = append(d[size], m)
+}
+
+// groups returns the files with the same content, in walk order, for
+// every content found in more than one file. Paths already linked to an
+// earlier one are left out. With compare, files with the same sum are
+// also compared byte by byte, for hashes that can collide.
+func (d dupeFinder) groups(p *pacer, hash func(string) (string, error), compare bool) ([][]match, error) {
+	sizes := make([]int64, 0, len(d))
+	for size, files := range d {
+		if len(files) > 1 {
+			sizes = append(sizes, size)
+		}
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+
+	var groups [][]match
+	for _, size := range sizes {
+		var sums []string
+		bySum := map[string][]match{}
+		seen := map[inode]bool{}
+		for _, m := range d[size] {
+			if id, ok := fileID(m.info); ok {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+			p.wait()
+			sum, err := hash(m.path)
+			if err != nil {
+				return nil, err
+			}
+			if bySum[sum] == nil {
+				sums = append(sums, sum)
+			}
+			bySum[sum] = append(bySum[sum], m)
+		}
+		for _, sum := range sums {
+			same := [][]match{bySum[sum]}
+			if compare {
+				var err error
+				if same, err = splitByContent(bySum[sum]); err != nil {
+					return nil, err
+				}
+			}
+			for _, g := range same {
+				if len(g) > 1 {
+					groups = append(groups, g)
+				}
+			}
+		}
+	}
+	return groups, nil
+}
+
+// splitByContent splits files into groups of identical content, each in
+// the order of files
+func splitByContent(files []match) ([][]match, error) {
+	var groups [][]match
+	for _, m := range files {
+		found := false
+		for i, g := range groups {
+			same, err := sameContent(g[0].path, m.path)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				groups[i] = append(g, m)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []match{m})
+		}
+	}
+	return groups, nil
+}
+
+// sameContent reports whether the files at a and b hold the same bytes
+func sameContent(a, b string) (bool, error) {
+	fa, err := fsys.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := fsys.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA, bufB := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !endA {
+			return false, errA
+		}
+		if errB != nil && !endB {
+			return false, errB
+		}
+		if endA || endB {
+			return endA == endB, nil
+		}
+	}
+}
+
+// hardlinkDups replaces the duplicates of each group with hard links to
+// its first file. Duplicates of threshold bytes or less are only
+// reported.
+func hardlinkDups(groups [][]match, threshold int64, p *pacer, out io.Writer) error {
+	for _, g := range groups {
+		keep := g[0]
+		for _, m := range g[1:] {
+			if m.info.Size() <= threshold {
+				if _, err := fmt.Fprintf(out, "Duplicate %s of %s (%d bytes, below threshold)\n",
+					m.path, keep.path, m.info.Size()); err != nil {
+					return err
+				}
+				continue
+			}
+
+			p.wait()
+			if err := linkFile(keep.path, m); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(out, "Linked %s to %s (%d bytes)\n", m.path, keep.path, m.info.Size()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// linkFile replaces the file of m with a hard link to target. The link
+// is made next to the file and renamed over it, so the path always
+// exists. Like delFile, it refuses files changed since the walk.
+func linkFile(target string, m match) error {
+	cur, err := fsys.Lstat(m.path)
+	if err != nil {
+		return err
+	}
+	if !sameFile(m.info, cur) || cur.Size() != m.info.Size() ||
+		!cur.ModTime().Equal(m.info.ModTime()) {
+		return fmt.Errorf("%s %w, not linking", m.path, ErrChanged)
+	}
+
+	tmp := m.path + ".fss-link"
+	if err := fsys.Link(target, tmp); err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmp, m.path); err != nil {
+		fsys.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package fss
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunHardlinkDups
+func TestRunHardlinkDups(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"a/big.log":   "the same large content",
+		"b/big.log":   "the same large content",
+		"a/small.log": "tiny",
+		"b/small.log": "tiny",
+		"c/other.log": "the same large contenT",
+	}
+	for name, data := range files {
+		fpath := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fpath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(tempDir, name) }
+
+	var out bytes.Buffer
+	s := NewScanner(tempDir, Config{Ext: ".log", HardlinkDups: true, DedupeLinkThreshold: 10})
+	if err := s.Run(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"Duplicate " + path("b/small.log") + " of " + path("a/small.log") + " (4 bytes, below threshold)\n",
+		"Linked " + path("b/big.log") + " to " + path("a/big.log") + " (22 bytes)\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in output, got %q instead\n", line, out.String())
+		}
+	}
+
+	same := func(a, b string) bool {
+		ia, err := os.Stat(path(a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ib, err := os.Stat(path(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return os.SameFile(ia, ib)
+	}
+	if !same("a/big.log", "b/big.log") {
+		t.Errorf("expected %s to be linked\n", path("b/big.log"))
+	}
+	if same("a/small.log", "b/small.log") {
+		t.Errorf("expected %s to stay a separate copy\n", path("b/small.log"))
+	}
+	if same("a/big.log", "c/other.log") {
+		t.Errorf("expected %s with other content to stay a separate copy\n", path("c/other.log"))
+	}
+
+	// Linked files are not duplicates anymore
+	out.Reset()
+	if err := s.Run(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "Linked") {
+		t.Errorf("expected no new links, got %q instead\n", out.String())
+	}
+}
+
+func TestDupeGroupsCollision(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a.log": "aaaa",
+		"b.log": "bbbb",
+		"c.log": "aaaa",
+	})
+	d := dupeFinder{}
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		info, err := os.Lstat(filepath.Join(tempDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.add(match{path: filepath.Join(tempDir, name), info: info})
+	}
+	// Every file collides on the same sum
+	collide := func(string) (string, error) { return "0", nil }
+
+	testCases := []struct {
+		name     string
+		compare  bool
+		expected [][]string
+	}{
+		{"Trusted", false, [][]string{{"a.log", "b.log", "c.log"}}},
+		{"Compared", true, [][]string{{"a.log", "c.log"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, err := d.groups(newPacer(0), collide, tc.compare)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names [][]string
+			for _, g := range groups {
+				var ns []string
+				for _, m := range g {
+					ns = append(ns, filepath.Base(m.path))
+				}
+				names = append(names, ns)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected groups %v, got %v instead\n", tc.expected, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package fss
+
+import "sync"
+
+type delJob struct {
+	seq int
+	m   match
+}
+
+// delResult is the outcome of deleting a file, or with ack set a note
+// about it sent by its worker, which waits for ack to be closed
+type delResult struct {
+	seq  int
+	m    match
+	err  error
+	dest string
+	ack  chan struct{}
+}
+
+// deletePool deletes files on a fixed number of workers, for filesystems
+// where each unlink is a slow round trip. The outcomes are handed to
+// report one at a time, in the order the files were submitted, so the
+// delete log stays in walk order. The notes a worker makes while removing
+// a file go to note the same way, before its outcome, and the worker only
+// goes on once its note is handled. A failed file doesn't stop the
+// workers, the first error report returns is kept and stops the
+// submissions.
+type deletePool struct {
+	jobs     chan delJob
+	results  chan delResult
+	inflight chan struct{}
+	workers  sync.WaitGroup
+	done     chan struct{}
+	seq      int
+
+	mu  sync.Mutex
+	err error
+}
+
+func newDeletePool(workers int, remove func(m match, note func(dest string)) error,
+	note func(m match, dest string), report func(m match, err error) error) *deletePool {
+	if workers < 1 {
+		workers = 1
+	}
+	dp := &deletePool{
+		jobs:     make(chan delJob),
+		results:  make(chan delResult, workers),
+		inflight: make(chan struct{}, 2*workers),
+		done:     make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		dp.workers.Add(1)
+		go func() {
+			defer dp.workers.Done()
+			for j := range dp.jobs {
+				noted := func(dest string) {
+					ack := make(chan struct{})
+					dp.results <- delResult{seq: j.seq, m: j.m, dest: dest, ack: ack}
+					<-ack
+				}
+				dp.results <- delResult{seq: j.seq, m: j.m, err: remove(j.m, noted)}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(dp.done)
+		pending := map[int]delResult{}
+		next := 0
+		for r := range dp.results {
+			pending[r.seq] = r
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				if r.ack != nil {
+					// The outcome comes once the worker is let go
+					note(r.m, r.dest)
+					close(r.ack)
+					continue
+				}
+				next++
+
+				if err := report(r.m, r.err); err != nil {
+					dp.setErr(err)
+				}
+				<-dp.inflight
+			}
+		}
+	}()
+
+	return dp
+}
+
+func (dp *deletePool) setErr(err error) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	if dp.err == nil {
+		dp.err = err
+	}
+}
+
+func (dp *deletePool) failed() error {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	return dp.err
+}
+
+// Submit queues m for deletion, blocking while too many files are in
+// flight. It returns the first error kept so far so the walk can stop.
+func (dp *deletePool) Submit(m match) error {
+	if err := dp.failed(); err != nil {
+		return err
+	}
+	dp.inflight <- struct{}{}
+	dp.jobs <- delJob{seq: dp.seq, m: m}
+	dp.seq++
+	return nil
+}
+
+// Wait waits for every submitted file to be deleted and reported, and
+// returns the first error kept
+func (dp *deletePool) Wait() error {
+	close(dp.jobs)
+	dp.workers.Wait()
+	close(dp.results)
+	<-dp.done
+	return dp.failed()
+}
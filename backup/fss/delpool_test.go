@@ -0,0 +1,144 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunDeleteWorkers
+func TestRunDeleteWorkers(t *testing.T) {
+	testCases := []struct {
+		name    string
+		workers int
+	}{
+		{"Serial", 0},
+		{"OneWorker", 1},
+		{"Workers", 4},
+		{"ManyWorkers", 64},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 40, ".gz": 5}, "dummy"))
+			var listBuffer bytes.Buffer
+			if err := NewScanner(tempDir, Config{Ext: ".log", List: true}).Run(&listBuffer); err != nil {
+				t.Fatal(err)
+			}
+
+			var buffer, logBuffer bytes.Buffer
+			cfg := Config{Ext: ".log", Del: true, LogWriter: &logBuffer, DeleteWorkers: tc.workers, ReportTotals: true}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+
+			// The log lists the files in walk order, whatever worker deleted them
+			var logged strings.Builder
+			for _, line := range strings.Split(strings.TrimSpace(logBuffer.String()), "\n") {
+				fields := strings.Fields(line)
+				logged.WriteString(fields[len(fields)-1] + "\n")
+			}
+			if listBuffer.String() != logged.String() {
+				t.Errorf("expected %q, got %q instead\n", listBuffer.String(), logged.String())
+			}
+
+			expTotals := "Total files deleted: 40\nTotal deletes failed: 0\n"
+			if !strings.HasSuffix(buffer.String(), expTotals) {
+				t.Errorf("expected %q, got %q instead\n", expTotals, buffer.String())
+			}
+			filesLeft, err := ioutil.ReadDir(tempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(filesLeft) != 5 {
+				t.Errorf("expected 5 files left, got %d instead\n", len(filesLeft))
+			}
+		})
+	}
+}
+
+// TestRunDeleteWorkersFailure checks a file failing to delete doesn't stop
+// the other workers
+func TestRunDeleteWorkersFailure(t *testing.T) {
+	errDenied := errors.New("denied")
+	f := newFaultFS(fsys)
+	f.fail("lstat", "file7.log", errDenied)
+	f.fail("lstat", "file13.log", errDenied)
+	useFS(t, f)
+
+	testCases := []struct {
+		name      string
+		onError   bool
+		expErr    bool
+		expFailed int
+	}{
+		{name: "OnError", onError: true, expFailed: 2},
+		{name: "Stop", expErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 20}, "dummy"))
+			var buffer bytes.Buffer
+			var failed []string
+			cfg := Config{Ext: ".log", Del: true, DeleteWorkers: 4, ReportTotals: true}
+			if tc.onError {
+				// OnError is called from the single reporting goroutine
+				cfg.OnError = func(path string, err error) bool {
+					failed = append(failed, filepath.Base(path))
+					return errors.Is(err, errDenied)
+				}
+			}
+
+			err := NewScanner(tempDir, cfg).Run(&buffer)
+			if tc.expErr {
+				if !errors.Is(err, errDenied) {
+					t.Fatalf("expected error %q, got %v instead\n", errDenied, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expFailed := "file13.log file7.log"
+			if res := strings.Join(failed, " "); res != expFailed {
+				t.Errorf("expected %q, got %q instead\n", expFailed, res)
+			}
+			expTotals := fmt.Sprintf("Total files deleted: %d\nTotal deletes failed: %d\n", 20-tc.expFailed, tc.expFailed)
+			if !strings.HasSuffix(buffer.String(), expTotals) {
+				t.Errorf("expected %q, got %q instead\n", expTotals, buffer.String())
+			}
+			filesLeft, err := ioutil.ReadDir(tempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(filesLeft) != tc.expFailed {
+				t.Errorf("expected %d files left, got %d instead\n", tc.expFailed, len(filesLeft))
+			}
+		})
+	}
+}
+
+func BenchmarkDelete(b *testing.B) {
+	for _, workers := range []int{0, 4, 16} {
+		b.Run(fmt.Sprintf("Workers%d", workers), func(b *testing.B) {
+			root := b.TempDir()
+			cfg := Config{Ext: ".log", Del: true, DeleteWorkers: workers}
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dir := filepath.Join(root, fmt.Sprint(i))
+				testsupport.Build(b, dir, testsupport.Numbered(map[string]int{".log": 500}, "dummy"))
+				b.StartTimer()
+				if err := NewScanner(dir, cfg).Run(ioutil.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package fss
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// outputEncodings maps the -output-encoding names to their encodings
+var outputEncodings = map[string]encoding.Encoding{
+	"utf-16le": unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be": unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"latin-1":  charmap.ISO8859_1,
+}
+
+// nopCloser turns a plain writer into an io.WriteCloser
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// NewEncodedWriter wraps out so the UTF-8 written to it is converted to
+// the named encoding. Characters Latin-1 can't represent are replaced.
+// Close flushes any buffered output.
+func NewEncodedWriter(out io.Writer, name string) (io.WriteCloser, error) {
+	name = strings.ToLower(name)
+	if name == "" || name == "utf-8" || name == "utf8" {
+		return nopCloser{out}, nil
+	}
+
+	enc, ok := outputEncodings[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q: use utf-8, utf-16le, utf-16be or latin-1", ErrInvalidEncoding, name)
+	}
+	return transform.NewWriter(out, encoding.ReplaceUnsupported(enc.NewEncoder())), nil
+}
+
+// encodingSample is the number of bytes read to detect the encoding of a
+// file
+const encodingSample = 64 << 10
+
+// fileEncodings are the names detectEncoding returns, with their aliases
+var fileEncodings = map[string]string{
+	"ascii":        "ascii",
+	"us-ascii":     "ascii",
+	"utf-8":        "utf-8",
+	"utf8":         "utf-8",
+	"utf-16le":     "utf-16le",
+	"utf-16be":     "utf-16be",
+	"iso-8859-1":   "iso-8859-1",
+	"latin-1":      "iso-8859-1",
+	"latin1":       "iso-8859-1",
+	"windows-1252": "windows-1252",
+	"cp1252":       "windows-1252",
+}
+
+// parseFileEncoding returns the name detectEncoding uses for the encoding
+// name
+func parseFileEncoding(name string) (string, error) {
+	enc, ok := fileEncodings[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("%w %q: use ascii, utf-8, utf-16le, utf-16be, iso-8859-1 or windows-1252",
+			ErrInvalidEncoding, name)
+	}
+	return enc, nil
+}
+
+// detectEncoding guesses the encoding of the text in sample. A BOM tells
+// the UTF-16 and UTF-8 files apart, the others are ASCII or UTF-8 when
+// they are valid. The 8 bit encodings can't be told apart by their bytes
+// alone: text using the printable Windows-1252 characters of 0x80 to 0x9F
+// is Windows-1252, the rest Latin-1. With full set the sample is only the
+// start of the file, and a rune cut at its end is ignored.
+func detectEncoding(sample []byte, full bool) string {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xff, 0xfe}):
+		return "utf-16le"
+	case bytes.HasPrefix(sample, []byte{0xfe, 0xff}):
+		return "utf-16be"
+	case bytes.HasPrefix(sample, []byte{0xef, 0xbb, 0xbf}):
+		return "utf-8"
+	}
+
+	ascii, c1, undefined := true, false, false
+	for _, b := range sample {
+		switch {
+		case b >= 0x80 && b <= 0x9f:
+			c1 = true
+			undefined = undefined || b == 0x81 || b == 0x8d || b == 0x8f || b == 0x90 || b == 0x9d
+			ascii = false
+		case b >= 0x80:
+			ascii = false
+		}
+	}
+	if ascii {
+		return "ascii"
+	}
+
+	if full {
+		for i := 1; i < utf8.UTFMax && i <= len(sample); i++ {
+			if utf8.RuneStart(sample[len(sample)-i]) {
+				if !utf8.FullRune(sample[len(sample)-i:]) {
+					sample = sample[:len(sample)-i]
+				}
+				break
+			}
+		}
+	}
+	if utf8.Valid(sample) {
+		return "utf-8"
+	}
+	if c1 && !undefined {
+		return "windows-1252"
+	}
+	return "iso-8859-1"
+}
+
+// fileEncoding detects the encoding of the file at path from its first
+// encodingSample bytes
+func fileEncoding(path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, encodingSample)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return detectEncoding(buf[:n], n == len(buf)), nil
+}
+
+// reportFileEncoding writes the encoding detected for the file at path and
+// its name, tab separated
+func reportFileEncoding(path, name string, out io.Writer) error {
+	enc, err := fileEncoding(path)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\t%s\n", enc, name)
+	return err
+}
@@ -0,0 +1,152 @@
+package fss
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// TestRunOutputEncoding
+func TestRunOutputEncoding(t *testing.T) {
+	tempDir := t.TempDir()
+	name := filepath.Join(tempDir, "café_日本.log")
+	if err := os.WriteFile(name, []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected := name + "\n"
+
+	testCases := []struct {
+		name     string
+		encoding string
+		decode   func([]byte) ([]byte, error)
+		expected string
+	}{
+		{"Default", "", func(b []byte) ([]byte, error) { return b, nil }, expected},
+		{"UTF8", "utf-8", func(b []byte) ([]byte, error) { return b, nil }, expected},
+		{"UTF16LE", "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder().Bytes, expected},
+		{"UTF16BE", "UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder().Bytes, expected},
+		{"Latin1ReplacesUnsupported", "latin-1", charmap.ISO8859_1.NewDecoder().Bytes,
+			filepath.Join(tempDir, "café_\x1a\x1a.log") + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{Ext: ".log", OutputEncoding: tc.encoding}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := tc.decode(buffer.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != string(res) {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, string(res))
+			}
+		})
+	}
+}
+
+func TestRunOutputEncodingUTF16Bytes(t *testing.T) {
+	var buffer bytes.Buffer
+	cfg := Config{Ext: ".log", OutputEncoding: "utf-16le"}
+	if err := NewScanner("testdata", cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{}
+	for _, c := range []byte("testdata/dir.log\n") {
+		expected = append(expected, c, 0)
+	}
+	if !bytes.Equal(expected, buffer.Bytes()) {
+		t.Errorf("expected %v, got %v instead\n", expected, buffer.Bytes())
+	}
+}
+
+func TestRunOutputEncodingInvalid(t *testing.T) {
+	var buffer bytes.Buffer
+	err := NewScanner("testdata", Config{OutputEncoding: "ebcdic"}).Run(&buffer)
+	if !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("expected error %q, got %v instead\n", ErrInvalidEncoding, err)
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sample   string
+		full     bool
+		expected string
+	}{
+		{"Empty", "", false, "ascii"},
+		{"ASCII", "plain text\n", false, "ascii"},
+		{"UTF8", "café au lait\n", false, "utf-8"},
+		{"UTF8BOM", "\xef\xbb\xbfplain\n", false, "utf-8"},
+		{"UTF16LE", "\xff\xfep\x00", false, "utf-16le"},
+		{"UTF16BE", "\xfe\xff\x00p", false, "utf-16be"},
+		{"Latin1", "caf\xe9 au lait\n", false, "iso-8859-1"},
+		{"Windows1252", "\x93quoted\x94 caf\xe9\n", false, "windows-1252"},
+		{"C1Controls", "caf\xe9\x81\n", false, "iso-8859-1"},
+		{"CutRune", "caf\xc3", true, "utf-8"},
+		{"CutRuneWholeFile", "caf\xc3", false, "iso-8859-1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := detectEncoding([]byte(tc.sample), tc.full); res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunReportFileEncoding
+func TestRunReportFileEncoding(t *testing.T) {
+	tempDir := t.TempDir()
+	latin1, err := charmap.ISO8859_1.NewEncoder().String("Grüße aus Köln\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, tempDir, map[string]string{
+		"legacy.log": latin1,
+		"plain.log":  "hello\n",
+		"utf8.log":   "Grüße aus Köln\n",
+	})
+
+	testCases := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{"Report", Config{ReportFileEncoding: true}, "iso-8859-1\t" + filepath.Join(tempDir, "legacy.log") + "\n" +
+			"ascii\t" + filepath.Join(tempDir, "plain.log") + "\n" +
+			"utf-8\t" + filepath.Join(tempDir, "utf8.log") + "\n"},
+		{"Require", Config{RequireEncoding: "latin-1"}, filepath.Join(tempDir, "legacy.log") + "\n"},
+		{"RequireReport", Config{RequireEncoding: "UTF-8", ReportFileEncoding: true},
+			"utf-8\t" + filepath.Join(tempDir, "utf8.log") + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			tc.cfg.List = true
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+
+	err = NewScanner(tempDir, Config{List: true, RequireEncoding: "ebcdic"}).Run(&bytes.Buffer{})
+	if !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("expected error %q, got %v instead\n", ErrInvalidEncoding, err)
+	}
+}
@@ -0,0 +1,95 @@
+package fss
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// DefaultEntropyKiB is the number of KiB read from each file to estimate
+// its entropy when Config.EntropyKiB is 0
+const DefaultEntropyKiB = 64
+
+// shannonEntropy returns the Shannon entropy of data in bits per byte,
+// from 0 for a single repeated byte to 8 for uniformly random bytes. It
+// is 0 for no data.
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	n := float64(len(data))
+	var h float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// fileEntropy returns the entropy of the first kib KiB of the file at
+// path
+func fileEntropy(path string, kib int) (float64, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, kib<<10)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	return shannonEntropy(buf[:n]), nil
+}
+
+// entropies caches the entropy estimated for each path during a run, so
+// the files filtered on it aren't read again to be listed
+type entropies struct {
+	kib    int
+	byPath map[string]float64
+}
+
+func newEntropies(kib int) *entropies {
+	if kib == 0 {
+		kib = DefaultEntropyKiB
+	}
+	return &entropies{kib: kib, byPath: map[string]float64{}}
+}
+
+// of returns the entropy of the file at path
+func (e *entropies) of(path string) (float64, error) {
+	if h, ok := e.byPath[path]; ok {
+		return h, nil
+	}
+	h, err := fileEntropy(path, e.kib)
+	if err != nil {
+		return 0, err
+	}
+	e.byPath[path] = h
+	return h, nil
+}
+
+// forget drops the entropy of path once it is no longer needed
+func (e *entropies) forget(path string) {
+	delete(e.byPath, path)
+}
+
+// entropyOut reports whether the entropy h is outside the MinEntropy and
+// MaxEntropy bounds of cfg, a zero bound being unset
+func entropyOut(cfg Config, h float64) bool {
+	return cfg.MinEntropy > 0 && h < cfg.MinEntropy || cfg.MaxEntropy > 0 && h > cfg.MaxEntropy
+}
+
+// listEntropy writes the entropy of the file in bits per byte and its
+// path, tab separated
+func listEntropy(path string, h float64, out io.Writer) error {
+	_, err := fmt.Fprintf(out, "%.3f\t%s\n", h, path)
+	return err
+}
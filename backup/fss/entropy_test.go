@@ -0,0 +1,119 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"crypto/rand"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	random := make([]byte, 64<<10)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	every := make([]byte, 256)
+	for i := range every {
+		every[i] = byte(i)
+	}
+
+	testCases := []struct {
+		name   string
+		data   []byte
+		expMin float64
+		expMax float64
+	}{
+		{"Empty", nil, 0, 0},
+		{"Zeros", make([]byte, 4096), 0, 0},
+		{"TwoBytes", []byte("abababab"), 1, 1},
+		{"EveryByte", every, 8, 8},
+		{"ASCIIText", []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)), 3.5, 5},
+		{"Random", random, 7.99, 8},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := shannonEntropy(tc.data)
+			if h < tc.expMin-1e-9 || h > tc.expMax+1e-9 || math.IsNaN(h) {
+				t.Errorf("expected between %g and %g, got %g instead\n", tc.expMin, tc.expMax, h)
+			}
+		})
+	}
+}
+
+// TestRunEntropy checks the files are matched on the entropy of their
+// start, and a file that can't be read is skipped with a warning
+func TestRunEntropy(t *testing.T) {
+	random := make([]byte, 16<<10)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"zeros.bin": {Content: string(make([]byte, 4096))},
+		"notes.txt": {Content: strings.Repeat("some plain text notes\n", 50)},
+		// Random bytes after 1 KiB of zeros, only read with more than 1 KiB
+		"random.bin": {Content: string(make([]byte, 1024)) + string(random)},
+	})
+
+	testCases := []struct {
+		name     string
+		cfg      Config
+		expected []string
+	}{
+		{"MinEntropy", Config{MinEntropy: 7.5}, []string{"random.bin"}},
+		{"MaxEntropy", Config{MaxEntropy: 1}, []string{"zeros.bin"}},
+		{"Between", Config{MinEntropy: 1, MaxEntropy: 7.5}, []string{"notes.txt"}},
+		{"FirstKiBOnly", Config{MinEntropy: 7.5, EntropyKiB: 1}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, line := range strings.Fields(buffer.String()) {
+				got = append(got, filepath.Base(line))
+			}
+			if strings.Join(tc.expected, " ") != strings.Join(got, " ") {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, got)
+			}
+		})
+	}
+
+	t.Run("Report", func(t *testing.T) {
+		var buffer bytes.Buffer
+		cfg := Config{MaxEntropy: 7.5, ReportEntropy: true}
+		if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		expected := "3.538\t" + filepath.Join(tempDir, "notes.txt") + "\n0.000\t" + filepath.Join(tempDir, "zeros.bin") + "\n"
+		if expected != buffer.String() {
+			t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+		}
+	})
+
+	t.Run("Unreadable", func(t *testing.T) {
+		dir := testsupport.Tree(t, map[string]testsupport.Spec{
+			"zeros.bin":  {Content: string(make([]byte, 64))},
+			"broken.bin": {Symlink: "missing.bin"},
+		})
+		var buffer bytes.Buffer
+		if err := NewScanner(dir, Config{MaxEntropy: 1}).Run(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "WARNING: skipping "+filepath.Join(dir, "broken.bin")) ||
+			lines[1] != filepath.Join(dir, "zeros.bin") {
+			t.Errorf("expected a warning and zeros.bin, got %q instead\n", lines)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "broken.bin")); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
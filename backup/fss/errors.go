@@ -0,0 +1,31 @@
+package fss
+
+import "errors"
+
+// Errors returned by the Scanner. They are wrapped with the path or value
+// involved, check for them with errors.Is.
+var (
+	ErrNotDir           = errors.New("not a directory")
+	ErrChanged          = errors.New("changed since it was scanned")
+	ErrCopyMismatch     = errors.New("doesn't match its source")
+	ErrInvalidSort      = errors.New("invalid sort key")
+	ErrInvalidWalkOrder = errors.New("invalid walk order")
+	ErrInvalidLevel     = errors.New("invalid level")
+	ErrInvalidCollision = errors.New("invalid rename collision strategy")
+	ErrNeedsStat        = errors.New("needs file stats and can't be used with -no-stat")
+
+	ErrInvalidEncoding = errors.New("invalid output encoding")
+	ErrNoPrefix        = errors.New("doesn't start with the strip prefix")
+	ErrFilterCmd       = errors.New("filter command failed")
+	ErrNoExecCmd       = errors.New("needs a command")
+	ErrInvalidPlan     = errors.New("invalid plan")
+	ErrArchiveMembers  = errors.New("can't be used on the read only archive members of -scan-archives")
+	ErrInvalidTemplate = errors.New("invalid archive name template")
+	ErrNoCtime         = errors.New("inode change times are not supported on this system")
+	ErrSnapshot        = errors.New("can't be used on a snapshot, run it on the live tree")
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	ErrUnknownSink     = errors.New("no archive sink registered for the scheme")
+	ErrInvalidSample   = errors.New("invalid sample size")
+	ErrUnknownHash     = errors.New("unknown hash algorithm")
+	ErrHashMismatch    = errors.New("hashed with another algorithm")
+)
@@ -0,0 +1,46 @@
+package fss_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"clitools/fss"
+)
+
+func ExampleNew() {
+	s, err := fss.New("testdata", fss.WithExt(".log"), fss.WithList())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := s.Run(os.Stdout); err != nil {
+		fmt.Println(err)
+	}
+	// Output: testdata/dir.log
+}
+
+func ExampleNew_checksum() {
+	s, err := fss.New("testdata", fss.WithExt(".sh"), fss.WithChecksum(2))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := s.Run(os.Stdout); err != nil {
+		fmt.Println(err)
+	}
+	// Output: e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  testdata/dir2/script.sh
+}
+
+func ExampleConfigError() {
+	_, err := fss.New("testdata", fss.WithList(), fss.WithDelete(os.Stderr))
+
+	var cfgErr *fss.ConfigError
+	if errors.As(err, &cfgErr) {
+		fmt.Println(cfgErr.Option)
+	}
+	fmt.Println(err)
+	// Output:
+	// List
+	// invalid List: can't be combined with delete or archive
+}
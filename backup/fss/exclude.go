@@ -0,0 +1,123 @@
+package fss
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// parseExclude parses an exclude pattern with the rsync rules: a pattern
+// with a slash or ** is matched against the end of the path relative to
+// the root, one starting with a slash against the whole of it, and the
+// others against the name only. A trailing slash matches directories only.
+// An absolute path under root is excluded as that path.
+func parseExclude(pattern, root string) (ignoreRule, error) {
+	var rule ignoreRule
+	p := pattern
+	if strings.HasSuffix(p, "/") {
+		rule.dirOnly, p = true, strings.TrimRight(p, "/")
+	}
+	if root != "" && filepath.IsAbs(p) {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return rule, err
+		}
+		if rel, err := filepath.Rel(abs, p); err == nil && rel != "." && inside(filepath.Clean(p), abs) {
+			p = "/" + filepath.ToSlash(rel)
+		}
+	}
+	switch {
+	case strings.HasPrefix(p, "/"):
+		rule.anchored, p = true, strings.TrimLeft(p, "/")
+	case strings.Contains(p, "/") || strings.Contains(p, "**"):
+		rule.anchored, p = true, "**/"+p
+	}
+	if p == "" {
+		return rule, fmt.Errorf("invalid pattern %q", pattern)
+	}
+
+	rule.segs = strings.Split(p, "/")
+	for _, seg := range rule.segs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return rule, fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return rule, nil
+}
+
+// ReadExcludeFile returns the exclude patterns of file, one per line.
+// Blank lines and the comments starting with # or ; are skipped.
+func ReadExcludeFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if _, err := parseExclude(line, ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, sc.Err()
+}
+
+// mountExcludes are the directories skipped by ExcludeMounts and
+// ExcludeMountPrefixes, compared as absolute clean paths
+type mountExcludes struct {
+	wd       string // the directory the relative paths of the walk are under
+	exact    map[string]bool
+	prefixes []string
+}
+
+// newMountExcludes returns the mountExcludes of cfg, nil when it has none
+func newMountExcludes(cfg Config) (*mountExcludes, error) {
+	if len(cfg.ExcludeMounts) == 0 && len(cfg.ExcludeMountPrefixes) == 0 {
+		return nil, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	me := &mountExcludes{wd: wd, exact: map[string]bool{}}
+	for _, p := range cfg.ExcludeMounts {
+		me.exact[me.abs(p)] = true
+	}
+	for _, p := range cfg.ExcludeMountPrefixes {
+		me.prefixes = append(me.prefixes, me.abs(p))
+	}
+	return me, nil
+}
+
+func (me *mountExcludes) abs(p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(me.wd, p)
+}
+
+// excluded reports whether the directory dir is one of the exact paths,
+// or starts with one of the prefixes. The prefixes are plain string
+// prefixes, /mnt/backup- matching /mnt/backup-2024.
+func (me *mountExcludes) excluded(dir string) bool {
+	dir = me.abs(dir)
+	if me.exact[dir] {
+		return true
+	}
+	for _, prefix := range me.prefixes {
+		if strings.HasPrefix(dir, prefix) {
+			return true
+		}
+	}
+	return false
+}
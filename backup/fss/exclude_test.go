@@ -0,0 +1,209 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseExclude(t *testing.T) {
+	root := filepath.FromSlash("/srv/data")
+	testCases := []struct {
+		name     string
+		pattern  string
+		rel      string
+		isDir    bool
+		expected bool
+	}{
+		{"Name", "*.tmp", "a/b/c.tmp", false, true},
+		{"NameOther", "*.tmp", "a/b/c.log", false, false},
+		{"Anchored", "/cache", "cache", true, true},
+		{"AnchoredDeeper", "/cache", "a/cache", true, false},
+		{"Slash", "build/out", "a/build/out", true, true},
+		{"SlashTop", "build/out", "build/out", false, true},
+		{"SlashPrefixOnly", "build/out", "rebuild/out", false, false},
+		{"DirOnly", "cache/", "a/cache", true, true},
+		{"DirOnlyFile", "cache/", "a/cache", false, false},
+		{"DoubleStar", "logs/**", "logs/a/b.log", false, true},
+		{"AbsoluteUnderRoot", "/srv/data/keep", "keep", false, true},
+		{"AbsoluteUnderRootDeeper", "/srv/data/keep", "a/keep", false, false},
+		{"AbsoluteElsewhere", "/keep", "keep", false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := parseExclude(filepath.FromSlash(tc.pattern), root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := rule.match(tc.rel, tc.isDir); res != tc.expected {
+				t.Errorf("expected %t, got %t instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestReadExcludeFile(t *testing.T) {
+	dir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"exclude.txt": "# scratch files\n*.tmp\n\n; caches\n/cache/\r\nbuild/out\n",
+		"empty.txt":   "",
+		"bad.txt":     "*.tmp\n[a-\n",
+	}))
+
+	testCases := []struct {
+		name     string
+		file     string
+		expected string
+		expErr   string
+	}{
+		{name: "Patterns", file: "exclude.txt", expected: "[*.tmp /cache/ build/out]"},
+		{name: "Empty", file: "empty.txt", expected: "[]"},
+		{name: "Invalid", file: "bad.txt", expErr: filepath.Join(dir, "bad.txt") + `:2: invalid pattern "[a-"`},
+		{name: "Missing", file: "missing.txt",
+			expErr: "open " + filepath.Join(dir, "missing.txt") + ": no such file or directory"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			patterns, err := ReadExcludeFile(filepath.Join(dir, tc.file))
+			if tc.expErr != "" {
+				if err == nil || err.Error() != tc.expErr {
+					t.Errorf("expected %q, got %v instead\n", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := fmt.Sprint(patterns); res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunExclude
+func TestRunExclude(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		".fssignore":      "*.keep\n",
+		"a.log":           "dummy",
+		"b.tmp":           "dummy",
+		"c.keep":          "dummy",
+		"cache/d.log":     "dummy",
+		"sub/cache/e.log": "dummy",
+		"sub/f.log":       "dummy",
+	}))
+
+	testCases := []struct {
+		name     string
+		noIgnore bool
+		expected []string
+	}{
+		{name: "WithIgnoreFiles", expected: []string{"a.log", "sub/cache/e.log"}},
+		{name: "NoIgnore", noIgnore: true, expected: []string{".fssignore", "a.log", "c.keep", "sub/cache/e.log"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{List: true, NoIgnore: tc.noIgnore,
+				Exclude: []string{"*.tmp", "/cache/", filepath.Join(tempDir, "sub", "f.log")}}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			expected := ""
+			for _, p := range tc.expected {
+				expected += filepath.Join(tempDir, filepath.FromSlash(p)) + "\n"
+			}
+			if expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunExcludeMounts checks the excluded directories are not walked,
+// whether they are named exactly, by prefix or relative to the working
+// directory
+func TestRunExcludeMounts(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log":              "dummy",
+		"mnt/nfs/b.log":      "dummy",
+		"mnt/nfs2/c.log":     "dummy",
+		"mnt/backup-1/d.log": "dummy",
+		"mnt/backup-2/e.log": "dummy",
+		"mnt/f.log":          "dummy",
+	}))
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		exact    []string
+		prefixes []string
+		expected []string
+	}{
+		{
+			name:     "Exact",
+			exact:    []string{filepath.Join(tempDir, "mnt", "nfs") + string(filepath.Separator)},
+			expected: []string{"a.log", "mnt/backup-1/d.log", "mnt/backup-2/e.log", "mnt/f.log", "mnt/nfs2/c.log"},
+		},
+		{
+			name:     "Prefix",
+			prefixes: []string{filepath.Join(tempDir, "mnt", "backup-")},
+			expected: []string{"a.log", "mnt/f.log", "mnt/nfs/b.log", "mnt/nfs2/c.log"},
+		},
+		{
+			name:     "Relative",
+			exact:    []string{filepath.Join(rel, "mnt", "nfs2")},
+			prefixes: []string{filepath.Join(rel, "mnt", "nfs")},
+			expected: []string{"a.log", "mnt/backup-1/d.log", "mnt/backup-2/e.log", "mnt/f.log"},
+		},
+		{
+			name:     "Root",
+			exact:    []string{tempDir},
+			expected: []string{"a.log", "mnt/backup-1/d.log", "mnt/backup-2/e.log", "mnt/f.log", "mnt/nfs/b.log", "mnt/nfs2/c.log"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{List: true, Sort: "path", ExcludeMounts: tc.exact, ExcludeMountPrefixes: tc.prefixes}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			expected := ""
+			for _, p := range tc.expected {
+				expected += filepath.Join(tempDir, filepath.FromSlash(p)) + "\n"
+			}
+			if expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+			}
+		})
+	}
+}
+
+func TestCollectExclude(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log":       "dummy",
+		"cache/b.log": "dummy",
+	}))
+
+	files, err := NewScanner(tempDir, Config{Exclude: []string{"cache/"}}).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != filepath.Join(tempDir, "a.log") {
+		t.Errorf("expected only a.log, got %v instead\n", files)
+	}
+}
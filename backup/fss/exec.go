@@ -0,0 +1,202 @@
+package fss
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// maxExecParallel bounds Config.ExecParallel, so a large value can't
+// start a process per matched file at once
+const maxExecParallel = 64
+
+// execArgs returns the arguments running command on the file at path,
+// split on spaces like FilterCmd. Each {} in them stands for the path, the
+// path is appended when there is none.
+func execArgs(command, path string) ([]string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("-exec %w", ErrNoExecCmd)
+	}
+	found := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{}") {
+			args[i] = strings.ReplaceAll(arg, "{}", path)
+			found = true
+		}
+	}
+	if !found {
+		args = append(args, path)
+	}
+	return args, nil
+}
+
+// runExec runs command on the file of m and returns its stdout followed by
+// its stderr
+func runExec(command string, m match) ([]byte, error) {
+	args, err := execArgs(command, m.path)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		err = fmt.Errorf("-exec %s: %w", strings.Join(args, " "), err)
+		return append(stdout.Bytes(), stderr.Bytes()...), err
+	}
+	return append(stdout.Bytes(), stderr.Bytes()...), nil
+}
+
+// dirSet holds directories in the order they were first added
+type dirSet struct {
+	seen  map[string]bool
+	order []string
+}
+
+func newDirSet() *dirSet {
+	return &dirSet{seen: map[string]bool{}}
+}
+
+func (s *dirSet) add(dir string) {
+	if !s.seen[dir] {
+		s.seen[dir] = true
+		s.order = append(s.order, dir)
+	}
+}
+
+// execOnDirs runs command once on each of dirs, on parallel workers like
+// Exec, and writes the outputs to out in the order of dirs. The errors of
+// the commands go through skip.
+func execOnDirs(workers int, command string, dirs []string, out io.Writer, skip func(path string, err error) error) error {
+	pool := newExecPool(workers, command, func(m match, output []byte, err error) error {
+		if _, werr := out.Write(output); werr != nil {
+			return werr
+		}
+		return skip(m.path, err)
+	})
+	for _, dir := range dirs {
+		if err := pool.Submit(match{path: dir}); err != nil {
+			break
+		}
+	}
+	return pool.Wait()
+}
+
+type execJob struct {
+	seq int
+	m   match
+}
+
+type execResult struct {
+	seq    int
+	m      match
+	output []byte
+	err    error
+}
+
+// execPool runs the Config.Exec command on a fixed number of workers. The
+// output of each command is kept until the ones of the files submitted
+// before it are handed to report, so it comes out in walk order whatever
+// finished first. A failed command doesn't stop the workers, the first
+// error report returns is kept and stops the submissions.
+type execPool struct {
+	jobs     chan execJob
+	results  chan execResult
+	inflight chan struct{}
+	workers  sync.WaitGroup
+	done     chan struct{}
+	seq      int
+
+	mu  sync.Mutex
+	err error
+}
+
+func newExecPool(workers int, command string, report func(m match, output []byte, err error) error) *execPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > maxExecParallel {
+		workers = maxExecParallel
+	}
+	ep := &execPool{
+		jobs:     make(chan execJob),
+		results:  make(chan execResult, workers),
+		inflight: make(chan struct{}, 2*workers),
+		done:     make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		ep.workers.Add(1)
+		go func() {
+			defer ep.workers.Done()
+			for j := range ep.jobs {
+				output, err := runExec(command, j.m)
+				ep.results <- execResult{seq: j.seq, m: j.m, output: output, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(ep.done)
+		pending := map[int]execResult{}
+		next := 0
+		for r := range ep.results {
+			pending[r.seq] = r
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+
+				if err := report(r.m, r.output, r.err); err != nil {
+					ep.setErr(err)
+				}
+				<-ep.inflight
+			}
+		}
+	}()
+
+	return ep
+}
+
+func (ep *execPool) setErr(err error) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.err == nil {
+		ep.err = err
+	}
+}
+
+func (ep *execPool) failed() error {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return ep.err
+}
+
+// Submit queues m, blocking while too many files are in flight. It
+// returns the first error kept so far so the walk can stop.
+func (ep *execPool) Submit(m match) error {
+	if err := ep.failed(); err != nil {
+		return err
+	}
+	ep.inflight <- struct{}{}
+	ep.jobs <- execJob{seq: ep.seq, m: m}
+	ep.seq++
+	return nil
+}
+
+// Wait waits for every submitted command to finish and be reported, and
+// returns the first error kept
+func (ep *execPool) Wait() error {
+	close(ep.jobs)
+	ep.workers.Wait()
+	close(ep.results)
+	<-ep.done
+	return ep.failed()
+}
@@ -0,0 +1,178 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecHelper is the command of the exec tests. It sleeps for the
+// duration on the first line of the file given last, then prints the rest
+// of the file, or fails on the files with bad in their name.
+func TestExecHelper(t *testing.T) {
+	if os.Getenv("FSS_TEST_EXEC") == "" {
+		return
+	}
+
+	path := os.Args[len(os.Args)-1]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	lines := strings.SplitN(string(data), "\n", 2)
+	if d, err := time.ParseDuration(lines[0]); err == nil {
+		time.Sleep(d)
+	}
+	if strings.Contains(filepath.Base(path), "bad") {
+		fmt.Fprintf(os.Stderr, "can't process %s\n", filepath.Base(path))
+		os.Exit(1)
+	}
+	if len(lines) > 1 {
+		fmt.Print(lines[1])
+	}
+	os.Exit(0)
+}
+
+func execRun(t *testing.T, root string, cfg Config) (string, error) {
+	t.Setenv("FSS_TEST_EXEC", "1")
+	cfg.Exec = os.Args[0] + " -test.run=^TestExecHelper$"
+
+	var buffer bytes.Buffer
+	err := NewScanner(root, cfg).Run(&buffer)
+	return buffer.String(), err
+}
+
+func TestExecArgs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		command string
+		expArgs []string
+	}{
+		{"Appended", "gzip -t", []string{"gzip", "-t", "a b.log"}},
+		{"Placeholder", "cp {} /backup", []string{"cp", "a b.log", "/backup"}},
+		{"InArgument", "convert {} {}.png", []string{"convert", "a b.log", "a b.log.png"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args, err := execArgs(tc.command, "a b.log")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expArgs, args) {
+				t.Errorf("expected %q, got %q instead\n", tc.expArgs, args)
+			}
+		})
+	}
+
+	if _, err := execArgs("  ", "a b.log"); err == nil || !strings.Contains(err.Error(), ErrNoExecCmd.Error()) {
+		t.Errorf("expected error %q, got %v instead\n", ErrNoExecCmd, err)
+	}
+}
+
+// TestRunExecParallel checks the outputs come out in walk order, the first
+// files taking the longest to run
+func TestRunExecParallel(t *testing.T) {
+	files := map[string]string{}
+	var expOut strings.Builder
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("file%d.log", i)
+		files[name] = fmt.Sprintf("%dms\n%s\n", 200-20*i, name)
+		expOut.WriteString(name + "\n")
+	}
+	tempDir := testsupport.Tree(t, testsupport.Files(files))
+
+	elapsed := map[int]time.Duration{}
+	for _, parallel := range []int{1, 8} {
+		start := time.Now()
+		res, err := execRun(t, tempDir, Config{Ext: ".log", ExecParallel: parallel})
+		if err != nil {
+			t.Fatal(err)
+		}
+		elapsed[parallel] = time.Since(start)
+		if res != expOut.String() {
+			t.Errorf("expected %q, got %q instead\n", expOut.String(), res)
+		}
+	}
+
+	// Sequential runs sleep for 1.12s in total, parallel ones for 200ms
+	if elapsed[8] > elapsed[1]/2 {
+		t.Errorf("expected parallel commands to take less than %s, got %s instead\n", elapsed[1]/2, elapsed[8])
+	}
+}
+
+// TestRunExecFailure checks a failed command stops the scan, or is skipped
+// by OnError with the output of the other ones still in order
+func TestRunExecFailure(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log":   "50ms\na\n",
+		"bad.log": "0s\n",
+		"c.log":   "0s\nc\n",
+	}))
+
+	res, err := execRun(t, tempDir, Config{Ext: ".log", ExecParallel: 4})
+	if err == nil || !strings.Contains(res, "can't process bad.log") {
+		t.Errorf("expected the bad.log command to fail, got %v: %q instead\n", err, res)
+	}
+
+	var failed []string
+	cfg := Config{Ext: ".log", ExecParallel: 4, OnError: func(path string, err error) bool {
+		failed = append(failed, filepath.Base(path))
+		return true
+	}}
+	res, err = execRun(t, tempDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expOut := "a\ncan't process bad.log\nc\n"
+	if res != expOut {
+		t.Errorf("expected %q, got %q instead\n", expOut, res)
+	}
+	if exp := []string{"bad.log"}; !reflect.DeepEqual(exp, failed) {
+		t.Errorf("expected %q, got %q instead\n", exp, failed)
+	}
+}
+
+// TestRunExecOnMatchDir checks the command runs once on each directory
+// with matched files, in the order of their first match, whatever the
+// number of workers
+func TestRunExecOnMatchDir(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("the echo command is needed")
+	}
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log":       "dummy",
+		"b.log":       "dummy",
+		"docs/c.log":  "dummy",
+		"docs/d.log":  "dummy",
+		"docs/e.txt":  "dummy",
+		"other/f.txt": "dummy",
+		"src/g.log":   "dummy",
+	}))
+
+	for _, parallel := range []int{1, 4} {
+		var buffer bytes.Buffer
+		cfg := Config{Ext: ".log", List: true, ExecOnMatchDir: "echo dir: {}", ExecParallel: parallel}
+		if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		var dirs []string
+		for _, line := range strings.Split(buffer.String(), "\n") {
+			if strings.HasPrefix(line, "dir: ") {
+				dirs = append(dirs, strings.TrimPrefix(line, "dir: "))
+			}
+		}
+		expDirs := []string{tempDir, filepath.Join(tempDir, "docs"), filepath.Join(tempDir, "src")}
+		if !reflect.DeepEqual(expDirs, dirs) {
+			t.Errorf("%d workers: expected %q, got %q instead\n", parallel, expDirs, dirs)
+		}
+	}
+}
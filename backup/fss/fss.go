@@ -0,0 +1,986 @@
+// Package fss implements the scanning logic of the fss tool. A Scanner
+// walks a directory tree, filters the files by extension and size, and
+// lists, archives or deletes the matches as set in its Config.
+package fss
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Config holds the filters and actions of a scan
+type Config struct {
+	Ext           string    // filter by file extension
+	Size          int64     // filter by file minimum file size
+	MaxFileSize   int64     // skip files larger than this many bytes, 0 for no limit
+	List          bool      // listing files
+	Del           bool      // delete files
+	LogWriter     io.Writer `json:"-"` // write log
+	Build         string    `json:"-"` // version of the program, logged with a run summary when set
+	Arc           string    // archive directory
+	ArcName       string    // template of the archive names, {name}{ext}.gz if empty
+	ArcNameTime   string    // time of the {date} of ArcName: mtime of the file, or run
+	XDGTrash      bool      // move deleted files to the XDG trash instead of removing them
+	DeleteWorkers int       // files deleted concurrently, 0 or 1 to delete them one at a time
+	NoIgnore      bool      // don't read the .fssignore files
+	Exclude       []string  // skip the paths matching these rsync style patterns
+
+	ExcludeMounts        []string // skip the directories at these paths, like mount points
+	ExcludeMountPrefixes []string // skip the directories whose path starts with one of these
+
+	UniqueExtPerDir bool // match only the first file of each extension per directory
+	ExcludeSymlinks bool // skip the symbolic links instead of matching them as files
+
+	ReportBrokenUTF8 bool    // report file names with invalid UTF-8
+	Sort             string  // sort listed files by path, size or mtime
+	MaxInMemory      int     // buffered records kept in memory before spilling to disk
+	Pace             float64 // filesystem operations per second, 0 for no limit
+
+	ReportUnusualChars bool // report file names with characters outside printable ASCII, space aside
+
+	Debounce         time.Duration // batch window for filesystem events in Watch
+	Settle           time.Duration // quiet time before a watched file is handled
+	WatchInitialScan bool          // run a full scan when Watch starts
+
+	Level   string // gzip level for archives, a number or auto
+	Verbose bool   // log extra details about actions
+
+	WriteFileList string // write every scanned file to this file
+	NoStat        bool   // walk with directory entries only, no stat per file
+	FromSnapshot  bool   // Root is a file written by Snapshot, queried instead of the tree
+	WalkOrder     string // order of the walk: pre, post or breadth, pre if empty
+	ReportTotals  bool   // print totals of scanned files and directories
+
+	Checksum     bool   // list the checksums of matched files
+	Hash         string // hash algorithm of the checksums, dedupe and plans: sha256, sha1, md5 or xxh64, sha256 if empty
+	HashWorkers  int    // files hashed concurrently
+	XattrCache   bool   // cache the checksums in the user.fss.<hash> extended attribute
+	RefreshCache bool   // hash the files again with XattrCache, ignoring the cached checksums
+
+	ReportLargestDir  bool // report the directory with the most matched files
+	ReportLargestDirN int  // number of directories in the largest dir report
+
+	OutputEncoding string // encoding of the output: utf-8, utf-16le, utf-16be or latin-1
+
+	StripPrefix string // remove this prefix from the listed paths
+	StrictStrip bool   // skip listed paths that don't start with StripPrefix
+
+	ReplacePrefix [2]string // replace the prefix ReplacePrefix[0] of listed paths with ReplacePrefix[1]
+
+	ResolveSymlinks bool // list the real path of the matched files, with every symbolic link resolved
+
+	GroupByExt bool // list the matched paths grouped under their extension
+
+	SieveN   int    // list a sample of about SieveN files keeping the per directory proportions
+	Sample   string // list a uniform random sample of the matched files, N files or P% of them
+	RandSeed int64  // seed of the sample RNG
+
+	ReportHardlinkTrees   bool // report the matched paths sharing an inode
+	ReportDuplicateInodes bool // report the matched paths sharing an inode on one line each, HARDLINK_GROUP
+	ReportDuplicateNames  bool // report the file names matched in more than one directory
+	ReportIdenticalDirs   bool // report the directories whose matched files have the same names, sizes and times
+
+	ReportByOwner bool // report the number and size of the matched files per owner
+	BigDirs       int  // report the directories with more direct entries than this
+	ApparentSize  bool // count the size of every hard link of a file in the reports, not the first one only
+	HumanSizes    bool // print the sizes of the by owner and big dirs reports in human readable units
+	JSONReport    bool // write the by owner, big dirs and WC reports as one JSON object
+
+	MaxArchiveFiles int // bundle archived files into zip files of at most this many files
+
+	TouchArchiveStamp bool // write the archive time to a .last_archive file in each directory with archived files
+
+	SplitByMonth bool // archive the files in a YYYY-MM directory, or bundle, per month of their modification time
+
+	ReportFileAge bool // list the age of the matched files before their path
+
+	ReportContentType bool // list the MIME type sniffed from the content before the path
+
+	ReportFSType bool // list the type of the filesystem of the matched files before their path
+
+	ReportGitStatus bool // list the git status of the matched files before their path
+
+	ReportJSONValidity bool // label the matched files VALID or INVALID JSON
+	ReportYAMLValidity bool // label the matched .yml and .yaml files VALID or INVALID YAML
+	ReportTOMLValidity bool // label the matched .toml files VALID or INVALID TOML
+	ReportCSVValidity  bool // label the matched .csv files VALID or INVALID CSV
+	CSVColumnCount     int  // columns every CSV row must have, 0 for as many as the first row
+	ReportINIValidity  bool // label the matched .ini and .cfg files VALID or INVALID INI
+
+	WC        bool // list the newlines, words and bytes of the matched text files, with their totals
+	LinesOnly bool // count the newlines only with WC, by byte search
+
+	ReportLineCount bool // list the number of lines of the matched files before their path
+	ReportWordCount bool // list the number of words of the matched files before their path
+	ReportFirstLine bool // list the first line of the matched files before their path
+	ReportPkgType   bool // list the executable format of the matched files before their path
+	ReportShebang   bool // list the interpreter of the #! line of the matched files before their path
+	ReportNullBytes bool // list the matched files holding a NUL byte as binary
+
+	ReportFileSignature bool // list the matched files whose first bytes don't agree with their extension as MISMATCH
+
+	ReportFileEncoding bool   // list the text encoding detected for the matched files before their path
+	RequireEncoding    string // match only the files detected in this encoding
+
+	MinEntropy    float64 // match only the files with at least this entropy, in bits per byte, at their start
+	MaxEntropy    float64 // match only the files with at most this entropy, in bits per byte, at their start
+	EntropyKiB    int     // KiB read from the start of each file to estimate its entropy, DefaultEntropyKiB if 0
+	ReportEntropy bool    // list the entropy of the matched files before their path
+
+	ReportNumericNames bool // match only the files with digits only names, listed as NUMERIC
+
+	GoBuildTag string // match only the Go files with a build constraint naming this tag
+
+	ReplaceOld    string // replace this string in the matched text files
+	ReplaceNew    string // string replacing ReplaceOld
+	ReplaceDryRun bool   // show the replacements without writing the files
+	ReplaceCount  int    // replace at most this many times per file, 0 for no limit
+
+	Exec         string // command run on each matched file, {} standing for its path
+	ExecParallel int    // commands run at once, 1 if not set and at most 64
+
+	ExecOnMatchDir string // command run after the walk on each directory with matched files, {} standing for its path
+
+	AppendSuffix    string // rename the matched files adding this suffix to their name
+	StripSuffix     string // rename the matched files whose name ends with this suffix, removing it
+	RenameCollision string // when the new name is taken: error, number or overwrite, error if empty
+
+	CNewer time.Duration // match files whose inode changed less than this long ago
+	COlder time.Duration // match files whose inode changed more than this long ago
+
+	ScanArchives bool // match the members of the zip and tar archives too, listed as archive!/member
+	ArchiveDepth int  // levels of archives inside archives scanned with ScanArchives
+
+	ReportZipContents bool // list the entries of the matched zip files
+	ZipEntryLimit     int  // entries listed per zip file, 0 for all
+	ReportTarContents bool // list the entries of the matched tar archives, compressed or not
+	ReportZip64       bool // label the matched zip files ZIP64 or ZIP32
+	ReportPartialGzip bool // label the matched gzip files that don't decompress to their end
+
+	FilterCmd    string // external command accepting or rejecting the matched files
+	FilterCmdNUL bool   // end the records of FilterCmd with NUL bytes instead of newlines
+
+	HardlinkDups        bool  // replace matched files with the same content by hard links
+	DedupeLinkThreshold int64 // only link duplicates larger than this many bytes
+
+	// Hooks for library use, each one optional. They are called
+	// synchronously from the goroutine running the scan, so they must not
+	// block for long, and need their own locking if they share state with
+	// other goroutines.
+	//
+	// OnMatch is called for each file that passed the filters, before any
+	// action. Returning false skips the file.
+	//
+	// OnAction is called after each action with its outcome: "archive"
+	// with the archive written to, "delete", or "trash" with XDGTrash,
+	// "rename" with the new name, and "list" with the listed name for the
+	// plain listing. A file trashed to another filesystem is first
+	// reported as "copy" with its verified copy, before it is removed.
+	// When it is set, the listing and the delete and rename logs are left
+	// to the hook instead of being written out.
+	//
+	// OnError is called with errors about a path, from the walk or the
+	// actions. Returning true skips the path and goes on with the scan.
+	OnMatch  func(path string, info os.FileInfo) bool   `json:"-"`
+	OnAction func(action, path, dest string, err error) `json:"-"`
+	OnError  func(path string, err error) bool          `json:"-"`
+
+	// onResult receives the outcomes with the file stats, set by Scan
+	onResult func(Result)
+	// gitCmd runs git for ReportGitStatus, split on spaces, "git" if empty
+	gitCmd string
+}
+
+// Scanner scans the tree under Root with the given Config
+type Scanner struct {
+	Root   string
+	Config Config
+}
+
+// NewScanner returns a Scanner for the tree under root
+func NewScanner(root string, cfg Config) *Scanner {
+	return &Scanner{Root: root, Config: cfg}
+}
+
+// Run walks the tree, applies the filters and actions, and writes the
+// listing and reports to out. A nil out discards them.
+func (s *Scanner) Run(out io.Writer) error {
+	return s.RunContext(context.Background(), out)
+}
+
+// RunContext is Run stopping the walk at the next entry once ctx is done,
+// with ctx.Err(). The actions already started are finished first.
+func (s *Scanner) RunContext(ctx context.Context, out io.Writer) error {
+	if out == nil {
+		out = io.Discard
+	}
+	enc, err := NewEncodedWriter(out, s.Config.OutputEncoding)
+	if err != nil {
+		return err
+	}
+	if err := s.run(ctx, enc, nil); err != nil {
+		enc.Close()
+		return err
+	}
+	return enc.Close()
+}
+
+// run scans the tree counting the scanned entries into tot, if not nil.
+// The walk stops with ctx.Err() once ctx is done.
+func (s *Scanner) run(ctx context.Context, out io.Writer, tot *scanTotals) error {
+	root, cfg := s.Root, s.Config
+	if tot == nil {
+		tot = &scanTotals{}
+	}
+
+	if _, _, err := parseLevel(cfg.Level); err != nil {
+		return err
+	}
+	if cfg.NoStat {
+		if err := checkNoStat(cfg); err != nil {
+			return err
+		}
+	}
+	if cfg.ScanArchives {
+		if err := checkScanArchives(cfg); err != nil {
+			return err
+		}
+	}
+	if err := checkCtime(cfg); err != nil {
+		return err
+	}
+	if err := checkWalkOrder(cfg.WalkOrder); err != nil {
+		return err
+	}
+	if err := checkFileReports(cfg); err != nil {
+		return err
+	}
+
+	// A snapshot is queried in place of the tree it recorded, the ignore
+	// files were applied when it was written
+	var snap *snapshotReader
+	if cfg.FromSnapshot {
+		if err := checkSnapshot(cfg); err != nil {
+			return err
+		}
+		var err error
+		if snap, err = openSnapshot(root); err != nil {
+			return err
+		}
+		defer snap.Close()
+		root, cfg.NoIgnore = snap.root.path, true
+	}
+	for _, command := range []string{cfg.Exec, cfg.ExecOnMatchDir} {
+		if command == "" {
+			continue
+		}
+		if _, err := execArgs(command, root); err != nil {
+			return err
+		}
+	}
+	var requireEnc string
+	if cfg.RequireEncoding != "" {
+		var err error
+		if requireEnc, err = parseFileEncoding(cfg.RequireEncoding); err != nil {
+			return err
+		}
+	}
+
+	// Sorted listings are buffered and written after the walk
+	var store *recordStore
+	if cfg.Sort != "" {
+		less, err := recordLess(cfg.Sort)
+		if err != nil {
+			return err
+		}
+		store = newRecordStore(cfg.MaxInMemory, less)
+		defer store.Close()
+	}
+
+	// Audit list of every file looked at, matched or not
+	var fileList *bufio.Writer
+	if cfg.WriteFileList != "" {
+		f, err := fsys.Create(cfg.WriteFileList, false)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fileList = bufio.NewWriter(f)
+		defer fileList.Flush()
+	}
+
+	// Stats, opens and unlinks all share one budget
+	p := newPacer(cfg.Pace)
+
+	act, err := newActor(ctx, root, cfg, p)
+	if err != nil {
+		return err
+	}
+	defer act.Close()
+
+	// Checksums are computed concurrently but written in listing order
+	var pool *hashPool
+	if cfg.Checksum {
+		pool = newHashPool(cfg.HashWorkers, hasher(cfg), func(path, sum string) error {
+			name, _ := outputPath(path, cfg)
+			return listChecksum(name, sum, out)
+		})
+	}
+	now := time.Now()
+	var types contentTypes
+	if cfg.ReportContentType {
+		types = contentTypes{}
+	}
+	var filesystems fsTypes
+	if cfg.ReportFSType {
+		filesystems = fsTypes{}
+	}
+	// The git status of the root is read with the first matched file
+	var git *gitStatuses
+	gitLoaded := false
+	var ents *entropies
+	if cfg.MinEntropy > 0 || cfg.MaxEntropy > 0 || cfg.ReportEntropy {
+		ents = newEntropies(cfg.EntropyKiB)
+	}
+	// The counts of WC are summed for the totals written after the walk
+	var wc *wcCounter
+	if cfg.WC {
+		wc = &wcCounter{}
+	}
+	// Grouped listings are written once every extension is known
+	var exts extGroups
+	if cfg.GroupByExt {
+		exts = extGroups{}
+	}
+	output := func(path string, info os.FileInfo) error {
+		// The JSON summary is the whole output, nothing is listed
+		if cfg.JSONReport {
+			if wc != nil {
+				p.wait()
+				return wc.count(path, path, cfg.LinesOnly, nil)
+			}
+			return nil
+		}
+		name, err := outputPath(path, cfg)
+		if errors.Is(err, ErrNoPrefix) {
+			return nil
+		}
+		if wc != nil {
+			p.wait()
+			return wc.count(path, name, cfg.LinesOnly, out)
+		}
+		if pool != nil {
+			p.wait()
+			return pool.Submit(path)
+		}
+		if cfg.ReportFileAge {
+			return listFileAge(name, now.Sub(info.ModTime()), out)
+		}
+		if types != nil {
+			p.wait()
+			typ, err := types.of(path)
+			if err != nil {
+				return err
+			}
+			return listContentType(name, typ, out)
+		}
+		if filesystems != nil {
+			typ, err := filesystems.of(path)
+			if err != nil {
+				return err
+			}
+			return listFSType(name, typ, out)
+		}
+		if cfg.ReportGitStatus {
+			if !gitLoaded {
+				gitLoaded = true
+				var err error
+				if git, err = loadGitStatus(cfg.gitCmd, root); err != nil {
+					if err := warnGitStatus(root, err, out); err != nil {
+						return err
+					}
+				}
+			}
+			if git == nil {
+				return listFile(name, out)
+			}
+			return listGitStatus(name, git.of(root, path), out)
+		}
+		if cfg.ReportEntropy {
+			p.wait()
+			h, err := ents.of(path)
+			if err != nil {
+				return err
+			}
+			ents.forget(path)
+			return listEntropy(name, h, out)
+		}
+		if cfg.ReportJSONValidity {
+			p.wait()
+			return reportJSONValidity(path, name, out)
+		}
+		if cfg.ReportYAMLValidity {
+			p.wait()
+			return reportYAMLValidity(path, name, out)
+		}
+		if cfg.ReportTOMLValidity {
+			p.wait()
+			return reportTOMLValidity(path, name, out)
+		}
+		if cfg.ReportCSVValidity {
+			p.wait()
+			return reportCSVValidity(path, name, cfg.CSVColumnCount, out)
+		}
+		if cfg.ReportINIValidity {
+			p.wait()
+			return reportINIValidity(path, name, out)
+		}
+		if cfg.ReportLineCount || cfg.ReportWordCount {
+			p.wait()
+			return reportCounts(path, name, cfg.ReportLineCount, cfg.ReportWordCount, out)
+		}
+		if cfg.ReportFirstLine {
+			p.wait()
+			return reportFirstLine(path, name, out)
+		}
+		if cfg.ReportPkgType {
+			p.wait()
+			return reportPkgType(path, name, out)
+		}
+		if cfg.ReportFileSignature {
+			p.wait()
+			return reportFileSignature(path, name, out)
+		}
+		if cfg.ReportShebang {
+			p.wait()
+			return reportShebang(path, name, out)
+		}
+		if cfg.ReportNullBytes {
+			p.wait()
+			return reportNullBytes(path, name, cfg.MaxFileSize, out)
+		}
+		if cfg.ReportFileEncoding {
+			p.wait()
+			return reportFileEncoding(path, name, out)
+		}
+		if cfg.ReportZipContents {
+			p.wait()
+			return reportZipContents(path, name, cfg.ZipEntryLimit, out)
+		}
+		if cfg.ReportTarContents {
+			p.wait()
+			return reportTarContents(path, name, out)
+		}
+		if cfg.ReportZip64 {
+			p.wait()
+			return reportZip64(path, name, out)
+		}
+		if cfg.ReportPartialGzip {
+			p.wait()
+			return reportPartialGzip(path, name, out)
+		}
+		if cfg.ReportNumericNames {
+			return reportNumericName(name, out)
+		}
+		if exts != nil {
+			exts.add(name)
+			return nil
+		}
+		if cfg.hooked() {
+			cfg.notify(Result{Path: path, Info: info, Action: "list", Dest: name})
+			return nil
+		}
+		return listFile(name, out)
+	}
+	emit := func(m match) error {
+		if store != nil {
+			return store.Add(newRecord(m.path, m.info))
+		}
+		return output(m.path, m.info)
+	}
+
+	// Samples are taken once all the matches are known
+	var sv *sieve
+	if cfg.SieveN > 0 {
+		sv = newSieve(cfg.SieveN, cfg.RandSeed)
+	}
+	smp, err := newSampler(cfg.Sample, cfg.RandSeed)
+	if err != nil {
+		return err
+	}
+	list := func(m match) error {
+		if sv != nil {
+			sv.add(newRecord(m.path, m.info))
+			return nil
+		}
+		if smp != nil {
+			return smp.add(m, emit)
+		}
+		return emit(m)
+	}
+
+	// Matched files per directory for the largest dir report
+	var dirs dirCounter
+	largestN := cfg.ReportLargestDirN
+	if cfg.ReportLargestDir && largestN < 1 {
+		largestN = 1
+	}
+	if largestN > 0 {
+		dirs = dirCounter{}
+	}
+	var links inodeGroups
+	if cfg.ReportHardlinkTrees || cfg.ReportDuplicateInodes {
+		links = inodeGroups{}
+	}
+	var names nameGroups
+	if cfg.ReportDuplicateNames {
+		names = nameGroups{}
+	}
+	var contents dirContents
+	if cfg.ReportIdenticalDirs {
+		contents = dirContents{}
+	}
+	var owners *ownerCounter
+	if cfg.ReportByOwner {
+		owners = newOwnerCounter()
+	}
+	var entries entryCounter
+	if cfg.BigDirs > 0 {
+		entries = entryCounter{}
+	}
+
+	// Hard linked files are counted once in the sizes, at their first
+	// link, unless ApparentSize is set. The entries of the walk and the
+	// matched files each have their own set.
+	var matchedLinks, walkedLinks linkSet
+	if !cfg.ApparentSize {
+		matchedLinks = linkSet{}
+		if entries != nil {
+			walkedLinks = linkSet{}
+		}
+	}
+	var dupes dupeFinder
+	if cfg.HardlinkDups {
+		dupes = dupeFinder{}
+	}
+
+	// Extensions already matched per directory
+	var seen extSeen
+	if cfg.UniqueExtPerDir {
+		seen = extSeen{}
+	}
+
+	// Excluded paths and those of the .fssignore files are left alone
+	ig, err := newIgnores(root, cfg)
+	if err != nil {
+		return err
+	}
+	mounts, err := newMountExcludes(cfg)
+	if err != nil {
+		return err
+	}
+
+	// skip hands an error about path to OnError, the scan goes on without
+	// the path when it returns true
+	skip := func(path string, err error) error {
+		if err != nil && cfg.OnError != nil && cfg.OnError(path, err) {
+			return nil
+		}
+		return err
+	}
+
+	// Commands run concurrently but their output is written in walk order
+	var execs *execPool
+	if cfg.Exec != "" {
+		execs = newExecPool(cfg.ExecParallel, cfg.Exec, func(m match, output []byte, err error) error {
+			if _, werr := out.Write(output); werr != nil {
+				return werr
+			}
+			return skip(m.path, err)
+		})
+	}
+
+	// Directories with matched files for ExecOnMatchDir
+	var matchedDirs *dirSet
+	if cfg.ExecOnMatchDir != "" {
+		matchedDirs = newDirSet()
+	}
+
+	// handle applies the actions to a file that passed every filter
+	handle := func(m match) error {
+		if cfg.OnMatch != nil && !cfg.OnMatch(m.path, m.info) {
+			return nil
+		}
+		if matchedDirs != nil {
+			matchedDirs.add(filepath.Dir(m.path))
+		}
+		size := matchedLinks.size(m.info)
+		tot.size += size
+		tot.apparent += m.info.Size()
+		if dirs != nil {
+			dirs.add(m, size)
+		}
+		if links != nil {
+			links.add(m)
+		}
+		if names != nil {
+			names.add(m)
+		}
+		if contents != nil {
+			contents.add(m)
+		}
+		if owners != nil {
+			owners.add(m, size)
+		}
+
+		// Replacing rewrites the file in place, it is reported instead of listed
+		if cfg.ReplaceOld != "" {
+			p.wait()
+			name, _ := outputPath(m.path, cfg)
+			return skip(m.path, replaceContent(m, name, cfg, out))
+		}
+
+		// The output of the command is written instead of the listing
+		if execs != nil {
+			p.wait()
+			return execs.Submit(m)
+		}
+
+		// If list was explicitly set, don't do anything else
+		if cfg.List {
+			return skip(m.path, list(m))
+		}
+
+		if keep, err := act.apply(m); err != nil || !keep {
+			return skip(m.path, err)
+		}
+		if dupes != nil {
+			dupes.add(m)
+		}
+
+		// List is the default option if nothing else was set
+		return skip(m.path, list(m))
+	}
+
+	// The external filter decides last, files it accepts are handled as
+	// its answers come back
+	var filter *filterCmd
+	if cfg.FilterCmd != "" {
+		if filter, err = startFilterCmd(cfg.FilterCmd, cfg.FilterCmdNUL, handle); err != nil {
+			return err
+		}
+		defer filter.Close()
+	}
+
+	// consider counts an entry of the walk, or a member of an archive,
+	// and handles it if it passes the filters
+	consider := func(path string, info os.FileInfo) error {
+		if info.IsDir() {
+			tot.dirs++
+		} else {
+			tot.files++
+		}
+
+		// Report broken file names only, for every entry in the tree
+		if cfg.ReportBrokenUTF8 {
+			return reportBrokenUTF8(path, out)
+		}
+		if cfg.ReportUnusualChars {
+			return reportUnusualChars(path, out)
+		}
+
+		skipped := filterOut(path, cfg.Ext, cfg.Size, cfg.MaxFileSize, info) ||
+			cfg.ExcludeSymlinks && info.Mode()&os.ModeSymlink != 0 ||
+			cfg.TouchArchiveStamp && filepath.Base(path) == archiveStampName ||
+			cfg.ReportNumericNames && !isNumericName(path)
+		if !skipped && cfg.GoBuildTag != "" {
+			p.wait()
+			tagged, err := hasGoBuildTag(path, cfg.GoBuildTag)
+			if err != nil {
+				return skip(path, err)
+			}
+			skipped = !tagged
+		}
+		if !skipped && requireEnc != "" {
+			p.wait()
+			enc, err := fileEncoding(path)
+			if err != nil {
+				return skip(path, err)
+			}
+			skipped = enc != requireEnc
+		}
+		if !skipped {
+			changed, err := ctimeOut(cfg, info, now)
+			if err != nil {
+				return skip(path, err)
+			}
+			skipped = changed
+		}
+		if !skipped && (cfg.MinEntropy > 0 || cfg.MaxEntropy > 0) {
+			// The files that can't be read are skipped with a warning
+			p.wait()
+			h, err := ents.of(path)
+			if err != nil {
+				if _, werr := fmt.Fprintf(out, "WARNING: skipping %s: %v\n", path, err); werr != nil {
+					return werr
+				}
+				skipped = true
+			} else if skipped = entropyOut(cfg, h); skipped || !cfg.ReportEntropy {
+				ents.forget(path)
+			}
+		}
+		if skipped || seen != nil && !seen.first(path) {
+			if fileList != nil && !info.IsDir() {
+				return writeListEntry(fileList, path, false)
+			}
+			return nil
+		}
+		if fileList != nil {
+			if err := writeListEntry(fileList, path, true); err != nil {
+				return err
+			}
+		}
+		m := match{path: path, info: info}
+		if filter != nil {
+			return filter.submit(m)
+		}
+		return handle(m)
+	}
+
+	// scanMembers considers the members of the archive at path. A corrupt
+	// archive is reported and skipped, the scan goes on.
+	scanMembers := func(path string) error {
+		var ferr error
+		err := scanArchive(path, cfg.ArchiveDepth, func(member string, info os.FileInfo) error {
+			ferr = consider(member, info)
+			return ferr
+		})
+		if err != nil && ferr == nil {
+			_, err = fmt.Fprintf(out, "WARNING: skipping corrupt archive %s: %v\n", path, err)
+		}
+		return err
+	}
+
+	// Ignored entries are pruned before the walk reaches them, whatever
+	// its order
+	prune := func(path string, d fs.DirEntry) (bool, error) {
+		if mounts != nil && d.IsDir() && path != root && mounts.excluded(path) {
+			return true, nil
+		}
+		if ig == nil {
+			return false, nil
+		}
+		ignored, err := ig.ignored(path, d.IsDir())
+		if err != nil {
+			return true, skip(path, err)
+		}
+		return ignored, nil
+	}
+
+	walk := func(fn fs.WalkDirFunc) error {
+		if snap != nil {
+			return snap.walk(prune, fn)
+		}
+		return walkTree(root, cfg.WalkOrder, prune, fn)
+	}
+	err = walk(func(path string, d fs.DirEntry, err error) error {
+		if cerr := ctx.Err(); cerr != nil {
+			return cerr
+		}
+		if err != nil {
+			return skip(path, err)
+		}
+		p.wait()
+
+		// Only the directory entry is used in no-stat mode
+		var info os.FileInfo
+		if cfg.NoStat {
+			info = dirEntryInfo{d}
+		} else if info, err = d.Info(); err != nil {
+			return skip(path, err)
+		}
+		if entries != nil && path != root {
+			entries.add(path, walkedLinks.size(info))
+		}
+
+		if err := consider(path, info); err != nil {
+			return err
+		}
+		if cfg.ScanArchives && info.Mode().IsRegular() && archiveKind(path) != "" {
+			p.wait()
+			return scanMembers(path)
+		}
+		return nil
+	})
+	if err == nil && filter != nil {
+		err = filter.finish()
+	}
+
+	if err == nil && sv != nil {
+		for _, r := range sv.sample() {
+			if err = emit(match{path: r.path, info: snapshotInfo{r}}); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil && smp != nil {
+		err = smp.flush(emit)
+	}
+	if err == nil && store != nil {
+		err = store.Each(func(r record) error {
+			return output(r.path, snapshotInfo{r})
+		})
+	}
+	if pool != nil {
+		if perr := pool.Wait(); err == nil {
+			err = perr
+		}
+	}
+	if execs != nil {
+		if eerr := execs.Wait(); err == nil {
+			err = eerr
+		}
+	}
+	if cerr := act.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// The directory commands run once every match is known
+	if matchedDirs != nil {
+		if err := execOnDirs(cfg.ExecParallel, cfg.ExecOnMatchDir, matchedDirs.order, out, skip); err != nil {
+			return err
+		}
+	}
+
+	if fileList != nil {
+		if err := fileList.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if wc != nil && !cfg.JSONReport {
+		if err := wc.reportTotals(cfg.LinesOnly, out); err != nil {
+			return err
+		}
+	}
+
+	if exts != nil {
+		if err := reportExtGroups(exts, out); err != nil {
+			return err
+		}
+	}
+
+	if dirs != nil {
+		if err := reportLargestDirs(dirs, largestN, out); err != nil {
+			return err
+		}
+	}
+	var bigDirs []bigDir
+	if entries != nil {
+		bigDirs = entries.over(cfg.BigDirs)
+	}
+	if cfg.JSONReport {
+		if err := reportJSONSummary(owners, bigDirs, wc, out); err != nil {
+			return err
+		}
+	} else {
+		if owners != nil {
+			if err := reportByOwner(owners, cfg.HumanSizes, out); err != nil {
+				return err
+			}
+		}
+		if bigDirs != nil {
+			if err := reportBigDirs(bigDirs, cfg.HumanSizes, out); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Duplicates are linked after the walk, once all of them are known
+	if dupes != nil {
+		groups, err := dupes.groups(p, hasher(cfg), !hashIsCrypto(cfg.Hash))
+		if err != nil {
+			return err
+		}
+		if err := hardlinkDups(groups, cfg.DedupeLinkThreshold, p, out); err != nil {
+			return err
+		}
+	}
+
+	if cfg.ReportHardlinkTrees {
+		if err := reportHardlinkTrees(links, out); err != nil {
+			return err
+		}
+	}
+	if cfg.ReportDuplicateInodes {
+		if err := reportDuplicateInodes(links, out); err != nil {
+			return err
+		}
+	}
+	if names != nil {
+		if err := reportDuplicateNames(names, out); err != nil {
+			return err
+		}
+	}
+	if contents != nil {
+		if err := reportIdenticalDirs(contents, out); err != nil {
+			return err
+		}
+	}
+
+	if smp != nil {
+		tot.sampled, tot.matched, tot.kept = true, int64(smp.seen), int64(smp.kept)
+	}
+	if cfg.Del {
+		tot.deletes = true
+		tot.deleted, tot.failed = act.deleteCounts()
+	}
+	if cfg.ReportTotals {
+		if _, err := fmt.Fprintf(out, "Total files scanned: %d\nTotal directories scanned: %d\n",
+			tot.files, tot.dirs); err != nil {
+			return err
+		}
+		if tot.sampled {
+			if _, err := fmt.Fprintf(out, "Total files matched: %d\nTotal files sampled: %d\n",
+				tot.matched, tot.kept); err != nil {
+				return err
+			}
+		}
+		if tot.size != tot.apparent {
+			if _, err := fmt.Fprintf(out, "Total size matched: %d bytes (%d bytes apparent)\n",
+				tot.size, tot.apparent); err != nil {
+				return err
+			}
+		}
+		if tot.deletes {
+			if _, err := fmt.Fprintf(out, "Total files deleted: %d\nTotal deletes failed: %d\n",
+				tot.deleted, tot.failed); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The pace is logged rather than listed, it isn't part of the results
+	if p != nil && cfg.LogWriter != nil {
+		ops, rate := p.achieved()
+		_, err = fmt.Fprintf(cfg.LogWriter, "Paced operations: %d (%.1f ops/sec)\n", ops, rate)
+	}
+
+	// The run summary ties the log to the build that wrote it
+	if err == nil && cfg.Build != "" && cfg.LogWriter != nil {
+		summary := log.New(cfg.LogWriter, "RUN SUMMARY: ", log.LstdFlags)
+		err = summary.Output(1, fmt.Sprintf("%s: %s, %s", s.Root, *tot, cfg.Build))
+	}
+	return err
+}
@@ -0,0 +1,812 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		name     string
+		root     string
+		cfg      Config
+		expected string
+	}{
+		{
+			name: "NoFilter",
+			root: "testdata",
+			cfg: Config{
+				Ext:  "",
+				Size: 0,
+				List: true,
+			},
+			expected: "testdata/dir.log\ntestdata/dir2/script.sh\ntestdata/log.gz\n",
+		},
+		{
+			name: "FilterExtensionMatch",
+			root: "testdata",
+			cfg: Config{
+				Ext:  ".log",
+				Size: 0,
+				List: true,
+			},
+			expected: "testdata/dir.log\n",
+		},
+		{
+			name: "FilterExtensionSizeMatch",
+			root: "testdata",
+			cfg: Config{
+				Ext:  ".log",
+				Size: 10,
+				List: true,
+			},
+			expected: "testdata/dir.log\n",
+		},
+		{
+			name: "FilterExtensionSizeNoMatch",
+			root: "testdata",
+			cfg: Config{
+				Ext:  ".log",
+				Size: 20,
+				List: true,
+			},
+			expected: "",
+		},
+		{
+			name: "FilterExtensionNoMatch",
+			root: "testdata",
+			cfg: Config{
+				Ext:  ".gz",
+				Size: 0,
+				List: true,
+			},
+			expected: "testdata/log.gz\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := NewScanner(tc.root, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			res := buffer.String()
+
+			if tc.expected != res {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunDelExtension runs on a memFS
+func TestRunDelExtension(t *testing.T) {
+	testCases := []struct {
+		name        string
+		cfg         Config
+		extNoDelete string
+		nDelete     int
+		nNoDelete   int
+		expected    string
+	}{
+		{
+			name: "DeleteExtensionNoMatch",
+			cfg: Config{
+				Ext: ".log",
+				Del: true,
+			},
+			extNoDelete: ".gz",
+			nDelete:     0,
+			nNoDelete:   10,
+			expected:    "",
+		},
+		{
+			name: "DeleteExtensionMatch",
+			cfg: Config{
+				Ext: ".log",
+				Del: true,
+			},
+			extNoDelete: "",
+			nDelete:     10,
+			nNoDelete:   0,
+			expected:    "",
+		},
+		{
+			name: "DeleteExtensionMixed",
+			cfg: Config{
+				Ext: ".log",
+				Del: true,
+			},
+			extNoDelete: ".gz",
+			nDelete:     5,
+			nNoDelete:   5,
+			expected:    "",
+		},
+	}
+
+	// Execute RunDel Test test cases
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				buffer    bytes.Buffer
+				logBuffer bytes.Buffer
+			)
+			tc.cfg.LogWriter = &logBuffer
+
+			_, tempDir := memTree(t, testsupport.Numbered(map[string]int{
+				tc.cfg.Ext:     tc.nDelete,
+				tc.extNoDelete: tc.nNoDelete,
+			}, "dummy"))
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			res := buffer.String()
+			if tc.expected != res {
+				t.Errorf("expected %q, go %q instead\n", tc.expected, res)
+			}
+
+			filesLeft, err := fsys.ReadDir(tempDir)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if len(filesLeft) != tc.nNoDelete {
+				t.Errorf("Expected %d files left, got %d instead\n",
+					tc.nNoDelete, len(filesLeft))
+			}
+
+			expLogLines := tc.nDelete + 1
+			lines := bytes.Split(logBuffer.Bytes(), []byte("\n"))
+			if len(lines) != expLogLines {
+				t.Errorf("expected %d files left, got %d instead\n", expLogLines, len(lines))
+			}
+		})
+	}
+}
+
+// TestRunArchive runs on a memFS
+func TestRunArchive(t *testing.T) {
+	// Archiving test test cases
+	testCases := []struct {
+		name         string
+		cfg          Config
+		extNoArchive string
+		nArchive     int
+		nNoArchive   int
+	}{
+		{
+			name:         "ArchiveExtensionNoMatch",
+			cfg:          Config{Ext: ".log"},
+			extNoArchive: ".gz",
+			nArchive:     0,
+			nNoArchive:   10,
+		},
+		{
+			name:         "ArchiveExtensionMatch",
+			cfg:          Config{Ext: ".log"},
+			extNoArchive: "",
+			nArchive:     10,
+			nNoArchive:   0,
+		},
+		{
+			name:         "ArchiveExtensionMixed",
+			cfg:          Config{Ext: ".log"},
+			extNoArchive: ".gz",
+			nArchive:     5,
+			nNoArchive:   5,
+		},
+	}
+	// Execute RunArchive test cases
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Buffer for RunArchive output
+			var buffer bytes.Buffer
+
+			// Create the dirs for RunArchive test
+			m, tempDir := memTree(t, testsupport.Numbered(map[string]int{
+				tc.cfg.Ext:      tc.nArchive,
+				tc.extNoArchive: tc.nNoArchive,
+			}, "dummy"))
+
+			arcDir := filepath.FromSlash("/mem/arc")
+			if err := m.MkdirAll(arcDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			tc.cfg.Arc = arcDir
+
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := fsys.ReadDir(tempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expFiles []string
+			for _, e := range entries {
+				if filepath.Ext(e.Name()) == tc.cfg.Ext {
+					expFiles = append(expFiles, filepath.Join(tempDir, e.Name()))
+				}
+			}
+
+			expOut := strings.Join(expFiles, "\n")
+
+			res := strings.TrimSpace(buffer.String())
+
+			if expOut != res {
+				t.Errorf("expected %q got %q instead\n", expOut, res)
+			}
+
+			fileArc, err := fsys.ReadDir(arcDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(fileArc) != tc.nArchive {
+				t.Errorf("expected %d files archived, got %d instead\n", tc.nArchive,
+					len(fileArc))
+			}
+		})
+	}
+}
+
+// TestRunArchiveNested archives a nested tree and checks the directories
+// are kept under the archive directory
+func TestRunArchiveNested(t *testing.T) {
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"app.log":                 {Content: "dummy"},
+		"2024/01/app.log":         {Content: "dummy"},
+		"2024/02/app.log":         {Content: "dummy"},
+		"2024/02/deep/nested.log": {Content: "dummy"},
+		"2024/02/notes.txt":       {Content: "dummy"},
+		"2024/03":                 {Dir: true},
+	})
+	arcDir := t.TempDir()
+
+	cfg := Config{Ext: ".log", Arc: arcDir}
+	if err := NewScanner(tempDir, cfg).Run(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var archived []string
+	err := filepath.WalkDir(arcDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(arcDir, path)
+			archived = append(archived, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"2024/01/app.log.gz", "2024/02/app.log.gz", "2024/02/deep/nested.log.gz", "app.log.gz"}
+	if strings.Join(expected, " ") != strings.Join(archived, " ") {
+		t.Errorf("expected %v, got %v instead\n", expected, archived)
+	}
+}
+
+// TestRunTouchArchiveStamp checks the directories with archived files get
+// a stamp, replacing the previous one, and the stamps aren't archived
+func TestRunTouchArchiveStamp(t *testing.T) {
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"a/app.log":         {Content: "dummy"},
+		"a/b/db.log":        {Content: "dummy"},
+		"c/d":               {Dir: true},
+		"a/b/.last_archive": {Content: "2001-01-01T00:00:00Z\n"},
+	})
+
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"Gzip", Config{}},
+		{"Bundle", Config{MaxArchiveFiles: 10}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			arcDir := t.TempDir()
+			cfg := tc.cfg
+			cfg.Arc = arcDir
+			cfg.TouchArchiveStamp = true
+			start := time.Now().Truncate(time.Second)
+			if err := NewScanner(tempDir, cfg).Run(&bytes.Buffer{}); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, dir := range []string{"a", "a/b"} {
+				data, err := os.ReadFile(filepath.Join(tempDir, filepath.FromSlash(dir), ".last_archive"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				stamp, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stamp.Before(start) {
+					t.Errorf("expected a stamp after %s in %s, got %s instead\n", start, dir, stamp)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(tempDir, "c", ".last_archive")); !os.IsNotExist(err) {
+				t.Errorf("expected no stamp in c, got %v instead\n", err)
+			}
+		})
+	}
+
+}
+
+// TestRunSplitByMonth checks files of two months are archived to one
+// directory, or one bundle, per month
+func TestRunSplitByMonth(t *testing.T) {
+	testCases := []struct {
+		name        string
+		cfg         Config
+		expArchives []string
+	}{
+		{"Gzip", Config{}, []string{"2024-01/a.log.gz", "2024-01/sub/c.log.gz", "2024-02/b.log.gz"}},
+		{"Bundle", Config{MaxArchiveFiles: 10}, []string{"archive-2024-01.001.zip", "archive-2024-02.001.zip"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			writeFiles(t, tempDir, map[string]string{"a.log": "dummy", "b.log": "dummy", "sub/c.log": "dummy"})
+			for name, mtime := range map[string]time.Time{
+				"a.log":     time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local),
+				"b.log":     time.Date(2024, 2, 1, 12, 0, 0, 0, time.Local),
+				"sub/c.log": time.Date(2024, 1, 31, 12, 0, 0, 0, time.Local),
+			} {
+				if err := os.Chtimes(filepath.Join(tempDir, filepath.FromSlash(name)), mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			arcDir := t.TempDir()
+			cfg := tc.cfg
+			cfg.Arc = arcDir
+			cfg.SplitByMonth = true
+			if err := NewScanner(tempDir, cfg).Run(&bytes.Buffer{}); err != nil {
+				t.Fatal(err)
+			}
+
+			var archives []string
+			err := filepath.Walk(arcDir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					rel, _ := filepath.Rel(arcDir, path)
+					archives = append(archives, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(tc.expArchives, " ") != strings.Join(archives, " ") {
+				t.Errorf("expected %q, got %q instead\n", tc.expArchives, archives)
+			}
+		})
+	}
+}
+
+// TestRunReportBrokenUTF8
+func TestRunReportBrokenUTF8(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("raw byte file names require Linux")
+	}
+
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 2}, "dummy"))
+
+	// Create the file with the raw syscall so no layer rewrites the name
+	badPath := filepath.Join(tempDir, "bad\xff\xfename.log")
+	fd, err := syscall.Open(badPath, syscall.O_CREAT|syscall.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(fd)
+
+	var buffer bytes.Buffer
+	cfg := Config{ReportBrokenUTF8: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("INVALID_UTF8: %x\n", badPath)
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunReportUnusualChars
+func TestRunReportUnusualChars(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("raw byte file names require Linux")
+	}
+
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"my notes.log": {Content: "dummy"},
+		"sub/app.log":  {Content: "dummy"},
+	})
+
+	// Create the file with the raw syscall so no layer rewrites the name
+	tabPath := filepath.Join(tempDir, "sub", "tab\tname.log")
+	fd, err := syscall.Open(tabPath, syscall.O_CREAT|syscall.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(fd)
+
+	var buffer bytes.Buffer
+	cfg := Config{ReportUnusualChars: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("UNUSUAL: %x\n", tabPath)
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunWriteFileList
+func TestRunWriteFileList(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 3, ".gz": 4}, "dummy"))
+
+	listDir := t.TempDir()
+	listFile := filepath.Join(listDir, "files.txt")
+
+	var buffer bytes.Buffer
+	cfg := Config{Ext: ".log", List: true, WriteFileList: listFile}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(listFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	matched := 0
+	for _, l := range lines {
+		if strings.HasPrefix(l, "*") {
+			matched++
+		}
+	}
+
+	expMatched := len(strings.Split(strings.TrimSpace(buffer.String()), "\n"))
+	if matched != expMatched {
+		t.Errorf("expected %d matched lines, got %d instead\n", expMatched, matched)
+	}
+	if len(lines) != 7 {
+		t.Errorf("expected %d lines, got %d instead\n", 7, len(lines))
+	}
+}
+
+// countStats makes the filesystem of the test count its calls
+func countStats(t testing.TB) *faultFS {
+	t.Helper()
+	f := newFaultFS(fsys)
+	useFS(t, f)
+	return f
+}
+
+// TestRunStatCount
+func TestRunStatCount(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       Config
+		expStat   int
+		expLstat  int
+		withArc   bool
+		nMatching int
+	}{
+		// The walker lstats the root, the entries come with their stats
+		{name: "List", cfg: Config{Ext: ".log", List: true}, expLstat: 1, nMatching: 5},
+		{name: "Archive", cfg: Config{Ext: ".log"}, withArc: true, expStat: 1, expLstat: 1, nMatching: 5},
+		{name: "Delete", cfg: Config{Ext: ".log", Del: true}, expLstat: 6, nMatching: 5},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": tc.nMatching, ".gz": 3}, "dummy"))
+			if tc.withArc {
+				arcDir := t.TempDir()
+				tc.cfg.Arc = arcDir
+			}
+			tc.cfg.LogWriter = &bytes.Buffer{}
+
+			f := countStats(t)
+
+			var buffer bytes.Buffer
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+
+			if f.count("stat") != tc.expStat || f.count("lstat") != tc.expLstat {
+				t.Errorf("expected %d stat and %d lstat calls, got %d and %d instead\n",
+					tc.expStat, tc.expLstat, f.count("stat"), f.count("lstat"))
+			}
+		})
+	}
+}
+
+// BenchmarkRunArchiveStats reports the stat calls made per archived file
+// on top of the walker's own lstat
+func BenchmarkRunArchiveStats(b *testing.B) {
+	const nFiles = 100
+	f := countStats(b)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tempDir, err := ioutil.TempDir("", "walkbench")
+		if err != nil {
+			b.Fatal(err)
+		}
+		arcDir, err := ioutil.TempDir("", "walkbencharc")
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < nFiles; j++ {
+			fpath := filepath.Join(tempDir, fmt.Sprintf("file%d.log", j))
+			if err := ioutil.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+		before := f.count("stat") + f.count("lstat")
+		b.StartTimer()
+
+		if err := NewScanner(tempDir, Config{Ext: ".log", Arc: arcDir}).Run(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		b.ReportMetric(float64(f.count("stat")+f.count("lstat")-before)/nFiles, "stats/file")
+		os.RemoveAll(tempDir)
+		os.RemoveAll(arcDir)
+		b.StartTimer()
+	}
+}
+
+// TestRunNoStat
+func TestRunNoStat(t *testing.T) {
+	testCases := []struct {
+		name   string
+		cfg    Config
+		expErr bool
+	}{
+		{name: "NoFilter", cfg: Config{List: true}},
+		{name: "FilterExtension", cfg: Config{Ext: ".log", List: true}},
+		{name: "SortByPath", cfg: Config{Ext: ".log", Sort: "path"}},
+		{name: "SizeFilter", cfg: Config{Size: 10, List: true}, expErr: true},
+		{name: "SortBySize", cfg: Config{Sort: "size", List: true}, expErr: true},
+		{name: "Delete", cfg: Config{Ext: ".log", Del: true}, expErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expected, buffer bytes.Buffer
+			if !tc.expErr {
+				if err := NewScanner("testdata", tc.cfg).Run(&expected); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tc.cfg.NoStat = true
+			err := NewScanner("testdata", tc.cfg).Run(&buffer)
+			if tc.expErr {
+				if !errors.Is(err, ErrNeedsStat) {
+					t.Fatalf("expected error %q, got %v instead", ErrNeedsStat, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected.String() != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", expected.String(), buffer.String())
+			}
+		})
+	}
+}
+
+func benchmarkRunStat(b *testing.B, noStat bool) {
+	tempDir := b.TempDir()
+	for d := 0; d < 10; d++ {
+		dir := filepath.Join(tempDir, fmt.Sprintf("dir%d", d))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 1000; j++ {
+			fpath := filepath.Join(dir, fmt.Sprintf("file%d.log", j))
+			if err := ioutil.WriteFile(fpath, nil, 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	cfg := Config{Ext: ".log", List: true, NoStat: noStat}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := NewScanner(tempDir, cfg).Run(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunFullStat(b *testing.B) { benchmarkRunStat(b, false) }
+func BenchmarkRunNoStat(b *testing.B)   { benchmarkRunStat(b, true) }
+
+// TestRunArchiveNotDir
+func TestRunArchiveNotDir(t *testing.T) {
+	var buffer bytes.Buffer
+	err := NewScanner("testdata", Config{Arc: "testdata/dir.log"}).Run(&buffer)
+	if !errors.Is(err, ErrNotDir) {
+		t.Errorf("expected error %q, got %v instead", ErrNotDir, err)
+	}
+}
+
+// TestRunReportTotals
+func TestRunReportTotals(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{
+			name: "AllFiles",
+			cfg:  Config{List: true, ReportTotals: true},
+			expected: "testdata/dir.log\ntestdata/dir2/script.sh\ntestdata/log.gz\n" +
+				"Total files scanned: 3\nTotal directories scanned: 2\n",
+		},
+		{
+			name:     "FilteredStillCountsAll",
+			cfg:      Config{Ext: ".sh", List: true, ReportTotals: true},
+			expected: "testdata/dir2/script.sh\nTotal files scanned: 3\nTotal directories scanned: 2\n",
+		},
+		{
+			name:     "NoStat",
+			cfg:      Config{Ext: ".gz", List: true, NoStat: true, ReportTotals: true},
+			expected: "testdata/log.gz\nTotal files scanned: 3\nTotal directories scanned: 2\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := NewScanner("testdata", tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunExcludeSymlinks
+func TestRunExcludeSymlinks(t *testing.T) {
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"a.log":      {Content: "dummy"},
+		"dir/b.log":  {Content: "dummy"},
+		"link.log":   {Symlink: "a.log"},
+		"dangling":   {Symlink: "missing.log"},
+		"dirlink":    {Symlink: "dir"},
+		"dir/up.log": {Symlink: "../a.log"},
+	})
+
+	testCases := []struct {
+		name     string
+		exclude  bool
+		expected []string
+	}{
+		{name: "Default", expected: []string{"a.log", "dangling", "dir/b.log", "dir/up.log", "dirlink", "link.log"}},
+		{name: "ExcludeSymlinks", exclude: true, expected: []string{"a.log", "dir/b.log"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{List: true, ExcludeSymlinks: tc.exclude}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			expected := ""
+			for _, p := range tc.expected {
+				expected += filepath.Join(tempDir, filepath.FromSlash(p)) + "\n"
+			}
+			if expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunResolveSymlinks
+func TestRunResolveSymlinks(t *testing.T) {
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"data/a.log":  {Content: "dummy"},
+		"link.log":    {Symlink: "data/a.log"},
+		"dirlink":     {Symlink: "data"},
+		"dangling":    {Symlink: "missing.log"},
+		"data/up.log": {Symlink: "../link.log"},
+	})
+	realDir, err := filepath.EvalSymlinks(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := func(dir, p string) string { return filepath.Join(dir, filepath.FromSlash(p)) }
+
+	var buffer bytes.Buffer
+	cfg := Config{List: true, ResolveSymlinks: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "UNRESOLVED: " + path(tempDir, "dangling") + "\n" +
+		path(realDir, "data/a.log") + "\n" +
+		path(realDir, "data/a.log") + "\n" +
+		path(realDir, "data") + "\n" +
+		path(realDir, "data/a.log") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunUniqueExtPerDir
+func TestRunUniqueExtPerDir(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a.log":     "dummy",
+		"b.log":     "dummy",
+		"c.log":     "dummy",
+		"d.log":     "dummy",
+		"e.log":     "dummy",
+		"f.txt":     "dummy",
+		"sub/g.log": "dummy",
+		"sub/h.log": "dummy",
+	})
+
+	var buffer bytes.Buffer
+	cfg := Config{List: true, UniqueExtPerDir: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := filepath.Join(tempDir, "a.log") + "\n" +
+		filepath.Join(tempDir, "f.txt") + "\n" +
+		filepath.Join(tempDir, "sub", "g.log") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunSummary checks the run summary is logged with the build only when
+// Build is set
+func TestRunSummary(t *testing.T) {
+	for _, build := range []string{"", "fss 1.3.0 (commit abc123)"} {
+		tempDir := t.TempDir()
+		writeFiles(t, tempDir, map[string]string{"a.log": "dummy", "b.txt": "dummy"})
+
+		var logBuffer bytes.Buffer
+		cfg := Config{Ext: ".log", Del: true, LogWriter: &logBuffer, Build: build}
+		if err := NewScanner(tempDir, cfg).Run(&bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+		logged := strings.Contains(logBuffer.String(), "RUN SUMMARY: ")
+		if build == "" && logged {
+			t.Errorf("expected no run summary without a build, got %q instead\n", logBuffer.String())
+		}
+		exp := tempDir + ": 2 files, 1 directories, 1 deleted, 0 deletes failed, " + build + "\n"
+		if build != "" && (!logged || !strings.HasSuffix(logBuffer.String(), exp)) {
+			t.Errorf("expected the run summary %q, got %q instead\n", exp, logBuffer.String())
+		}
+	}
+}
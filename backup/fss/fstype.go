@@ -0,0 +1,34 @@
+package fss
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// fsTypes caches the filesystem type of each directory during a run, so
+// statfs is called once per directory of matched files rather than once
+// per file. The files of a directory are on its filesystem, short of a
+// file bind mounted over.
+type fsTypes map[string]string
+
+// of returns the type of the filesystem holding the file at path
+func (c fsTypes) of(path string) (string, error) {
+	dir := filepath.Dir(path)
+	if typ, ok := c[dir]; ok {
+		return typ, nil
+	}
+	typ, err := fsType(dir)
+	if err != nil {
+		return "", err
+	}
+	c[dir] = typ
+	return typ, nil
+}
+
+// listFSType writes the filesystem type of the file and its path, tab
+// separated
+func listFSType(path, typ string, out io.Writer) error {
+	_, err := fmt.Fprintf(out, "%s\t%s\n", typ, path)
+	return err
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package fss
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// fsStatfs reads the filesystem of a path. It is a variable so tests can
+// count the calls.
+var fsStatfs = unix.Statfs
+
+// fsMagics names the filesystems by the magic number statfs returns for
+// them. ext2 and ext3 share the magic of ext4.
+var fsMagics = map[int64]string{
+	unix.EXT4_SUPER_MAGIC:      "ext4",
+	unix.BTRFS_SUPER_MAGIC:     "btrfs",
+	unix.XFS_SUPER_MAGIC:       "xfs",
+	unix.F2FS_SUPER_MAGIC:      "f2fs",
+	0x2fc12fc1:                 "zfs",
+	unix.TMPFS_MAGIC:           "tmpfs",
+	unix.RAMFS_MAGIC:           "ramfs",
+	unix.OVERLAYFS_SUPER_MAGIC: "overlay",
+	unix.SQUASHFS_MAGIC:        "squashfs",
+	unix.ISOFS_SUPER_MAGIC:     "iso9660",
+	unix.MSDOS_SUPER_MAGIC:     "vfat",
+	unix.EXFAT_SUPER_MAGIC:     "exfat",
+	0x5346544e:                 "ntfs",
+	unix.NFS_SUPER_MAGIC:       "nfs",
+	unix.SMB2_SUPER_MAGIC:      "smb2",
+	unix.CIFS_SUPER_MAGIC:      "cifs",
+	unix.FUSE_SUPER_MAGIC:      "fuse",
+	unix.PROC_SUPER_MAGIC:      "proc",
+	unix.SYSFS_MAGIC:           "sysfs",
+	unix.CGROUP2_SUPER_MAGIC:   "cgroup2",
+	unix.DEVPTS_SUPER_MAGIC:    "devpts",
+}
+
+// fsTypeName returns the name of the filesystem with magic, its magic in
+// hex when it isn't known
+func fsTypeName(magic int64) string {
+	if name, ok := fsMagics[magic]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", magic)
+}
+
+// fsType returns the type of the filesystem holding path
+func fsType(path string) (string, error) {
+	var st unix.Statfs_t
+	if err := fsStatfs(path, &st); err != nil {
+		return "", err
+	}
+	return fsTypeName(int64(st.Type)), nil
+}
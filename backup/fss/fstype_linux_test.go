@@ -0,0 +1,68 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestFSTypeName(t *testing.T) {
+	testCases := []struct {
+		magic    int64
+		expected string
+	}{
+		{unix.EXT4_SUPER_MAGIC, "ext4"},
+		{unix.TMPFS_MAGIC, "tmpfs"},
+		{unix.BTRFS_SUPER_MAGIC, "btrfs"},
+		{0x1234, "0x1234"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			if res := fsTypeName(tc.magic); res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunReportFSType checks each matched file is listed after the type of
+// the filesystem of the temporary directory, with one statfs per directory
+func TestRunReportFSType(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.log":     "dummy",
+		"b.log":     "dummy",
+		"sub/c.log": "dummy",
+		"sub/d.log": "dummy",
+	}))
+	typ, err := fsType(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	defer func(orig func(string, *unix.Statfs_t) error) { fsStatfs = orig }(fsStatfs)
+	fsStatfs = func(path string, st *unix.Statfs_t) error {
+		calls++
+		return unix.Statfs(path, st)
+	}
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{List: true, ReportFSType: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	var expected strings.Builder
+	for _, p := range []string{"a.log", "b.log", "sub/c.log", "sub/d.log"} {
+		expected.WriteString(typ + "\t" + filepath.Join(tempDir, filepath.FromSlash(p)) + "\n")
+	}
+	if expected.String() != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected.String(), buffer.String())
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 statfs calls, got %d instead\n", calls)
+	}
+}
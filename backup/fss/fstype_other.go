@@ -0,0 +1,8 @@
+//go:build !linux
+
+package fss
+
+// fsType is only known on Linux, the other filesystems are unknown
+func fsType(path string) (string, error) {
+	return "unknown", nil
+}
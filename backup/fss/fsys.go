@@ -0,0 +1,84 @@
+package fss
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// fileSystem is what the walk, the filters, the actions and the plans
+// do to the files. The package runs on osFS; the tests swap in an
+// in-memory one to run without a disk and to make single paths fail.
+type fileSystem interface {
+	Open(name string) (fs.File, error)
+	// Create creates the file name, truncating it if it exists. With excl
+	// it fails with fs.ErrExist instead.
+	Create(name string, excl bool) (io.WriteCloser, error)
+	// CreateTemp creates a new file in dir, named after pattern as with
+	// os.CreateTemp, only readable and writable by its owner
+	CreateTemp(dir, pattern string) (tempFile, error)
+	ReadFile(name string) ([]byte, error)
+	Lstat(name string) (os.FileInfo, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(name string, perm os.FileMode) error
+	Remove(name string) error
+	Rename(oldpath, newpath string) error
+	Link(oldname, newname string) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// tempFile is a file made by CreateTemp, an *os.File on disk
+type tempFile interface {
+	io.WriteCloser
+	Name() string
+	Chmod(mode os.FileMode) error
+	Sync() error
+}
+
+// fsys is the filesystem the scans run on. It is a variable so tests can
+// replace it.
+var fsys fileSystem = osFS{}
+
+// osFS is the fileSystem of the os package
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) { return os.Open(name) }
+
+func (osFS) Create(name string, excl bool) (io.WriteCloser, error) {
+	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if excl {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	return os.OpenFile(name, flag, 0644)
+}
+
+func (osFS) CreateTemp(dir, pattern string) (tempFile, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) ReadFile(name string) ([]byte, error)              { return os.ReadFile(name) }
+func (osFS) Lstat(name string) (os.FileInfo, error)            { return os.Lstat(name) }
+func (osFS) Stat(name string) (os.FileInfo, error)             { return os.Stat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error)        { return os.ReadDir(name) }
+func (osFS) MkdirAll(name string, perm os.FileMode) error      { return os.MkdirAll(name, perm) }
+func (osFS) Remove(name string) error                          { return os.Remove(name) }
+func (osFS) Rename(oldpath, newpath string) error              { return os.Rename(oldpath, newpath) }
+func (osFS) Link(oldname, newname string) error                { return os.Link(oldname, newname) }
+func (osFS) Chtimes(name string, atime, mtime time.Time) error { return os.Chtimes(name, atime, mtime) }
+
+// sameFile reports whether a and b describe the same file like
+// os.SameFile, which only knows the FileInfo of the os package. The
+// FileInfo of other filesystems compare themselves with a SameFile
+// method.
+func sameFile(a, b os.FileInfo) bool {
+	if s, ok := a.(interface{ SameFile(os.FileInfo) bool }); ok {
+		return s.SameFile(b)
+	}
+	return os.SameFile(a, b)
+}
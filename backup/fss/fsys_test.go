@@ -0,0 +1,403 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMemFSParity runs the same scans on a memFS and on disk and compares
+// their output
+func TestMemFSParity(t *testing.T) {
+	entries := map[string]testsupport.Spec{
+		"a.log":         {Content: "first", MTime: -3 * time.Hour},
+		"b.txt":         {Content: "second file", MTime: -2 * time.Hour},
+		"sub/c.log":     {Content: "third file of all", MTime: -time.Hour},
+		"sub/deep/d.gz": {Size: 100},
+		"empty":         {Dir: true},
+	}
+	testCases := []struct {
+		name string
+		cfg  Config
+	}{
+		{"List", Config{List: true}},
+		{"Ext", Config{Ext: ".log", List: true}},
+		{"Size", Config{Size: 10, List: true}},
+		{"SortSize", Config{Sort: "size"}},
+		{"SortMTime", Config{Sort: "mtime"}},
+		{"PostOrder", Config{List: true, WalkOrder: WalkPost}},
+		{"Breadth", Config{List: true, WalkOrder: WalkBreadth}},
+		{"Totals", Config{Ext: ".log", List: true, ReportTotals: true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diskRoot := testsupport.Tree(t, entries)
+			var disk bytes.Buffer
+			if err := NewScanner(diskRoot, tc.cfg).Run(&disk); err != nil {
+				t.Fatal(err)
+			}
+
+			_, memRoot := memTree(t, entries)
+			var mem bytes.Buffer
+			if err := NewScanner(memRoot, tc.cfg).Run(&mem); err != nil {
+				t.Fatal(err)
+			}
+
+			expected := strings.ReplaceAll(disk.String(), diskRoot, "ROOT")
+			res := strings.ReplaceAll(mem.String(), memRoot, "ROOT")
+			if expected != res {
+				t.Errorf("expected %q, got %q instead\n", expected, res)
+			}
+		})
+	}
+}
+
+// TestMemFSReports runs the reports reading the content of the files on
+// a memFS and on disk and compares their output
+func TestMemFSReports(t *testing.T) {
+	diskRoot := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a.json":  `{"a": 1}`,
+		"b.json":  "{",
+		"c.yml":   "a: [",
+		"d.toml":  "a = 1\n",
+		"e.csv":   "a,b\n1\n",
+		"f.ini":   "[s]\na=1\n",
+		"g.txt":   "one two\nthree\n",
+		"h.sh":    "#!/bin/sh\necho\n",
+		"i.png":   "not a png",
+		"j.go":    "//go:build linux\n\npackage j\n",
+		"k.log":   "text with a NUL\x00byte",
+		"part.gz": "\x1f\x8b\x08\x00",
+	}))
+	writeZip(t, filepath.Join(diskRoot, "l.zip"), []string{"x.txt", "y.tar"})
+	writeTar(t, filepath.Join(diskRoot, "m.tar.gz"), []string{"z.txt"},
+		func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil })
+
+	// The memFS gets the same files, archives included
+	entries := map[string]testsupport.Spec{}
+	diskEntries, err := os.ReadDir(diskRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range diskEntries {
+		data, err := os.ReadFile(filepath.Join(diskRoot, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[e.Name()] = testsupport.Spec{Content: string(data)}
+	}
+
+	testCases := []struct {
+		name string
+		cfg  Config
+	}{
+		{"JSON", Config{ReportJSONValidity: true, Ext: ".json"}},
+		{"YAML", Config{ReportYAMLValidity: true}},
+		{"TOML", Config{ReportTOMLValidity: true}},
+		{"CSV", Config{ReportCSVValidity: true}},
+		{"INI", Config{ReportINIValidity: true}},
+		{"LineCount", Config{ReportLineCount: true, Ext: ".txt"}},
+		{"WordCount", Config{ReportWordCount: true, Ext: ".txt"}},
+		{"FirstLine", Config{ReportFirstLine: true, Ext: ".sh"}},
+		{"PkgType", Config{ReportPkgType: true}},
+		{"Shebang", Config{ReportShebang: true}},
+		{"NullBytes", Config{ReportNullBytes: true}},
+		{"ContentType", Config{ReportContentType: true}},
+		{"Signature", Config{ReportFileSignature: true}},
+		{"Encoding", Config{ReportFileEncoding: true, Ext: ".txt"}},
+		{"Entropy", Config{ReportEntropy: true}},
+		{"WC", Config{WC: true, Ext: ".txt"}},
+		{"GoBuildTag", Config{GoBuildTag: "linux", List: true}},
+		{"Checksum", Config{Checksum: true, List: true}},
+		{"ChecksumXattrCache", Config{Checksum: true, XattrCache: true, List: true}},
+		{"ZipContents", Config{ReportZipContents: true}},
+		{"Zip64", Config{ReportZip64: true}},
+		{"PartialGzip", Config{ReportPartialGzip: true}},
+		{"TarContents", Config{ReportTarContents: true}},
+		{"ScanArchives", Config{ScanArchives: true, List: true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var disk bytes.Buffer
+			if err := NewScanner(diskRoot, tc.cfg).Run(&disk); err != nil {
+				t.Fatal(err)
+			}
+
+			_, memRoot := memTree(t, entries)
+			var mem bytes.Buffer
+			if err := NewScanner(memRoot, tc.cfg).Run(&mem); err != nil {
+				t.Fatal(err)
+			}
+
+			expected := strings.ReplaceAll(disk.String(), diskRoot, "ROOT")
+			res := strings.ReplaceAll(mem.String(), memRoot, "ROOT")
+			if expected == "" || expected != res {
+				t.Errorf("expected %q, got %q instead\n", expected, res)
+			}
+		})
+	}
+}
+
+// TestRunFSErrors checks the failing filesystem operations are passed to
+// OnError and the scan goes on with the other files. Plans and duplicate
+// links go through the filesystem too, their failures are their own.
+func TestRunFSErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		op      string
+		suffix  string
+		err     error
+		cfg     Config
+		failed  string   // base name of the path passed to OnError, suffix if empty
+		expLeft []string // files still in the tree
+		expArc  []string // archives written
+	}{
+		{
+			name: "DeleteEACCES", op: "remove", suffix: "b.log", err: syscall.EACCES,
+			cfg:     Config{Ext: ".log", Del: true},
+			expLeft: []string{"b.log", "sub", "sub/d.txt"},
+		},
+		{
+			name: "DeleteChanged", op: "lstat", suffix: "c.log", err: syscall.EIO,
+			cfg:     Config{Ext: ".log", Del: true},
+			expLeft: []string{"c.log", "sub", "sub/d.txt"},
+		},
+		{
+			name: "ArchiveENOSPC", op: "create", suffix: "b.log.gz", err: syscall.ENOSPC, failed: "b.log",
+			cfg:     Config{Ext: ".log", Del: true, Arc: filepath.FromSlash("/mem/arc")},
+			expLeft: []string{"b.log", "sub", "sub/d.txt"},
+			expArc:  []string{"a.log.gz", "c.log.gz"},
+		},
+		{
+			name: "ArchiveOpenEIO", op: "open", suffix: "a.log", err: syscall.EIO,
+			cfg:     Config{Ext: ".log", Arc: filepath.FromSlash("/mem/arc")},
+			expLeft: []string{"a.log", "b.log", "c.log", "sub", "sub/d.txt"},
+			expArc:  []string{"b.log.gz", "c.log.gz"},
+		},
+		{
+			name: "BundleOpenEIO", op: "open", suffix: "b.log", err: syscall.EIO,
+			cfg:     Config{Ext: ".log", Arc: filepath.FromSlash("/mem/arc"), MaxArchiveFiles: 10},
+			expLeft: []string{"a.log", "b.log", "c.log", "sub", "sub/d.txt"},
+			expArc:  []string{"archive.001.zip"},
+		},
+		{
+			name: "ReplaceReadFileEIO", op: "readfile", suffix: "b.log", err: syscall.EIO,
+			cfg:     Config{Ext: ".log", ReplaceOld: "s", ReplaceNew: "S"},
+			expLeft: []string{"a.log", "b.log", "c.log", "sub", "sub/d.txt"},
+		},
+		{
+			name: "ReplaceCreateTempENOSPC", op: "createtemp", suffix: "b.log.fss-*", err: syscall.ENOSPC, failed: "b.log",
+			cfg:     Config{Ext: ".log", ReplaceOld: "s", ReplaceNew: "S"},
+			expLeft: []string{"a.log", "b.log", "c.log", "sub", "sub/d.txt"},
+		},
+		{
+			name: "ReadDirEACCES", op: "readdir", suffix: "sub", err: syscall.EACCES,
+			cfg:     Config{Del: true},
+			expLeft: []string{"sub", "sub/d.txt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, root := memTree(t, testsupport.Files(map[string]string{
+				"a.log":     "first",
+				"b.log":     "second",
+				"c.log":     "third",
+				"sub/d.txt": "fourth",
+			}))
+			if err := m.MkdirAll(filepath.FromSlash("/mem/arc"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			f := newFaultFS(m)
+			f.fail(tc.op, tc.suffix, tc.err)
+			useFS(t, f)
+
+			var failed []string
+			tc.cfg.LogWriter = io.Discard
+			tc.cfg.OnError = func(path string, err error) bool {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("%s: expected error %q, got %q instead\n", path, tc.err, err)
+				}
+				failed = append(failed, filepath.Base(path))
+				return true
+			}
+			if err := NewScanner(root, tc.cfg).Run(io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			expFailed := tc.failed
+			if expFailed == "" {
+				expFailed = tc.suffix
+			}
+			if len(failed) != 1 || failed[0] != expFailed {
+				t.Errorf("expected %s to fail, got %v instead\n", expFailed, failed)
+			}
+
+			if left := m.paths(root); strings.Join(left, " ") != strings.Join(tc.expLeft, " ") {
+				t.Errorf("expected %v left, got %v instead\n", tc.expLeft, m.paths(root))
+			}
+
+			entries, err := m.ReadDir(filepath.FromSlash("/mem/arc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var arcs []string
+			for _, e := range entries {
+				arcs = append(arcs, e.Name())
+			}
+			if strings.Join(arcs, " ") != strings.Join(tc.expArc, " ") {
+				t.Errorf("expected archives %v, got %v instead\n", tc.expArc, arcs)
+			}
+		})
+	}
+
+	t.Run("ApplyRemoveEACCES", func(t *testing.T) {
+		m, root := memTree(t, testsupport.Files(map[string]string{
+			"a.log":     "first",
+			"b.log":     "second",
+			"sub/d.txt": "fourth",
+		}))
+		p, err := NewScanner(root, Config{Ext: ".log", Del: true}).Plan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := newFaultFS(m)
+		f.fail("remove", "b.log", syscall.EACCES)
+		useFS(t, f)
+
+		var out bytes.Buffer
+		sum, err := ApplyPlan(p, ApplyOptions{}, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum.Applied != 1 || sum.Failed != 1 {
+			t.Errorf("expected 1 applied and 1 failed, got %+v instead: %q\n", sum, out.String())
+		}
+		if left := m.paths(root); strings.Join(left, " ") != "b.log sub sub/d.txt" {
+			t.Errorf("expected b.log to be left, got %v instead\n", left)
+		}
+	})
+
+	t.Run("TrashCrossDevice", func(t *testing.T) {
+		m, root := memTree(t, testsupport.Files(map[string]string{
+			"a.log": "first",
+			"b.log": "second",
+		}))
+		trash := filepath.FromSlash("/mem/data")
+		t.Setenv("XDG_DATA_HOME", trash)
+		f := newFaultFS(m)
+		f.fail("rename", ".log", syscall.EXDEV)
+		f.fail("createtemp", "b.log.fss-*", syscall.ENOSPC)
+		useFS(t, f)
+
+		var failed []string
+		cfg := Config{Ext: ".log", Del: true, XDGTrash: true, OnError: func(path string, err error) bool {
+			if !errors.Is(err, syscall.ENOSPC) {
+				t.Errorf("%s: expected error %q, got %q instead\n", path, syscall.ENOSPC, err)
+			}
+			failed = append(failed, filepath.Base(path))
+			return true
+		}}
+		if err := NewScanner(root, cfg).Run(io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(failed, " ") != "b.log" {
+			t.Errorf("expected b.log to fail, got %v instead\n", failed)
+		}
+		if left := m.paths(root); strings.Join(left, " ") != "b.log" {
+			t.Errorf("expected b.log to be left, got %v instead\n", left)
+		}
+		// The verified copy of a.log took its name, no temporary file is left
+		if files := m.paths(filepath.Join(trash, "Trash")); strings.Join(files, " ") != "files files/a.log info info/a.log.trashinfo" {
+			t.Errorf("expected a.log and its info in the trash, got %v instead\n", files)
+		}
+		if got, err := m.read(filepath.Join(trash, "Trash", "files", "a.log")); err != nil || string(got) != "first" {
+			t.Errorf("expected the content of a.log, got %q and %v instead\n", got, err)
+		}
+	})
+
+	t.Run("DedupeLinkEIO", func(t *testing.T) {
+		m, root := memTree(t, testsupport.Files(map[string]string{
+			"a.log": "same",
+			"b.log": "same",
+		}))
+		f := newFaultFS(m)
+		f.fail("link", "b.log.fss-link", syscall.EIO)
+		useFS(t, f)
+
+		err := NewScanner(root, Config{Ext: ".log", HardlinkDups: true}).Run(io.Discard)
+		if !errors.Is(err, syscall.EIO) {
+			t.Errorf("expected error %q, got %v instead\n", syscall.EIO, err)
+		}
+		if left := m.paths(root); strings.Join(left, " ") != "a.log b.log" {
+			t.Errorf("expected a.log and b.log left, got %v instead\n", left)
+		}
+
+		// Without the fault the duplicate becomes a link to the first file
+		useFS(t, m)
+		if err := NewScanner(root, Config{Ext: ".log", HardlinkDups: true}).Run(io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		a, errA := m.Lstat(filepath.Join(root, "a.log"))
+		b, errB := m.Lstat(filepath.Join(root, "b.log"))
+		if errA != nil || errB != nil || !sameFile(a, b) {
+			t.Errorf("expected b.log to be linked to a.log, got %v %v instead\n", errA, errB)
+		}
+	})
+}
+
+// TestRunMemFSArchive checks the archives written to a memFS decompress
+// to the archived files, and restore back
+func TestRunMemFSArchive(t *testing.T) {
+	m, root := memTree(t, testsupport.Files(map[string]string{
+		"a.log":     "first",
+		"sub/b.log": "second",
+	}))
+	arcDir, dest := filepath.FromSlash("/mem/arc"), filepath.FromSlash("/mem/restored")
+	if err := m.MkdirAll(arcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewScanner(root, Config{Ext: ".log", Arc: arcDir}).Run(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{"a.log": "first", "sub/b.log": "second"} {
+		data, err := m.read(filepath.Join(arcDir, filepath.FromSlash(name)+".gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: expected %q, got %q instead\n", name, content, got)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := Restore(arcDir, dest, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.read(filepath.Join(dest, "sub", "b.log")); err != nil || string(got) != "second" {
+		t.Errorf("expected sub/b.log to be restored, got %q and %v instead\n", got, err)
+	}
+	// Restored files are never overwritten
+	if err := Restore(arcDir, dest, &out); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected error %q, got %v instead\n", fs.ErrExist, err)
+	}
+}
@@ -0,0 +1,121 @@
+package fss
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitClean is the status of the tracked files git status doesn't list
+const gitClean = ".."
+
+// gitStatuses holds the git status of the files of the work tree holding
+// a scanned root
+type gitStatuses struct {
+	prefix string            // root relative to the top of the work tree, slash separated
+	codes  map[string]string // status by path relative to the top of the work tree
+}
+
+// loadGitStatus runs git status in the work tree of root with command,
+// "git" when empty, split on spaces
+func loadGitStatus(command, root string) (*gitStatuses, error) {
+	if command == "" {
+		command = "git"
+	}
+	prefix, err := runGit(command, root, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	status, err := runGit(command, root, "status", "--porcelain", "-z", "--untracked-files=all", "--ignored")
+	if err != nil {
+		return nil, err
+	}
+	codes, err := parseGitStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	return &gitStatuses{prefix: strings.TrimSpace(string(prefix)), codes: codes}, nil
+}
+
+// runGit runs the git subcommand args in root and returns its output,
+// the error holding its stderr when it fails
+func runGit(command, root string, args ...string) ([]byte, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("-report-git-status %w", ErrNoExecCmd)
+	}
+	cmd := exec.Command(fields[0], append(append(fields[1:], "-C", root), args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// parseGitStatus reads the NUL terminated entries of git status
+// --porcelain -z into the status of each path. The status is the XY code
+// of the entry with its blanks turned into dots, M. for a staged change
+// and .M for an unstaged one, as in the porcelain v2 format. Untracked
+// and ignored directories end with a slash.
+func parseGitStatus(out []byte) (map[string]string, error) {
+	codes := map[string]string{}
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if entry == "" {
+			continue
+		}
+		if len(entry) < 4 || entry[2] != ' ' {
+			return nil, fmt.Errorf("git status: unexpected entry %q", entry)
+		}
+		code := strings.ReplaceAll(entry[:2], " ", ".")
+		codes[entry[3:]] = code
+		// Renames and copies are followed by the path they came from
+		if code[0] == 'R' || code[0] == 'C' {
+			i++
+		}
+	}
+	return codes, nil
+}
+
+// of returns the status of the file at path under root, the status of
+// its untracked or ignored parent directory when it has one
+func (g *gitStatuses) of(root, file string) string {
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return gitClean
+	}
+	p := path.Join(g.prefix, filepath.ToSlash(rel))
+	if code, ok := g.codes[p]; ok {
+		return code
+	}
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if code, ok := g.codes[dir+"/"]; ok {
+			return code
+		}
+	}
+	return gitClean
+}
+
+// listGitStatus writes the git status of the file and its path, tab
+// separated
+func listGitStatus(name, status string, out io.Writer) error {
+	_, err := fmt.Fprintf(out, "%s\t%s\n", status, name)
+	return err
+}
+
+// warnGitStatus writes the warning of a root whose git status can't be
+// read, its files are listed without it
+func warnGitStatus(root string, err error, out io.Writer) error {
+	_, werr := fmt.Fprintf(out, "WARNING: no git status for %s, listing without it: %v\n", root, err)
+	return werr
+}
@@ -0,0 +1,106 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestGitCmdHelper is the git command run by the tests, it's selected
+// with FSS_TEST_GIT and gets the git arguments after --
+func TestGitCmdHelper(t *testing.T) {
+	mode := os.Getenv("FSS_TEST_GIT")
+	if mode == "" {
+		return
+	}
+	args := flag.Args()
+	if mode == "norepo" {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+	if len(args) < 3 || args[0] != "-C" {
+		fmt.Fprintf(os.Stderr, "unexpected arguments %q\n", args)
+		os.Exit(2)
+	}
+	switch args[2] {
+	case "rev-parse":
+		fmt.Println("sub/")
+	case "status":
+		fmt.Print(" M sub/changed.log\x00?? sub/new.log\x00R  sub/moved.log\x00sub/old.log\x00" +
+			"A  sub/added.log\x00!! sub/build/\x00")
+	}
+	os.Exit(0)
+}
+
+func TestParseGitStatus(t *testing.T) {
+	codes, err := parseGitStatus([]byte("MM both.go\x00R  new.go\x00old.go\x00?? dir/\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"both.go": "MM", "new.go": "R.", "dir/": "??"}
+	if !reflect.DeepEqual(expected, codes) {
+		t.Errorf("expected %v, got %v instead\n", expected, codes)
+	}
+
+	if _, err := parseGitStatus([]byte("garbage\x00")); err == nil {
+		t.Error("expected an error, got nil instead")
+	}
+}
+
+// TestRunReportGitStatus
+func TestRunReportGitStatus(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"added.log":     "dummy",
+		"build/out.log": "dummy",
+		"changed.log":   "dummy",
+		"clean.log":     "dummy",
+		"moved.log":     "dummy",
+		"new.log":       "dummy",
+	}))
+	join := func(lines ...string) string {
+		for i, line := range lines {
+			status, name := line[:2], line[3:]
+			lines[i] = status + "\t" + filepath.Join(tempDir, filepath.FromSlash(name))
+		}
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	testCases := []struct {
+		name     string
+		mode     string
+		expected string
+	}{
+		{"Repo", "repo", join("A. added.log", "!! build/out.log", ".M changed.log", ".. clean.log",
+			"R. moved.log", "?? new.log")},
+		{"NoRepo", "norepo", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("FSS_TEST_GIT", tc.mode)
+			cfg := Config{ReportGitStatus: true, gitCmd: os.Args[0] + " -test.run=^TestGitCmdHelper$ --"}
+
+			var buffer bytes.Buffer
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.mode == "norepo" {
+				lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+				if len(lines) != 7 || !strings.Contains(lines[0], "not a git repository") ||
+					lines[1] != filepath.Join(tempDir, "added.log") {
+					t.Errorf("expected a warning and the plain listing, got %q instead\n", lines)
+				}
+				return
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
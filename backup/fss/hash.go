@@ -0,0 +1,274 @@
+package fss
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Hash algorithms of the checksums, set with Config.Hash
+const (
+	HashSHA256 = "sha256"
+	HashSHA1   = "sha1"
+	HashMD5    = "md5"
+	HashXXH64  = "xxh64"
+)
+
+// hashAlgo is a hash algorithm of the registry. The content of files
+// with the same sum of a non cryptographic algorithm is compared before
+// they are handled as duplicates.
+type hashAlgo struct {
+	new    func() hash.Hash
+	crypto bool
+}
+
+// hashAlgos is the registry of the algorithms used by every feature
+// hashing files: checksums, dedupe and plans. SHA-1 and MD5 are there to
+// read legacy manifests, XXH64 when speed matters more than strength.
+var hashAlgos = map[string]hashAlgo{
+	HashSHA256: {new: sha256.New, crypto: true},
+	HashSHA1:   {new: sha1.New, crypto: true},
+	HashMD5:    {new: md5.New, crypto: true},
+	HashXXH64:  {new: newXXH64},
+}
+
+// HashAlgos returns the names of the hash algorithms, sorted
+func HashAlgos() []string {
+	names := make([]string, 0, len(hashAlgos))
+	for name := range hashAlgos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupHash returns the algorithm named algo, SHA-256 if algo is empty
+func lookupHash(algo string) (string, hashAlgo, error) {
+	if algo == "" {
+		algo = HashSHA256
+	}
+	a, ok := hashAlgos[algo]
+	if !ok {
+		return "", hashAlgo{}, fmt.Errorf("%w %q, use %s", ErrUnknownHash, algo, strings.Join(HashAlgos(), ", "))
+	}
+	return algo, a, nil
+}
+
+// hashIsCrypto reports whether algo is a cryptographic hash, unknown
+// algorithms aren't
+func hashIsCrypto(algo string) bool {
+	_, a, err := lookupHash(algo)
+	return err == nil && a.crypto
+}
+
+// hashXattr returns the extended attribute caching the algo sum of a file
+// with the size and modification time it was computed for
+func hashXattr(algo string) string {
+	return "user.fss." + algo
+}
+
+// hashFile returns the hex encoded SHA-256 of the file at path
+func hashFile(path string) (string, error) {
+	return hashFileAlgo(path, HashSHA256)
+}
+
+// hashFileAlgo returns the hex encoded algo sum of the file at path
+func hashFileAlgo(path, algo string) (string, error) {
+	_, a, err := lookupHash(algo)
+	if err != nil {
+		return "", err
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := a.new()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hasher returns the function hashing the files with the algorithm of
+// cfg, caching the checksums in extended attributes with XattrCache
+func hasher(cfg Config) func(string) (string, error) {
+	algo, _, _ := lookupHash(cfg.Hash)
+	if !cfg.XattrCache {
+		return func(path string) (string, error) {
+			return hashFileAlgo(path, algo)
+		}
+	}
+	return func(path string) (string, error) {
+		return hashFileCached(path, algo, cfg.RefreshCache)
+	}
+}
+
+// hashFileCached returns the algo sum of the file at path like
+// hashFileAlgo, from its hashXattr attribute when it was computed for the
+// current size and modification time, unless refresh is set. A computed
+// checksum is stored in the attribute. Files without extended attribute
+// support are always hashed.
+func hashFileCached(path, algo string, refresh bool) (string, error) {
+	algo, a, err := lookupHash(algo)
+	if err != nil {
+		return "", err
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	// Only the files on disk have attributes
+	osf, _ := f.(*os.File)
+	h := a.new()
+	stamp := fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+	if !refresh && osf != nil {
+		if v, err := getXattr(osf, hashXattr(algo)); err == nil {
+			var sum, size, mtime string
+			if n, _ := fmt.Sscan(string(v), &sum, &size, &mtime); n == 3 && size+" "+mtime == stamp && len(sum) == 2*h.Size() {
+				return sum, nil
+			}
+		}
+	}
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	// The cache is best effort, read only files and filesystems without
+	// attributes just don't get one
+	if osf != nil {
+		setXattr(osf, hashXattr(algo), []byte(sum+" "+stamp))
+	}
+	return sum, nil
+}
+
+type hashJob struct {
+	seq  int
+	path string
+}
+
+type hashResult struct {
+	seq  int
+	path string
+	sum  string
+	err  error
+}
+
+// hashPool hashes files on a fixed number of workers and hands the
+// results to emit in the order they were submitted. Each worker has at
+// most one file open, and at most 2*workers files are in flight between
+// Submit and emit so a slow file can't make the reorder buffer grow.
+type hashPool struct {
+	jobs     chan hashJob
+	results  chan hashResult
+	inflight chan struct{}
+	workers  sync.WaitGroup
+	done     chan struct{}
+	seq      int
+
+	mu  sync.Mutex
+	err error
+}
+
+func newHashPool(workers int, hash func(string) (string, error), emit func(path, sum string) error) *hashPool {
+	if workers < 1 {
+		workers = 1
+	}
+	hp := &hashPool{
+		jobs:     make(chan hashJob),
+		results:  make(chan hashResult, workers),
+		inflight: make(chan struct{}, 2*workers),
+		done:     make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		hp.workers.Add(1)
+		go func() {
+			defer hp.workers.Done()
+			for j := range hp.jobs {
+				sum, err := hash(j.path)
+				hp.results <- hashResult{seq: j.seq, path: j.path, sum: sum, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(hp.done)
+		pending := map[int]hashResult{}
+		next := 0
+		for r := range hp.results {
+			pending[r.seq] = r
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+
+				err := r.err
+				if err == nil && hp.failed() == nil {
+					err = emit(r.path, r.sum)
+				}
+				if err != nil {
+					hp.setErr(err)
+				}
+				<-hp.inflight
+			}
+		}
+	}()
+
+	return hp
+}
+
+func (hp *hashPool) setErr(err error) {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	if hp.err == nil {
+		hp.err = err
+	}
+}
+
+func (hp *hashPool) failed() error {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	return hp.err
+}
+
+// Submit queues path for hashing, blocking while too many files are in
+// flight. It returns the first error seen so far so the walk can stop.
+func (hp *hashPool) Submit(path string) error {
+	if err := hp.failed(); err != nil {
+		return err
+	}
+	hp.inflight <- struct{}{}
+	hp.jobs <- hashJob{seq: hp.seq, path: path}
+	hp.seq++
+	return nil
+}
+
+// Wait waits for every submitted file to be emitted and returns the
+// first error
+func (hp *hashPool) Wait() error {
+	close(hp.jobs)
+	hp.workers.Wait()
+	close(hp.results)
+	<-hp.done
+	return hp.failed()
+}
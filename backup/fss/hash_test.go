@@ -0,0 +1,270 @@
+package fss
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashFile(t *testing.T) {
+	sum, err := hashFile("testdata/dir.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile("testdata/dir.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("%x", sha256.Sum256(data))
+	if sum != expected {
+		t.Errorf("expected %q, got %q instead\n", expected, sum)
+	}
+}
+
+func TestHashFileAlgo(t *testing.T) {
+	data, err := os.ReadFile("testdata/dir.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xxh := newXXH64()
+	xxh.Write(data)
+
+	testCases := []struct {
+		algo     string
+		expected string
+	}{
+		{"", fmt.Sprintf("%x", sha256.Sum256(data))},
+		{HashSHA256, fmt.Sprintf("%x", sha256.Sum256(data))},
+		{HashSHA1, fmt.Sprintf("%x", sha1.Sum(data))},
+		{HashMD5, fmt.Sprintf("%x", md5.Sum(data))},
+		{HashXXH64, fmt.Sprintf("%x", xxh.Sum(nil))},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.algo, func(t *testing.T) {
+			sum, err := hashFileAlgo("testdata/dir.log", tc.algo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sum != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, sum)
+			}
+		})
+	}
+
+	if _, err := hashFileAlgo("testdata/dir.log", "crc32"); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("expected error %q, got %q instead\n", ErrUnknownHash, err)
+	}
+	var cerr *ConfigError
+	if err := (Config{Hash: "crc32"}).Validate(); !errors.As(err, &cerr) || cerr.Option != "Hash" {
+		t.Errorf("expected a Hash config error, got %v instead\n", err)
+	}
+}
+
+func TestHashFileCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write := func(content string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sumOf := func(content string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	}
+
+	write("aaaa", mtime)
+	if _, err := hashFileCached(path, HashSHA256, false); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = getXattr(f, hashXattr(HashSHA256))
+	f.Close()
+	if err != nil {
+		t.Skipf("no extended attributes in the temporary directory: %v", err)
+	}
+
+	// Each step rewrites the file with the same size, the mtime decides
+	// whether the cached checksum is still trusted
+	testCases := []struct {
+		name     string
+		content  string
+		mtime    time.Time
+		refresh  bool
+		expected string
+	}{
+		{name: "Cached", content: "bbbb", mtime: mtime, expected: sumOf("aaaa")},
+		{name: "Refresh", content: "bbbb", mtime: mtime, refresh: true, expected: sumOf("bbbb")},
+		{name: "Refreshed", content: "cccc", mtime: mtime, expected: sumOf("bbbb")},
+		{name: "Stale", content: "cccc", mtime: mtime.Add(time.Second), expected: sumOf("cccc")},
+		{name: "CachedAgain", content: "dddd", mtime: mtime.Add(time.Second), expected: sumOf("cccc")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			write(tc.content, tc.mtime)
+			sum, err := hashFileCached(path, HashSHA256, tc.refresh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sum != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, sum)
+			}
+		})
+	}
+}
+
+func TestHashPoolOrder(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var paths, expected []string
+	for i := 0; i < 50; i++ {
+		// Early files are the largest so they finish last
+		data := bytes.Repeat([]byte{byte(i)}, (50-i)*10000)
+		fpath := filepath.Join(tempDir, fmt.Sprintf("file%02d.log", i))
+		if err := os.WriteFile(fpath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, fpath)
+		expected = append(expected, fmt.Sprintf("%x  %s", sha256.Sum256(data), fpath))
+	}
+
+	for _, workers := range []int{1, 3, 8} {
+		t.Run(fmt.Sprintf("Workers%d", workers), func(t *testing.T) {
+			var res []string
+			hp := newHashPool(workers, hashFile, func(path, sum string) error {
+				res = append(res, sum+"  "+path)
+				return nil
+			})
+			for _, p := range paths {
+				if err := hp.Submit(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := hp.Wait(); err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Join(res, "\n") != strings.Join(expected, "\n") {
+				t.Errorf("results out of order or wrong:\n%s", strings.Join(res, "\n"))
+			}
+		})
+	}
+}
+
+func TestHashPoolError(t *testing.T) {
+	var res []string
+	hp := newHashPool(4, hashFile, func(path, sum string) error {
+		res = append(res, path)
+		return nil
+	})
+	for _, p := range []string{"testdata/dir.log", "testdata/missing.log", "testdata/log.gz"} {
+		hp.Submit(p)
+	}
+
+	if err := hp.Wait(); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v instead\n", err)
+	}
+	if len(res) != 1 || res[0] != "testdata/dir.log" {
+		t.Errorf("expected only results before the error, got %v\n", res)
+	}
+}
+
+// TestRunChecksum
+func TestRunChecksum(t *testing.T) {
+	var expected bytes.Buffer
+	for _, p := range []string{"testdata/dir.log", "testdata/dir2/script.sh", "testdata/log.gz"} {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&expected, "%x  %s\n", sha256.Sum256(data), p)
+	}
+
+	for _, cfg := range []Config{
+		{Checksum: true, HashWorkers: 2},
+		{Checksum: true, HashWorkers: 2, Sort: "path", MaxInMemory: 1},
+	} {
+		var buffer bytes.Buffer
+		if err := NewScanner("testdata", cfg).Run(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		if expected.String() != buffer.String() {
+			t.Errorf("expected %q, got %q instead\n", expected.String(), buffer.String())
+		}
+	}
+}
+
+func benchmarkHashPool(b *testing.B, workers int) {
+	tempDir := b.TempDir()
+	data := make([]byte, 4<<20)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	var paths []string
+	for i := 0; i < 32; i++ {
+		fpath := filepath.Join(tempDir, fmt.Sprintf("file%d", i))
+		if err := os.WriteFile(fpath, data, 0644); err != nil {
+			b.Fatal(err)
+		}
+		paths = append(paths, fpath)
+	}
+	b.SetBytes(int64(len(data) * len(paths)))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hp := newHashPool(workers, hashFile, func(string, string) error { return nil })
+		for _, p := range paths {
+			hp.Submit(p)
+		}
+		if err := hp.Wait(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHashPool1(b *testing.B)   { benchmarkHashPool(b, 1) }
+func BenchmarkHashPool2(b *testing.B)   { benchmarkHashPool(b, 2) }
+func BenchmarkHashPool4(b *testing.B)   { benchmarkHashPool(b, 4) }
+func BenchmarkHashPoolCPU(b *testing.B) { benchmarkHashPool(b, runtime.NumCPU()) }
+
+// BenchmarkHash compares the throughput of the hash algorithms, see the
+// README of fss for the figures
+func BenchmarkHash(b *testing.B) {
+	data := make([]byte, 1<<20)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	for _, algo := range HashAlgos() {
+		b.Run(algo, func(b *testing.B) {
+			_, a, err := lookupHash(algo)
+			if err != nil {
+				b.Fatal(err)
+			}
+			h := a.new()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				h.Reset()
+				h.Write(data)
+				h.Sum(nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package fss
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// actionEvent is one call of the OnAction hook
+type actionEvent struct {
+	action, path, dest string
+	err                error
+}
+
+// TestRunHooksList
+func TestRunHooksList(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a.log":    "dummy",
+		"skip.log": "dummy",
+		"c.txt":    "dummy",
+	})
+
+	var events []actionEvent
+	cfg := Config{
+		Ext: ".log",
+		OnMatch: func(path string, info os.FileInfo) bool {
+			return info.Name() != "skip.log"
+		},
+		OnAction: func(action, path, dest string, err error) {
+			events = append(events, actionEvent{action, path, dest, err})
+		},
+	}
+	if err := NewScanner(tempDir, cfg).Run(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(tempDir, "a.log")
+	expected := []actionEvent{{"list", path, path, nil}}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v instead\n", expected, events)
+	}
+}
+
+// TestRunHooksArchiveDelete
+func TestRunHooksArchiveDelete(t *testing.T) {
+	tempDir := t.TempDir()
+	arcDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{"sub/a.log": "dummy"})
+
+	var events []actionEvent
+	cfg := Config{
+		Ext: ".log",
+		Arc: arcDir,
+		Del: true,
+		OnAction: func(action, path, dest string, err error) {
+			events = append(events, actionEvent{action, path, dest, err})
+		},
+	}
+	// The hook takes the place of the delete log
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewScanner(tempDir, cfg).Run(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(tempDir, "sub", "a.log")
+	dest := filepath.Join(arcDir, "sub", "a.log.gz")
+	expected := []actionEvent{
+		{"archive", path, dest, nil},
+		{"delete", path, "", nil},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v, got %v instead\n", expected, events)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("expected the archive at %s, got %v instead\n", dest, err)
+	}
+}
+
+// TestRunHooksError
+func TestRunHooksError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cont     bool
+		expError bool
+		expLeft  bool
+	}{
+		{"Continue", true, false, false},
+		{"Stop", false, true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			writeFiles(t, tempDir, map[string]string{
+				"a.log": "dummy",
+				"b.log": "dummy",
+			})
+			changed := filepath.Join(tempDir, "a.log")
+
+			var failed []string
+			cfg := Config{
+				Ext: ".log",
+				Del: true,
+				// Growing a.log after the match makes its delete fail
+				OnMatch: func(path string, info os.FileInfo) bool {
+					if path == changed {
+						if err := os.WriteFile(path, []byte("dummy dummy"), 0644); err != nil {
+							t.Fatal(err)
+						}
+					}
+					return true
+				},
+				OnAction: func(action, path, dest string, err error) {},
+				OnError: func(path string, err error) bool {
+					if !errors.Is(err, ErrChanged) {
+						t.Errorf("expected error %q, got %q instead\n", ErrChanged, err)
+					}
+					failed = append(failed, path)
+					return tc.cont
+				},
+			}
+			err := NewScanner(tempDir, cfg).Run(nil)
+			if tc.expError != (err != nil) {
+				t.Fatalf("expected error %t, got %v instead\n", tc.expError, err)
+			}
+
+			if !reflect.DeepEqual(failed, []string{changed}) {
+				t.Errorf("expected OnError for %s, got %v instead\n", changed, failed)
+			}
+			_, err = os.Stat(filepath.Join(tempDir, "b.log"))
+			if tc.expLeft != (err == nil) {
+				t.Errorf("expected b.log left %t, got %v instead\n", tc.expLeft, err)
+			}
+		})
+	}
+}
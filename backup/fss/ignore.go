@@ -0,0 +1,239 @@
+package fss
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the files holding the patterns of the paths a
+// scan always leaves alone, in the root or any directory under it
+const IgnoreFile = ".fssignore"
+
+// ignoreRule is a pattern of an ignore file, split on slashes
+type ignoreRule struct {
+	segs     []string
+	negate   bool // re-include the paths matched by an earlier rule
+	dirOnly  bool // match directories only
+	anchored bool // match relative to the directory of the file only, not below it
+}
+
+// parseIgnore reads the rules of the ignore file at file. Blank lines and
+// lines starting with # are skipped, a leading backslash escapes a # or !.
+func parseIgnore(file string) ([]ignoreRule, error) {
+	f, err := fsys.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		rule, ok, err := parseIgnoreLine(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, n, err)
+		}
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, sc.Err()
+}
+
+// parseIgnoreLine parses a line of an ignore file, ok is false for the
+// lines without a pattern
+func parseIgnoreLine(line string) (rule ignoreRule, ok bool, err error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || line[0] == '#' {
+		return rule, false, nil
+	}
+	switch {
+	case line[0] == '!':
+		rule.negate, line = true, line[1:]
+	case strings.HasPrefix(line, `\#`), strings.HasPrefix(line, `\!`):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	// A slash at the start or in the middle ties the pattern to the
+	// directory of the file
+	if strings.Contains(line, "/") {
+		rule.anchored, line = true, strings.TrimLeft(line, "/")
+	}
+	if line == "" {
+		return rule, false, nil
+	}
+
+	rule.segs = strings.Split(line, "/")
+	for _, seg := range rule.segs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return rule, false, fmt.Errorf("invalid pattern %q", line)
+		}
+	}
+	return rule, true, nil
+}
+
+// match reports whether the rule matches rel, the slash separated path
+// relative to the directory of its file
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	names := strings.Split(rel, "/")
+	if !r.anchored {
+		return matchSegs(r.segs, names[len(names)-1:])
+	}
+	return matchSegs(r.segs, names)
+}
+
+// matchSegs matches the names of a path against pattern segments, where a
+// ** segment matches any number of names
+func matchSegs(segs, names []string) bool {
+	for len(segs) > 0 {
+		if segs[0] == "**" {
+			rest := segs[1:]
+			// A trailing ** matches everything inside, not the directory
+			if len(rest) == 0 {
+				return len(names) > 0
+			}
+			for i := 0; i <= len(names); i++ {
+				if matchSegs(rest, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(segs[0], names[0]); !ok {
+			return false
+		}
+		segs, names = segs[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// ignores holds the exclude patterns of a scan and the rules of the
+// ignore files under root, read once per directory the first time they're
+// needed
+type ignores struct {
+	root    string
+	exclude []ignoreRule
+	files   bool // read the ignore files
+	rules   map[string][]ignoreRule
+}
+
+// newIgnores returns the ignores of the tree under root, nil when cfg has
+// no exclude patterns and the ignore files are disabled
+func newIgnores(root string, cfg Config) (*ignores, error) {
+	if cfg.NoIgnore && len(cfg.Exclude) == 0 {
+		return nil, nil
+	}
+	ig := &ignores{root: filepath.Clean(root), files: !cfg.NoIgnore, rules: map[string][]ignoreRule{}}
+	for _, pattern := range cfg.Exclude {
+		rule, err := parseExclude(pattern, root)
+		if err != nil {
+			return nil, err
+		}
+		ig.exclude = append(ig.exclude, rule)
+	}
+	return ig, nil
+}
+
+// dirRules returns the rules of the ignore file of dir, if any
+func (ig *ignores) dirRules(dir string) ([]ignoreRule, error) {
+	if rules, ok := ig.rules[dir]; ok {
+		return rules, nil
+	}
+	rules, err := parseIgnore(filepath.Join(dir, IgnoreFile))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ig.rules[dir] = rules
+	return rules, nil
+}
+
+// ignored reports whether path is matched by an exclude pattern, or by
+// the ignore files of its parent directories. The rules of deeper files
+// come after the shallower ones, and the last rule matching wins. The
+// ignore files themselves are always ignored so the actions never remove
+// them.
+func (ig *ignores) ignored(p string, isDir bool) (bool, error) {
+	p = filepath.Clean(p)
+	if p == ig.root || !inside(p, ig.root) {
+		return false, nil
+	}
+	if len(ig.exclude) > 0 {
+		rel, err := filepath.Rel(ig.root, p)
+		if err != nil {
+			return false, err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, r := range ig.exclude {
+			if r.match(rel, isDir) {
+				return true, nil
+			}
+		}
+	}
+	if !ig.files {
+		return false, nil
+	}
+	if !isDir && filepath.Base(p) == IgnoreFile {
+		return true, nil
+	}
+
+	var dirs []string
+	for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == ig.root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rules, err := ig.dirRules(dirs[i])
+		if err != nil {
+			return false, err
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		rel, err := filepath.Rel(dirs[i], p)
+		if err != nil {
+			return false, err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, r := range rules {
+			if r.match(rel, isDir) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored, nil
+}
+
+// ignoredTree reports whether path or one of the directories between it
+// and the root is ignored. The walks skip ignored directories instead,
+// this is for the paths found without walking down to them.
+func (ig *ignores) ignoredTree(p string, isDir bool) (bool, error) {
+	p = filepath.Clean(p)
+	for dir := filepath.Dir(p); dir != ig.root && inside(dir, ig.root); dir = filepath.Dir(dir) {
+		if ok, err := ig.ignored(dir, true); ok || err != nil {
+			return ok, err
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	return ig.ignored(p, isDir)
+}
@@ -0,0 +1,178 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRuleMatch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pattern  string
+		rel      string
+		isDir    bool
+		expected bool
+	}{
+		{"Glob", "*.keep", "a.keep", false, true},
+		{"GlobDeeper", "*.keep", "sub/dir/a.keep", false, true},
+		{"GlobOtherExt", "*.keep", "a.log", false, false},
+		{"Name", "important", "sub/important", true, true},
+		{"DirOnlyDir", "important/", "important", true, true},
+		{"DirOnlyFile", "important/", "important", false, false},
+		{"Anchored", "/a.log", "a.log", false, true},
+		{"AnchoredDeeper", "/a.log", "sub/a.log", false, false},
+		{"MiddleSlash", "logs/*.gz", "logs/a.gz", false, true},
+		{"MiddleSlashDeeper", "logs/*.gz", "sub/logs/a.gz", false, false},
+		{"LeadingStars", "**/tmp", "a/b/tmp", true, true},
+		{"LeadingStarsTop", "**/tmp", "tmp", true, true},
+		{"MiddleStars", "a/**/b.log", "a/x/y/b.log", false, true},
+		{"MiddleStarsNone", "a/**/b.log", "a/b.log", false, true},
+		{"TrailingStars", "a/**", "a/x/y", false, true},
+		{"TrailingStarsDir", "a/**", "a", true, false},
+		{"StarNoSlash", "a/*", "a/x/y", false, false},
+		{"Negated", "!*.keep", "a.keep", false, true},
+		{"EscapedHash", `\#notes`, "#notes", false, true},
+		{"EscapedBang", `\!important`, "!important", false, true},
+		{"TrailingSpaces", "*.keep  ", "a.keep", false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, ok, err := parseIgnoreLine(tc.pattern)
+			if err != nil || !ok {
+				t.Fatalf("expected a rule, got %v, %v instead\n", ok, err)
+			}
+			if res := rule.match(tc.rel, tc.isDir); res != tc.expected {
+				t.Errorf("expected %t, got %t instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestParseIgnoreLine(t *testing.T) {
+	testCases := []struct {
+		name   string
+		line   string
+		expOk  bool
+		expErr bool
+		negate bool
+	}{
+		{name: "Blank", line: "   "},
+		{name: "Comment", line: "# keep these"},
+		{name: "Slash", line: "/"},
+		{name: "Pattern", line: "*.keep", expOk: true},
+		{name: "Negation", line: "!a.keep", expOk: true, negate: true},
+		{name: "BadPattern", line: "[a-", expErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, ok, err := parseIgnoreLine(tc.line)
+			if (err != nil) != tc.expErr {
+				t.Fatalf("expected error %t, got %v instead\n", tc.expErr, err)
+			}
+			if ok != tc.expOk || rule.negate != tc.negate {
+				t.Errorf("expected %t and negate %t, got %t and %t instead\n", tc.expOk, tc.negate, ok, rule.negate)
+			}
+		})
+	}
+}
+
+// TestRunIgnore
+func TestRunIgnore(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		".fssignore":              "# protected\n*.keep\nimportant/\n/top.log\n!sub/again.keep\n",
+		"a.log":                   "dummy",
+		"top.log":                 "dummy",
+		"b.keep":                  "dummy",
+		"important/c.log":         "dummy",
+		"sub/top.log":             "dummy",
+		"sub/again.keep":          "dummy",
+		"sub/other.keep":          "dummy",
+		"sub/deeper/.fssignore":   "!*.keep\n*.log\n",
+		"sub/deeper/d.log":        "dummy",
+		"sub/deeper/e.keep":       "dummy",
+		"sub/deeper/important/f":  "dummy",
+		"sub/deeper/nested/g.txt": "dummy",
+	}))
+	join := func(paths ...string) string {
+		var sb strings.Builder
+		for _, p := range paths {
+			sb.WriteString(filepath.Join(tempDir, filepath.FromSlash(p)) + "\n")
+		}
+		return sb.String()
+	}
+
+	testCases := []struct {
+		name     string
+		noIgnore bool
+		expected string
+	}{
+		{
+			name: "Ignore",
+			expected: join("a.log", "sub/again.keep", "sub/deeper/e.keep",
+				"sub/deeper/nested/g.txt", "sub/top.log"),
+		},
+		{
+			name:     "NoIgnore",
+			noIgnore: true,
+			expected: join(".fssignore", "a.log", "b.keep", "important/c.log", "sub/again.keep",
+				"sub/deeper/.fssignore", "sub/deeper/d.log", "sub/deeper/e.keep", "sub/deeper/important/f",
+				"sub/deeper/nested/g.txt", "sub/other.keep", "sub/top.log", "top.log"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{List: true, NoIgnore: tc.noIgnore}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunIgnoreDelete checks the ignored files survive a delete of the tree
+func TestRunIgnoreDelete(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		".fssignore": "*.keep\n",
+		"a.log":      "dummy",
+		"b.keep":     "dummy",
+	}))
+
+	var logBuffer bytes.Buffer
+	cfg := Config{Del: true, LogWriter: &logBuffer}
+	if err := NewScanner(tempDir, cfg).Run(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{".fssignore", "b.keep"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Errorf("expected %s to be kept, got %v instead\n", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "a.log")); !os.IsNotExist(err) {
+		t.Errorf("expected a.log to be deleted, got %v instead\n", err)
+	}
+}
+
+func TestRunIgnoreInvalid(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		".fssignore": "*.keep\n[a-\n",
+		"a.log":      "dummy",
+	}))
+
+	err := NewScanner(tempDir, Config{List: true}).Run(&bytes.Buffer{})
+	expected := filepath.Join(tempDir, ".fssignore") + `:2: invalid pattern "[a-"`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v instead\n", expected, err)
+	}
+}
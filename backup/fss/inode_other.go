@@ -0,0 +1,20 @@
+//go:build windows
+
+package fss
+
+import "os"
+
+// fileID is not available without inodes
+func fileID(info os.FileInfo) (inode, bool) {
+	return inode{}, false
+}
+
+// fileLinks counts every file as its only link
+func fileLinks(info os.FileInfo) uint64 {
+	return 1
+}
+
+// fileOwner is not available without uids
+func fileOwner(info os.FileInfo) (uint32, bool) {
+	return 0, false
+}
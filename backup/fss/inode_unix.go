@@ -0,0 +1,38 @@
+//go:build !windows
+
+package fss
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode of info, false when they are not
+// available
+func fileID(info os.FileInfo) (inode, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inode{}, false
+	}
+	return inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// fileLinks returns the number of hard links of info, 1 when it is not
+// available
+func fileLinks(info os.FileInfo) uint64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 1
+	}
+	return uint64(st.Nlink)
+}
+
+// fileOwner returns the uid of the owner of info, false when it is not
+// available
+func fileOwner(info os.FileInfo) (uint32, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return st.Uid, true
+}
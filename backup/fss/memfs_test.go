@@ -0,0 +1,506 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// useFS makes f the filesystem of the scans until the end of the test
+func useFS(t testing.TB, f fileSystem) {
+	t.Helper()
+	orig := fsys
+	fsys = f
+	t.Cleanup(func() { fsys = orig })
+}
+
+// memTree builds the entries, declared as with testsupport.Tree, in a new
+// memFS made the filesystem of the test, and returns their root
+func memTree(t testing.TB, entries map[string]testsupport.Spec) (*memFS, string) {
+	t.Helper()
+	m := newMemFS()
+	root := filepath.FromSlash("/mem/root")
+	if err := m.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for p, spec := range entries {
+		path := filepath.Join(root, filepath.FromSlash(p))
+		if err := m.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case spec.Dir:
+			if err := m.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+		case spec.Symlink != "":
+			t.Fatalf("%s: memFS has no symbolic links", p)
+		default:
+			data := []byte(spec.Content)
+			if spec.Content == "" && spec.Size > 0 {
+				data = bytes.Repeat([]byte("x"), int(spec.Size))
+			}
+			m.write(path, data)
+		}
+		if spec.MTime != 0 {
+			mtime := now.Add(spec.MTime)
+			if err := m.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	useFS(t, m)
+	return m, root
+}
+
+// memNode is a file or directory of a memFS
+type memNode struct {
+	dir   bool
+	data  []byte
+	mtime time.Time
+}
+
+// memFS is an in-memory fileSystem. Hard links share their node, there
+// are no symbolic links. The parent of an entry
+// has to exist, as on disk; the root of the paths always does.
+type memFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+	temps int // files made by CreateTemp so far, numbering their names
+}
+
+func newMemFS() *memFS {
+	return &memFS{nodes: map[string]*memNode{}}
+}
+
+// memInfo is the FileInfo of a memNode, with its content when it was
+// taken
+type memInfo struct {
+	name  string
+	node  *memNode
+	size  int64
+	mtime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return i.mtime }
+func (i memInfo) IsDir() bool        { return i.node.dir }
+func (i memInfo) Sys() interface{}   { return nil }
+
+func (i memInfo) Mode() os.FileMode {
+	if i.node.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// SameFile reports whether o is the same node, for sameFile
+func (i memInfo) SameFile(o os.FileInfo) bool {
+	oi, ok := o.(memInfo)
+	return ok && oi.node == i.node
+}
+
+// lookup returns the node at name, a directory for the root of the paths
+func (m *memFS) lookup(op, name string) (*memNode, error) {
+	name = filepath.Clean(name)
+	if filepath.Dir(name) == name {
+		return &memNode{dir: true}, nil
+	}
+	n, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+func (m *memFS) info(name string, n *memNode) memInfo {
+	return memInfo{name: filepath.Base(name), node: n, size: int64(len(n.data)), mtime: n.mtime}
+}
+
+// write sets the content of the file at name, creating it
+func (m *memFS) write(name string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes[filepath.Clean(name)] = &memNode{data: data, mtime: time.Now()}
+}
+
+// read returns the content of the file at name
+func (m *memFS) read(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), n.data...), nil
+}
+
+// paths returns the slash separated paths of the entries under root,
+// relative to it and sorted
+func (m *memFS) paths(root string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var paths []string
+	for p := range m.nodes {
+		if rel, err := filepath.Rel(root, p); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// memFile is a file of a memFS open for reading
+type memFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f memFile) Stat() (os.FileInfo, error) { return f.info, nil }
+func (f memFile) Close() error               { return nil }
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return memFile{Reader: bytes.NewReader(n.data), info: m.info(name, n)}, nil
+}
+
+// memWriter appends to a file of a memFS
+type memWriter struct {
+	m    *memFS
+	node *memNode
+}
+
+func (w memWriter) Write(p []byte) (int, error) {
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+	w.node.data = append(w.node.data, p...)
+	w.node.mtime = time.Now()
+	return len(p), nil
+}
+
+func (w memWriter) Close() error { return nil }
+
+func (m *memFS) Create(name string, excl bool) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if parent, err := m.lookup("open", filepath.Dir(name)); err != nil || !parent.dir {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	n, ok := m.nodes[name]
+	if ok && (excl || n.dir) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+	if !ok {
+		n = &memNode{}
+		m.nodes[name] = n
+	}
+	n.data, n.mtime = nil, time.Now()
+	return memWriter{m: m, node: n}, nil
+}
+
+// memTemp is a file of a memFS made by CreateTemp. The modes of a memFS
+// are fixed, Chmod keeps them.
+type memTemp struct {
+	memWriter
+	name string
+}
+
+func (f memTemp) Name() string                 { return f.name }
+func (f memTemp) Chmod(mode os.FileMode) error { return nil }
+func (f memTemp) Sync() error                  { return nil }
+
+func (m *memFS) CreateTemp(dir, pattern string) (tempFile, error) {
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for {
+		m.mu.Lock()
+		m.temps++
+		name := filepath.Join(dir, prefix+strconv.Itoa(m.temps)+suffix)
+		m.mu.Unlock()
+		w, err := m.Create(name, true)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return memTemp{memWriter: w.(memWriter), name: name}, nil
+	}
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) { return m.read(name) }
+
+func (m *memFS) Lstat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return m.info(name, n), nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return m.info(name, n), nil
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	n, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.dir {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	var entries []fs.DirEntry
+	for p, c := range m.nodes {
+		if filepath.Dir(p) == name && p != name {
+			entries = append(entries, fs.FileInfoToDirEntry(m.info(p, c)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *memFS) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := filepath.Clean(name); filepath.Dir(p) != p; p = filepath.Dir(p) {
+		if n, ok := m.nodes[p]; ok {
+			if !n.dir {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+		m.nodes[p] = &memNode{dir: true, mtime: time.Now()}
+	}
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, err := m.lookup("remove", name); err != nil {
+		return err
+	}
+	for p := range m.nodes {
+		if filepath.Dir(p) == name && p != name {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	n, err := m.lookup("rename", oldpath)
+	if err != nil {
+		return err
+	}
+	if parent, err := m.lookup("rename", filepath.Dir(newpath)); err != nil || !parent.dir {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	moved := map[string]*memNode{newpath: n}
+	prefix := oldpath + string(filepath.Separator)
+	for p, c := range m.nodes {
+		if strings.HasPrefix(p, prefix) {
+			moved[filepath.Join(newpath, p[len(prefix):])] = c
+			delete(m.nodes, p)
+		}
+	}
+	delete(m.nodes, oldpath)
+	for p, c := range moved {
+		m.nodes[p] = c
+	}
+	return nil
+}
+
+func (m *memFS) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	n, err := m.lookup("link", oldname)
+	if err != nil {
+		return err
+	}
+	if parent, err := m.lookup("link", filepath.Dir(newname)); err != nil || !parent.dir {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.nodes[newname]; ok || n.dir {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	m.nodes[newname] = n
+	return nil
+}
+
+func (m *memFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	n.mtime = mtime
+	return nil
+}
+
+// faultFS wraps a fileSystem, counting the calls of each operation and
+// making the ones set with fail return an error
+type faultFS struct {
+	fileSystem
+
+	mu    sync.Mutex
+	errs  map[[2]string]error // error by operation and path suffix
+	calls map[string]int
+}
+
+func newFaultFS(base fileSystem) *faultFS {
+	return &faultFS{fileSystem: base, errs: map[[2]string]error{}, calls: map[string]int{}}
+}
+
+// fail makes op, the name of the fileSystem method in lower case, fail
+// with err on the paths ending with suffix, every path if suffix is empty
+func (f *faultFS) fail(op, suffix string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[[2]string{op, suffix}] = err
+}
+
+// count returns the number of calls of op so far
+func (f *faultFS) count(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// call counts a call of op on path and returns the error it was set to
+// fail with, as a *fs.PathError
+func (f *faultFS) call(op, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[op]++
+	for key, err := range f.errs {
+		if key[0] == op && strings.HasSuffix(path, key[1]) {
+			return &fs.PathError{Op: op, Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+func (f *faultFS) Open(name string) (fs.File, error) {
+	if err := f.call("open", name); err != nil {
+		return nil, err
+	}
+	return f.fileSystem.Open(name)
+}
+
+func (f *faultFS) Create(name string, excl bool) (io.WriteCloser, error) {
+	if err := f.call("create", name); err != nil {
+		return nil, err
+	}
+	return f.fileSystem.Create(name, excl)
+}
+
+func (f *faultFS) CreateTemp(dir, pattern string) (tempFile, error) {
+	if err := f.call("createtemp", filepath.Join(dir, pattern)); err != nil {
+		return nil, err
+	}
+	return f.fileSystem.CreateTemp(dir, pattern)
+}
+
+func (f *faultFS) ReadFile(name string) ([]byte, error) {
+	if err := f.call("readfile", name); err != nil {
+		return nil, err
+	}
+	return f.fileSystem.ReadFile(name)
+}
+
+func (f *faultFS) Lstat(name string) (os.FileInfo, error) {
+	if err := f.call("lstat", name); err != nil {
+		return nil, err
+	}
+	return f.fileSystem.Lstat(name)
+}
+
+func (f *faultFS) Stat(name string) (os.FileInfo, error) {
+	if err := f.call("stat", name); err != nil {
+		return nil, err
+	}
+	return f.fileSystem.Stat(name)
+}
+
+func (f *faultFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.call("readdir", name); err != nil {
+		return nil, err
+	}
+	return f.fileSystem.ReadDir(name)
+}
+
+func (f *faultFS) MkdirAll(name string, perm os.FileMode) error {
+	if err := f.call("mkdirall", name); err != nil {
+		return err
+	}
+	return f.fileSystem.MkdirAll(name, perm)
+}
+
+func (f *faultFS) Remove(name string) error {
+	if err := f.call("remove", name); err != nil {
+		return err
+	}
+	return f.fileSystem.Remove(name)
+}
+
+func (f *faultFS) Rename(oldpath, newpath string) error {
+	if err := f.call("rename", oldpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*fs.PathError).Err}
+	}
+	return f.fileSystem.Rename(oldpath, newpath)
+}
+
+func (f *faultFS) Link(oldname, newname string) error {
+	if err := f.call("link", newname); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err.(*fs.PathError).Err}
+	}
+	return f.fileSystem.Link(oldname, newname)
+}
+
+func (f *faultFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := f.call("chtimes", name); err != nil {
+		return err
+	}
+	return f.fileSystem.Chtimes(name, atime, mtime)
+}
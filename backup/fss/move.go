@@ -0,0 +1,83 @@
+package fss
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"syscall"
+)
+
+// moveFile moves the file at src to dst. It is renamed when both are on
+// the same filesystem. When the rename fails with EXDEV, src is copied
+// next to dst and the copy renamed to dst once it is checked against src,
+// then pending is called with both paths before src is removed. An
+// interruption leaves src as it was, or its verified copy at dst with a
+// pending delete of src. copied reports which way the file was moved.
+func moveFile(src, dst string, pending func(src, dst string)) (copied bool, err error) {
+	err = fsys.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return false, err
+	}
+	if err := copyVerified(src, dst); err != nil {
+		return true, err
+	}
+	if pending != nil {
+		pending(src, dst)
+	}
+	if err := fsys.Remove(src); err != nil {
+		return true, fmt.Errorf("%s copied to %s, removing it: %w", src, dst, err)
+	}
+	return true, nil
+}
+
+// copyVerified copies the file at src to a temporary file in the
+// directory of dst, with the permissions and modification time of src.
+// The copy is read back and renamed to dst only if it has the size and
+// SHA-256 of what was read from src.
+func copyVerified(src, dst string) error {
+	in, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := fsys.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".fss-*")
+	if err != nil {
+		return err
+	}
+	defer fsys.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), in)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := fsys.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+
+	sum, err := hashFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if n != info.Size() || sum != hex.EncodeToString(h.Sum(nil)) {
+		return fmt.Errorf("copy of %s to %s %w", src, dst, ErrCopyMismatch)
+	}
+	return fsys.Rename(tmp.Name(), dst)
+}
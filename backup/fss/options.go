@@ -0,0 +1,589 @@
+package fss
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Option configures a Scanner built with New
+type Option func(*Config)
+
+// ConfigError reports an invalid or incompatible scan configuration.
+// Err holds the underlying error when there is one.
+type ConfigError struct {
+	Option string
+	Reason string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid %s: %s: %v", e.Option, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Option, e.Reason)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// New returns a Scanner for the tree under root configured by opts. It
+// checks the resulting Config with Validate and returns a *ConfigError
+// for invalid combinations. This is the preferred way to build a Scanner
+// from library code.
+func New(root string, opts ...Option) (*Scanner, error) {
+	var cfg Config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return NewScanner(root, cfg), nil
+}
+
+// Validate checks the Config for invalid values and options that can't
+// be used together. The error is always a *ConfigError.
+func (c Config) Validate() error {
+	if c.Size < 0 {
+		return &ConfigError{Option: "Size", Reason: "must not be negative"}
+	}
+	if c.List && (c.Del || c.Arc != "") {
+		return &ConfigError{Option: "List", Reason: "can't be combined with delete or archive"}
+	}
+	if c.XDGTrash && !c.Del {
+		return &ConfigError{Option: "XDGTrash", Reason: "needs Del"}
+	}
+	if c.TouchArchiveStamp && c.Arc == "" {
+		return &ConfigError{Option: "TouchArchiveStamp", Reason: "needs Arc"}
+	}
+	if c.SplitByMonth && c.Arc == "" {
+		return &ConfigError{Option: "SplitByMonth", Reason: "needs Arc"}
+	}
+	if c.Del && c.LogWriter == nil && c.OnAction == nil {
+		return &ConfigError{Option: "Del", Reason: "needs a log writer or an OnAction hook"}
+	}
+	if c.ScanArchives {
+		if err := checkScanArchives(c); err != nil {
+			return &ConfigError{Option: "ScanArchives", Reason: "incompatible options", Err: err}
+		}
+	}
+	if c.ReplaceOld == "" && (c.ReplaceNew != "" || c.ReplaceDryRun || c.ReplaceCount != 0) {
+		return &ConfigError{Option: "ReplaceNew", Reason: "needs ReplaceOld"}
+	}
+	if c.ReplaceOld != "" && (c.List || c.Del || c.Arc != "" || c.HardlinkDups) {
+		return &ConfigError{Option: "ReplaceOld", Reason: "can't be combined with list, delete, archive or hardlink dups"}
+	}
+	if c.Exec != "" && (c.List || c.Del || c.Arc != "" || c.HardlinkDups || c.ReplaceOld != "") {
+		return &ConfigError{Option: "Exec", Reason: "can't be combined with list, delete, archive, hardlink dups or replace"}
+	}
+	if c.Exec != "" {
+		if _, err := execArgs(c.Exec, ""); err != nil {
+			return &ConfigError{Option: "Exec", Reason: "empty command", Err: err}
+		}
+	}
+	if c.ExecOnMatchDir != "" {
+		if _, err := execArgs(c.ExecOnMatchDir, ""); err != nil {
+			return &ConfigError{Option: "ExecOnMatchDir", Reason: "empty command", Err: err}
+		}
+	}
+	if c.HumanSizes && !c.ReportByOwner && c.BigDirs == 0 {
+		return &ConfigError{Option: "ReportByOwner", Reason: "needed by human sizes, unless BigDirs is set"}
+	}
+	if c.JSONReport && !c.ReportByOwner && c.BigDirs == 0 && !c.WC {
+		return &ConfigError{Option: "ReportByOwner", Reason: "needed by JSON reports, unless BigDirs or WC is set"}
+	}
+	for _, o := range []struct {
+		name   string
+		suffix string
+	}{{"AppendSuffix", c.AppendSuffix}, {"StripSuffix", c.StripSuffix}} {
+		if o.suffix == "" {
+			continue
+		}
+		if strings.ContainsAny(o.suffix, "/"+string(filepath.Separator)) {
+			return &ConfigError{Option: o.name, Reason: "must not hold a path separator"}
+		}
+		if c.List || c.Del || c.HardlinkDups || c.ReplaceOld != "" || c.Exec != "" || c.WC || c.Sample != "" {
+			return &ConfigError{Option: o.name, Reason: "can't be combined with list, delete, hardlink dups, replace, exec, WC or Sample"}
+		}
+	}
+	if c.AppendSuffix != "" && c.StripSuffix != "" {
+		return &ConfigError{Option: "StripSuffix", Reason: "can't be combined with AppendSuffix"}
+	}
+	if c.RenameCollision != "" && c.AppendSuffix == "" && c.StripSuffix == "" {
+		return &ConfigError{Option: "RenameCollision", Reason: "needs AppendSuffix or StripSuffix"}
+	}
+	if err := checkRenameCollision(c.RenameCollision); err != nil {
+		return &ConfigError{Option: "RenameCollision", Reason: "unknown strategy", Err: err}
+	}
+	if err := checkFileReports(c); err != nil {
+		return err
+	}
+	if c.CSVColumnCount != 0 && !c.ReportCSVValidity {
+		return &ConfigError{Option: "CSVColumnCount", Reason: "needs ReportCSVValidity"}
+	}
+	if c.LinesOnly && !c.WC {
+		return &ConfigError{Option: "LinesOnly", Reason: "needs WC"}
+	}
+	if c.WC && (c.Del || c.Arc != "" || c.HardlinkDups || c.ReplaceOld != "" || c.Exec != "") {
+		return &ConfigError{Option: "WC", Reason: "can't be combined with delete, archive, hardlink dups, replace or exec"}
+	}
+	if err := checkCtime(c); err != nil {
+		option := "CNewer"
+		if c.CNewer <= 0 {
+			option = "COlder"
+		}
+		return &ConfigError{Option: option, Reason: "unsupported", Err: err}
+	}
+	if c.List && c.HardlinkDups {
+		return &ConfigError{Option: "List", Reason: "can't be combined with hardlink dups"}
+	}
+	for _, o := range []struct {
+		name  string
+		paths []string
+	}{{"ExcludeMounts", c.ExcludeMounts}, {"ExcludeMountPrefixes", c.ExcludeMountPrefixes}} {
+		for _, p := range o.paths {
+			if p == "" {
+				return &ConfigError{Option: o.name, Reason: "empty path"}
+			}
+		}
+	}
+	for _, pattern := range c.Exclude {
+		if _, err := parseExclude(pattern, ""); err != nil {
+			return &ConfigError{Option: "Exclude", Reason: "invalid pattern", Err: err}
+		}
+	}
+	if c.Sort != "" {
+		if _, err := recordLess(c.Sort); err != nil {
+			return &ConfigError{Option: "Sort", Reason: "unknown key", Err: err}
+		}
+	}
+	if c.Sample != "" {
+		if _, _, err := parseSample(c.Sample); err != nil {
+			return &ConfigError{Option: "Sample", Reason: "invalid size", Err: err}
+		}
+		if c.Del || c.Arc != "" || c.HardlinkDups || c.ReplaceOld != "" || c.Exec != "" {
+			return &ConfigError{Option: "Sample", Reason: "can't be combined with delete, archive, hardlink dups, replace or exec"}
+		}
+		if c.SieveN > 0 {
+			return &ConfigError{Option: "Sample", Reason: "can't be combined with SieveN"}
+		}
+	}
+	for _, o := range []struct {
+		name  string
+		value float64
+	}{{"MinEntropy", c.MinEntropy}, {"MaxEntropy", c.MaxEntropy}} {
+		if o.value < 0 || o.value > 8 {
+			return &ConfigError{Option: o.name, Reason: "must be between 0 and 8 bits per byte"}
+		}
+	}
+	if c.MinEntropy > 0 && c.MaxEntropy > 0 && c.MinEntropy > c.MaxEntropy {
+		return &ConfigError{Option: "MinEntropy", Reason: "must not be above MaxEntropy"}
+	}
+	if c.EntropyKiB < 0 {
+		return &ConfigError{Option: "EntropyKiB", Reason: "must not be negative"}
+	}
+	if err := checkWalkOrder(c.WalkOrder); err != nil {
+		return &ConfigError{Option: "WalkOrder", Reason: "unknown order", Err: err}
+	}
+	if _, _, err := lookupHash(c.Hash); err != nil {
+		return &ConfigError{Option: "Hash", Reason: "unknown algorithm", Err: err}
+	}
+	if _, _, err := parseLevel(c.Level); err != nil {
+		return &ConfigError{Option: "Level", Reason: "unknown level", Err: err}
+	}
+	if c.FromSnapshot {
+		if err := checkSnapshot(c); err != nil {
+			return &ConfigError{Option: "FromSnapshot", Reason: "incompatible options", Err: err}
+		}
+	}
+	if c.NoStat {
+		if err := checkNoStat(c); err != nil {
+			return &ConfigError{Option: "NoStat", Reason: "incompatible options", Err: err}
+		}
+	}
+	if _, err := checkArcName(c); err != nil {
+		return &ConfigError{Option: "ArcName", Reason: "invalid template", Err: err}
+	}
+	if c.RequireEncoding != "" {
+		if _, err := parseFileEncoding(c.RequireEncoding); err != nil {
+			return &ConfigError{Option: "RequireEncoding", Reason: "unknown encoding", Err: err}
+		}
+	}
+	if _, err := NewEncodedWriter(io.Discard, c.OutputEncoding); err != nil {
+		return &ConfigError{Option: "OutputEncoding", Reason: "unknown encoding", Err: err}
+	}
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{
+		{"Pace", c.Pace},
+		{"HashWorkers", float64(c.HashWorkers)},
+		{"DeleteWorkers", float64(c.DeleteWorkers)},
+		{"MaxInMemory", float64(c.MaxInMemory)},
+		{"DedupeLinkThreshold", float64(c.DedupeLinkThreshold)},
+		{"MaxFileSize", float64(c.MaxFileSize)},
+		{"ZipEntryLimit", float64(c.ZipEntryLimit)},
+		{"CSVColumnCount", float64(c.CSVColumnCount)},
+		{"ArchiveDepth", float64(c.ArchiveDepth)},
+		{"ReplaceCount", float64(c.ReplaceCount)},
+		{"ExecParallel", float64(c.ExecParallel)},
+		{"BigDirs", float64(c.BigDirs)},
+		{"CNewer", float64(c.CNewer)},
+		{"COlder", float64(c.COlder)},
+	} {
+		if v.value < 0 {
+			return &ConfigError{Option: v.name, Reason: "must not be negative"}
+		}
+	}
+	return nil
+}
+
+// WithExt matches only files with the extension ext, dot included
+func WithExt(ext string) Option {
+	return func(c *Config) { c.Ext = ext }
+}
+
+// WithExclude skips the paths matching the rsync style patterns, on top
+// of the ones already set
+func WithExclude(patterns ...string) Option {
+	return func(c *Config) { c.Exclude = append(c.Exclude, patterns...) }
+}
+
+// WithExcludeMounts skips the directories at paths, on top of the ones
+// already set
+func WithExcludeMounts(paths ...string) Option {
+	return func(c *Config) { c.ExcludeMounts = append(c.ExcludeMounts, paths...) }
+}
+
+// WithExcludeMountPrefixes skips the directories whose path starts with
+// one of prefixes, on top of the ones already set
+func WithExcludeMountPrefixes(prefixes ...string) Option {
+	return func(c *Config) { c.ExcludeMountPrefixes = append(c.ExcludeMountPrefixes, prefixes...) }
+}
+
+// WithMinSize matches only files of at least n bytes
+func WithMinSize(n int64) Option {
+	return func(c *Config) { c.Size = n }
+}
+
+// WithMaxSize matches only files of at most n bytes
+func WithMaxSize(n int64) Option {
+	return func(c *Config) { c.MaxFileSize = n }
+}
+
+// WithList only lists the matched files, even if actions are set
+func WithList() Option {
+	return func(c *Config) { c.List = true }
+}
+
+// WithDelete deletes the matched files, logging each one to logW
+func WithDelete(logW io.Writer) Option {
+	return func(c *Config) {
+		c.Del = true
+		c.LogWriter = logW
+	}
+}
+
+// WithXDGTrash moves the deleted files to the XDG trash instead of
+// removing them
+func WithXDGTrash() Option {
+	return func(c *Config) { c.XDGTrash = true }
+}
+
+// checkFileReports rejects two reports written in place of the listing,
+// one line per file, as only one of them would be written. The line and
+// word counts are written on the same line and go together.
+func checkFileReports(c Config) error {
+	counts := "ReportLineCount"
+	if !c.ReportLineCount {
+		counts = "ReportWordCount"
+	}
+	var set []string
+	for _, r := range []struct {
+		name string
+		set  bool
+	}{
+		{"WC", c.WC},
+		{"Checksum", c.Checksum},
+		{"ReportFileAge", c.ReportFileAge},
+		{"ReportContentType", c.ReportContentType},
+		{"ReportFSType", c.ReportFSType},
+		{"ReportGitStatus", c.ReportGitStatus},
+		{"ReportEntropy", c.ReportEntropy},
+		{"ReportJSONValidity", c.ReportJSONValidity},
+		{"ReportYAMLValidity", c.ReportYAMLValidity},
+		{"ReportTOMLValidity", c.ReportTOMLValidity},
+		{"ReportCSVValidity", c.ReportCSVValidity},
+		{"ReportINIValidity", c.ReportINIValidity},
+		{counts, c.ReportLineCount || c.ReportWordCount},
+		{"ReportFirstLine", c.ReportFirstLine},
+		{"ReportPkgType", c.ReportPkgType},
+		{"ReportFileSignature", c.ReportFileSignature},
+		{"ReportShebang", c.ReportShebang},
+		{"ReportNullBytes", c.ReportNullBytes},
+		{"ReportFileEncoding", c.ReportFileEncoding},
+		{"ReportZipContents", c.ReportZipContents},
+		{"ReportTarContents", c.ReportTarContents},
+		{"ReportZip64", c.ReportZip64},
+		{"ReportPartialGzip", c.ReportPartialGzip},
+		{"ReportNumericNames", c.ReportNumericNames},
+		{"GroupByExt", c.GroupByExt},
+	} {
+		if r.set {
+			set = append(set, r.name)
+		}
+	}
+	if len(set) > 1 {
+		return &ConfigError{Option: set[1], Reason: "can't be combined with " + set[0] + ", one report per file"}
+	}
+	return nil
+}
+
+// WithAppendSuffix renames the matched files adding suffix to their
+// name, with collision, error if empty, deciding of the names already
+// taken
+func WithAppendSuffix(suffix, collision string) Option {
+	return func(c *Config) {
+		c.AppendSuffix = suffix
+		c.RenameCollision = collision
+	}
+}
+
+// WithStripSuffix renames the matched files whose name ends with suffix
+// removing it, with collision like WithAppendSuffix
+func WithStripSuffix(suffix, collision string) Option {
+	return func(c *Config) {
+		c.StripSuffix = suffix
+		c.RenameCollision = collision
+	}
+}
+
+// WithReplace replaces old by new in the matched files, at most count
+// times per file when count is not 0
+func WithReplace(old, new string, count int) Option {
+	return func(c *Config) {
+		c.ReplaceOld = old
+		c.ReplaceNew = new
+		c.ReplaceCount = count
+	}
+}
+
+// WithReplaceDryRun shows the replacements without writing the files
+func WithReplaceDryRun() Option {
+	return func(c *Config) { c.ReplaceDryRun = true }
+}
+
+// WithExec runs command on each matched file, on parallel processes at
+// once
+func WithExec(command string, parallel int) Option {
+	return func(c *Config) {
+		c.Exec = command
+		c.ExecParallel = parallel
+	}
+}
+
+// WithExecOnMatchDir runs command once on each directory holding matched
+// files after the walk, on parallel processes like WithExec. Each {} in
+// its arguments stands for the directory, appended if there is none.
+func WithExecOnMatchDir(command string, parallel int) Option {
+	return func(c *Config) {
+		c.ExecOnMatchDir = command
+		c.ExecParallel = parallel
+	}
+}
+
+// WithReportByOwner reports the number and size of the matched files per
+// owner, with the sizes in human readable units or as JSON
+func WithReportByOwner(human, asJSON bool) Option {
+	return func(c *Config) {
+		c.ReportByOwner = true
+		c.HumanSizes = human
+		c.JSONReport = asJSON
+	}
+}
+
+// WithWC lists the newlines, words and bytes of the matched text files
+// and their totals, the newlines only with linesOnly
+func WithWC(linesOnly bool) Option {
+	return func(c *Config) {
+		c.WC = true
+		c.LinesOnly = linesOnly
+	}
+}
+
+// WithBigDirs reports the directories with more than n direct entries
+func WithBigDirs(n int) Option {
+	return func(c *Config) { c.BigDirs = n }
+}
+
+// WithArcName names the archives after template, with the {date} of the
+// run rather than the modification time of each file with runTime
+func WithArcName(template string, runTime bool) Option {
+	return func(c *Config) {
+		c.ArcName = template
+		if runTime {
+			c.ArcNameTime = "run"
+		}
+	}
+}
+
+// WithWalkOrder walks the tree in order, WalkPre, WalkPost or WalkBreadth
+func WithWalkOrder(order string) Option {
+	return func(c *Config) { c.WalkOrder = order }
+}
+
+// WithCtime matches the files whose inode changed less than newer and
+// more than older ago, 0 for no bound
+func WithCtime(newer, older time.Duration) Option {
+	return func(c *Config) {
+		c.CNewer = newer
+		c.COlder = older
+	}
+}
+
+// WithDeleteWorkers deletes the matched files on workers goroutines
+func WithDeleteWorkers(workers int) Option {
+	return func(c *Config) { c.DeleteWorkers = workers }
+}
+
+// WithArchive compresses the matched files into dir, keeping the
+// directory structure relative to the root
+func WithArchive(dir string) Option {
+	return func(c *Config) { c.Arc = dir }
+}
+
+// WithLevel sets the gzip level for archives, a number or "auto"
+func WithLevel(level string) Option {
+	return func(c *Config) { c.Level = level }
+}
+
+// WithSort lists the matches sorted by "path", "size" or "mtime"
+func WithSort(key string) Option {
+	return func(c *Config) { c.Sort = key }
+}
+
+// WithPace limits filesystem operations to rate per second
+func WithPace(rate float64) Option {
+	return func(c *Config) { c.Pace = rate }
+}
+
+// WithNoStat walks with directory entries only, see Config.NoStat
+func WithNoStat() Option {
+	return func(c *Config) { c.NoStat = true }
+}
+
+// WithFromSnapshot queries the snapshot file given as the root instead of
+// walking a tree, see Scanner.Snapshot
+func WithFromSnapshot() Option {
+	return func(c *Config) { c.FromSnapshot = true }
+}
+
+// WithChecksum lists checksums computed on workers goroutines
+func WithChecksum(workers int) Option {
+	return func(c *Config) {
+		c.Checksum = true
+		c.HashWorkers = workers
+	}
+}
+
+// WithHash hashes the files with the algorithm named algo, one of
+// HashAlgos
+func WithHash(algo string) Option {
+	return func(c *Config) { c.Hash = algo }
+}
+
+// WithOutputEncoding writes the output in the named encoding
+func WithOutputEncoding(name string) Option {
+	return func(c *Config) { c.OutputEncoding = name }
+}
+
+// WithStripPrefix removes prefix from the listed paths. Paths without it
+// are skipped when strict is set and listed unchanged otherwise.
+func WithStripPrefix(prefix string, strict bool) Option {
+	return func(c *Config) {
+		c.StripPrefix = prefix
+		c.StrictStrip = strict
+	}
+}
+
+// WithReplacePrefix replaces the prefix old of the listed paths with new
+func WithReplacePrefix(old, new string) Option {
+	return func(c *Config) { c.ReplacePrefix = [2]string{old, new} }
+}
+
+// WithEntropy matches only the files with an entropy between min and
+// max bits per byte in their first kib KiB, a zero bound or size being
+// unset
+func WithEntropy(min, max float64, kib int) Option {
+	return func(c *Config) {
+		c.MinEntropy = min
+		c.MaxEntropy = max
+		c.EntropyKiB = kib
+	}
+}
+
+// WithSample lists a uniform random sample of the matched files, n files
+// or a percentage such as "1%", drawn with the RNG seeded by seed
+func WithSample(size string, seed int64) Option {
+	return func(c *Config) {
+		c.Sample = size
+		c.RandSeed = seed
+	}
+}
+
+// WithSieve lists a stratified sample of about n of the matched files,
+// drawn with the RNG seeded by seed
+func WithSieve(n int, seed int64) Option {
+	return func(c *Config) {
+		c.SieveN = n
+		c.RandSeed = seed
+	}
+}
+
+// WithTouchArchiveStamp writes the time of the run to a .last_archive
+// file in each directory with archived files
+func WithTouchArchiveStamp() Option {
+	return func(c *Config) { c.TouchArchiveStamp = true }
+}
+
+// WithSplitByMonth archives the files by month of their modification time
+func WithSplitByMonth() Option {
+	return func(c *Config) { c.SplitByMonth = true }
+}
+
+// WithMaxArchiveFiles bundles the archived files into numbered zip files
+// of at most n files
+func WithMaxArchiveFiles(n int) Option {
+	return func(c *Config) { c.MaxArchiveFiles = n }
+}
+
+// WithScanArchives matches the members of the zip and tar archives too,
+// and of the archives inside them down to depth levels
+func WithScanArchives(depth int) Option {
+	return func(c *Config) {
+		c.ScanArchives = true
+		c.ArchiveDepth = depth
+	}
+}
+
+// WithHardlinkDups replaces matched files with the same content by hard
+// links to the first one, when they are larger than threshold bytes
+func WithHardlinkDups(threshold int64) Option {
+	return func(c *Config) {
+		c.HardlinkDups = true
+		c.DedupeLinkThreshold = threshold
+	}
+}
+
+// WithZipContents lists the entries of the matched zip files instead of
+// their path, at most limit per file when limit is above 0
+func WithZipContents(limit int) Option {
+	return func(c *Config) {
+		c.ReportZipContents = true
+		c.ZipEntryLimit = limit
+	}
+}
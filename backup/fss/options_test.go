@@ -0,0 +1,127 @@
+package fss
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var logBuffer bytes.Buffer
+
+	testCases := []struct {
+		name      string
+		opts      []Option
+		expOption string
+		expErr    error
+	}{
+		{name: "NoOptions"},
+		{name: "ListByExt", opts: []Option{WithExt(".log"), WithList()}},
+		{name: "DeleteWithLog", opts: []Option{WithExt(".log"), WithDelete(&logBuffer)}},
+		{name: "ArchiveAutoLevel", opts: []Option{WithArchive("/tmp"), WithLevel("auto")}},
+		{name: "NegativeSize", opts: []Option{WithMinSize(-1)}, expOption: "Size"},
+		{name: "ListAndDelete", opts: []Option{WithList(), WithDelete(&logBuffer)}, expOption: "List"},
+		{name: "DeleteNoLog", opts: []Option{WithDelete(nil)}, expOption: "Del"},
+		{name: "TrashWithDelete", opts: []Option{WithDelete(&logBuffer), WithXDGTrash()}},
+		{name: "TrashNoDelete", opts: []Option{WithXDGTrash()}, expOption: "XDGTrash"},
+		{name: "StampWithArchive", opts: []Option{WithArchive("/tmp"), WithTouchArchiveStamp()}},
+		{name: "StampNoArchive", opts: []Option{WithList(), WithTouchArchiveStamp()}, expOption: "TouchArchiveStamp"},
+		{name: "SplitWithArchive", opts: []Option{WithArchive("/tmp"), WithSplitByMonth()}},
+		{name: "EntropyRange", opts: []Option{WithEntropy(1, 7.5, 4)}},
+		{name: "EntropyOverEight", opts: []Option{WithEntropy(9, 0, 0)}, expOption: "MinEntropy"},
+		{name: "EntropyInverted", opts: []Option{WithEntropy(7, 2, 0)}, expOption: "MinEntropy"},
+		{name: "EntropyNegativeKiB", opts: []Option{WithEntropy(7, 0, -1)}, expOption: "EntropyKiB"},
+		{name: "SampleList", opts: []Option{WithList(), WithSample("1%", 7)}},
+		{name: "SampleDelete", opts: []Option{WithDelete(&logBuffer), WithSample("10", 1)}, expOption: "Sample"},
+		{name: "SampleBadSize", opts: []Option{WithSample("ten", 1)}, expOption: "Sample"},
+		{name: "SampleAndSieve", opts: []Option{WithSample("10", 1), WithSieve(10, 1)}, expOption: "Sample"},
+		{name: "SplitNoArchive", opts: []Option{WithDelete(&logBuffer), WithSplitByMonth()}, expOption: "SplitByMonth"},
+		{name: "BadExclude", opts: []Option{WithExclude("*.log", "[a-")}, expOption: "Exclude"},
+		{name: "ScanArchivesList", opts: []Option{WithList(), WithScanArchives(1)}},
+		{name: "ScanArchivesDelete", opts: []Option{WithDelete(&logBuffer), WithScanArchives(1)}, expOption: "ScanArchives",
+			expErr: ErrArchiveMembers},
+		{name: "ScanArchivesChecksum", opts: []Option{WithScanArchives(0), WithChecksum(1)}, expOption: "ScanArchives",
+			expErr: ErrArchiveMembers},
+		{name: "NegativeArchiveDepth", opts: []Option{WithScanArchives(-1)}, expOption: "ArchiveDepth"},
+		{name: "BadSort", opts: []Option{WithSort("name")}, expOption: "Sort", expErr: ErrInvalidSort},
+		{name: "BadWalkOrder", opts: []Option{WithWalkOrder("inorder")}, expOption: "WalkOrder", expErr: ErrInvalidWalkOrder},
+		{name: "BadLevel", opts: []Option{WithLevel("11")}, expOption: "Level", expErr: ErrInvalidLevel},
+		{name: "NoStatSize", opts: []Option{WithNoStat(), WithMinSize(10)}, expOption: "NoStat", expErr: ErrNeedsStat},
+		{name: "SnapshotChecksum", opts: []Option{WithFromSnapshot(), WithList(), WithChecksum(1)}, expOption: "FromSnapshot", expErr: ErrSnapshot},
+		{name: "BadEncoding", opts: []Option{WithOutputEncoding("ebcdic")}, expOption: "OutputEncoding",
+			expErr: ErrInvalidEncoding},
+		{name: "NegativePace", opts: []Option{WithPace(-1)}, expOption: "Pace"},
+		{name: "ListAndHardlink", opts: []Option{WithList(), WithHardlinkDups(0)}, expOption: "List"},
+		{name: "NegativeThreshold", opts: []Option{WithHardlinkDups(-1)}, expOption: "DedupeLinkThreshold"},
+		{name: "NegativeZipLimit", opts: []Option{WithZipContents(-1)}, expOption: "ZipEntryLimit"},
+		{name: "ReplaceDryRunOnly", opts: []Option{WithReplaceDryRun()}, expOption: "ReplaceNew"},
+		{name: "ReplaceAndDelete", opts: []Option{WithDelete(&logBuffer), WithReplace("a", "b", 0)}, expOption: "ReplaceOld"},
+		{name: "JSONNoReport", opts: []Option{func(c *Config) { c.JSONReport = true }}, expOption: "ReportByOwner"},
+		{name: "ReportByOwnerJSON", opts: []Option{WithList(), WithReportByOwner(true, true)}},
+		{name: "BigDirsJSON", opts: []Option{WithList(), WithBigDirs(1000), func(c *Config) { c.JSONReport = true }}},
+		{name: "WCJSON", opts: []Option{WithList(), WithWC(true), func(c *Config) { c.JSONReport = true }}},
+		{name: "LinesOnlyNoWC", opts: []Option{func(c *Config) { c.LinesOnly = true }}, expOption: "LinesOnly"},
+		{name: "WCAndDelete", opts: []Option{WithDelete(&logBuffer), WithWC(false)}, expOption: "WC"},
+		{name: "LineAndWordCounts", opts: []Option{WithList(), func(c *Config) { c.ReportLineCount, c.ReportWordCount = true, true }}},
+		{name: "TwoFileReports", opts: []Option{WithList(), func(c *Config) {
+			c.ReportJSONValidity, c.ReportLineCount, c.ReportFirstLine = true, true, true
+		}}, expOption: "ReportLineCount"},
+		{name: "WordCountAndChecksum", opts: []Option{WithList(), func(c *Config) { c.Checksum, c.ReportWordCount = true, true }}, expOption: "ReportWordCount"},
+		{name: "CSVColumnsNoReport", opts: []Option{func(c *Config) { c.CSVColumnCount = 3 }}, expOption: "CSVColumnCount"},
+		{name: "NegativeBigDirs", opts: []Option{WithBigDirs(-1)}, expOption: "BigDirs"},
+		{name: "NegativeReplaceCount", opts: []Option{WithReplace("a", "b", -1)}, expOption: "ReplaceCount"},
+		{name: "ExecAndReplace", opts: []Option{WithReplace("a", "b", 0), WithExec("gzip -t", 1)}, expOption: "Exec"},
+		{name: "EmptyExec", opts: []Option{WithExec(" ", 1)}, expOption: "Exec", expErr: ErrNoExecCmd},
+		{name: "EmptyExecOnMatchDir", opts: []Option{WithExecOnMatchDir(" ", 1)}, expOption: "ExecOnMatchDir", expErr: ErrNoExecCmd},
+		{name: "NegativeExecParallel", opts: []Option{WithExec("gzip -t", -1)}, expOption: "ExecParallel"},
+		{name: "AppendSuffixArchive", opts: []Option{WithArchive("/tmp"), WithAppendSuffix(".archived", CollisionNumber)}},
+		{name: "AppendSuffixAndList", opts: []Option{WithList(), WithAppendSuffix(".done", "")}, expOption: "AppendSuffix"},
+		{name: "AppendSuffixSeparator", opts: []Option{WithAppendSuffix("/done", "")}, expOption: "AppendSuffix"},
+		{name: "CollisionNoSuffix", opts: []Option{func(c *Config) { c.RenameCollision = CollisionNumber }}, expOption: "RenameCollision"},
+		{name: "StripSuffix", opts: []Option{WithStripSuffix(".processed", CollisionOverwrite)}},
+		{name: "StripAndAppendSuffix", opts: []Option{WithAppendSuffix(".done", ""), WithStripSuffix(".done", "")}, expOption: "StripSuffix"},
+		{name: "StripSuffixAndDelete", opts: []Option{WithDelete(&logBuffer), WithStripSuffix(".done", "")}, expOption: "StripSuffix"},
+		{name: "UnknownCollision", opts: []Option{WithAppendSuffix(".done", "keep")}, expOption: "RenameCollision", expErr: ErrInvalidCollision},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New("testdata", tc.opts...)
+			if tc.expOption == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.Root != "testdata" {
+					t.Errorf("expected root %q, got %q instead\n", "testdata", s.Root)
+				}
+				return
+			}
+
+			var cfgErr *ConfigError
+			if !errors.As(err, &cfgErr) {
+				t.Fatalf("expected *ConfigError, got %v instead", err)
+			}
+			if cfgErr.Option != tc.expOption {
+				t.Errorf("expected option %q, got %q instead\n", tc.expOption, cfgErr.Option)
+			}
+			if tc.expErr != nil && !errors.Is(err, tc.expErr) {
+				t.Errorf("expected error %q, got %q instead\n", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestNewRun(t *testing.T) {
+	s, err := New("testdata", WithExt(".log"), WithSort("size"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := s.Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "testdata/dir.log\n"; expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
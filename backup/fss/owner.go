@@ -0,0 +1,111 @@
+package fss
+
+import (
+	"fmt"
+	"io"
+	"os/user"
+	"sort"
+	"strconv"
+)
+
+// unknownOwner groups the files whose owner isn't known, like archive
+// members or files on systems without uids
+const unknownOwner = "unknown"
+
+// ownerUsage is the number and total size of the matched files of an owner
+type ownerUsage struct {
+	Owner string `json:"owner"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// ownerCounter tallies matched files per owner, the uids are resolved to
+// user names once each
+type ownerCounter struct {
+	usage map[string]*ownerUsage
+	names map[uint32]string
+}
+
+func newOwnerCounter() *ownerCounter {
+	return &ownerCounter{usage: map[string]*ownerUsage{}, names: map[uint32]string{}}
+}
+
+// owner returns the name of the user uid, the uid itself when it has no
+// user
+func (c *ownerCounter) owner(uid uint32) string {
+	if name, ok := c.names[uid]; ok {
+		return name
+	}
+	name := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	c.names[uid] = name
+	return name
+}
+
+func (c *ownerCounter) add(m match, size int64) {
+	owner := unknownOwner
+	if uid, ok := fileOwner(m.info); ok {
+		owner = c.owner(uid)
+	}
+	u, ok := c.usage[owner]
+	if !ok {
+		u = &ownerUsage{Owner: owner}
+		c.usage[owner] = u
+	}
+	u.Files++
+	u.Size += size
+}
+
+// sorted returns the owners by total size, the largest first
+func (c *ownerCounter) sorted() []ownerUsage {
+	owners := make([]ownerUsage, 0, len(c.usage))
+	for _, u := range c.usage {
+		owners = append(owners, *u)
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].Size != owners[j].Size {
+			return owners[i].Size > owners[j].Size
+		}
+		if owners[i].Files != owners[j].Files {
+			return owners[i].Files > owners[j].Files
+		}
+		return owners[i].Owner < owners[j].Owner
+	})
+	return owners
+}
+
+// reportByOwner writes the matched files and their size per owner, the
+// sizes in human readable units with human
+func reportByOwner(c *ownerCounter, human bool, out io.Writer) error {
+	for _, u := range c.sorted() {
+		size := strconv.FormatInt(u.Size, 10) + " bytes"
+		if human {
+			size = HumanSize(u.Size)
+		}
+		if _, err := fmt.Fprintf(out, "Owner: %s (%d files, %s)\n", u.Owner, u.Files, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HumanSize formats a size in bytes with the binary units of du -h: 512B,
+// 1.5K, 23M
+func HumanSize(n int64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	v := float64(n)
+	i := -1
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if v < 10 {
+		return fmt.Sprintf("%.1f%c", v, units[i])
+	}
+	return fmt.Sprintf("%.0f%c", v, units[i])
+}
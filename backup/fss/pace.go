@@ -0,0 +1,80 @@
+package fss
+
+import (
+	"sync"
+	"time"
+)
+
+// pacer is a token bucket limiting filesystem operations per second.
+// A nil pacer does nothing so unpaced runs pay no cost. It is safe for
+// concurrent use so one budget can be shared by every worker.
+type pacer struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	start  time.Time
+	ops    int64
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// newPacer returns a pacer allowing rate operations per second, or nil
+// when rate is not positive
+func newPacer(rate float64) *pacer {
+	if rate <= 0 {
+		return nil
+	}
+	p := &pacer{
+		rate:  rate,
+		burst: 1,
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+	p.start = p.now()
+	p.last = p.start
+	p.tokens = p.burst
+	return p
+}
+
+// wait blocks until one operation is allowed by the budget
+func (p *pacer) wait() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	p.tokens += now.Sub(p.last).Seconds() * p.rate
+	if p.tokens > p.burst {
+		p.tokens = p.burst
+	}
+	p.last = now
+
+	if p.tokens < 1 {
+		d := time.Duration((1 - p.tokens) / p.rate * float64(time.Second))
+		p.sleep(d)
+		p.last = p.last.Add(d)
+		p.tokens = 1
+	}
+	p.tokens--
+	p.ops++
+}
+
+// achieved returns the number of operations and the rate reached so far
+func (p *pacer) achieved() (int64, float64) {
+	if p == nil {
+		return 0, 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	elapsed := p.now().Sub(p.start).Seconds()
+	if elapsed <= 0 {
+		return p.ops, 0
+	}
+	return p.ops, float64(p.ops) / elapsed
+}
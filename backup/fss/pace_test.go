@@ -0,0 +1,143 @@
+package fss
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock advances only when the pacer sleeps
+type fakeClock struct {
+	mu    sync.Mutex
+	t     time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+	c.slept += d
+}
+
+func newFakePacer(rate float64) (*pacer, *fakeClock) {
+	c := &fakeClock{t: time.Unix(0, 0)}
+	p := newPacer(rate)
+	p.now = c.now
+	p.sleep = c.sleep
+	p.start = c.t
+	p.last = c.t
+	return p, c
+}
+
+func TestPacer(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rate     float64
+		ops      int
+		expSlept time.Duration
+	}{
+		{"SingleOpNoWait", 10, 1, 0},
+		{"TenPerSecond", 10, 11, time.Second},
+		{"TwoPerSecond", 2, 5, 2 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, c := newFakePacer(tc.rate)
+			for i := 0; i < tc.ops; i++ {
+				p.wait()
+			}
+
+			if c.slept != tc.expSlept {
+				t.Errorf("expected to sleep %s, slept %s instead\n", tc.expSlept, c.slept)
+			}
+
+			ops, _ := p.achieved()
+			if ops != int64(tc.ops) {
+				t.Errorf("expected %d ops, got %d instead\n", tc.ops, ops)
+			}
+		})
+	}
+}
+
+func TestPacerShared(t *testing.T) {
+	p, c := newFakePacer(100)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				p.wait()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// One free token, then 99 operations at 10ms each
+	if exp := 990 * time.Millisecond; c.slept != exp {
+		t.Errorf("expected to sleep %s, slept %s instead\n", exp, c.slept)
+	}
+	if _, rate := p.achieved(); rate > 102 {
+		t.Errorf("expected rate at most 102 ops/sec, got %.1f instead\n", rate)
+	}
+}
+
+func TestPacerNil(t *testing.T) {
+	p := newPacer(0)
+	if p != nil {
+		t.Fatal("expected nil pacer for zero rate")
+	}
+	p.wait()
+	if ops, rate := p.achieved(); ops != 0 || rate != 0 {
+		t.Errorf("expected no stats from nil pacer, got %d %.1f\n", ops, rate)
+	}
+}
+
+// TestRunPace checks the pace stats are logged, not listed, and logged
+// once per root
+func TestRunPace(t *testing.T) {
+	var buffer, logBuffer bytes.Buffer
+	cfg := Config{Ext: ".log", List: true, Pace: 1000, LogWriter: &logBuffer}
+	if err := NewScanner("testdata", cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if buffer.String() != "testdata/dir.log\n" {
+		t.Errorf("expected only the listing, got %q instead\n", buffer.String())
+	}
+	// testdata has 5 entries including the root and dir2
+	if !strings.HasPrefix(logBuffer.String(), "Paced operations: 5 (") {
+		t.Errorf("expected pace stats line, got %q instead\n", logBuffer.String())
+	}
+
+	buffer.Reset()
+	logBuffer.Reset()
+	if err := RunRoots([]string{"testdata", filepath.Join("testdata", "dir2")}, cfg, false, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buffer.String(), "Paced") {
+		t.Errorf("expected no pace stats in the listing, got %q instead\n", buffer.String())
+	}
+	if n := strings.Count(logBuffer.String(), "Paced operations: "); n != 2 {
+		t.Errorf("expected the pace stats of 2 roots, got %q instead\n", logBuffer.String())
+	}
+}
+
+func BenchmarkPacerNil(b *testing.B) {
+	var p *pacer
+	for i := 0; i < b.N; i++ {
+		p.wait()
+	}
+}
@@ -0,0 +1,345 @@
+package fss
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// PlanVersion is the version of the plan schema written by WritePlan
+const PlanVersion = 2
+
+// Plan lists the actions a scan would apply, to be reviewed before
+// ApplyPlan runs them. The header and the entries are hash chained: each
+// Chain is the SHA-256 of the previous one and the entry, starting from
+// the hash of the header, and the Chain of the plan is the last one. An
+// edited, dropped or reordered entry breaks the chain when the plan is
+// read back. The chain is always SHA-256, Hash is the algorithm of the
+// sums of the files.
+type Plan struct {
+	Version int         `json:"version"`
+	Root    string      `json:"root"`
+	Arc     string      `json:"arc,omitempty"`   // archive directory of the archive actions
+	Level   string      `json:"level,omitempty"` // gzip level of the archives
+	Hash    string      `json:"hash"`            // hash algorithm of the entry sums
+	Created time.Time   `json:"created"`
+	Build   string      `json:"build,omitempty"` // version and commit of the program that wrote the plan
+	Entries []PlanEntry `json:"entries"`
+	Chain   string      `json:"chain"`
+}
+
+// PlanEntry is a planned file with the metadata it had when it was planned
+type PlanEntry struct {
+	Actions []string  `json:"actions"` // archive, delete or both, in order
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Sum     string    `json:"sum"` // hash of the content labeled with its algorithm, sha256:<hex>
+	Chain   string    `json:"chain"`
+}
+
+// Drift categories, the ways a file can differ from its plan entry. Only
+// the files that are still there can be forced.
+const (
+	DriftMissing = "missing"
+	DriftSize    = "size"
+	DriftMTime   = "mtime"
+	DriftHash    = "hash"
+)
+
+// Plan walks the tree like Run and returns the archive and delete actions
+// it would apply to the matched files, without applying them
+func (s *Scanner) Plan() (*Plan, error) {
+	cfg := s.Config
+	switch {
+	case !cfg.Del && cfg.Arc == "":
+		return nil, errors.New("plan needs a delete or archive action")
+	case cfg.List:
+		return nil, &ConfigError{Option: "List", Reason: "can't be planned"}
+	case cfg.MaxArchiveFiles > 0:
+		return nil, &ConfigError{Option: "MaxArchiveFiles", Reason: "can't be planned"}
+	case cfg.SplitByMonth:
+		return nil, &ConfigError{Option: "SplitByMonth", Reason: "can't be planned"}
+	case cfg.XDGTrash:
+		// ApplyPlan removes the files, they would never reach the trash
+		return nil, &ConfigError{Option: "XDGTrash", Reason: "can't be planned"}
+	case isSinkURL(cfg.Arc):
+		return nil, &ConfigError{Option: "Arc", Reason: "can't be planned to an archive sink URL"}
+	}
+	if _, _, err := parseLevel(cfg.Level); err != nil {
+		return nil, err
+	}
+	if cfg.Arc != "" {
+		if err := checkArchiveDir(cfg.Arc); err != nil {
+			return nil, err
+		}
+	}
+
+	var actions []string
+	if cfg.Arc != "" {
+		actions = append(actions, "archive")
+	}
+	if cfg.Del {
+		actions = append(actions, "delete")
+	}
+
+	files, err := s.Collect()
+	if err != nil {
+		return nil, err
+	}
+	p := &Plan{
+		Version: PlanVersion,
+		Root:    s.Root,
+		Arc:     cfg.Arc,
+		Level:   cfg.Level,
+		Created: time.Now().UTC(),
+		Entries: make([]PlanEntry, 0, len(files)),
+	}
+	p.Hash, _, _ = lookupHash(cfg.Hash)
+	hash := hasher(cfg)
+	for _, f := range files {
+		sum, err := hash(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		p.Entries = append(p.Entries, PlanEntry{
+			Actions: actions,
+			Path:    f.Path,
+			Size:    f.Info.Size(),
+			ModTime: f.Info.ModTime().UTC(),
+			Sum:     p.Hash + ":" + sum,
+		})
+	}
+	p.seal()
+	return p, nil
+}
+
+// headerHash returns the hash the chain of the entries starts from. The
+// build is only hashed when set, so the plans written without it still
+// verify.
+func (p *Plan) headerHash() string {
+	header := fmt.Sprintf("fss plan\n%d\n%s\n%s\n%s\n%s\n%d",
+		p.Version, p.Root, p.Arc, p.Level, p.Hash, p.Created.UnixNano())
+	if p.Build != "" {
+		header += "\n" + p.Build
+	}
+	return chainHash(header)
+}
+
+// SetBuild records the build of the program writing the plan in its
+// header and chains the entries again from it
+func (p *Plan) SetBuild(build string) {
+	p.Build = build
+	p.seal()
+}
+
+// entryHash returns the chain hash of e following prev
+func entryHash(prev string, e PlanEntry) string {
+	return chainHash(fmt.Sprintf("%s\n%s\n%s\n%d\n%d\n%s",
+		prev, strings.Join(e.Actions, ","), e.Path, e.Size, e.ModTime.UnixNano(), e.Sum))
+}
+
+func chainHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// seal sets the chain hashes of the entries and of the plan
+func (p *Plan) seal() {
+	chain := p.headerHash()
+	for i := range p.Entries {
+		chain = entryHash(chain, p.Entries[i])
+		p.Entries[i].Chain = chain
+	}
+	p.Chain = chain
+}
+
+// verify checks the chain hashes of the plan
+func (p *Plan) verify() error {
+	chain := p.headerHash()
+	for i, e := range p.Entries {
+		chain = entryHash(chain, e)
+		if e.Chain != chain {
+			return fmt.Errorf("%w: entry %d (%s) doesn't match the hash chain", ErrInvalidPlan, i, e.Path)
+		}
+	}
+	if p.Chain != chain {
+		return fmt.Errorf("%w: the plan doesn't match the hash chain", ErrInvalidPlan)
+	}
+	return nil
+}
+
+// WritePlan writes p to w as indented JSON
+func WritePlan(w io.Writer, p *Plan) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// ReadPlan reads a plan written by WritePlan and checks its version, hash
+// algorithm and hash chain
+func ReadPlan(r io.Reader) (*Plan, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var p Plan
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+	if p.Version != PlanVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidPlan, p.Version)
+	}
+	if _, ok := hashAlgos[p.Hash]; !ok {
+		return nil, fmt.Errorf("%w: %v %q", ErrInvalidPlan, ErrUnknownHash, p.Hash)
+	}
+	for i, e := range p.Entries {
+		if !strings.HasPrefix(e.Sum, p.Hash+":") {
+			return nil, fmt.Errorf("%w: entry %d (%s) isn't a %s sum", ErrInvalidPlan, i, e.Path, p.Hash)
+		}
+	}
+	if err := p.verify(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ApplyOptions sets how ApplyPlan treats the files that changed since
+// they were planned
+type ApplyOptions struct {
+	Force     []string  // drift categories applied anyway: size, mtime or hash
+	LogWriter io.Writer // log of the deleted files, none if nil
+	Hash      string    // refuse plans hashed with another algorithm, any if empty
+}
+
+// ApplySummary counts the outcomes of the entries of an applied plan
+type ApplySummary struct {
+	Applied int
+	Drifted int // skipped as the file no longer matches its entry
+	Failed  int
+}
+
+// ApplyPlan runs the actions of p. Files that differ from their entry are
+// skipped unless every way they differ is forced. Each entry's outcome
+// and the summary are written to out, failed actions don't stop the
+// others.
+func ApplyPlan(p *Plan, opts ApplyOptions, out io.Writer) (ApplySummary, error) {
+	var sum ApplySummary
+	if opts.Hash != "" && opts.Hash != p.Hash {
+		return sum, fmt.Errorf("plan %w, %s instead of %s", ErrHashMismatch, p.Hash, opts.Hash)
+	}
+	force := map[string]bool{}
+	for _, c := range opts.Force {
+		if c != DriftSize && c != DriftMTime && c != DriftHash {
+			return sum, fmt.Errorf("unknown drift category %q, use size, mtime or hash", c)
+		}
+		force[c] = true
+	}
+	level, auto, err := parseLevel(p.Level)
+	if err != nil {
+		return sum, err
+	}
+	var delLogger *log.Logger
+	if opts.LogWriter != nil {
+		delLogger = log.New(opts.LogWriter, "DELETED FILE: ", log.LstdFlags)
+	}
+
+	for _, e := range p.Entries {
+		cur, drift, err := planDrift(e, p.Hash)
+		if err == nil && len(drift) > 0 {
+			var left []string
+			for _, c := range drift {
+				if !force[c] {
+					left = append(left, c)
+				}
+			}
+			if len(left) > 0 {
+				sum.Drifted++
+				if _, err := fmt.Fprintf(out, "SKIPPED (drift: %s): %s\n", strings.Join(left, ", "), e.Path); err != nil {
+					return sum, err
+				}
+				continue
+			}
+		}
+		if err == nil {
+			err = applyEntry(p, e, match{path: e.Path, info: cur}, level, auto, delLogger)
+		}
+		if err != nil {
+			sum.Failed++
+			if _, err := fmt.Fprintf(out, "FAILED: %s: %v\n", e.Path, err); err != nil {
+				return sum, err
+			}
+			continue
+		}
+		sum.Applied++
+		if _, err := fmt.Fprintf(out, "APPLIED %s: %s\n", strings.Join(e.Actions, "+"), e.Path); err != nil {
+			return sum, err
+		}
+	}
+
+	_, err = fmt.Fprintf(out, "Applied: %d, skipped due to drift: %d, failed: %d\n",
+		sum.Applied, sum.Drifted, sum.Failed)
+	return sum, err
+}
+
+// planDrift returns the current stats of the file of e and the ways it
+// differs from e, its content hashed with algo
+func planDrift(e PlanEntry, algo string) (os.FileInfo, []string, error) {
+	cur, err := fsys.Lstat(e.Path)
+	if os.IsNotExist(err) {
+		return nil, []string{DriftMissing}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var drift []string
+	if cur.Size() != e.Size {
+		drift = append(drift, DriftSize)
+	}
+	if !cur.ModTime().Equal(e.ModTime) {
+		drift = append(drift, DriftMTime)
+	}
+	sum, err := hashFileAlgo(e.Path, algo)
+	if err != nil {
+		return nil, nil, err
+	}
+	if algo+":"+sum != e.Sum {
+		drift = append(drift, DriftHash)
+	}
+	return cur, drift, nil
+}
+
+// applyEntry runs the actions of e on the file of m
+func applyEntry(p *Plan, e PlanEntry, m match, level int, auto bool, delLogger *log.Logger) error {
+	for _, action := range e.Actions {
+		switch action {
+		case "archive":
+			if p.Arc == "" {
+				return fmt.Errorf("%w: archive action without an archive directory", ErrInvalidPlan)
+			}
+			l := level
+			if auto {
+				var err error
+				if l, err = autoLevel(m.path, m.info.Size()); err != nil {
+					return err
+				}
+			}
+			if err := acrchiveFile(p.Arc, p.Root, m, l); err != nil {
+				return err
+			}
+		case "delete":
+			if err := delFile(m, fsys.Remove, delLogger); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unknown action %q", ErrInvalidPlan, action)
+		}
+	}
+	return nil
+}
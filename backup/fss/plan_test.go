@@ -0,0 +1,219 @@
+package fss
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// planFiles writes the files of a plan test and returns their plan
+func planFiles(t *testing.T, tempDir, arcDir string) *Plan {
+	t.Helper()
+	writeFiles(t, tempDir, map[string]string{
+		"a.log":     "dummy",
+		"b.log":     "dummy",
+		"c.log":     "dummy",
+		"e.log":     "dummy",
+		"notes.txt": "dummy",
+	})
+	p, err := NewScanner(tempDir, Config{Ext: ".log", Arc: arcDir, Del: true}).Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d instead\n", len(p.Entries))
+	}
+	return p
+}
+
+func TestPlanApply(t *testing.T) {
+	testCases := []struct {
+		name     string
+		force    []string
+		applied  []string
+		expected string
+	}{
+		{
+			name:    "NoForce",
+			applied: []string{"a.log"},
+			expected: "APPLIED archive+delete: {dir}/a.log\n" +
+				"SKIPPED (drift: hash): {dir}/b.log\n" +
+				"SKIPPED (drift: mtime): {dir}/c.log\n" +
+				"SKIPPED (drift: missing): {dir}/e.log\n" +
+				"Applied: 1, skipped due to drift: 3, failed: 0\n",
+		},
+		{
+			name:    "ForceHash",
+			force:   []string{"hash"},
+			applied: []string{"a.log", "b.log"},
+			expected: "APPLIED archive+delete: {dir}/a.log\n" +
+				"APPLIED archive+delete: {dir}/b.log\n" +
+				"SKIPPED (drift: mtime): {dir}/c.log\n" +
+				"SKIPPED (drift: missing): {dir}/e.log\n" +
+				"Applied: 2, skipped due to drift: 2, failed: 0\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			arcDir := t.TempDir()
+			planned := planFiles(t, tempDir, arcDir)
+
+			// The plan goes through its file format
+			var buffer bytes.Buffer
+			if err := WritePlan(&buffer, planned); err != nil {
+				t.Fatal(err)
+			}
+			p, err := ReadPlan(&buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// b.log gets new content of the same size, c.log a new mtime
+			bPath := filepath.Join(tempDir, "b.log")
+			if err := os.WriteFile(bPath, []byte("DUMMY"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(bPath, p.Entries[1].ModTime, p.Entries[1].ModTime); err != nil {
+				t.Fatal(err)
+			}
+			later := p.Entries[2].ModTime.Add(time.Hour)
+			if err := os.Chtimes(filepath.Join(tempDir, "c.log"), later, later); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(filepath.Join(tempDir, "e.log")); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			sum, err := ApplyPlan(p, ApplyOptions{Force: tc.force}, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sum.Applied != len(tc.applied) {
+				t.Errorf("expected %d applied, got %+v instead\n", len(tc.applied), sum)
+			}
+			expected := strings.ReplaceAll(tc.expected, "{dir}", tempDir)
+			if expected != out.String() {
+				t.Errorf("expected %q, got %q instead\n", expected, out.String())
+			}
+
+			for _, name := range tc.applied {
+				if _, err := os.Stat(filepath.Join(tempDir, name)); !os.IsNotExist(err) {
+					t.Errorf("expected %s to be deleted, got %v instead\n", name, err)
+				}
+				if _, err := os.Stat(filepath.Join(arcDir, name+".gz")); err != nil {
+					t.Errorf("expected %s to be archived, got %v instead\n", name, err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(tempDir, "c.log")); err != nil {
+				t.Errorf("expected c.log to stay, got %v instead\n", err)
+			}
+		})
+	}
+}
+
+func TestReadPlanTampered(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tamper func(p *Plan)
+	}{
+		{"EntrySize", func(p *Plan) { p.Entries[0].Size++ }},
+		{"EntryPath", func(p *Plan) { p.Entries[1].Path += ".other" }},
+		{"DroppedEntry", func(p *Plan) { p.Entries = p.Entries[1:] }},
+		{"DroppedLastEntry", func(p *Plan) { p.Entries = p.Entries[:len(p.Entries)-1] }},
+		{"Reordered", func(p *Plan) { p.Entries[0], p.Entries[1] = p.Entries[1], p.Entries[0] }},
+		{"Root", func(p *Plan) { p.Root = "/" }},
+		{"Version", func(p *Plan) { p.Version++ }},
+		{"Hash", func(p *Plan) { p.Hash = HashMD5 }},
+		{"Build", func(p *Plan) { p.SetBuild("1.3.0 (commit abc123)"); p.Build = "1.4.0 (commit def456)" }},
+		{"DroppedBuild", func(p *Plan) { p.SetBuild("1.3.0 (commit abc123)"); p.Build = "" }},
+		{"UnknownHash", func(p *Plan) { p.Hash = "crc32"; p.seal() }},
+		{"EntrySumAlgo", func(p *Plan) {
+			p.Entries[0].Sum = strings.Replace(p.Entries[0].Sum, HashSHA256, HashMD5, 1)
+			p.seal()
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := planFiles(t, t.TempDir(), t.TempDir())
+			tc.tamper(p)
+
+			var buffer bytes.Buffer
+			if err := WritePlan(&buffer, p); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ReadPlan(&buffer); !errors.Is(err, ErrInvalidPlan) {
+				t.Errorf("expected error %q, got %q instead\n", ErrInvalidPlan, err)
+			}
+		})
+	}
+}
+
+func TestPlanNoAction(t *testing.T) {
+	if _, err := NewScanner(t.TempDir(), Config{Ext: ".log"}).Plan(); err == nil {
+		t.Error("expected an error without an action, got nil instead")
+	}
+	var cerr *ConfigError
+	_, err := NewScanner(t.TempDir(), Config{Del: true, XDGTrash: true}).Plan()
+	if !errors.As(err, &cerr) || cerr.Option != "XDGTrash" {
+		t.Errorf("expected an XDGTrash ConfigError, got %v instead\n", err)
+	}
+	p := &Plan{Version: PlanVersion}
+	p.seal()
+	if _, err := ApplyPlan(p, ApplyOptions{Force: []string{"missing"}}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an error forcing missing files, got nil instead")
+	}
+}
+
+func TestPlanHash(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{"a.log": "dummy"})
+	p, err := NewScanner(tempDir, Config{Ext: ".log", Del: true, Hash: HashMD5}).Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Hash != HashMD5 || p.Entries[0].Sum != "md5:275876e34cf609db118f3d84b799a790" {
+		t.Fatalf("expected an md5 plan, got %q and %q instead\n", p.Hash, p.Entries[0].Sum)
+	}
+
+	var out bytes.Buffer
+	if _, err := ApplyPlan(p, ApplyOptions{Hash: HashSHA256}, &out); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("expected error %q, got %q instead\n", ErrHashMismatch, err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "a.log")); err != nil {
+		t.Errorf("expected a.log to stay, got %v instead\n", err)
+	}
+
+	sum, err := ApplyPlan(p, ApplyOptions{Hash: HashMD5, LogWriter: &out}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Applied != 1 {
+		t.Errorf("expected 1 applied, got %+v instead\n", sum)
+	}
+}
+
+// TestPlanBuild checks the build recorded with SetBuild is read back
+func TestPlanBuild(t *testing.T) {
+	p := planFiles(t, t.TempDir(), t.TempDir())
+	p.SetBuild("1.3.0 (commit abc123)")
+
+	var buffer bytes.Buffer
+	if err := WritePlan(&buffer, p); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadPlan(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Build != p.Build {
+		t.Errorf("expected %q, got %q instead\n", p.Build, read.Build)
+	}
+}
@@ -0,0 +1,152 @@
+package fss
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// filterWindow is the number of records sent to the filter command
+// ahead of its answers. It bounds how far the walk gets ahead of it.
+const filterWindow = 64
+
+// filterCmd runs the external filter of Config.FilterCmd. The command is
+// started once per run and gets one record per file that passed the
+// built-in filters on its stdin:
+//
+//	path TAB size TAB mtime
+//
+// mtime is in Unix seconds, and each record ends with a newline, or a NUL
+// byte with FilterCmdNUL. Paths may contain tabs, so the size and mtime
+// are the last two fields. For each record, in order, the command writes
+// accept or reject to its stdout followed by the same delimiter. It must
+// answer a record without waiting for the next ones, only filterWindow
+// records are sent ahead. Any other answer, or the command exiting before
+// answering every record, fails the run with its stderr.
+type filterCmd struct {
+	command string
+	delim   byte
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	w       *bufio.Writer
+	r       *bufio.Reader
+	stderr  bytes.Buffer
+	pending []match
+	handle  func(match) error
+	done    bool
+}
+
+// startFilterCmd starts command, splitting its arguments on spaces.
+// Accepted files are passed to handle.
+func startFilterCmd(command string, nul bool, handle func(match) error) (*filterCmd, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("-filter-cmd %w", ErrFilterCmd)
+	}
+
+	f := &filterCmd{command: command, delim: '\n', handle: handle}
+	if nul {
+		f.delim = 0
+	}
+	f.cmd = exec.Command(args[0], args[1:]...)
+	f.cmd.Stderr = &f.stderr
+
+	stdin, err := f.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := f.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("-filter-cmd %s: %w", command, err)
+	}
+	f.stdin, f.w, f.r = stdin, bufio.NewWriter(stdin), bufio.NewReader(stdout)
+	return f, nil
+}
+
+// submit sends the record of m, then handles the oldest file once the
+// window is full
+func (f *filterCmd) submit(m match) error {
+	if f.delim == '\n' && strings.ContainsRune(m.path, '\n') {
+		return f.fail(fmt.Errorf("%q has a newline, use NUL delimited records", m.path))
+	}
+	if _, err := fmt.Fprintf(f.w, "%s\t%d\t%d%c", m.path, m.info.Size(), m.info.ModTime().Unix(), f.delim); err != nil {
+		return f.fail(err)
+	}
+	f.pending = append(f.pending, m)
+	if len(f.pending) < filterWindow {
+		return nil
+	}
+	if err := f.w.Flush(); err != nil {
+		return f.fail(err)
+	}
+	return f.decide()
+}
+
+// decide reads the answer for the oldest pending file
+func (f *filterCmd) decide() error {
+	answer, err := f.r.ReadString(f.delim)
+	if err != nil {
+		return f.fail(fmt.Errorf("no answer for %s", f.pending[0].path))
+	}
+	m := f.pending[0]
+	f.pending = f.pending[1:]
+
+	switch strings.TrimSpace(strings.TrimSuffix(answer, string(f.delim))) {
+	case "accept":
+		return f.handle(m)
+	case "reject":
+		return nil
+	}
+	return f.fail(fmt.Errorf("invalid answer %q for %s", answer, m.path))
+}
+
+// finish sends the end of the input, handles the files still pending
+// and waits for the command to exit
+func (f *filterCmd) finish() error {
+	if err := f.w.Flush(); err != nil {
+		return f.fail(err)
+	}
+	f.stdin.Close()
+	for len(f.pending) > 0 {
+		if err := f.decide(); err != nil {
+			return err
+		}
+	}
+
+	f.done = true
+	if err := f.cmd.Wait(); err != nil {
+		return f.wrap(err)
+	}
+	return nil
+}
+
+// fail stops the command and returns err with its stderr
+func (f *filterCmd) fail(err error) error {
+	f.Close()
+	return f.wrap(err)
+}
+
+func (f *filterCmd) wrap(err error) error {
+	msg := strings.TrimSpace(f.stderr.String())
+	if msg == "" {
+		return fmt.Errorf("-filter-cmd %s: %w: %v", f.command, ErrFilterCmd, err)
+	}
+	return fmt.Errorf("-filter-cmd %s: %w: %v: %s", f.command, ErrFilterCmd, err, msg)
+}
+
+// Close kills the command if it's still running
+func (f *filterCmd) Close() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.stdin.Close()
+	f.cmd.Process.Kill()
+	f.cmd.Wait()
+}
@@ -0,0 +1,126 @@
+package fss
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFilterCmdHelper is the filter command run by the tests, it's
+// selected with FSS_TEST_FILTER
+func TestFilterCmdHelper(t *testing.T) {
+	mode := os.Getenv("FSS_TEST_FILTER")
+	if mode == "" {
+		return
+	}
+
+	delim := byte('\n')
+	if strings.HasSuffix(mode, "-nul") {
+		delim, mode = 0, strings.TrimSuffix(mode, "-nul")
+	}
+	r := bufio.NewReader(os.Stdin)
+	for {
+		record, err := r.ReadString(delim)
+		if err != nil {
+			os.Exit(0)
+		}
+		fields := strings.Split(strings.TrimSuffix(record, string(delim)), "\t")
+		switch mode {
+		case "crash":
+			fmt.Fprintln(os.Stderr, "lookup service unavailable")
+			os.Exit(3)
+		case "garbage":
+			fmt.Printf("maybe%c", delim)
+		case "log":
+			answer := "reject"
+			if len(fields) == 3 && strings.HasSuffix(fields[0], ".log") {
+				answer = "accept"
+			}
+			fmt.Printf("%s%c", answer, delim)
+		}
+	}
+}
+
+func filterCmdRun(t *testing.T, mode, root string, cfg Config) (string, error) {
+	t.Setenv("FSS_TEST_FILTER", mode)
+	cfg.FilterCmd = os.Args[0] + " -test.run=^TestFilterCmdHelper$"
+
+	var buffer bytes.Buffer
+	err := NewScanner(root, cfg).Run(&buffer)
+	return buffer.String(), err
+}
+
+// TestRunFilterCmd
+func TestRunFilterCmd(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     string
+		cfg      Config
+		expected string
+	}{
+		{"Accepted", "log", Config{List: true}, "testdata/dir.log\n"},
+		{"AfterBuiltinFilters", "log", Config{List: true, Ext: ".gz"}, ""},
+		{"NUL", "log-nul", Config{List: true, FilterCmdNUL: true}, "testdata/dir.log\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := filterCmdRun(t, tc.mode, "testdata", tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestRunFilterCmdErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		mode   string
+		expMsg string
+	}{
+		{"Crash", "crash", "lookup service unavailable"},
+		{"InvalidAnswer", "garbage", `invalid answer "maybe\n"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := filterCmdRun(t, tc.mode, "testdata", Config{List: true})
+			if !errors.Is(err, ErrFilterCmd) {
+				t.Fatalf("expected error %q, got %v instead\n", ErrFilterCmd, err)
+			}
+			if !strings.Contains(err.Error(), tc.expMsg) {
+				t.Errorf("expected %q in the error, got %q instead\n", tc.expMsg, err)
+			}
+		})
+	}
+}
+
+// More files than the window keep the walk and the command in step
+func TestRunFilterCmdWindow(t *testing.T) {
+	tempDir := t.TempDir()
+	var expected string
+	for i := 0; i < 3*filterWindow; i++ {
+		fpath := filepath.Join(tempDir, fmt.Sprintf("file%03d.log", i))
+		if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		expected += fpath + "\n"
+	}
+
+	res, err := filterCmdRun(t, "log", tempDir, Config{List: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != expected {
+		t.Errorf("expected %d files, got %q instead\n", 3*filterWindow, res)
+	}
+}
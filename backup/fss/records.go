@@ -0,0 +1,282 @@
+package fss
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// DefaultMaxInMemory is the number of buffered records kept in memory
+// before spilling to disk when no limit is configured
+const DefaultMaxInMemory = 1000000
+
+// record is the compact form of a matched file used wherever matches
+// have to be buffered instead of handing around full os.FileInfo values
+type record struct {
+	path  string
+	size  int64
+	mtime int64
+	mode  uint32
+}
+
+func newRecord(path string, info os.FileInfo) record {
+	return record{
+		path:  path,
+		size:  info.Size(),
+		mtime: info.ModTime().UnixNano(),
+		mode:  uint32(info.Mode()),
+	}
+}
+
+// recordLess returns the ordering function for the sort key
+func recordLess(key string) (func(a, b record) bool, error) {
+	switch key {
+	case "path":
+		return func(a, b record) bool { return a.path < b.path }, nil
+	case "size":
+		return func(a, b record) bool {
+			if a.size != b.size {
+				return a.size < b.size
+			}
+			return a.path < b.path
+		}, nil
+	case "mtime":
+		return func(a, b record) bool {
+			if a.mtime != b.mtime {
+				return a.mtime < b.mtime
+			}
+			return a.path < b.path
+		}, nil
+	}
+	return nil, fmt.Errorf("%w %q: use path, size or mtime", ErrInvalidSort, key)
+}
+
+// recordStore keeps up to max records in memory. Every time the buffer
+// fills up it is sorted and spilled to a temporary file, and Each merges
+// the spilled runs back in order.
+type recordStore struct {
+	max  int
+	less func(a, b record) bool
+	buf  []record
+	runs []string
+}
+
+func newRecordStore(max int, less func(a, b record) bool) *recordStore {
+	if max <= 0 {
+		max = DefaultMaxInMemory
+	}
+	return &recordStore{max: max, less: less}
+}
+
+// Add buffers r, spilling to disk when the in-memory limit is reached
+func (s *recordStore) Add(r record) error {
+	s.buf = append(s.buf, r)
+	if len(s.buf) >= s.max {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *recordStore) sortBuf() {
+	sort.Slice(s.buf, func(i, j int) bool { return s.less(s.buf[i], s.buf[j]) })
+}
+
+func (s *recordStore) spill() error {
+	s.sortBuf()
+
+	f, err := os.CreateTemp("", "fss-records-*")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+
+	w := bufio.NewWriter(f)
+	for _, r := range s.buf {
+		if err := writeRecord(w, r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	s.buf = s.buf[:0]
+	return f.Close()
+}
+
+// Each calls fn for every record in sorted order
+func (s *recordStore) Each(fn func(record) error) error {
+	s.sortBuf()
+
+	if len(s.runs) == 0 {
+		for _, r := range s.buf {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	h := &mergeHeap{less: s.less}
+	for _, name := range s.runs {
+		f, err := os.Open(name)
+		if err != nil {
+			h.close()
+			return err
+		}
+		src := &runSource{f: f, r: bufio.NewReader(f)}
+		ok, err := src.next()
+		if err != nil {
+			f.Close()
+			h.close()
+			return err
+		}
+		if ok {
+			h.items = append(h.items, src)
+		} else {
+			f.Close()
+		}
+	}
+	if len(s.buf) > 0 {
+		src := &runSource{mem: s.buf}
+		src.next()
+		h.items = append(h.items, src)
+	}
+	defer h.close()
+	heap.Init(h)
+
+	for h.Len() > 0 {
+		src := h.items[0]
+		if err := fn(src.cur); err != nil {
+			return err
+		}
+		ok, err := src.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// Close removes the spilled runs
+func (s *recordStore) Close() error {
+	var err error
+	for _, name := range s.runs {
+		if e := os.Remove(name); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.runs = nil
+	s.buf = nil
+	return err
+}
+
+// writeRecord encodes r as varint fields followed by the path bytes
+func writeRecord(w *bufio.Writer, r record) error {
+	var b [4 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], uint64(len(r.path)))
+	n += binary.PutVarint(b[n:], r.size)
+	n += binary.PutVarint(b[n:], r.mtime)
+	n += binary.PutUvarint(b[n:], uint64(r.mode))
+	if _, err := w.Write(b[:n]); err != nil {
+		return err
+	}
+	_, err := w.WriteString(r.path)
+	return err
+}
+
+// readRecord decodes a record written by writeRecord
+func readRecord(br *bufio.Reader) (record, error) {
+	var r record
+	l, err := binary.ReadUvarint(br)
+	if err != nil {
+		return r, err
+	}
+	if r.size, err = binary.ReadVarint(br); err != nil {
+		return r, err
+	}
+	if r.mtime, err = binary.ReadVarint(br); err != nil {
+		return r, err
+	}
+	mode, err := binary.ReadUvarint(br)
+	if err != nil {
+		return r, err
+	}
+	r.mode = uint32(mode)
+
+	p := make([]byte, l)
+	if _, err := io.ReadFull(br, p); err != nil {
+		return r, err
+	}
+	r.path = string(p)
+	return r, nil
+}
+
+// runSource is one sorted input of the merge, on disk or in memory
+type runSource struct {
+	f   *os.File
+	r   *bufio.Reader
+	mem []record
+	cur record
+}
+
+func (s *runSource) next() (bool, error) {
+	if s.r == nil {
+		if len(s.mem) == 0 {
+			return false, nil
+		}
+		s.cur, s.mem = s.mem[0], s.mem[1:]
+		return true, nil
+	}
+
+	r, err := readRecord(s.r)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	s.cur = r
+	return true, nil
+}
+
+type mergeHeap struct {
+	items []*runSource
+	less  func(a, b record) bool
+	all   []*runSource
+}
+
+func (h *mergeHeap) Len() int           { return len(h.items) }
+func (h *mergeHeap) Less(i, j int) bool { return h.less(h.items[i].cur, h.items[j].cur) }
+func (h *mergeHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap) Push(x interface{}) { h.items = append(h.items, x.(*runSource)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := h.items
+	n := len(old)
+	x := old[n-1]
+	h.items = old[:n-1]
+	h.all = append(h.all, x)
+	return x
+}
+
+func (h *mergeHeap) close() {
+	for _, list := range [][]*runSource{h.items, h.all} {
+		for _, s := range list {
+			if s.f != nil {
+				s.f.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRecordStore(t *testing.T) {
+	testCases := []struct {
+		name     string
+		max      int
+		key      string
+		expRuns  int
+		expected []string
+	}{
+		{"InMemory", 10, "path", 0, []string{"a", "b", "c", "d", "e"}},
+		{"SpillEveryTwo", 2, "path", 2, []string{"a", "b", "c", "d", "e"}},
+		{"SpillEveryOne", 1, "path", 5, []string{"a", "b", "c", "d", "e"}},
+		{"SpillBySize", 2, "size", 2, []string{"e", "c", "a", "d", "b"}},
+		{"SpillByMtime", 3, "mtime", 1, []string{"b", "d", "a", "c", "e"}},
+	}
+
+	input := []record{
+		{path: "c", size: 20, mtime: 30},
+		{path: "a", size: 30, mtime: 20},
+		{path: "e", size: 10, mtime: 50},
+		{path: "b", size: 50, mtime: 10},
+		{path: "d", size: 40, mtime: 10},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			less, err := recordLess(tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := newRecordStore(tc.max, less)
+			for _, r := range input {
+				if err := s.Add(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(s.runs) != tc.expRuns {
+				t.Errorf("expected %d spilled runs, got %d instead\n", tc.expRuns, len(s.runs))
+			}
+			runs := append([]string{}, s.runs...)
+
+			var res []string
+			if err := s.Each(func(r record) error {
+				res = append(res, r.path)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprint(res) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected %v, got %v instead\n", tc.expected, res)
+			}
+
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range runs {
+				if _, err := os.Stat(name); !os.IsNotExist(err) {
+					t.Errorf("expected spill file %s to be removed\n", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	r := record{path: "testdata/dir2/script.sh", size: 1 << 40, mtime: -5, mode: uint32(os.ModeDir | 0755)}
+
+	s := newRecordStore(1, func(a, b record) bool { return a.path < b.path })
+	defer s.Close()
+	if err := s.Add(r); err != nil {
+		t.Fatal(err)
+	}
+
+	var res record
+	if err := s.Each(func(got record) error {
+		res = got
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if res != r {
+		t.Errorf("expected %+v, got %+v instead\n", r, res)
+	}
+}
+
+func TestRecordLessInvalid(t *testing.T) {
+	if _, err := recordLess("name"); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("expected error %q, got %v instead", ErrInvalidSort, err)
+	}
+}
+
+// TestRunSortSpill
+func TestRunSortSpill(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 7}, "dummy"))
+
+	for i, name := range []string{"file3.log", "file1.log", "file7.log"} {
+		data := make([]byte, 100*(i+1))
+		if err := os.WriteFile(filepath.Join(tempDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := Config{Sort: "size", MaxInMemory: 2}
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ""
+	for _, name := range []string{"file2.log", "file4.log", "file5.log", "file6.log", "file3.log", "file1.log", "file7.log"} {
+		expected += filepath.Join(tempDir, name) + "\n"
+	}
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// fakeInfo is a synthetic os.FileInfo for the memory benchmarks
+type fakeInfo struct {
+	name string
+	size int64
+}
+
+func (f fakeInfo) Name() string       { return f.name }
+func (f fakeInfo) Size() int64        { return f.size }
+func (f fakeInfo) Mode() os.FileMode  { return 0644 }
+func (f fakeInfo) ModTime() time.Time { return time.Unix(f.size, 0) }
+func (f fakeInfo) IsDir() bool        { return false }
+func (f fakeInfo) Sys() interface{}   { return nil }
+
+const benchEntries = 5000000
+
+func peakHeapMB() float64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return float64(m.HeapInuse) / (1 << 20)
+}
+
+// BenchmarkBufferFileInfo buffers every match as os.FileInfo, as the
+// buffered outputs would without the record store
+func BenchmarkBufferFileInfo(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		var infos []os.FileInfo
+		var paths []string
+		for j := 0; j < benchEntries; j++ {
+			p := fmt.Sprintf("/data/logs/%d/file%d.log", j%1000, j)
+			paths = append(paths, p)
+			infos = append(infos, fakeInfo{name: filepath.Base(p), size: int64(j)})
+		}
+		b.ReportMetric(peakHeapMB(), "peak-heap-MB")
+		runtime.KeepAlive(infos)
+		runtime.KeepAlive(paths)
+	}
+}
+
+// BenchmarkRecordStore buffers the same matches through the spilling store
+func BenchmarkRecordStore(b *testing.B) {
+	less, _ := recordLess("size")
+	for i := 0; i < b.N; i++ {
+		s := newRecordStore(100000, less)
+		var peak float64
+		for j := 0; j < benchEntries; j++ {
+			p := fmt.Sprintf("/data/logs/%d/file%d.log", j%1000, j)
+			if err := s.Add(newRecord(p, fakeInfo{name: filepath.Base(p), size: int64(j)})); err != nil {
+				b.Fatal(err)
+			}
+			if j%1000000 == 0 {
+				if h := peakHeapMB(); h > peak {
+					peak = h
+				}
+			}
+		}
+		if h := peakHeapMB(); h > peak {
+			peak = h
+		}
+		b.ReportMetric(peak, "peak-heap-MB")
+
+		if err := s.Each(func(record) error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,95 @@
+package fss
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Strategies of Config.RenameCollision, for the renames whose new name is
+// already taken
+const (
+	CollisionError     = "error"     // leave the file as it is and fail with fs.ErrExist
+	CollisionNumber    = "number"    // add a number before the extension, like the trash
+	CollisionOverwrite = "overwrite" // replace the file holding the new name
+)
+
+// checkRenameCollision checks the collision strategy s, error if empty
+func checkRenameCollision(s string) error {
+	switch s {
+	case "", CollisionError, CollisionNumber, CollisionOverwrite:
+		return nil
+	}
+	return fmt.Errorf("%w %q: use error, number or overwrite", ErrInvalidCollision, s)
+}
+
+// renameCollision returns the name a file is renamed to instead of dst as
+// set by strategy when dst is taken, dst itself when it is free. With
+// number the name gets the first free number from 2 before its
+// extension, a.log.2.processed for a.log.processed.
+func renameCollision(dst, strategy string) (string, error) {
+	free := func(name string) (bool, error) {
+		_, err := fsys.Lstat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	ok, err := free(dst)
+	if ok || err != nil {
+		return dst, err
+	}
+	switch strategy {
+	case CollisionOverwrite:
+		return dst, nil
+	case CollisionNumber:
+		ext := filepath.Ext(dst)
+		for n := 2; ; n++ {
+			name := fmt.Sprintf("%s.%d%s", strings.TrimSuffix(dst, ext), n, ext)
+			if ok, err := free(name); ok || err != nil {
+				return name, err
+			}
+		}
+	}
+	return "", fmt.Errorf("%s %w, not renaming", dst, fs.ErrExist)
+}
+
+// renamedPath returns the path the file at path is renamed to with the
+// AppendSuffix or StripSuffix of cfg. It is false for the files left
+// alone by StripSuffix, those whose name doesn't end with it or is the
+// suffix itself.
+func renamedPath(path string, cfg Config) (string, bool) {
+	if cfg.AppendSuffix != "" {
+		return path + cfg.AppendSuffix, true
+	}
+	base := filepath.Base(path)
+	if len(base) <= len(cfg.StripSuffix) || !strings.HasSuffix(base, cfg.StripSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(path, cfg.StripSuffix), true
+}
+
+// renameFile renames the file of m to dst, or the name chosen by
+// renameCollision, and returns the new name. Like delFile it re-stats the
+// file first so a file replaced since the walk is left alone.
+func renameFile(m match, dst, strategy string) (string, error) {
+	cur, err := fsys.Lstat(m.path)
+	if err != nil {
+		return "", err
+	}
+	if !sameFile(m.info, cur) || cur.Size() != m.info.Size() ||
+		!cur.ModTime().Equal(m.info.ModTime()) {
+		return "", fmt.Errorf("%s %w, not renaming", m.path, ErrChanged)
+	}
+
+	if dst, err = renameCollision(dst, strategy); err != nil {
+		return "", err
+	}
+	if err := fsys.Rename(m.path, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
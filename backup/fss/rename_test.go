@@ -0,0 +1,172 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// treeNames returns the paths of the files under root relative to it,
+// sorted, with their content
+func treeNames(t *testing.T, root string) []string {
+	t.Helper()
+	var names []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		names = append(names, filepath.ToSlash(rel)+"="+string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestRunAppendSuffix checks the matched files end up with the suffix and
+// no longer exist under their name, and the collision strategies
+func TestRunAppendSuffix(t *testing.T) {
+	testCases := []struct {
+		name      string
+		collision string
+		expErr    error
+		expFiles  []string
+		expLog    []string
+	}{
+		{
+			name:     "Renamed",
+			expErr:   fs.ErrExist,
+			expFiles: []string{"a.log.done=a", "b.log.done=old", "b.log=b", "c.txt=c", "sub/d.log.done=d"},
+			expLog:   []string{"a.log -> a.log.done", "sub/d.log -> sub/d.log.done"},
+		},
+		{
+			name:      "Number",
+			collision: CollisionNumber,
+			expFiles:  []string{"a.log.done=a", "b.log.2.done=b", "b.log.done=old", "c.txt=c", "sub/d.log.done=d"},
+			expLog:    []string{"a.log -> a.log.done", "b.log -> b.log.2.done", "sub/d.log -> sub/d.log.done"},
+		},
+		{
+			name:      "Overwrite",
+			collision: CollisionOverwrite,
+			expFiles:  []string{"a.log.done=a", "b.log.done=b", "c.txt=c", "sub/d.log.done=d"},
+			expLog:    []string{"a.log -> a.log.done", "b.log -> b.log.done", "sub/d.log -> sub/d.log.done"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			writeFiles(t, tempDir, map[string]string{
+				"a.log":      "a",
+				"b.log":      "b",
+				"b.log.done": "old",
+				"c.txt":      "c",
+				"sub/d.log":  "d",
+			})
+
+			var logBuffer bytes.Buffer
+			var failed []string
+			cfg := Config{Ext: ".log", AppendSuffix: ".done", RenameCollision: tc.collision, LogWriter: &logBuffer}
+			cfg.OnError = func(path string, err error) bool {
+				if !errors.Is(err, tc.expErr) {
+					t.Errorf("%s: expected error %v, got %v instead\n", path, tc.expErr, err)
+				}
+				failed = append(failed, filepath.Base(path))
+				return true
+			}
+			var out bytes.Buffer
+			if err := NewScanner(tempDir, cfg).Run(&out); err != nil {
+				t.Fatal(err)
+			}
+			if out.Len() != 0 {
+				t.Errorf("expected no listing, got %q instead\n", out.String())
+			}
+			if tc.expErr != nil && strings.Join(failed, " ") != "b.log" {
+				t.Errorf("expected b.log to fail, got %v instead\n", failed)
+			}
+
+			if files := treeNames(t, tempDir); strings.Join(files, " ") != strings.Join(tc.expFiles, " ") {
+				t.Errorf("expected %v, got %v instead\n", tc.expFiles, files)
+			}
+			for _, line := range tc.expLog {
+				parts := strings.Split(line, " -> ")
+				exp := " " + filepath.Join(tempDir, filepath.FromSlash(parts[0])) +
+					" -> " + filepath.Join(tempDir, filepath.FromSlash(parts[1])) + "\n"
+				if !strings.Contains(logBuffer.String(), exp) {
+					t.Errorf("expected %q in the log, got %q instead\n", exp, logBuffer.String())
+				}
+			}
+			if n := strings.Count(logBuffer.String(), "RENAMED FILE: "); n != len(tc.expLog) {
+				t.Errorf("expected %d renames logged, got %d instead\n", len(tc.expLog), n)
+			}
+		})
+	}
+}
+
+// TestRunAppendSuffixHook checks the renames are passed to OnAction with
+// their new name instead of being logged
+func TestRunAppendSuffixHook(t *testing.T) {
+	m, root := memTree(t, testsupport.Files(map[string]string{"a.log": "a"}))
+	useFS(t, m)
+
+	var logBuffer bytes.Buffer
+	var actions []string
+	cfg := Config{AppendSuffix: ".processed", LogWriter: &logBuffer}
+	cfg.OnAction = func(action, path, dest string, err error) {
+		actions = append(actions, action+" "+filepath.Base(path)+" "+filepath.Base(dest))
+	}
+	if err := NewScanner(root, cfg).Run(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "rename a.log a.log.processed"; strings.Join(actions, ", ") != expected {
+		t.Errorf("expected %q, got %q instead\n", expected, strings.Join(actions, ", "))
+	}
+	if logBuffer.Len() != 0 {
+		t.Errorf("expected no log, got %q instead\n", logBuffer.String())
+	}
+	if left := m.paths(root); strings.Join(left, " ") != "a.log.processed" {
+		t.Errorf("expected a.log.processed left, got %v instead\n", left)
+	}
+}
+
+// TestRunStripSuffix checks the matched files ending with the suffix are
+// renamed to their base form, the others left alone, and the collision
+// strategy applies to the names already taken
+func TestRunStripSuffix(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a.log.processed":     "a",
+		"b.log.processed":     "b",
+		"b.log":               "old",
+		"c.log":               "c",
+		".processed":          "bare",
+		"sub/d.csv.processed": "d",
+	})
+
+	var logBuffer bytes.Buffer
+	cfg := Config{StripSuffix: ".processed", RenameCollision: CollisionNumber, LogWriter: &logBuffer}
+	if err := NewScanner(tempDir, cfg).Run(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{".processed=bare", "a.log=a", "b.2.log=b", "b.log=old", "c.log=c", "sub/d.csv=d"}
+	if files := treeNames(t, tempDir); strings.Join(files, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v instead\n", expected, files)
+	}
+	if n := strings.Count(logBuffer.String(), "RENAMED FILE: "); n != 3 {
+		t.Errorf("expected 3 renames logged, got %q instead\n", logBuffer.String())
+	}
+}
@@ -0,0 +1,110 @@
+package fss
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// replaceContent replaces cfg.ReplaceOld by cfg.ReplaceNew in the file of
+// m, at most cfg.ReplaceCount times when it is set. The new content is
+// written to a temporary file next to it, renamed over the file once
+// complete, so a failed write leaves the file as it was. Files with a NUL
+// byte aren't text and are left alone. The number of replacements is
+// written with name, even with an OnAction hook, and with
+// cfg.ReplaceDryRun the changed lines are written instead of the file.
+func replaceContent(m match, name string, cfg Config, out io.Writer) error {
+	data, err := fsys.ReadFile(m.path)
+	if err != nil {
+		return err
+	}
+	if containsNullByte(data) {
+		return nil
+	}
+
+	text, limit := string(data), cfg.ReplaceCount
+	if limit <= 0 {
+		limit = -1
+	}
+	n := strings.Count(text, cfg.ReplaceOld)
+	if limit >= 0 && n > limit {
+		n = limit
+	}
+	if n == 0 {
+		return nil
+	}
+
+	if cfg.ReplaceDryRun {
+		if _, err := fmt.Fprintf(out, "%d\t%s (dry run)\n", n, name); err != nil {
+			return err
+		}
+		return previewReplace(text, cfg.ReplaceOld, cfg.ReplaceNew, n, out)
+	}
+
+	cur, err := fsys.Lstat(m.path)
+	if err != nil {
+		return err
+	}
+	if !sameFile(m.info, cur) || !cur.ModTime().Equal(m.info.ModTime()) {
+		return fmt.Errorf("%s %w, not replacing", m.path, ErrChanged)
+	}
+	err = writeReplaced(m.path, cur.Mode().Perm(), strings.Replace(text, cfg.ReplaceOld, cfg.ReplaceNew, limit))
+	cfg.notify(Result{Path: m.path, Info: m.info, Action: "replace", Dest: name, Err: err})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%d\t%s\n", n, name)
+	return err
+}
+
+// writeReplaced writes text to a temporary file in the directory of path
+// and renames it over path
+func writeReplaced(path string, perm os.FileMode, text string) error {
+	tmp, err := fsys.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".fss-*")
+	if err != nil {
+		return err
+	}
+	defer fsys.Remove(tmp.Name())
+
+	if _, err := io.WriteString(tmp, text); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return fsys.Rename(tmp.Name(), path)
+}
+
+// previewReplace writes the lines of text changed by the first n
+// replacements of old by new, as diff style removed and added lines. A
+// string spanning lines can't be shown line by line and only the count
+// is written.
+func previewReplace(text, old, new string, n int, out io.Writer) error {
+	if strings.Contains(old, "\n") {
+		return nil
+	}
+	for i, line := range strings.Split(text, "\n") {
+		if n == 0 {
+			break
+		}
+		k := strings.Count(line, old)
+		if k == 0 {
+			continue
+		}
+		if k > n {
+			k = n
+		}
+		n -= k
+		if _, err := fmt.Fprintf(out, "%d: -%s\n%d: +%s\n", i+1, line, i+1, strings.Replace(line, old, new, k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRunReplace
+func TestRunReplace(t *testing.T) {
+	const content = "host=old.example\nbackup=old.example\nmirror=old.example old.example\n"
+
+	testCases := []struct {
+		name       string
+		cfg        Config
+		expContent string
+		expOut     string
+	}{
+		{
+			name:       "All",
+			cfg:        Config{ReplaceOld: "old.example", ReplaceNew: "new.example"},
+			expContent: "host=new.example\nbackup=new.example\nmirror=new.example new.example\n",
+			expOut:     "4\tapp.conf\n",
+		},
+		{
+			name:       "Count",
+			cfg:        Config{ReplaceOld: "old.example", ReplaceNew: "new.example", ReplaceCount: 3},
+			expContent: "host=new.example\nbackup=new.example\nmirror=new.example old.example\n",
+			expOut:     "3\tapp.conf\n",
+		},
+		{
+			name:       "DryRun",
+			cfg:        Config{ReplaceOld: "old.example", ReplaceNew: "new.example", ReplaceCount: 2, ReplaceDryRun: true},
+			expContent: content,
+			expOut: "2\tapp.conf (dry run)\n" +
+				"1: -host=old.example\n1: +host=new.example\n" +
+				"2: -backup=old.example\n2: +backup=new.example\n",
+		},
+		{
+			name:       "NoMatch",
+			cfg:        Config{ReplaceOld: "other.example", ReplaceNew: "new.example"},
+			expContent: content,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+				"app.conf": {Content: content, Mode: 0600},
+				"app.bin":  {Content: "old.example\x00"},
+			})
+			var buffer bytes.Buffer
+			tc.cfg.StripPrefix = tempDir + string(filepath.Separator)
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expOut != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expOut, buffer.String())
+			}
+
+			data, err := os.ReadFile(filepath.Join(tempDir, "app.conf"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expContent != string(data) {
+				t.Errorf("expected %q, got %q instead\n", tc.expContent, string(data))
+			}
+			info, err := os.Stat(filepath.Join(tempDir, "app.conf"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("expected mode %v, got %v instead\n", os.FileMode(0600), info.Mode().Perm())
+			}
+
+			// Binary files and the temporary files are never left behind
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				t.Errorf("expected 2 files, got %d instead\n", len(entries))
+			}
+			if data, _ := os.ReadFile(filepath.Join(tempDir, "app.bin")); string(data) != "old.example\x00" {
+				t.Errorf("expected the binary file to be kept, got %q instead\n", string(data))
+			}
+		})
+	}
+}
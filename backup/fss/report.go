@@ -0,0 +1,357 @@
+package fss
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// numericName matches the names made of digits only
+var numericName = regexp.MustCompile(`^\d+$`)
+
+// isNumericName reports whether the base name of path, without its
+// extension, is made of digits only
+func isNumericName(path string) bool {
+	base := filepath.Base(path)
+	return numericName.MatchString(strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// reportNumericName writes the path of a file with a numeric name
+func reportNumericName(path string, out io.Writer) error {
+	_, err := fmt.Fprintf(out, "NUMERIC: %s\n", path)
+	return err
+}
+
+// dirCount is the number and total size of matched files in a directory
+type dirCount struct {
+	dir   string
+	count int
+	size  int64
+}
+
+// dirCounter tallies matched files per parent directory
+type dirCounter map[string]*dirCount
+
+func (c dirCounter) add(m match, size int64) {
+	dir := filepath.Dir(m.path)
+	d, ok := c[dir]
+	if !ok {
+		d = &dirCount{dir: dir}
+		c[dir] = d
+	}
+	d.count++
+	d.size += size
+}
+
+// largest returns up to n directories with the most matched files
+func (c dirCounter) largest(n int) []dirCount {
+	dirs := make([]dirCount, 0, len(c))
+	for _, d := range c {
+		dirs = append(dirs, *d)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].count != dirs[j].count {
+			return dirs[i].count > dirs[j].count
+		}
+		if dirs[i].size != dirs[j].size {
+			return dirs[i].size > dirs[j].size
+		}
+		return dirs[i].dir < dirs[j].dir
+	})
+	if n < len(dirs) {
+		dirs = dirs[:n]
+	}
+	return dirs
+}
+
+// reportLargestDirs writes the n directories with the most matched files
+func reportLargestDirs(c dirCounter, n int, out io.Writer) error {
+	for _, d := range c.largest(n) {
+		if _, err := fmt.Fprintf(out, "Largest dir: %s (%d files, %d bytes)\n", d.dir, d.count, d.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bigDir is the number of direct entries of a directory and their total
+// size
+type bigDir struct {
+	Dir     string `json:"dir"`
+	Entries int    `json:"entries"`
+	Size    int64  `json:"size"`
+}
+
+// entryCounter tallies the entries of the walk per parent directory,
+// matched or not
+type entryCounter map[string]*bigDir
+
+func (c entryCounter) add(path string, size int64) {
+	dir := filepath.Dir(path)
+	d, ok := c[dir]
+	if !ok {
+		d = &bigDir{Dir: dir}
+		c[dir] = d
+	}
+	d.Entries++
+	d.Size += size
+}
+
+// over returns the directories with more than n entries, the most first
+func (c entryCounter) over(n int) []bigDir {
+	dirs := []bigDir{}
+	for _, d := range c {
+		if d.Entries > n {
+			dirs = append(dirs, *d)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].Entries != dirs[j].Entries {
+			return dirs[i].Entries > dirs[j].Entries
+		}
+		return dirs[i].Dir < dirs[j].Dir
+	})
+	return dirs
+}
+
+// reportBigDirs writes the directories with their entries and size, in
+// human readable units with human
+func reportBigDirs(dirs []bigDir, human bool, out io.Writer) error {
+	for _, d := range dirs {
+		size := strconv.FormatInt(d.Size, 10) + " bytes"
+		if human {
+			size = HumanSize(d.Size)
+		}
+		if _, err := fmt.Fprintf(out, "Big dir: %s (%d entries, %s)\n", d.Dir, d.Entries, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportJSONSummary writes the reports of owners, bigDirs and the totals
+// of wc, those not nil, as one JSON object
+func reportJSONSummary(owners *ownerCounter, bigDirs []bigDir, wc *wcCounter, out io.Writer) error {
+	summary := map[string]interface{}{}
+	if owners != nil {
+		summary["by_owner"] = owners.sorted()
+	}
+	if bigDirs != nil {
+		summary["big_dirs"] = bigDirs
+	}
+	if wc != nil {
+		summary["wc"] = wc
+	}
+	return json.NewEncoder(out).Encode(summary)
+}
+
+// extGroups collects the listed paths per extension, in listing order
+type extGroups map[string][]string
+
+func (g extGroups) add(path string) {
+	ext := filepath.Ext(path)
+	g[ext] = append(g[ext], path)
+}
+
+// reportExtGroups writes a [.ext] header for each extension, sorted,
+// followed by its paths indented. The paths without an extension come
+// first, under [].
+func reportExtGroups(g extGroups, out io.Writer) error {
+	exts := make([]string, 0, len(g))
+	for ext := range g {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+
+	for _, ext := range exts {
+		if _, err := fmt.Fprintf(out, "[%s]\n", ext); err != nil {
+			return err
+		}
+		for _, path := range g[ext] {
+			if _, err := fmt.Fprintf(out, "  %s\n", path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// inode identifies a file across hard links
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// linkSet tells the first link of the hard linked files apart from the
+// others. Only the inodes of files with more than one link are kept.
+type linkSet map[inode]struct{}
+
+// size returns the size of info, or 0 when it is another link of a file
+// already seen. A nil set counts the size of every link.
+func (s linkSet) size(info os.FileInfo) int64 {
+	if s == nil || info.IsDir() || fileLinks(info) < 2 {
+		return info.Size()
+	}
+	id, ok := fileID(info)
+	if !ok {
+		return info.Size()
+	}
+	if _, seen := s[id]; seen {
+		return 0
+	}
+	s[id] = struct{}{}
+	return info.Size()
+}
+
+// inodeGroups collects the matched paths per inode
+type inodeGroups map[inode][]string
+
+func (g inodeGroups) add(m match) {
+	if id, ok := fileID(m.info); ok {
+		g[id] = append(g[id], m.path)
+	}
+}
+
+// shared returns the inodes of more than one matched path, sorted, with
+// their paths sorted
+func (g inodeGroups) shared() []inode {
+	ids := make([]inode, 0, len(g))
+	for id, paths := range g {
+		if len(paths) > 1 {
+			ids = append(ids, id)
+			sort.Strings(paths)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].dev != ids[j].dev {
+			return ids[i].dev < ids[j].dev
+		}
+		return ids[i].ino < ids[j].ino
+	})
+	return ids
+}
+
+// reportHardlinkTrees writes every inode shared by more than one matched
+// path, followed by its paths indented
+func reportHardlinkTrees(g inodeGroups, out io.Writer) error {
+	for _, id := range g.shared() {
+		paths := g[id]
+		if _, err := fmt.Fprintf(out, "Hardlink inode %d (%d paths):\n", id.ino, len(paths)); err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if _, err := fmt.Fprintf(out, "  %s\n", path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reportDuplicateInodes writes every inode shared by more than one
+// matched path on one line, HARDLINK_GROUP <inode>: followed by its paths
+// comma separated
+func reportDuplicateInodes(g inodeGroups, out io.Writer) error {
+	for _, id := range g.shared() {
+		if _, err := fmt.Fprintf(out, "HARDLINK_GROUP %d: %s\n", id.ino, strings.Join(g[id], ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nameGroups collects the matched paths per base name
+type nameGroups map[string][]string
+
+func (g nameGroups) add(m match) {
+	name := filepath.Base(m.path)
+	g[name] = append(g[name], m.path)
+}
+
+// reportDuplicateNames writes the paths of every base name matched in
+// more than one directory, one block per name. Each block starts with a
+// blank line, setting it apart from the listing and the other blocks.
+func reportDuplicateNames(g nameGroups, out io.Writer) error {
+	names := make([]string, 0, len(g))
+	for name, paths := range g {
+		if len(paths) > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := fmt.Fprintln(out); err != nil {
+			return err
+		}
+		paths := g[name]
+		sort.Strings(paths)
+		for _, path := range paths {
+			if _, err := fmt.Fprintln(out, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dirContents collects the name, size and modification time of the matched
+// files per directory
+type dirContents map[string][]string
+
+func (c dirContents) add(m match) {
+	dir := filepath.Dir(m.path)
+	c[dir] = append(c[dir], fmt.Sprintf("%s\x00%d\x00%d",
+		filepath.Base(m.path), m.info.Size(), m.info.ModTime().UnixNano()))
+}
+
+// identical returns the directories whose matched files have the same
+// names, sizes and modification times, in groups of two or more sorted by
+// their first directory. The files themselves aren't read.
+func (c dirContents) identical() [][]string {
+	byHash := map[string][]string{}
+	for dir, files := range c {
+		sort.Strings(files)
+		h := sha256.New()
+		for _, f := range files {
+			io.WriteString(h, f+"\n")
+		}
+		sum := hex.EncodeToString(h.Sum(nil))
+		byHash[sum] = append(byHash[sum], dir)
+	}
+
+	var groups [][]string
+	for _, dirs := range byHash {
+		if len(dirs) > 1 {
+			sort.Strings(dirs)
+			groups = append(groups, dirs)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+// reportIdenticalDirs writes every group of identical directories with
+// the number of matched files in each, followed by the directories
+// indented
+func reportIdenticalDirs(c dirContents, out io.Writer) error {
+	for _, dirs := range c.identical() {
+		if _, err := fmt.Fprintf(out, "Identical dirs (%d files):\n", len(c[dirs[0]])); err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			if _, err := fmt.Fprintf(out, "  %s\n", dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
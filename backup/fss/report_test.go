@@ -0,0 +1,680 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirCounterLargest(t *testing.T) {
+	c := dirCounter{
+		"a": {dir: "a", count: 2, size: 10},
+		"b": {dir: "b", count: 5, size: 1},
+		"c": {dir: "c", count: 2, size: 30},
+		"d": {dir: "d", count: 2, size: 30},
+	}
+
+	testCases := []struct {
+		name     string
+		n        int
+		expected string
+	}{
+		{"Top1", 1, "[b]"},
+		{"Top3TiesBySizeThenPath", 3, "[b c d]"},
+		{"MoreThanDirs", 10, "[b c d a]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var res []string
+			for _, d := range c.largest(tc.n) {
+				res = append(res, d.dir)
+			}
+			if fmt.Sprint(res) != tc.expected {
+				t.Errorf("expected %s, got %v instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunReportLargestDir
+func TestRunReportLargestDir(t *testing.T) {
+	tempDir := t.TempDir()
+	layout := map[string]int{"small": 2, "hot": 6, "mid": 3}
+	for dir, n := range layout {
+		if err := os.Mkdir(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			fpath := filepath.Join(tempDir, dir, fmt.Sprintf("file%d.log", i))
+			if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Files that don't match must not count
+		fpath := filepath.Join(tempDir, dir, "extra.gz")
+		if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{
+			name:     "Largest",
+			cfg:      Config{Ext: ".log", ReportLargestDir: true},
+			expected: fmt.Sprintf("Largest dir: %s (6 files, 30 bytes)\n", filepath.Join(tempDir, "hot")),
+		},
+		{
+			name: "Top2",
+			cfg:  Config{Ext: ".log", ReportLargestDirN: 2},
+			expected: fmt.Sprintf("Largest dir: %s (6 files, 30 bytes)\nLargest dir: %s (3 files, 15 bytes)\n",
+				filepath.Join(tempDir, "hot"), filepath.Join(tempDir, "mid")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+
+			// The report comes after the 11 listed files
+			lines := strings.SplitAfter(buffer.String(), "\n")
+			res := strings.Join(lines[11:], "")
+			if tc.expected != res {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunReportHardlinkTrees
+func TestRunReportHardlinkTrees(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are not available on Windows")
+	}
+	tempDir := t.TempDir()
+	for _, dir := range []string{"a", "b", filepath.Join("b", "c")} {
+		if err := os.Mkdir(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orig := filepath.Join(tempDir, "a", "orig.log")
+	single := filepath.Join(tempDir, "a", "single.log")
+	for _, fpath := range []string{orig, single} {
+		if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := []string{filepath.Join(tempDir, "b", "link.log"), filepath.Join(tempDir, "b", "c", "link.log")}
+	for _, link := range links {
+		if err := os.Link(orig, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := os.Stat(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := fileID(info)
+
+	var buffer bytes.Buffer
+	cfg := Config{Ext: ".log", List: true, ReportHardlinkTrees: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	// The report comes after the 4 listed files
+	lines := strings.SplitAfter(buffer.String(), "\n")
+	res := strings.Join(lines[4:], "")
+	expected := fmt.Sprintf("Hardlink inode %d (3 paths):\n  %s\n  %s\n  %s\n", id.ino, orig, links[1], links[0])
+	if expected != res {
+		t.Errorf("expected %q, got %q instead\n", expected, res)
+	}
+}
+
+// TestRunReportDuplicateInodes checks each shared inode is one line with
+// its number, and the files with a single link are left out
+func TestRunReportDuplicateInodes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are not available on Windows")
+	}
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a/first.log":  "first",
+		"a/second.log": "second",
+		"single.log":   "single",
+	})
+	var ids []inode
+	var groups [][]string
+	for _, name := range []string{"first.log", "second.log"} {
+		orig := filepath.Join(tempDir, "a", name)
+		link := filepath.Join(tempDir, "b-"+name)
+		if err := os.Link(orig, link); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := fileID(info)
+		ids = append(ids, id)
+		groups = append(groups, []string{orig, link})
+	}
+	if ids[1].ino < ids[0].ino {
+		ids[0], ids[1] = ids[1], ids[0]
+		groups[0], groups[1] = groups[1], groups[0]
+	}
+
+	var buffer bytes.Buffer
+	cfg := Config{Ext: ".log", ReportDuplicateInodes: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	// The report comes after the 5 listed files
+	lines := strings.SplitAfter(buffer.String(), "\n")
+	res := strings.Join(lines[5:], "")
+	expected := fmt.Sprintf("HARDLINK_GROUP %d: %s\nHARDLINK_GROUP %d: %s\n",
+		ids[0].ino, strings.Join(groups[0], ", "), ids[1].ino, strings.Join(groups[1], ", "))
+	if expected != res {
+		t.Errorf("expected %q, got %q instead\n", expected, res)
+	}
+}
+
+// TestRunReportFileAge
+func TestRunReportFileAge(t *testing.T) {
+	tempDir := t.TempDir()
+	now := time.Now()
+	ages := []struct {
+		name     string
+		age      time.Duration
+		expected string
+	}{
+		{"new.log", 5*time.Minute + 30*time.Second, "5m 30s"},
+		{"old.log", 2*24*time.Hour + 3*time.Hour + 14*time.Minute, "2d 3h 14m"},
+	}
+
+	var expected string
+	for _, a := range ages {
+		fpath := filepath.Join(tempDir, a.name)
+		if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-a.age)
+		if err := os.Chtimes(fpath, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		expected += a.expected + "\t" + fpath + "\n"
+	}
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{List: true, ReportFileAge: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunReportContentType
+func TestRunReportContentType(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write([]byte("compressed log lines")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"packed.log", gz.Bytes(), "application/x-gzip"},
+		{"plain.log", []byte("plain log lines"), "text/plain; charset=utf-8"},
+	}
+
+	var expected string
+	for _, f := range files {
+		fpath := filepath.Join(tempDir, f.name)
+		if err := os.WriteFile(fpath, f.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		expected += f.expected + "\t" + fpath + "\n"
+	}
+
+	var buffer bytes.Buffer
+	cfg := Config{List: true, Ext: ".log", ReportContentType: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+func TestContentTypesCache(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "file.log")
+	if err := os.WriteFile(fpath, []byte("plain text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	types := contentTypes{}
+	if _, err := types.of(fpath); err != nil {
+		t.Fatal(err)
+	}
+	// The cached type is returned without reading the file again
+	if err := os.Remove(fpath); err != nil {
+		t.Fatal(err)
+	}
+	typ, err := types.of(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != "text/plain; charset=utf-8" {
+		t.Errorf("expected %q, got %q instead\n", "text/plain; charset=utf-8", typ)
+	}
+}
+
+func TestIsNumericName(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{"tmp/12345", true},
+		{"tmp/12345.tmp", true},
+		{"tmp/007", true},
+		{"tmp/123abc", false},
+		{"tmp/abc.123", false},
+		{"tmp/12 34", false},
+		{"tmp/.123", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if got := isNumericName(tc.path); got != tc.expected {
+				t.Errorf("expected %t, got %t instead\n", tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestRunReportNumericNames
+func TestRunReportNumericNames(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"1700000000":  "dummy",
+		"42.cache":    "dummy",
+		"report2.txt": "dummy",
+		"notes":       "dummy",
+	})
+
+	var buffer bytes.Buffer
+	cfg := Config{List: true, ReportNumericNames: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "NUMERIC: " + filepath.Join(tempDir, "1700000000") + "\n" +
+		"NUMERIC: " + filepath.Join(tempDir, "42.cache") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+
+	// Only the numeric names are deleted
+	cfg = Config{Del: true, LogWriter: &buffer, ReportNumericNames: true}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	for name, exists := range map[string]bool{
+		"1700000000": false, "42.cache": false, "report2.txt": true, "notes": true,
+	} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); (err == nil) != exists {
+			t.Errorf("expected %s to exist %t, got %v instead\n", name, exists, err)
+		}
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	testCases := []struct {
+		size     int64
+		expected string
+	}{
+		{0, "0B"},
+		{512, "512B"},
+		{1024, "1.0K"},
+		{1536, "1.5K"},
+		{23 << 20, "23M"},
+		{5 << 40, "5.0T"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			if res := HumanSize(tc.size); res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestOwnerCounterUnknown(t *testing.T) {
+	c := newOwnerCounter()
+	c.add(match{path: "a.log", info: fakeInfo{name: "a.log", size: 10}}, 10)
+	c.add(match{path: "b.log", info: fakeInfo{name: "b.log", size: 5}}, 5)
+
+	expected := []ownerUsage{{Owner: unknownOwner, Files: 2, Size: 15}}
+	if res := c.sorted(); fmt.Sprint(res) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v instead\n", expected, res)
+	}
+}
+
+// TestRunReportByOwner
+func TestRunReportByOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no file owners on windows")
+	}
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"a.log":     {Size: 2048},
+		"b.log":     {Size: 1024},
+		"notes.txt": {Size: 10},
+	})
+
+	testCases := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{"Text", Config{Ext: ".log", ReportByOwner: true}, filepath.Join(tempDir, "a.log") + "\n" +
+			filepath.Join(tempDir, "b.log") + "\n" + "Owner: " + u.Username + " (2 files, 3072 bytes)\n"},
+		{"Human", Config{Ext: ".txt", ReportByOwner: true, HumanSizes: true}, filepath.Join(tempDir, "notes.txt") + "\n" +
+			"Owner: " + u.Username + " (1 files, 10B)\n"},
+		{"JSON", Config{Ext: ".log", ReportByOwner: true, JSONReport: true},
+			`{"by_owner":[{"owner":"` + u.Username + `","files":2,"size":3072}]}` + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			tc.cfg.List = true
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunHardlinkSizes checks a hard linked file is counted once in the
+// sizes, at its first link in walk order, unless ApparentSize is set
+func TestRunHardlinkSizes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no hard link counts on windows")
+	}
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"data/a.bin": {Size: 1000},
+		"data/b.bin": {Size: 500},
+		"copy/c.bin": {Size: 200},
+	})
+	if err := os.Link(filepath.Join(tempDir, "data", "a.bin"), filepath.Join(tempDir, "copy", "a.bin")); err != nil {
+		t.Fatal(err)
+	}
+	copyDir, dataDir := filepath.Join(tempDir, "copy"), filepath.Join(tempDir, "data")
+
+	testCases := []struct {
+		name     string
+		apparent bool
+		expected string
+	}{
+		{"Linked", false, "Largest dir: " + copyDir + " (2 files, 1200 bytes)\n" +
+			"Largest dir: " + dataDir + " (2 files, 500 bytes)\n" +
+			"Owner: " + u.Username + " (4 files, 1700 bytes)\n" +
+			"Total files scanned: 4\nTotal directories scanned: 3\n" +
+			"Total size matched: 1700 bytes (2700 bytes apparent)\n"},
+		{"Apparent", true, "Largest dir: " + dataDir + " (2 files, 1500 bytes)\n" +
+			"Largest dir: " + copyDir + " (2 files, 1200 bytes)\n" +
+			"Owner: " + u.Username + " (4 files, 2700 bytes)\n" +
+			"Total files scanned: 4\nTotal directories scanned: 3\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{
+				List: true, ReportLargestDirN: 2, ReportByOwner: true, ReportTotals: true, ApparentSize: tc.apparent,
+				OnAction: func(action, path, dest string, err error) {},
+			}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunBigDirs
+func TestRunBigDirs(t *testing.T) {
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"a/1.log":   {Size: 100},
+		"a/2.log":   {Size: 100},
+		"a/3.txt":   {Size: 100},
+		"a/4.txt":   {Size: 100},
+		"b/1.log":   {Size: 2048},
+		"b/2.log":   {Size: 2048},
+		"b/c/1.log": {Size: 10},
+	})
+	dirA, dirB := filepath.Join(tempDir, "a"), filepath.Join(tempDir, "b")
+	info, err := os.Lstat(filepath.Join(dirB, "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonA, err := json.Marshal(dirA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		// Every entry is counted, the filters only narrow the listing
+		{"Text", Config{Ext: ".none", BigDirs: 2}, "Big dir: " + dirA + " (4 entries, 400 bytes)\n" +
+			fmt.Sprintf("Big dir: %s (3 entries, %d bytes)\n", dirB, 4096+info.Size())},
+		{"Threshold", Config{Ext: ".none", BigDirs: 3}, "Big dir: " + dirA + " (4 entries, 400 bytes)\n"},
+		{"Human", Config{Ext: ".none", BigDirs: 3, HumanSizes: true}, "Big dir: " + dirA + " (4 entries, 400B)\n"},
+		{"None", Config{Ext: ".none", BigDirs: 4}, ""},
+		{"JSON", Config{Ext: ".log", BigDirs: 3, JSONReport: true},
+			`{"big_dirs":[{"dir":` + string(jsonA) + `,"entries":4,"size":400}]}` + "\n"},
+		{"JSONEmpty", Config{Ext: ".log", BigDirs: 4, JSONReport: true}, `{"big_dirs":[]}` + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			tc.cfg.List = true
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunGroupByExt checks each listed path comes once, under the header
+// of its extension
+func TestRunGroupByExt(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"app.log":        "dummy",
+		"a/old.log.gz":   "dummy",
+		"a/b/db.log":     "dummy",
+		"a/README":       "dummy",
+		"notes.txt":      "dummy",
+		"a/b/report.gz":  "dummy",
+		"a/b/c/data.txt": "dummy",
+	}))
+
+	var listBuffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{List: true}).Run(&listBuffer); err != nil {
+		t.Fatal(err)
+	}
+	listed := strings.Split(strings.TrimSpace(listBuffer.String()), "\n")
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{List: true, GroupByExt: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	var headers, grouped []string
+	ext := ""
+	for _, line := range strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n") {
+		if strings.HasPrefix(line, "[") {
+			ext = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			headers = append(headers, ext)
+			continue
+		}
+		path := strings.TrimPrefix(line, "  ")
+		if filepath.Ext(path) != ext {
+			t.Errorf("expected %q under [%s], got it under [%s] instead\n", path, filepath.Ext(path), ext)
+		}
+		grouped = append(grouped, path)
+	}
+
+	expHeaders := []string{"", ".gz", ".log", ".txt"}
+	if !reflect.DeepEqual(expHeaders, headers) {
+		t.Errorf("expected %q, got %q instead\n", expHeaders, headers)
+	}
+	if len(grouped) != len(listed) {
+		t.Errorf("expected %d paths, got %d instead\n", len(listed), len(grouped))
+	}
+	sort.Strings(listed)
+	sort.Strings(grouped)
+	if !reflect.DeepEqual(listed, grouped) {
+		t.Errorf("expected %q, got %q instead\n", listed, grouped)
+	}
+}
+
+// TestRunReportDuplicateNames
+func TestRunReportDuplicateNames(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{
+		"a/app.log":      "dummy",
+		"b/app.log":      "dummy",
+		"b/c/app.log":    "dummy",
+		"a/config.yaml":  "dummy",
+		"b/config.yaml":  "dummy",
+		"a/single.log":   "dummy",
+		"b/c/other.yaml": "dummy",
+	}))
+	join := func(paths ...string) string {
+		var sb strings.Builder
+		for _, p := range paths {
+			sb.WriteString(filepath.Join(tempDir, filepath.FromSlash(p)) + "\n")
+		}
+		return sb.String()
+	}
+
+	var buffer bytes.Buffer
+	cfg := Config{List: true, ReportDuplicateNames: true, OnAction: func(action, path, dest string, err error) {}}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "\n" + join("a/app.log", "b/app.log", "b/c/app.log") + "\n" + join("a/config.yaml", "b/config.yaml")
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestRunReportIdenticalDirs
+func TestRunReportIdenticalDirs(t *testing.T) {
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"a/photo.jpg":   {Size: 100},
+		"a/notes.txt":   {Size: 10},
+		"b/photo.jpg":   {Size: 100},
+		"b/notes.txt":   {Size: 10},
+		"c/photo.jpg":   {Size: 100},
+		"c/notes.txt":   {Size: 11},
+		"d/e/photo.jpg": {Size: 100},
+	})
+	mtime := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	for _, p := range []string{"a/photo.jpg", "a/notes.txt", "b/photo.jpg", "b/notes.txt", "c/photo.jpg", "c/notes.txt"} {
+		if err := os.Chtimes(filepath.Join(tempDir, filepath.FromSlash(p)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := func(p string) string { return filepath.Join(tempDir, p) }
+
+	testCases := []struct {
+		name   string
+		cfg    Config
+		expOut string
+	}{
+		{"AllFiles", Config{},
+			"Identical dirs (2 files):\n  " + dir("a") + "\n  " + dir("b") + "\n"},
+		{"Filtered", Config{Ext: ".jpg"},
+			"Identical dirs (1 files):\n  " + dir("a") + "\n  " + dir("b") + "\n  " + dir("c") + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			tc.cfg.List = true
+			tc.cfg.ReportIdenticalDirs = true
+			tc.cfg.OnAction = func(action, path, dest string, err error) {}
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expOut != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expOut, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunFileReportsConflict checks a scan with two reports of one line
+// per file fails instead of writing only the first one
+func TestRunFileReportsConflict(t *testing.T) {
+	cfg := Config{List: true, ReportJSONValidity: true, ReportLineCount: true, ReportFirstLine: true}
+	var buffer bytes.Buffer
+	err := NewScanner("testdata", cfg).Run(&buffer)
+	var cerr *ConfigError
+	if !errors.As(err, &cerr) || cerr.Option != "ReportLineCount" {
+		t.Fatalf("expected a ReportLineCount ConfigError, got %v instead\n", err)
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("expected no output, got %q instead\n", buffer.String())
+	}
+}
@@ -0,0 +1,85 @@
+package fss
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Restore decompresses the archives written by a scan with Config.Arc
+// from arcDir into dest, keeping the directory structure and the
+// modification times. Existing files are never overwritten. Each restored
+// file is written to out.
+func Restore(arcDir, dest string, out io.Writer) error {
+	if err := checkArchiveDir(arcDir); err != nil {
+		return err
+	}
+
+	return walkTree(arcDir, WalkPre, keepAll, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".gz" {
+			return nil
+		}
+
+		relDir, err := filepath.Rel(arcDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		target, err := restoreFile(path, filepath.Join(dest, relDir))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, target)
+		return err
+	})
+}
+
+// restoreFile decompresses the archive path into dir and returns the
+// restored file path
+func restoreFile(path, dir string) (string, error) {
+	in, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	defer zr.Close()
+
+	// The name in the header is only trusted as a base name
+	name := filepath.Base(zr.Name)
+	if zr.Name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), ".gz")
+	}
+	target := filepath.Join(dir, name)
+
+	if err := fsys.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := fsys.Create(target, true)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, zr); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	if !zr.ModTime.IsZero() {
+		if err := fsys.Chtimes(target, zr.ModTime, zr.ModTime); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
@@ -0,0 +1,74 @@
+package fss
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRestore checks that archived files are restored with their
+// content, layout and modification time
+func TestRestore(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join("a.log"):        "first",
+		filepath.Join("sub", "b.log"): "second",
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	arcDir := t.TempDir()
+	if err := NewScanner(root, Config{Arc: arcDir}).Run(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	var buffer bytes.Buffer
+	if err := Restore(arcDir, dest, &buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	expOut := filepath.Join(dest, "a.log") + "\n" + filepath.Join(dest, "sub", "b.log") + "\n"
+	if expOut != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expOut, buffer.String())
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dest, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("expected %q, got %q instead\n", content, string(data))
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("expected mtime %v, got %v instead\n", mtime, info.ModTime())
+		}
+	}
+
+	// Restoring again must not overwrite the restored files
+	if err := Restore(arcDir, dest, &buffer); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected error %q, got %v instead\n", fs.ErrExist, err)
+	}
+}
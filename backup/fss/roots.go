@@ -0,0 +1,178 @@
+package fss
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// scanTotals counts the entries looked at by a scan
+type scanTotals struct {
+	files int64
+	dirs  int64
+
+	// Size of the matched files, each hard linked file counted once, and
+	// apparent size counting every link
+	size     int64
+	apparent int64
+
+	// Files matched and kept by Sample, when sampled is set
+	sampled       bool
+	matched, kept int64
+
+	// Files deleted and the deletes that failed, when deletes is set
+	deletes         bool
+	deleted, failed int64
+}
+
+// add adds the totals of o to t
+func (t *scanTotals) add(o scanTotals) {
+	t.files += o.files
+	t.dirs += o.dirs
+	t.size += o.size
+	t.apparent += o.apparent
+	t.sampled = t.sampled || o.sampled
+	t.matched += o.matched
+	t.kept += o.kept
+	t.deletes = t.deletes || o.deletes
+	t.deleted += o.deleted
+	t.failed += o.failed
+}
+
+// String returns the totals on one line, the files and directories
+// followed by the sample, size and delete totals the scan has
+func (t scanTotals) String() string {
+	s := fmt.Sprintf("%d files, %d directories", t.files, t.dirs)
+	if t.sampled {
+		s += fmt.Sprintf(", %d matched, %d sampled", t.matched, t.kept)
+	}
+	if t.size != t.apparent {
+		s += fmt.Sprintf(", %d bytes matched (%d bytes apparent)", t.size, t.apparent)
+	}
+	if t.deletes {
+		s += fmt.Sprintf(", %d deleted, %d deletes failed", t.deleted, t.failed)
+	}
+	return s
+}
+
+// RootsError reports the roots of RunRoots that failed
+type RootsError struct {
+	Roots []string
+	Errs  []error
+}
+
+func (e *RootsError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = fmt.Sprintf("%s: %v", e.Roots[i], err)
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the error of each failed root
+func (e *RootsError) Unwrap() []error {
+	return e.Errs
+}
+
+// CleanRoots returns roots without the duplicates and the roots inside
+// another one, which would be scanned twice. Each dropped root is
+// reported to warn.
+func CleanRoots(roots []string, warn io.Writer) []string {
+	abs := make([]string, len(roots))
+	for i, root := range roots {
+		a, err := filepath.Abs(root)
+		if err != nil {
+			a = filepath.Clean(root)
+		}
+		abs[i] = a
+	}
+
+	var clean []string
+	for i, root := range roots {
+		dropped := false
+		for j := range roots {
+			if i == j {
+				continue
+			}
+			switch {
+			case abs[i] == abs[j] && j < i:
+				fmt.Fprintf(warn, "warning: skipping duplicate root %s\n", root)
+			case abs[i] != abs[j] && inside(abs[i], abs[j]):
+				fmt.Fprintf(warn, "warning: skipping root %s inside %s\n", root, roots[j])
+			default:
+				continue
+			}
+			dropped = true
+			break
+		}
+		if !dropped {
+			clean = append(clean, root)
+		}
+	}
+	return clean
+}
+
+// inside reports whether path is under dir
+func inside(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// RunRoots runs a scan of each root with cfg, writing to out. A failed
+// root doesn't stop the scan of the others unless failFast is set, the
+// failures are returned as a *RootsError. The totals are reported for
+// each root and for all of them.
+func RunRoots(roots []string, cfg Config, failFast bool, out io.Writer) error {
+	if len(roots) == 1 {
+		return NewScanner(roots[0], cfg).Run(out)
+	}
+
+	enc, err := NewEncodedWriter(out, cfg.OutputEncoding)
+	if err != nil {
+		return err
+	}
+
+	reportTotals := cfg.ReportTotals
+	cfg.ReportTotals = false
+	totals := make([]scanTotals, len(roots))
+	failed := &RootsError{}
+	for i, root := range roots {
+		if err := NewScanner(root, cfg).run(context.Background(), enc, &totals[i]); err != nil {
+			failed.Roots = append(failed.Roots, root)
+			failed.Errs = append(failed.Errs, err)
+			if failFast {
+				break
+			}
+		}
+	}
+
+	if reportTotals {
+		if err := reportRootTotals(enc, roots, totals); err != nil {
+			enc.Close()
+			return err
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if len(failed.Errs) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// reportRootTotals writes the totals of each root and of all of them
+func reportRootTotals(w io.Writer, roots []string, totals []scanTotals) error {
+	var all scanTotals
+	for i, root := range roots {
+		if _, err := fmt.Fprintf(w, "Totals for %s: %s\n", root, totals[i]); err != nil {
+			return err
+		}
+		all.add(totals[i])
+	}
+	_, err := fmt.Fprintf(w, "Totals for all roots: %s\n", all)
+	return err
+}
@@ -0,0 +1,189 @@
+package fss
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCleanRoots checks duplicate roots and roots inside another one are
+// dropped with a warning
+func TestCleanRoots(t *testing.T) {
+	// A fresh temp dir is outside the module wherever it is checked out
+	outside := t.TempDir()
+
+	testCases := []struct {
+		name     string
+		roots    []string
+		expected string
+		warnings int
+	}{
+		{"Distinct", []string{"testdata/dir2", outside}, "testdata/dir2," + outside, 0},
+		{"Duplicate", []string{"testdata", "testdata/", "./testdata"}, "testdata", 2},
+		{"NestedAfter", []string{"testdata", "testdata/dir2"}, "testdata", 1},
+		{"NestedBefore", []string{"testdata/dir2", "testdata"}, "testdata", 1},
+		{"SamePrefix", []string{"testdata/dir", "testdata/dir2"}, "testdata/dir,testdata/dir2", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var warn bytes.Buffer
+			res := strings.Join(CleanRoots(tc.roots, &warn), ",")
+			if res != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, res)
+			}
+			if n := strings.Count(warn.String(), "warning: "); n != tc.warnings {
+				t.Errorf("expected %d warnings, got %q instead\n", tc.warnings, warn.String())
+			}
+		})
+	}
+}
+
+// TestRunRoots checks each root is scanned with its own totals, and a
+// failed root stops the others only with failFast
+func TestRunRoots(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a/one.log": "dummy",
+		"b/two.log": "dummy",
+		"b/sub/x":   "dummy",
+	})
+	a, b := filepath.Join(tempDir, "a"), filepath.Join(tempDir, "b")
+	missing := filepath.Join(tempDir, "missing")
+
+	testCases := []struct {
+		name     string
+		roots    []string
+		failFast bool
+		expected string
+		failed   int
+	}{
+		{
+			name:  "Totals",
+			roots: []string{a, b},
+			expected: filepath.Join(a, "one.log") + "\n" + filepath.Join(b, "two.log") + "\n" +
+				"Totals for " + a + ": 1 files, 1 directories\n" +
+				"Totals for " + b + ": 2 files, 2 directories\n" +
+				"Totals for all roots: 3 files, 3 directories\n",
+		},
+		{
+			name:  "FailedRootContinues",
+			roots: []string{missing, a},
+			expected: filepath.Join(a, "one.log") + "\n" +
+				"Totals for " + missing + ": 0 files, 0 directories\n" +
+				"Totals for " + a + ": 1 files, 1 directories\n" +
+				"Totals for all roots: 1 files, 1 directories\n",
+			failed: 1,
+		},
+		{
+			name:     "FailFast",
+			roots:    []string{missing, a},
+			failFast: true,
+			expected: "Totals for " + missing + ": 0 files, 0 directories\n" +
+				"Totals for " + a + ": 0 files, 0 directories\n" +
+				"Totals for all roots: 0 files, 0 directories\n",
+			failed: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := Config{Ext: ".log", List: true, ReportTotals: true}
+			err := RunRoots(tc.roots, cfg, tc.failFast, &buffer)
+
+			if tc.failed == 0 && err != nil {
+				t.Fatal(err)
+			}
+			if tc.failed > 0 {
+				var rootsErr *RootsError
+				if !errors.As(err, &rootsErr) || len(rootsErr.Errs) != tc.failed {
+					t.Fatalf("expected %d failed roots, got %v instead\n", tc.failed, err)
+				}
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("expected a not exist error, got %v instead\n", err)
+				}
+			}
+			if buffer.String() != tc.expected {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunRootsFullTotals checks the sample, size and delete totals are
+// reported for each root and summed for all of them
+func TestRunRootsFullTotals(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  Config
+		exp  [3]string
+	}{
+		{
+			name: "Sample",
+			cfg:  Config{Ext: ".log", List: true, Sample: "100%"},
+			exp: [3]string{
+				"1 files, 1 directories, 1 matched, 1 sampled",
+				"3 files, 2 directories, 2 matched, 2 sampled, 5 bytes matched (10 bytes apparent)",
+				"4 files, 3 directories, 3 matched, 3 sampled, 10 bytes matched (15 bytes apparent)",
+			},
+		},
+		{
+			name: "Delete",
+			cfg:  Config{Ext: ".log", Del: true, LogWriter: io.Discard},
+			exp: [3]string{
+				"1 files, 1 directories, 1 deleted, 0 deletes failed",
+				"3 files, 2 directories, 2 deleted, 0 deletes failed",
+				"4 files, 3 directories, 3 deleted, 0 deletes failed",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			writeFiles(t, tempDir, map[string]string{
+				"a/one.log": "dummy",
+				"b/two.log": "dummy",
+				"b/sub/x":   "dummy",
+			})
+			if err := os.Link(filepath.Join(tempDir, "b", "two.log"), filepath.Join(tempDir, "b", "sub", "x.log")); err != nil {
+				t.Fatal(err)
+			}
+			a, b := filepath.Join(tempDir, "a"), filepath.Join(tempDir, "b")
+
+			var buffer bytes.Buffer
+			tc.cfg.ReportTotals = true
+			if err := RunRoots([]string{a, b}, tc.cfg, false, &buffer); err != nil {
+				t.Fatal(err)
+			}
+			expected := "Totals for " + a + ": " + tc.exp[0] + "\n" +
+				"Totals for " + b + ": " + tc.exp[1] + "\n" +
+				"Totals for all roots: " + tc.exp[2] + "\n"
+			if !strings.HasSuffix(buffer.String(), expected) {
+				t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunRootsWriteError checks a failed write of the totals is returned
+func TestRunRootsWriteError(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{"a/one.log": "dummy", "b/two.log": "dummy"})
+
+	out, err := os.Create(filepath.Join(tempDir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	cfg := Config{Ext: ".txt", ReportTotals: true}
+	err = RunRoots([]string{filepath.Join(tempDir, "a"), filepath.Join(tempDir, "b")}, cfg, false, out)
+	if !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected %v, got %v instead\n", os.ErrClosed, err)
+	}
+}
@@ -0,0 +1,94 @@
+package fss
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sampler lists a uniform random sample of the matched files, either n
+// of them with a reservoir or each with probability rate
+type sampler struct {
+	n    int
+	rate float64
+	rnd  *rand.Rand
+
+	seen int
+	kept int
+	pool []sampled
+}
+
+// sampled is a file of the reservoir with its rank in the walk
+type sampled struct {
+	m    match
+	rank int
+}
+
+// parseSample reads a sample size, a number of files or a percentage of
+// them such as 1% or 0.5%
+func parseSample(s string) (n int, rate float64, err error) {
+	if pct := strings.TrimSuffix(s, "%"); pct != s {
+		rate, err = strconv.ParseFloat(pct, 64)
+		if err != nil || rate <= 0 || rate > 100 {
+			return 0, 0, fmt.Errorf("%w %q, expected more than 0%% and at most 100%%", ErrInvalidSample, s)
+		}
+		return 0, rate / 100, nil
+	}
+	n, err = strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, 0, fmt.Errorf("%w %q, expected a number of files or a percentage", ErrInvalidSample, s)
+	}
+	return n, 0, nil
+}
+
+// newSampler returns the sampler of the sample size s with the seeded
+// RNG, nil when s is empty
+func newSampler(s string, seed int64) (*sampler, error) {
+	if s == "" {
+		return nil, nil
+	}
+	n, rate, err := parseSample(s)
+	if err != nil {
+		return nil, err
+	}
+	return &sampler{n: n, rate: rate, rnd: rand.New(rand.NewSource(seed))}, nil
+}
+
+// add samples the file of m. The files kept by rate are passed to emit
+// right away, those of the reservoir once flushed.
+func (s *sampler) add(m match, emit func(match) error) error {
+	s.seen++
+	if s.n == 0 {
+		if s.rnd.Float64() >= s.rate {
+			return nil
+		}
+		s.kept++
+		return emit(m)
+	}
+
+	// Algorithm R: the i-th file replaces a random one of the reservoir
+	// with probability n/i
+	if len(s.pool) < s.n {
+		s.pool = append(s.pool, sampled{m, s.seen})
+		return nil
+	}
+	if j := s.rnd.Intn(s.seen); j < s.n {
+		s.pool[j] = sampled{m, s.seen}
+	}
+	return nil
+}
+
+// flush passes the files of the reservoir to emit in walk order
+func (s *sampler) flush(emit func(match) error) error {
+	sort.Slice(s.pool, func(i, j int) bool { return s.pool[i].rank < s.pool[j].rank })
+	for _, f := range s.pool {
+		s.kept++
+		if err := emit(f.m); err != nil {
+			return err
+		}
+	}
+	s.pool = nil
+	return nil
+}
@@ -0,0 +1,168 @@
+package fss
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseSample(t *testing.T) {
+	testCases := []struct {
+		name    string
+		size    string
+		expN    int
+		expRate float64
+		expErr  bool
+	}{
+		{"Count", "1000", 1000, 0, false},
+		{"Percent", "1%", 0, 0.01, false},
+		{"FractionalPercent", "0.5%", 0, 0.005, false},
+		{"WholeTree", "100%", 0, 1, false},
+		{"Zero", "0", 0, 0, true},
+		{"ZeroPercent", "0%", 0, 0, true},
+		{"OverPercent", "150%", 0, 0, true},
+		{"NotANumber", "some", 0, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, rate, err := parseSample(tc.size)
+			if tc.expErr {
+				if !errors.Is(err, ErrInvalidSample) {
+					t.Errorf("expected error %q, got %v instead\n", ErrInvalidSample, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tc.expN || math.Abs(rate-tc.expRate) > 1e-9 {
+				t.Errorf("expected %d and %g, got %d and %g instead\n", tc.expN, tc.expRate, n, rate)
+			}
+		})
+	}
+}
+
+// TestSamplerUniform checks each file has the same chance to be in the
+// reservoir, and the rate keeps about that share of the files
+func TestSamplerUniform(t *testing.T) {
+	const files, n, runs = 20, 5, 4000
+
+	picked := make([]int, files)
+	for seed := int64(0); seed < runs; seed++ {
+		s, err := newSampler(fmt.Sprint(n), seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < files; i++ {
+			if err := s.add(match{path: fmt.Sprint(i)}, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		prev := -1
+		err = s.flush(func(m match) error {
+			var i int
+			fmt.Sscan(m.path, &i)
+			if i <= prev {
+				t.Fatalf("expected the sample in walk order, got %d after %d\n", i, prev)
+			}
+			prev = i
+			picked[i]++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	exp := float64(runs) * n / files
+	for i, count := range picked {
+		if math.Abs(float64(count)-exp) > 0.1*exp {
+			t.Errorf("file %d: expected about %.0f picks, got %d instead\n", i, exp, count)
+		}
+	}
+
+	s, err := newSampler("10%", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		if err := s.add(match{path: fmt.Sprint(i)}, func(match) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.kept < 900 || s.kept > 1100 {
+		t.Errorf("expected about 1000 files, got %d instead\n", s.kept)
+	}
+}
+
+// TestRunSample checks the sample is stable for a seed, and the totals
+// have the count of all the matched files
+func TestRunSample(t *testing.T) {
+	tempDir := numberedTree(t, 50)
+
+	testCases := []struct {
+		name    string
+		size    string
+		expRate bool
+	}{
+		{"Reservoir", "10", false},
+		{"Rate", "20%", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run := func(seed int64) string {
+				var buffer bytes.Buffer
+				cfg := Config{Sample: tc.size, RandSeed: seed, ReportTotals: true}
+				if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+					t.Fatal(err)
+				}
+				return buffer.String()
+			}
+
+			res := run(7)
+			if res != run(7) {
+				t.Error("expected the same sample for the same seed")
+			}
+			if res == run(8) {
+				t.Error("expected another sample for another seed")
+			}
+
+			lines := strings.Split(strings.TrimSpace(res), "\n")
+			listed := len(lines) - 4
+			if !tc.expRate && listed != 10 {
+				t.Errorf("expected 10 files, got %d instead\n", listed)
+			}
+			if tc.expRate && (listed < 3 || listed > 20) {
+				t.Errorf("expected about 10 files, got %d instead\n", listed)
+			}
+			expTotals := fmt.Sprintf("Total files matched: 50\nTotal files sampled: %d", listed)
+			if !strings.HasSuffix(strings.TrimSpace(res), expTotals) {
+				t.Errorf("expected the totals to end with %q, got %q instead\n", expTotals, res)
+			}
+		})
+	}
+}
+
+// TestRunSampleChecksum checks the sampled files are the ones checksummed
+func TestRunSampleChecksum(t *testing.T) {
+	tempDir := numberedTree(t, 30)
+
+	var buffer bytes.Buffer
+	cfg := Config{Sample: "5", RandSeed: 3, Checksum: true, HashWorkers: 4}
+	if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 checksums, got %q instead\n", lines)
+	}
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) != 2 || len(fields[0]) != 64 {
+			t.Errorf("expected a checksum and a path, got %q instead\n", line)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package fss
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// Result is the outcome of an action on a matched file, as sent by Scan
+type Result struct {
+	Path   string
+	Info   os.FileInfo // stat of the file from the walk, before the action
+	Action string      // list, archive, delete, trash, copy, rename or replace, as passed to OnAction
+	Dest   string      // listed name, archive written to, verified copy or new name, as passed to OnAction
+	Err    error       // error of the action, the file was left as it was
+}
+
+// hooked reports whether the outcomes of the actions go to a hook, the
+// listing and the logs being left to it
+func (c Config) hooked() bool {
+	return c.OnAction != nil || c.onResult != nil
+}
+
+// notify passes r to the OnAction hook and to the results of Scan.
+// Every action reports its outcome through it.
+func (c Config) notify(r Result) {
+	if c.OnAction != nil {
+		c.OnAction(r.Action, r.Path, r.Dest, r.Err)
+	}
+	if c.onResult != nil {
+		c.onResult(r)
+	}
+}
+
+// Scan runs the scan on a new goroutine and sends the outcome of each
+// action on a matched file to the results as it happens, "list" for the
+// files only listed. The scan waits for the consumer, a slow one holds it
+// back. Nothing is written out: the reports are left out and the logs go
+// to the hooks only, as with the OnAction hook set, which is still called.
+//
+// The results are closed once the scan is over, then the error ending it,
+// if any, is sent to the errors before they are closed too. No result
+// arrives after the error, but results may arrive after one with Err set:
+// OnError can skip the path, and with DeleteWorkers the deletes already
+// running still report. Cancelling ctx stops the walk at the next entry,
+// the results not taken yet are dropped and the error is ctx.Err().
+func (s *Scanner) Scan(ctx context.Context) (<-chan Result, <-chan error) {
+	results := make(chan Result)
+	errs := make(chan error, 1)
+
+	cfg := s.Config
+	cfg.onResult = func(r Result) {
+		select {
+		case results <- r:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(errs)
+		err := NewScanner(s.Root, cfg).run(ctx, io.Discard, nil)
+		close(results)
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return results, errs
+}
@@ -0,0 +1,195 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// numberedTree makes n .log files under a temporary directory
+func numberedTree(t *testing.T, n int) string {
+	files := map[string]string{}
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("file%03d.log", i)] = "dummy"
+	}
+	return testsupport.Tree(t, testsupport.Files(files))
+}
+
+func TestScan(t *testing.T) {
+	tempDir := t.TempDir()
+	arcDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a.log":     "dummy",
+		"sub/b.log": "dummy",
+		"c.txt":     "dummy",
+	})
+
+	testCases := []struct {
+		name       string
+		cfg        Config
+		expActions []string
+	}{
+		{"List", Config{Ext: ".log", List: true}, []string{"list a.log", "list sub/b.log"}},
+		{"ArchiveDelete", Config{Ext: ".log", Arc: arcDir, Del: true},
+			[]string{"archive a.log", "delete a.log", "archive sub/b.log", "delete sub/b.log"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var hooked int
+			tc.cfg.OnAction = func(action, path, dest string, err error) { hooked++ }
+			results, errs := NewScanner(tempDir, tc.cfg).Scan(context.Background())
+
+			var actions []string
+			for r := range results {
+				if r.Err != nil || r.Info == nil || r.Info.Name() != filepath.Base(r.Path) {
+					t.Errorf("unexpected result %+v\n", r)
+				}
+				rel, _ := filepath.Rel(tempDir, r.Path)
+				actions = append(actions, r.Action+" "+filepath.ToSlash(rel))
+			}
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expActions, actions) {
+				t.Errorf("expected %q, got %q instead\n", tc.expActions, actions)
+			}
+			if hooked != len(tc.expActions) {
+				t.Errorf("expected %d OnAction calls, got %d instead\n", len(tc.expActions), hooked)
+			}
+		})
+	}
+}
+
+// TestScanError checks the failed action is sent with its error, then the
+// error ending the scan once the results are closed
+func TestScanError(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{"a.log": "dummy", "sub/b.log": "dummy"})
+	// The archive of sub/b.log can't be written under a file
+	arcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(arcDir, "sub"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, errs := NewScanner(tempDir, Config{Ext: ".log", Arc: arcDir, Del: true}).Scan(context.Background())
+	var got []string
+	for r := range results {
+		rel, _ := filepath.Rel(tempDir, r.Path)
+		got = append(got, fmt.Sprintf("%s %s %t", r.Action, filepath.ToSlash(rel), r.Err != nil))
+	}
+	if err := <-errs; err == nil {
+		t.Error("expected an error, got nil instead")
+	}
+	if _, ok := <-errs; ok {
+		t.Error("expected the errors closed after the error")
+	}
+	expected := []string{"archive a.log false", "delete a.log false", "archive sub/b.log true"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %q, got %q instead\n", expected, got)
+	}
+}
+
+// TestScanSlowConsumer checks the walk waits for a consumer slower than
+// it, no more than one file ahead of the results taken
+func TestScanSlowConsumer(t *testing.T) {
+	tempDir := numberedTree(t, 20)
+
+	var matched int64
+	cfg := Config{List: true, OnMatch: func(path string, info os.FileInfo) bool {
+		atomic.AddInt64(&matched, 1)
+		return true
+	}}
+	results, errs := NewScanner(tempDir, cfg).Scan(context.Background())
+
+	taken := int64(0)
+	for range results {
+		taken++
+		time.Sleep(5 * time.Millisecond)
+		if ahead := atomic.LoadInt64(&matched) - taken; ahead > 1 {
+			t.Errorf("expected the walk at most 1 file ahead, got %d instead\n", ahead)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if taken != 20 {
+		t.Errorf("expected 20 results, got %d instead\n", taken)
+	}
+}
+
+// TestScanCancel checks a cancelled scan stops early and closes both
+// channels, the error being the one of the context
+func TestScanCancel(t *testing.T) {
+	tempDir := numberedTree(t, 200)
+
+	testCases := []struct {
+		name string
+		cfg  Config
+	}{
+		{"List", Config{List: true}},
+		{"DeleteWorkers", Config{Del: true, DeleteWorkers: 4, LogWriter: &syncBuffer{}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			results, errs := NewScanner(tempDir, tc.cfg).Scan(ctx)
+
+			taken := 0
+			for range results {
+				taken++
+				if taken == 5 {
+					cancel()
+				}
+			}
+			if err := <-errs; !errors.Is(err, context.Canceled) {
+				t.Errorf("expected error %q, got %v instead\n", context.Canceled, err)
+			}
+			if _, ok := <-errs; ok {
+				t.Error("expected the errors closed after the error")
+			}
+			if taken >= 200 {
+				t.Errorf("expected the scan to stop early, got %d results\n", taken)
+			}
+		})
+	}
+}
+
+// TestRunContextCancel checks RunContext stops the walk once its context
+// is cancelled from a hook, without writing the totals
+func TestRunContextCancel(t *testing.T) {
+	tempDir := numberedTree(t, 200)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	matched := 0
+	cfg := Config{List: true, ReportTotals: true, OnMatch: func(path string, info os.FileInfo) bool {
+		matched++
+		if matched == 5 {
+			cancel()
+		}
+		return true
+	}}
+
+	var out bytes.Buffer
+	if err := NewScanner(tempDir, cfg).RunContext(ctx, &out); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error %q, got %v instead\n", context.Canceled, err)
+	}
+	if matched >= 200 {
+		t.Errorf("expected the walk to stop early, got %d matches\n", matched)
+	}
+	if strings.Contains(out.String(), "Total files scanned") {
+		t.Errorf("expected no totals, got %q instead\n", out.String())
+	}
+}
@@ -0,0 +1,83 @@
+package fss
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Match is a file that passed the filters of a scan
+type Match struct {
+	Path string
+	Info os.FileInfo
+}
+
+// Collect walks the tree and returns the files passing the filters,
+// without listing them or applying any action. They can be narrowed down
+// and handed to Apply.
+func (s *Scanner) Collect() ([]Match, error) {
+	cfg := s.Config
+	if err := checkCtime(cfg); err != nil {
+		return nil, err
+	}
+	if err := checkWalkOrder(cfg.WalkOrder); err != nil {
+		return nil, err
+	}
+	if cfg.FromSnapshot {
+		return nil, fmt.Errorf("selecting files %w", ErrSnapshot)
+	}
+	p := newPacer(cfg.Pace)
+	ig, err := newIgnores(s.Root, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var files []Match
+	prune := func(path string, d fs.DirEntry) (bool, error) {
+		if ig == nil {
+			return false, nil
+		}
+		return ig.ignored(path, d.IsDir())
+	}
+	err = walkTree(s.Root, cfg.WalkOrder, prune, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		p.wait()
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if filterOut(path, cfg.Ext, cfg.Size, cfg.MaxFileSize, info) ||
+			cfg.ExcludeSymlinks && info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if changed, err := ctimeOut(cfg, info, now); err != nil || changed {
+			return err
+		}
+		files = append(files, Match{Path: path, Info: info})
+		return nil
+	})
+	return files, err
+}
+
+// Apply archives and deletes files as set in the Config, the same way Run
+// does for the matched files, logging to Config.LogWriter
+func (s *Scanner) Apply(files []Match) error {
+	cfg := s.Config
+	act, err := newActor(context.Background(), s.Root, cfg, newPacer(cfg.Pace))
+	if err != nil {
+		return err
+	}
+	defer act.Close()
+
+	for _, f := range files {
+		if _, err := act.apply(match{path: f.Path, info: f.Info}); err != nil {
+			return err
+		}
+	}
+	return act.Close()
+}
@@ -0,0 +1,48 @@
+package fss
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectApply(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"keep.log":   "dummy",
+		"remove.log": "dummy",
+		"other.txt":  "dummy",
+	})
+
+	s := NewScanner(tempDir, Config{Ext: ".log"})
+	files, err := s.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v instead\n", files)
+	}
+	// Collecting doesn't touch the files even with an action set
+	if _, err := os.Stat(filepath.Join(tempDir, "remove.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	var logBuffer bytes.Buffer
+	s.Config.Del = true
+	s.Config.LogWriter = &logBuffer
+	if err := s.Apply(files[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "keep.log")); err != nil {
+		t.Errorf("expected keep.log to stay, got %v instead\n", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "remove.log")); !os.IsNotExist(err) {
+		t.Errorf("expected remove.log to be deleted, got %v instead\n", err)
+	}
+	if !strings.Contains(logBuffer.String(), "DELETED FILE: ") {
+		t.Errorf("expected the delete in the log, got %q instead\n", logBuffer.String())
+	}
+}
@@ -0,0 +1,55 @@
+package fss
+
+import (
+	"math/rand"
+	"path/filepath"
+	"sort"
+)
+
+// sieve collects the records of the matched files per directory for a
+// stratified sample
+type sieve struct {
+	n     int
+	total int
+	dirs  map[string][]record
+	rnd   *rand.Rand
+}
+
+// newSieve returns a sieve sampling about n files with the seeded RNG
+func newSieve(n int, seed int64) *sieve {
+	return &sieve{n: n, dirs: map[string][]record{}, rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (s *sieve) add(r record) {
+	dir := filepath.Dir(r.path)
+	s.dirs[dir] = append(s.dirs[dir], r)
+	s.total++
+}
+
+// sample returns floor(n * dirCount / total) files of each directory, in
+// directory order and walk order within a directory. All the files are
+// returned when there are no more than n.
+func (s *sieve) sample() []record {
+	dirs := make([]string, 0, len(s.dirs))
+	for dir := range s.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var res []record
+	for _, dir := range dirs {
+		records := s.dirs[dir]
+		if s.total <= s.n {
+			res = append(res, records...)
+			continue
+		}
+
+		k := s.n * len(records) / s.total
+		picked := s.rnd.Perm(len(records))[:k]
+		sort.Ints(picked)
+		for _, i := range picked {
+			res = append(res, records[i])
+		}
+	}
+	return res
+}
@@ -0,0 +1,93 @@
+package fss
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSieveProportions(t *testing.T) {
+	layout := map[string]int{"a": 500, "b": 300, "c": 150, "d": 50}
+	total := 1000
+
+	for _, n := range []int{100, 250, 999} {
+		t.Run(fmt.Sprintf("N%d", n), func(t *testing.T) {
+			s := newSieve(n, 42)
+			for dir, count := range layout {
+				for i := 0; i < count; i++ {
+					s.add(record{path: filepath.Join(dir, fmt.Sprintf("file%d", i))})
+				}
+			}
+
+			sample := s.sample()
+			got := map[string]int{}
+			for _, r := range sample {
+				got[filepath.Dir(r.path)]++
+			}
+
+			for dir, count := range layout {
+				exp := float64(count) / float64(total)
+				res := float64(got[dir]) / float64(len(sample))
+				if math.Abs(res-exp) > 0.1*exp {
+					t.Errorf("dir %s: expected proportion %.3f, got %.3f instead\n", dir, exp, res)
+				}
+			}
+			if len(sample) > n || len(sample) < n-len(layout) {
+				t.Errorf("expected about %d files, got %d instead\n", n, len(sample))
+			}
+		})
+	}
+}
+
+func TestSieveSmallTree(t *testing.T) {
+	s := newSieve(10, 1)
+	for i := 0; i < 3; i++ {
+		s.add(record{path: fmt.Sprintf("dir/file%d", i)})
+	}
+	if res := s.sample(); len(res) != 3 {
+		t.Errorf("expected all 3 files, got %d instead\n", len(res))
+	}
+}
+
+// TestRunSieve checks the sample is stable for a seed
+func TestRunSieve(t *testing.T) {
+	tempDir := t.TempDir()
+	for dir, n := range map[string]int{"big": 40, "small": 10} {
+		if err := os.Mkdir(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			fpath := filepath.Join(tempDir, dir, fmt.Sprintf("file%d.log", i))
+			if err := os.WriteFile(fpath, []byte("dummy"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	run := func(seed int64) string {
+		var buffer bytes.Buffer
+		if err := NewScanner(tempDir, Config{SieveN: 10, RandSeed: seed}).Run(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		return buffer.String()
+	}
+
+	res := run(7)
+	lines := strings.Split(strings.TrimSpace(res), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("expected 10 files, got %d instead\n", len(lines))
+	}
+	if big := strings.Count(res, filepath.Join(tempDir, "big")); big != 8 {
+		t.Errorf("expected 8 files of big, got %d instead\n", big)
+	}
+	if again := run(7); again != res {
+		t.Errorf("expected the same sample for the same seed, got %q and %q\n", res, again)
+	}
+	if other := run(8); other == res {
+		t.Error("expected a different sample for another seed")
+	}
+}
@@ -0,0 +1,111 @@
+package fss
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// sigMap are the magic bytes the files of each extension start with, for
+// reportFileSignature
+var sigMap = map[string][]byte{
+	".pdf":    []byte("%PDF-"),
+	".png":    []byte("\x89PNG\r\n\x1a\n"),
+	".jpg":    []byte("\xff\xd8\xff"),
+	".jpeg":   []byte("\xff\xd8\xff"),
+	".gif":    []byte("GIF8"),
+	".bmp":    []byte("BM"),
+	".ico":    []byte("\x00\x00\x01\x00"),
+	".zip":    []byte("PK\x03\x04"),
+	".jar":    []byte("PK\x03\x04"),
+	".apk":    []byte("PK\x03\x04"),
+	".docx":   []byte("PK\x03\x04"),
+	".xlsx":   []byte("PK\x03\x04"),
+	".pptx":   []byte("PK\x03\x04"),
+	".odt":    []byte("PK\x03\x04"),
+	".gz":     []byte("\x1f\x8b"),
+	".tgz":    []byte("\x1f\x8b"),
+	".bz2":    []byte("BZh"),
+	".xz":     []byte("\xfd7zXZ\x00"),
+	".zst":    []byte("\x28\xb5\x2f\xfd"),
+	".7z":     []byte("7z\xbc\xaf\x27\x1c"),
+	".rpm":    []byte("\xed\xab\xee\xdb"),
+	".deb":    []byte("!<arch>\n"),
+	".class":  []byte("\xca\xfe\xba\xbe"),
+	".wasm":   []byte("\x00asm"),
+	".exe":    []byte("MZ"),
+	".dll":    []byte("MZ"),
+	".sqlite": []byte("SQLite format 3\x00"),
+	".ogg":    []byte("OggS"),
+	".flac":   []byte("fLaC"),
+}
+
+// sigLength is the number of bytes read to check a signature, the length
+// of the longest one
+const sigLength = 16
+
+// textExts are the extensions of text files, which must not start with
+// the signature of a binary format
+var textExts = map[string]bool{
+	".log": true, ".txt": true, ".csv": true, ".json": true, ".md": true,
+	".xml": true, ".html": true, ".yml": true, ".yaml": true, ".toml": true,
+	".ini": true, ".cfg": true, ".conf": true,
+}
+
+// binaryMagic reports whether header starts with a signature of sigMap
+// that text can't start with by chance, one holding a control byte or
+// of at least 4 bytes. Short printable ones like BM or MZ begin words.
+func binaryMagic(header []byte) bool {
+	for _, sig := range sigMap {
+		if !bytes.HasPrefix(header, sig) {
+			continue
+		}
+		if len(sig) >= 4 {
+			return true
+		}
+		for _, c := range sig {
+			if c < 0x20 || c >= 0x7f {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkMagic reports whether header, the first bytes of a file, agrees
+// with its extension ext: it starts with the signature of the extension,
+// or with no binary signature for a text extension. The other extensions
+// always agree.
+func checkMagic(ext string, header []byte) bool {
+	ext = strings.ToLower(ext)
+	if sig, ok := sigMap[ext]; ok {
+		return bytes.HasPrefix(header, sig)
+	}
+	if textExts[ext] {
+		return !binaryMagic(header)
+	}
+	return true
+}
+
+// reportFileSignature writes name marked as MISMATCH when the first bytes
+// of the file at path don't agree with its extension
+func reportFileSignature(path, name string, out io.Writer) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, sigLength)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if checkMagic(filepath.Ext(path), header[:n]) {
+		return nil
+	}
+	_, err = fmt.Fprintf(out, "MISMATCH: %s\n", name)
+	return err
+}
@@ -0,0 +1,68 @@
+package fss
+
+import (
+	"bytes"
+	"compress/gzip"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckMagic(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ext      string
+		header   string
+		expected bool
+	}{
+		{"PDF", ".pdf", "%PDF-1.7\n", true},
+		{"PDFNotPDF", ".pdf", "<html>", false},
+		{"UpperCaseExt", ".PNG", "\x89PNG\r\n\x1a\n\x00\x00", true},
+		{"Empty", ".zip", "", false},
+		{"JarIsZip", ".jar", "PK\x03\x04\x14\x00", true},
+		{"Text", ".log", "2024-01-01 started\n", true},
+		{"GzipAsLog", ".log", "\x1f\x8b\x08\x00", false},
+		{"PDFAsTxt", ".txt", "%PDF-1.4", false},
+		{"WordAsLog", ".log", "MZ started\n", true},
+		{"Unknown", ".dat", "\x1f\x8b\x08\x00", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := checkMagic(tc.ext, []byte(tc.header)); res != tc.expected {
+				t.Errorf("expected %t, got %t instead\n", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestRunReportFileSignature checks a gzip file renamed to .log and a
+// .gz that isn't gzip are reported, the files agreeing with their
+// extension are not
+func TestRunReportFileSignature(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write([]byte("a line of the log\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"app.log":     "a line of the log\n",
+		"app.log.gz":  gz.String(),
+		"renamed.log": gz.String(),
+		"fake.gz":     "not gzip",
+		"data.bin":    gz.String(),
+	})
+
+	var buffer bytes.Buffer
+	if err := NewScanner(tempDir, Config{ReportFileSignature: true}).Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "MISMATCH: " + filepath.Join(tempDir, "fake.gz") + "\n" +
+		"MISMATCH: " + filepath.Join(tempDir, "renamed.log") + "\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
@@ -0,0 +1,146 @@
+package fss
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMeta describes an archive put to a sink
+type FileMeta struct {
+	Name    string    // base name of the archived file, or of the bundle
+	Size    int64     // size of the archived file, -1 for a bundle
+	ModTime time.Time // modification time of the archived file, or creation time of the bundle
+	Mode    os.FileMode
+}
+
+// ArchiveSink is where the archives of a scan are written. relPath is the
+// slash separated path of the archive below the destination. Put is
+// called for one archive at a time, and the sink is closed at the end of
+// the run.
+type ArchiveSink interface {
+	Put(ctx context.Context, relPath string, r io.Reader, meta FileMeta) error
+	Exists(ctx context.Context, relPath string) (bool, error)
+	Close() error
+}
+
+// SinkOpener opens the sink of an archive destination URL
+type SinkOpener func(u *url.URL) (ArchiveSink, error)
+
+var (
+	sinksMu sync.Mutex
+	sinks   = map[string]SinkOpener{}
+)
+
+// RegisterSink sends the archives of the Arc destinations with the URL
+// scheme, s3 for s3://bucket/prefix, to the sinks returned by open. It
+// panics when the scheme is already registered.
+func RegisterSink(scheme string, open SinkOpener) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	if _, ok := sinks[scheme]; ok {
+		panic("fss: archive sink registered twice for " + scheme)
+	}
+	sinks[scheme] = open
+}
+
+// isSinkURL reports whether arc is the URL of a registered sink rather
+// than a directory
+func isSinkURL(arc string) bool {
+	return strings.Contains(arc, "://")
+}
+
+// openSink returns the sink of the Arc destination, the directory itself
+// unless arc is a URL
+func openSink(arc string) (ArchiveSink, error) {
+	if !isSinkURL(arc) {
+		if err := checkArchiveDir(arc); err != nil {
+			return nil, err
+		}
+		return dirSink{dir: arc}, nil
+	}
+
+	u, err := url.Parse(arc)
+	if err != nil {
+		return nil, err
+	}
+	sinksMu.Lock()
+	open, ok := sinks[u.Scheme]
+	sinksMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: %w %s", arc, ErrUnknownSink, u.Scheme)
+	}
+	return open(u)
+}
+
+// sinkDest is the archive at relPath in arc, as logged and passed to the
+// hooks
+func sinkDest(arc, relPath string) string {
+	if isSinkURL(arc) {
+		return strings.TrimSuffix(arc, "/") + "/" + relPath
+	}
+	return filepath.Join(arc, filepath.FromSlash(relPath))
+}
+
+// dirSink writes the archives to a local directory, replacing the
+// existing ones of the same name
+type dirSink struct {
+	dir string
+}
+
+func (s dirSink) Put(ctx context.Context, relPath string, r io.Reader, meta FileMeta) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(relPath))
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out, err := fsys.Create(path, false)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (s dirSink) Exists(ctx context.Context, relPath string) (bool, error) {
+	_, err := fsys.Stat(filepath.Join(s.dir, filepath.FromSlash(relPath)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s dirSink) Close() error {
+	return nil
+}
+
+// putArchive compresses the file of m with the gzip level and puts it to
+// sink at relPath
+func putArchive(ctx context.Context, sink ArchiveSink, relPath string, m match, level int) error {
+	in, err := fsys.Open(m.path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(compressTo(pw, in, m, level))
+	}()
+	meta := FileMeta{Name: m.info.Name(), Size: m.info.Size(), ModTime: m.info.ModTime(), Mode: m.info.Mode()}
+	err = sink.Put(ctx, relPath, pr, meta)
+	// Stops the compression when the sink gave up before the end
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-done
+	return err
+}
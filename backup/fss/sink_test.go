@@ -0,0 +1,239 @@
+package fss
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memSink keeps the archives put to it in memory, failing the puts of
+// the paths in fail
+type memSink struct {
+	mu     sync.Mutex
+	files  map[string][]byte
+	metas  map[string]FileMeta
+	fail   map[string]bool
+	closed bool
+}
+
+func (s *memSink) Put(ctx context.Context, relPath string, r io.Reader, meta FileMeta) error {
+	if s.fail[relPath] {
+		return fmt.Errorf("put %s: refused", relPath)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[relPath], s.metas[relPath] = data, meta
+	return nil
+}
+
+func (s *memSink) Exists(ctx context.Context, relPath string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[relPath]
+	return ok, nil
+}
+
+func (s *memSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// paths returns the sorted paths of the archives put
+func (s *memSink) paths() []string {
+	var paths []string
+	for path := range s.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// The mem://N sinks of the tests, registered once for the package
+var memSinks = struct {
+	sync.Mutex
+	sinks []*memSink
+}{}
+
+func init() {
+	RegisterSink("mem", func(u *url.URL) (ArchiveSink, error) {
+		memSinks.Lock()
+		defer memSinks.Unlock()
+		var i int
+		if _, err := fmt.Sscan(u.Host, &i); err != nil || i >= len(memSinks.sinks) {
+			return nil, fmt.Errorf("no memory sink %q", u.Host)
+		}
+		return memSinks.sinks[i], nil
+	})
+}
+
+// newMemSink returns an empty memory sink and its Arc URL
+func newMemSink(fail ...string) (*memSink, string) {
+	s := &memSink{files: map[string][]byte{}, metas: map[string]FileMeta{}, fail: map[string]bool{}}
+	for _, path := range fail {
+		s.fail[path] = true
+	}
+	memSinks.Lock()
+	defer memSinks.Unlock()
+	memSinks.sinks = append(memSinks.sinks, s)
+	return s, fmt.Sprintf("mem://%d", len(memSinks.sinks)-1)
+}
+
+// TestRunArchiveSink checks the archives go to the sink of an Arc URL,
+// and the hooks get their place in it
+func TestRunArchiveSink(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cfg      Config
+		expPaths []string
+	}{
+		{"Gzip", Config{}, []string{"a.log.gz", "sub/b.log.gz"}},
+		{"Bundle", Config{MaxArchiveFiles: 10}, []string{"archive.001.zip"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			writeFiles(t, tempDir, map[string]string{"a.log": "dummy", "sub/b.log": "dummy"})
+			sink, arc := newMemSink()
+
+			var dests []string
+			cfg := tc.cfg
+			cfg.Ext, cfg.Arc = ".log", arc
+			cfg.OnAction = func(action, path, dest string, err error) {
+				if err != nil {
+					t.Errorf("unexpected error %v for %s\n", err, path)
+				}
+				if action == "archive" {
+					dests = append(dests, dest)
+				}
+			}
+			if err := NewScanner(tempDir, cfg).Run(nil); err != nil {
+				t.Fatal(err)
+			}
+			if !sink.closed {
+				t.Error("expected the sink closed at the end of the run")
+			}
+			if strings.Join(tc.expPaths, " ") != strings.Join(sink.paths(), " ") {
+				t.Fatalf("expected %q, got %q instead\n", tc.expPaths, sink.paths())
+			}
+
+			members := map[string]string{}
+			if tc.cfg.MaxArchiveFiles == 0 {
+				for path, data := range sink.files {
+					zr, err := gzip.NewReader(bytes.NewReader(data))
+					if err != nil {
+						t.Fatal(err)
+					}
+					content, err := io.ReadAll(zr)
+					if err != nil {
+						t.Fatal(err)
+					}
+					members[strings.TrimSuffix(path, ".gz")] = string(content)
+					if meta := sink.metas[path]; meta.Size != 5 || meta.Name != zr.Name {
+						t.Errorf("unexpected meta %+v for %s\n", meta, path)
+					}
+				}
+			} else {
+				data := sink.files["archive.001.zip"]
+				zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, f := range zr.File {
+					r, err := f.Open()
+					if err != nil {
+						t.Fatal(err)
+					}
+					content, err := io.ReadAll(r)
+					r.Close()
+					if err != nil {
+						t.Fatal(err)
+					}
+					members[f.Name] = string(content)
+				}
+			}
+			expMembers := map[string]string{"a.log": "dummy", "sub/b.log": "dummy"}
+			if fmt.Sprint(expMembers) != fmt.Sprint(members) {
+				t.Errorf("expected %v, got %v instead\n", expMembers, members)
+			}
+
+			expDests := make([]string, 0, 2)
+			for _, path := range []string{"a.log", "sub/b.log"} {
+				if tc.cfg.MaxArchiveFiles == 0 {
+					expDests = append(expDests, arc+"/"+path+".gz")
+				} else {
+					expDests = append(expDests, arc+"/archive.001.zip")
+				}
+			}
+			if strings.Join(expDests, " ") != strings.Join(dests, " ") {
+				t.Errorf("expected %q, got %q instead\n", expDests, dests)
+			}
+		})
+	}
+}
+
+// TestRunArchiveSinkFailure checks a file the sink refuses isn't deleted
+func TestRunArchiveSinkFailure(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{"a.log": "dummy", "b.log": "dummy"})
+	sink, arc := newMemSink("b.log.gz")
+
+	var logBuffer bytes.Buffer
+	cfg := Config{Arc: arc, Del: true, LogWriter: &logBuffer}
+	if err := NewScanner(tempDir, cfg).Run(&bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Fatalf("expected the put refused, got %v instead\n", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "b.log")); err != nil {
+		t.Errorf("expected b.log kept, got %v instead\n", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "a.log")); !os.IsNotExist(err) {
+		t.Errorf("expected a.log deleted, got %v instead\n", err)
+	}
+	if exp := []string{"a.log.gz"}; strings.Join(exp, " ") != strings.Join(sink.paths(), " ") {
+		t.Errorf("expected %q, got %q instead\n", exp, sink.paths())
+	}
+}
+
+func TestOpenSink(t *testing.T) {
+	tempDir := t.TempDir()
+	if _, err := openSink("nope://bucket/prefix"); !errors.Is(err, ErrUnknownSink) {
+		t.Errorf("expected error %q, got %v instead\n", ErrUnknownSink, err)
+	}
+	if _, err := openSink(filepath.Join(tempDir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("expected a missing directory, got %v instead\n", err)
+	}
+
+	sink, err := openSink(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	ctx := context.Background()
+	if err := sink.Put(ctx, "sub/a.gz", strings.NewReader("data"), FileMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(tempDir, "sub", "a.gz"))
+	if err != nil || string(data) != "data" {
+		t.Errorf("expected %q, got %q instead: %v\n", "data", data, err)
+	}
+	for path, exp := range map[string]bool{"sub/a.gz": true, "sub/b.gz": false} {
+		if ok, err := sink.Exists(ctx, path); err != nil || ok != exp {
+			t.Errorf("expected %s to exist %t, got %t instead: %v\n", path, exp, ok, err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package fss
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotMagic starts every snapshot, followed by one record per entry
+// of the tree in walk order, the root first. The records are the ones
+// the sorted listings spill to disk.
+const snapshotMagic = "fss snapshot 1\n"
+
+// Snapshot walks the tree under Root and writes every entry to w with its
+// size, modification time and mode, so it can be queried later without
+// walking it again by a Scanner with Config.FromSnapshot. The excluded
+// and ignored paths are left out, the other filters don't apply.
+func (s *Scanner) Snapshot(w io.Writer) error {
+	cfg := s.Config
+	p := newPacer(cfg.Pace)
+	ig, err := newIgnores(s.Root, cfg)
+	if err != nil {
+		return err
+	}
+	skip := func(path string, err error) error {
+		if err != nil && cfg.OnError != nil && cfg.OnError(path, err) {
+			return nil
+		}
+		return err
+	}
+	prune := func(path string, d fs.DirEntry) (bool, error) {
+		if ig == nil {
+			return false, nil
+		}
+		ignored, err := ig.ignored(path, d.IsDir())
+		if err != nil {
+			return true, skip(path, err)
+		}
+		return ignored, nil
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	err = walkTree(s.Root, WalkPre, prune, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return skip(path, err)
+		}
+		p.wait()
+		info, err := d.Info()
+		if err != nil {
+			return skip(path, err)
+		}
+		return writeRecord(bw, newRecord(path, info))
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// checkSnapshot rejects the options that can't be answered from the
+// recorded sizes, times and modes: the actions, which have to run on the
+// live tree, and the filters and reports reading the files or needing
+// more of their stats
+func checkSnapshot(cfg Config) error {
+	for _, o := range []struct {
+		set  bool
+		flag string
+	}{
+		{cfg.Del, "-del"},
+		{cfg.Arc != "", "-arc"},
+		{cfg.HardlinkDups, "-hardlink-dups"},
+		{cfg.ReplaceOld != "", "-replace-old"},
+		{cfg.Exec != "", "-exec"},
+		{cfg.ExecOnMatchDir != "", "-exec-on-match-dir"},
+		{cfg.AppendSuffix != "", "-append-suffix"},
+		{cfg.StripSuffix != "", "-strip-suffix"},
+		{cfg.Checksum, "-checksum"},
+		{cfg.ReportContentType, "-report-content-type"},
+		{cfg.ReportFSType, "-report-fs-type"},
+		{cfg.ReportGitStatus, "-report-git-status"},
+		{cfg.ReportJSONValidity, "-report-json-validity"},
+		{cfg.WC, "-wc"},
+		{cfg.ReportYAMLValidity, "-report-yaml-validity"},
+		{cfg.ReportTOMLValidity, "-report-toml-validity"},
+		{cfg.ReportCSVValidity, "-report-csv-validity"},
+		{cfg.ReportINIValidity, "-report-ini-validity"},
+		{cfg.ReportLineCount, "-report-line-count"},
+		{cfg.ReportWordCount, "-report-word-count"},
+		{cfg.ReportFirstLine, "-report-first-line"},
+		{cfg.ReportPkgType, "-report-pkg-type"},
+		{cfg.ReportFileSignature, "-report-file-signature"},
+		{cfg.ReportShebang, "-report-shebang"},
+		{cfg.ReportNullBytes, "-report-null-bytes"},
+		{cfg.ReportFileEncoding, "-report-file-encoding"},
+		{cfg.RequireEncoding != "", "-require-encoding"},
+		{cfg.MinEntropy > 0, "-min-entropy"},
+		{cfg.MaxEntropy > 0, "-max-entropy"},
+		{cfg.ReportEntropy, "-report-entropy"},
+		{cfg.ReportZipContents, "-report-zip-contents"},
+		{cfg.ReportTarContents, "-report-tar-contents"},
+		{cfg.ReportZip64, "-report-zip64"},
+		{cfg.ReportPartialGzip, "-report-partial-gzip"},
+		{cfg.GoBuildTag != "", "-go-build-tag"},
+		{cfg.ScanArchives, "-scan-archives"},
+		{cfg.CNewer > 0, "-cnewer"},
+		{cfg.COlder > 0, "-colder"},
+		{cfg.ReportByOwner, "-by-owner"},
+		{cfg.ReportHardlinkTrees, "-report-hardlink-trees"},
+		{cfg.ReportDuplicateInodes, "-report-duplicate-inodes"},
+		{cfg.ResolveSymlinks, "-resolve-symlinks-in-output"},
+		{cfg.WalkOrder != "" && cfg.WalkOrder != WalkPre, "-walk-order " + cfg.WalkOrder},
+	} {
+		if o.set {
+			return fmt.Errorf("%s %w", o.flag, ErrSnapshot)
+		}
+	}
+	return nil
+}
+
+// snapshotReader replays the entries of a snapshot file
+type snapshotReader struct {
+	path string
+	f    *os.File
+	r    *bufio.Reader
+	root record
+}
+
+// openSnapshot opens the snapshot at path and reads its root
+func openSnapshot(path string) (*snapshotReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshotReader{path: path, f: f, r: bufio.NewReader(f)}
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(s.r, magic); err != nil || string(magic) != snapshotMagic {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, ErrInvalidSnapshot)
+	}
+	if s.root, err = readRecord(s.r); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w: %v", path, ErrInvalidSnapshot, err)
+	}
+	return s, nil
+}
+
+func (s *snapshotReader) Close() error {
+	return s.f.Close()
+}
+
+// walk calls fn for each entry of the snapshot, in the pre-order of the
+// walk that recorded it, with the same pruning and filepath.SkipDir
+// semantics as walkTree
+func (s *snapshotReader) walk(prune pruneFunc, fn fs.WalkDirFunc) error {
+	// Entries under skipped are left out, the walk being in pre-order
+	// they all come right after it
+	skipped := ""
+	r := s.root
+	for {
+		if skipped == "" || !inside(r.path, skipped) {
+			skipped = ""
+			d := snapshotEntry{r}
+			pruned, err := prune(r.path, d)
+			if err != nil {
+				return err
+			}
+			if pruned {
+				skipped = r.path
+			} else if err := fn(r.path, d, nil); err == filepath.SkipDir {
+				skipped = r.path
+				if !d.IsDir() {
+					skipped = filepath.Dir(r.path)
+				}
+				if r.path == s.root.path || skipped == s.root.path {
+					return nil
+				}
+			} else if err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if r, err = readRecord(s.r); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w: %v", s.path, ErrInvalidSnapshot, err)
+		}
+	}
+}
+
+// snapshotEntry is the fs.DirEntry of a recorded entry
+type snapshotEntry struct {
+	r record
+}
+
+func (e snapshotEntry) Name() string               { return filepath.Base(e.r.path) }
+func (e snapshotEntry) IsDir() bool                { return e.Type().IsDir() }
+func (e snapshotEntry) Type() fs.FileMode          { return fs.FileMode(e.r.mode).Type() }
+func (e snapshotEntry) Info() (fs.FileInfo, error) { return snapshotInfo{e.r}, nil }
+
+// snapshotInfo is the os.FileInfo of a recorded entry, with no Sys
+type snapshotInfo struct {
+	r record
+}
+
+func (i snapshotInfo) Name() string       { return filepath.Base(i.r.path) }
+func (i snapshotInfo) Size() int64        { return i.r.size }
+func (i snapshotInfo) Mode() os.FileMode  { return os.FileMode(i.r.mode) }
+func (i snapshotInfo) ModTime() time.Time { return time.Unix(0, i.r.mtime) }
+func (i snapshotInfo) IsDir() bool        { return i.Mode().IsDir() }
+func (i snapshotInfo) Sys() interface{}   { return nil }
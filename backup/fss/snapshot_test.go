@@ -0,0 +1,158 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRunFromSnapshot checks a query of a snapshot matches the scan of
+// the tree it recorded, once the tree is gone
+func TestRunFromSnapshot(t *testing.T) {
+	tempDir := testsupport.Tree(t, map[string]testsupport.Spec{
+		"app.log":          {Size: 300, MTime: -48 * time.Hour},
+		"a/old.log":        {Size: 100, MTime: -72 * time.Hour},
+		"a/b/new.log":      {Size: 200},
+		"a/b/.fssignore":   {Content: "*.tmp\n"},
+		"a/b/scratch.tmp":  {Size: 10},
+		"a/notes.txt":      {Size: 10},
+		"skip/ignored.log": {Size: 10},
+	})
+
+	testCases := []struct {
+		name string
+		cfg  Config
+	}{
+		{"List", Config{List: true}},
+		{"Ext", Config{List: true, Ext: ".log"}},
+		{"Size", Config{List: true, Size: 150}},
+		{"SortSize", Config{List: true, Sort: "size"}},
+		{"Exclude", Config{List: true, Exclude: []string{"b/"}}},
+		{"Totals", Config{List: true, Ext: ".log", ReportTotals: true}},
+		{"FileAge", Config{List: true, Ext: ".log", ReportFileAge: true}},
+		{"Reports", Config{List: true, ReportLargestDirN: 2, BigDirs: 1, ReportDuplicateNames: true}},
+		{"GroupByExt", Config{List: true, GroupByExt: true}},
+	}
+
+	// The .fssignore files and the snapshot excludes are applied when
+	// the snapshot is written
+	opts := []Config{}
+	for _, tc := range testCases {
+		cfg := tc.cfg
+		cfg.Exclude = append([]string{"skip/"}, cfg.Exclude...)
+		opts = append(opts, cfg)
+	}
+	expected := make([]string, len(testCases))
+	for i, cfg := range opts {
+		var buffer bytes.Buffer
+		if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		expected[i] = buffer.String()
+	}
+
+	snapFile := filepath.Join(t.TempDir(), "scan.fss")
+	f, err := os.Create(snapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewScanner(tempDir, Config{Exclude: []string{"skip/"}}).Snapshot(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(tempDir); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			cfg := tc.cfg
+			cfg.FromSnapshot = true
+			if err := NewScanner(snapFile, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if expected[i] != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", expected[i], buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunFromSnapshotRefused checks the actions and the reports reading
+// the files are refused on a snapshot
+func TestRunFromSnapshotRefused(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{"a.log": "dummy"}))
+	var snapshot bytes.Buffer
+	if err := NewScanner(tempDir, Config{}).Snapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	snapFile := filepath.Join(t.TempDir(), "scan.fss")
+	if err := os.WriteFile(snapFile, snapshot.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		cfg  Config
+	}{
+		{"Delete", Config{Del: true, LogWriter: &bytes.Buffer{}}},
+		{"Archive", Config{Arc: t.TempDir()}},
+		{"Exec", Config{Exec: "gzip -t"}},
+		{"Replace", Config{ReplaceOld: "a", ReplaceNew: "b"}},
+		{"Checksum", Config{List: true, Checksum: true}},
+		{"LineCount", Config{List: true, ReportLineCount: true}},
+		{"ByOwner", Config{List: true, ReportByOwner: true}},
+		{"PostOrder", Config{List: true, WalkOrder: WalkPost}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.FromSnapshot = true
+			err := NewScanner(snapFile, tc.cfg).Run(&bytes.Buffer{})
+			if !errors.Is(err, ErrSnapshot) {
+				t.Errorf("expected error %q, got %v instead\n", ErrSnapshot, err)
+			}
+		})
+	}
+
+	if _, err := NewScanner(snapFile, Config{FromSnapshot: true}).Collect(); !errors.Is(err, ErrSnapshot) {
+		t.Errorf("expected error %q, got %v instead\n", ErrSnapshot, err)
+	}
+}
+
+func TestRunFromSnapshotInvalid(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{"a.log": "dummy"}))
+	var snapshot bytes.Buffer
+	if err := NewScanner(tempDir, Config{}).Snapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		content []byte
+	}{
+		{"NotSnapshot", []byte("a.log\n")},
+		{"Empty", nil},
+		{"Truncated", snapshot.Bytes()[:snapshot.Len()-2]},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snapFile := filepath.Join(t.TempDir(), "scan.fss")
+			if err := os.WriteFile(snapFile, tc.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := NewScanner(snapFile, Config{List: true, FromSnapshot: true}).Run(&bytes.Buffer{})
+			if !errors.Is(err, ErrInvalidSnapshot) {
+				t.Errorf("expected error %q, got %v instead\n", ErrInvalidSnapshot, err)
+			}
+		})
+	}
+}
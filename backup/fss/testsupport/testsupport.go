@@ -0,0 +1,126 @@
+// Package testsupport builds directory trees for the tests of the fss
+// package and of programs embedding it. A tree is declared as a map of
+// slash separated relative paths to the Spec of each entry:
+//
+//	root := testsupport.Tree(t, map[string]testsupport.Spec{
+//		"logs/app.log":     {Content: "started", MTime: -48 * time.Hour},
+//		"logs/big.bin":     {Size: 1 << 20},
+//		"logs/current.log": {Symlink: "app.log"},
+//		"empty":            {Dir: true},
+//	})
+//
+// Parent directories are created as needed. The tree is removed with the
+// temporary directory of the test.
+package testsupport
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Spec describes an entry of a tree. The zero Spec is an empty file.
+type Spec struct {
+	Content string        // content of the file
+	Size    int64         // size of the file filled with 'x', when there's no Content
+	MTime   time.Duration // modification time relative to now, 0 to leave it
+	Mode    os.FileMode   // permission bits, 0644 for files and 0755 for directories if 0
+	Symlink string        // make a symbolic link to this target instead of a file
+	Dir     bool          // make a directory instead of a file
+}
+
+// Tree builds the entries in a new temporary directory of t and returns
+// its path
+func Tree(t testing.TB, entries map[string]Spec) string {
+	t.Helper()
+	root := t.TempDir()
+	Build(t, root, entries)
+	return root
+}
+
+// Build creates the entries under the existing directory root. The
+// modification times and modes are set once every entry is created, the
+// deepest paths first, so they aren't changed by the entries created
+// after them.
+func Build(t testing.TB, root string, entries map[string]Spec) {
+	t.Helper()
+	paths := make([]string, 0, len(entries))
+	for p := range entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		if err := create(filepath.Join(root, filepath.FromSlash(p)), entries[p]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	for i := len(paths) - 1; i >= 0; i-- {
+		spec, path := entries[paths[i]], filepath.Join(root, filepath.FromSlash(paths[i]))
+		if spec.Symlink != "" {
+			continue
+		}
+		mode := spec.Mode
+		if mode == 0 {
+			mode = 0644
+			if spec.Dir {
+				mode = 0755
+			}
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		if spec.MTime != 0 {
+			mtime := now.Add(spec.MTime)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// create makes the entry of spec at path
+func create(path string, spec Spec) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	switch {
+	case spec.Dir:
+		return os.MkdirAll(path, 0755)
+	case spec.Symlink != "":
+		return os.Symlink(spec.Symlink, path)
+	}
+
+	data := []byte(spec.Content)
+	if spec.Content == "" && spec.Size > 0 {
+		data = bytes.Repeat([]byte("x"), int(spec.Size))
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Files returns the specs of files with the given contents, keyed by path
+func Files(contents map[string]string) map[string]Spec {
+	entries := make(map[string]Spec, len(contents))
+	for p, content := range contents {
+		entries[p] = Spec{Content: content}
+	}
+	return entries
+}
+
+// Numbered returns the specs of counts[ext] files per extension, named
+// file1.ext, file2.ext and so on, each one holding content
+func Numbered(counts map[string]int, content string) map[string]Spec {
+	entries := map[string]Spec{}
+	for ext, n := range counts {
+		for i := 1; i <= n; i++ {
+			entries[fmt.Sprintf("file%d%s", i, ext)] = Spec{Content: content}
+		}
+	}
+	return entries
+}
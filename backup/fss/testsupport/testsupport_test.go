@@ -0,0 +1,70 @@
+package testsupport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTree(t *testing.T) {
+	root := Tree(t, map[string]Spec{
+		"logs/app.log":     {Content: "started", MTime: -48 * time.Hour},
+		"logs/big.bin":     {Size: 1024},
+		"logs/current.log": {Symlink: "app.log"},
+		"bin/run.sh":       {Content: "#!/bin/sh", Mode: 0755},
+		"empty":            {Dir: true},
+	})
+
+	testCases := []struct {
+		path     string
+		mode     os.FileMode
+		size     int64
+		oldMTime bool
+	}{
+		{"logs/app.log", 0644, 7, true},
+		{"logs/big.bin", 0644, 1024, false},
+		{"logs/current.log", os.ModeSymlink, -1, false},
+		{"bin/run.sh", 0755, 9, false},
+		{"empty", os.ModeDir | 0755, -1, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			info, err := os.Lstat(filepath.Join(root, filepath.FromSlash(tc.path)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			mode := info.Mode()
+			if mode&os.ModeSymlink != 0 {
+				mode = os.ModeSymlink
+			}
+			if mode != tc.mode {
+				t.Errorf("expected mode %v, got %v instead\n", tc.mode, mode)
+			}
+			if tc.size >= 0 && info.Size() != tc.size {
+				t.Errorf("expected size %d, got %d instead\n", tc.size, info.Size())
+			}
+			if old := time.Since(info.ModTime()) > 47*time.Hour; old != tc.oldMTime {
+				t.Errorf("expected an old mtime %t, got %v instead\n", tc.oldMTime, info.ModTime())
+			}
+		})
+	}
+
+	target, err := os.Readlink(filepath.Join(root, "logs", "current.log"))
+	if err != nil || target != "app.log" {
+		t.Errorf("expected a link to app.log, got %q %v instead\n", target, err)
+	}
+}
+
+func TestNumbered(t *testing.T) {
+	entries := Numbered(map[string]int{".log": 2, ".gz": 1}, "dummy")
+	for _, name := range []string{"file1.log", "file2.log", "file1.gz"} {
+		if entries[name].Content != "dummy" {
+			t.Errorf("expected %s with content, got %v instead\n", name, entries)
+		}
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected 3 entries, got %d instead\n", len(entries))
+	}
+}
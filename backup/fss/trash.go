@@ -0,0 +1,86 @@
+package fss
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// trashDir returns the home trash directory of the freedesktop.org Trash
+// specification, $XDG_DATA_HOME/Trash or ~/.local/share/Trash
+func trashDir() (string, error) {
+	if data := os.Getenv("XDG_DATA_HOME"); data != "" {
+		return filepath.Join(data, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// trashFile moves the file at path to the files directory of the trash,
+// with a .trashinfo file in the info directory holding its original path
+// and deletion date. A name already in the trash gets a number suffix.
+// A trash on another filesystem gets a verified copy of the file, with
+// pending called before the file is removed, see moveFile.
+func trashFile(path string, pending func(src, dst string)) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	dir, err := trashDir()
+	if err != nil {
+		return err
+	}
+	filesDir, infoDir := filepath.Join(dir, "files"), filepath.Join(dir, "info")
+	for _, d := range []string{filesDir, infoDir} {
+		if err := fsys.MkdirAll(d, 0700); err != nil {
+			return err
+		}
+	}
+
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: abs}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+
+	// The info file is created first and exclusively, it reserves the name
+	base := filepath.Base(abs)
+	ext := filepath.Ext(base)
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), n, ext)
+		}
+		infoPath := filepath.Join(infoDir, name+".trashinfo")
+		f, err := fsys.Create(infoPath, true)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// A file left in the trash without its info is never overwritten
+		if _, err := fsys.Lstat(filepath.Join(filesDir, name)); err == nil {
+			f.Close()
+			fsys.Remove(infoPath)
+			continue
+		}
+		_, err = io.WriteString(f, info)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			_, err = moveFile(abs, filepath.Join(filesDir, name), pending)
+		}
+		// The info of a copy left next to the file is kept with it
+		if _, serr := fsys.Lstat(filepath.Join(filesDir, name)); err != nil && serr != nil {
+			fsys.Remove(infoPath)
+		}
+		return err
+	}
+}
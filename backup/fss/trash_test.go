@@ -0,0 +1,179 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTrashFile(t *testing.T) {
+	trash := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", trash)
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{"old report.log": "dummy"})
+	path := filepath.Join(tempDir, "old report.log")
+
+	// The second file of the same name gets a number suffix
+	for i, name := range []string{"old report.log", "old report.2.log"} {
+		if i > 0 {
+			writeFiles(t, tempDir, map[string]string{"old report.log": "dummy"})
+		}
+		if err := trashFile(path, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be moved, got %v instead\n", path, err)
+		}
+		if _, err := os.Stat(filepath.Join(trash, "Trash", "files", name)); err != nil {
+			t.Errorf("expected %s in the trash, got %v instead\n", name, err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(trash, "Trash", "info", name+".trashinfo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(string(data), "\n")
+		if len(lines) != 4 || lines[0] != "[Trash Info]" || lines[3] != "" {
+			t.Fatalf("expected a [Trash Info] group, got %q instead\n", string(data))
+		}
+		expected := "Path=" + (&url.URL{Path: path}).EscapedPath()
+		if lines[1] != expected || !strings.Contains(lines[1], "old%20report.log") {
+			t.Errorf("expected %q, got %q instead\n", expected, lines[1])
+		}
+		date, err := time.ParseInLocation("2006-01-02T15:04:05", strings.TrimPrefix(lines[2], "DeletionDate="), time.Local)
+		if err != nil || time.Since(date) > time.Minute {
+			t.Errorf("expected the deletion date, got %q instead\n", lines[2])
+		}
+	}
+}
+
+// TestRunXDGTrash
+func TestRunXDGTrash(t *testing.T) {
+	trash := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", trash)
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{"a.log": "dummy", "b.txt": "dummy"})
+
+	var logBuffer bytes.Buffer
+	cfg := Config{Ext: ".log", Del: true, XDGTrash: true, LogWriter: &logBuffer}
+	if err := NewScanner(tempDir, cfg).Run(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(trash, "Trash", "files", "a.log")); err != nil {
+		t.Errorf("expected a.log in the trash, got %v instead\n", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "b.txt")); err != nil {
+		t.Errorf("expected b.txt to stay, got %v instead\n", err)
+	}
+	if log := logBuffer.String(); !strings.HasPrefix(log, "TRASHED FILE: ") ||
+		!strings.HasSuffix(log, filepath.Join(tempDir, "a.log")+"\n") {
+		t.Errorf("expected the trash in the log, got %q instead\n", logBuffer.String())
+	}
+}
+
+// TestRunXDGTrashCrossDevice checks the files are copied, checked and
+// removed when the trash is on another filesystem
+func TestRunXDGTrashCrossDevice(t *testing.T) {
+	testCases := []struct {
+		name      string
+		renameErr error
+		workers   int
+		expErr    error
+	}{
+		{name: "Serial", renameErr: syscall.EXDEV},
+		{name: "Workers", renameErr: syscall.EXDEV, workers: 4},
+		{name: "OtherError", renameErr: syscall.EACCES, expErr: syscall.EACCES},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFaultFS(osFS{})
+			// Only the files moved into the trash cross devices, not their
+			// copies renamed inside it
+			f.fail("rename", ".log", tc.renameErr)
+			useFS(t, f)
+			trash := t.TempDir()
+			t.Setenv("XDG_DATA_HOME", trash)
+			mtime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+			tempDir := testsupport.Tree(t, testsupport.Files(map[string]string{"a.log": "first", "b.log": "second"}))
+			for _, name := range []string{"a.log", "b.log"} {
+				path := filepath.Join(tempDir, name)
+				if err := os.Chmod(path, 0640); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var logBuffer bytes.Buffer
+			cfg := Config{Ext: ".log", Del: true, XDGTrash: true, LogWriter: &logBuffer, DeleteWorkers: tc.workers}
+			err := NewScanner(tempDir, cfg).Run(&bytes.Buffer{})
+			filesDir := filepath.Join(trash, "Trash", "files")
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Fatalf("expected error %q, got %v instead\n", tc.expErr, err)
+				}
+				if _, err := os.Stat(filepath.Join(tempDir, "a.log")); err != nil {
+					t.Errorf("expected a.log to stay, got %v instead\n", err)
+				}
+				if entries, _ := os.ReadDir(filepath.Join(trash, "Trash", "info")); len(entries) != 0 {
+					t.Errorf("expected no trash info left, got %d files instead\n", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, content := range map[string]string{"a.log": "first", "b.log": "second"} {
+				if _, err := os.Stat(filepath.Join(tempDir, name)); !os.IsNotExist(err) {
+					t.Errorf("expected %s to be removed, got %v instead\n", name, err)
+				}
+				dst := filepath.Join(filesDir, name)
+				data, err := os.ReadFile(dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != content {
+					t.Errorf("expected %q, got %q instead\n", content, string(data))
+				}
+				info, err := os.Stat(dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+					t.Errorf("expected mode 0640 and mtime %s, got %s and %s instead\n", mtime, info.Mode().Perm(), info.ModTime())
+				}
+			}
+			if entries, _ := os.ReadDir(filesDir); len(entries) != 2 {
+				t.Errorf("expected only the 2 copies in the trash, got %d files instead\n", len(entries))
+			}
+
+			// Each copy is logged as a pending delete before the file is
+			// removed, in walk order with the delete workers too
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSpace(logBuffer.String()), "\n") {
+				fields := strings.Fields(line)
+				lines = append(lines, fields[0]+" "+strings.Join(fields[4:], " "))
+			}
+			expected := []string{
+				"PENDING " + filepath.Join(tempDir, "a.log") + " -> " + filepath.Join(filesDir, "a.log") + " (copied across filesystems)",
+				"TRASHED " + filepath.Join(tempDir, "a.log"),
+				"PENDING " + filepath.Join(tempDir, "b.log") + " -> " + filepath.Join(filesDir, "b.log") + " (copied across filesystems)",
+				"TRASHED " + filepath.Join(tempDir, "b.log"),
+			}
+			if !reflect.DeepEqual(expected, lines) {
+				t.Errorf("expected %q, got %q instead\n", expected, lines)
+			}
+		})
+	}
+}
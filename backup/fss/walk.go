@@ -0,0 +1,179 @@
+package fss
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// The orders of Config.WalkOrder. The entries of a directory are always
+// visited sorted by name.
+const (
+	WalkPre     = "pre"     // a directory before its entries, the default
+	WalkPost    = "post"    // a directory after its entries
+	WalkBreadth = "breadth" // every entry of a level before the next level
+)
+
+// checkWalkOrder rejects the unknown walk orders
+func checkWalkOrder(order string) error {
+	switch order {
+	case "", WalkPre, WalkPost, WalkBreadth:
+		return nil
+	}
+	return fmt.Errorf("%w %q: use pre, post or breadth", ErrInvalidWalkOrder, order)
+}
+
+// pruneFunc reports whether the entry at path is left out of a walk. A
+// pruned directory isn't read.
+type pruneFunc func(path string, d fs.DirEntry) (bool, error)
+
+// keepAll is the pruneFunc of the walks that visit every entry
+func keepAll(string, fs.DirEntry) (bool, error) { return false, nil }
+
+// walkTree walks the tree of fsys under root in order, calling fn for
+// each entry like filepath.WalkDir does. prune is called first for each
+// entry, so directories are left out the same way in every order. As with
+// filepath.WalkDir, fn returning filepath.SkipDir skips a directory, or
+// the remaining entries of the directory of a file; in post-order the
+// entries of a directory are visited by then.
+func walkTree(root, order string, prune pruneFunc, fn fs.WalkDirFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		d := fs.FileInfoToDirEntry(info)
+		switch order {
+		case WalkPost:
+			err = walkPost(root, d, prune, fn)
+		case WalkBreadth:
+			err = walkBreadth(root, d, prune, fn)
+		default:
+			err = walkPre(root, d, prune, fn)
+		}
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkPre visits the directory d at path, and then its entries, the order
+// of filepath.WalkDir. A directory that can't be read is passed to fn a
+// second time with the error.
+func walkPre(path string, d fs.DirEntry, prune pruneFunc, fn fs.WalkDirFunc) error {
+	pruned, err := prune(path, d)
+	if err != nil || pruned {
+		return err
+	}
+
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := fsys.ReadDir(path)
+	if err != nil {
+		if err := fn(path, d, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, e := range entries {
+		if err := walkPre(filepath.Join(path, e.Name()), e, prune, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// walkPost visits the entries of the directory d at path, and then d
+func walkPost(path string, d fs.DirEntry, prune pruneFunc, fn fs.WalkDirFunc) error {
+	pruned, err := prune(path, d)
+	if err != nil || pruned {
+		return err
+	}
+
+	if d.IsDir() {
+		entries, err := fsys.ReadDir(path)
+		if err != nil {
+			if err := fn(path, d, err); err != nil {
+				return err
+			}
+		}
+		for _, e := range entries {
+			err := walkPost(filepath.Join(path, e.Name()), e, prune, fn)
+			if err == filepath.SkipDir {
+				if e.IsDir() {
+					continue
+				}
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return fn(path, d, nil)
+}
+
+// walkBreadth visits the tree under the directory d at root level by level
+func walkBreadth(root string, d fs.DirEntry, prune pruneFunc, fn fs.WalkDirFunc) error {
+	type dirEntry struct {
+		path string
+		d    fs.DirEntry
+	}
+
+	pruned, err := prune(root, d)
+	if err != nil || pruned {
+		return err
+	}
+	if err := fn(root, d, nil); err != nil || !d.IsDir() {
+		return err
+	}
+
+	queue := []dirEntry{{root, d}}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+
+		entries, err := fsys.ReadDir(dir.path)
+		if err != nil {
+			if err := fn(dir.path, dir.d, err); err == filepath.SkipDir {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		for _, e := range entries {
+			path := filepath.Join(dir.path, e.Name())
+			pruned, err := prune(path, e)
+			if err != nil {
+				return err
+			}
+			if pruned {
+				continue
+			}
+
+			err = fn(path, e, nil)
+			if err == filepath.SkipDir {
+				if e.IsDir() {
+					continue
+				}
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if e.IsDir() {
+				queue = append(queue, dirEntry{path, e})
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// walkFixture is a nested tree with files and directories at every level
+var walkFixture = testsupport.Files(map[string]string{
+	"a.log":       "dummy",
+	"b/c.log":     "dummy",
+	"b/d/e.log":   "dummy",
+	"b/f.log":     "dummy",
+	"g/h/i/j.log": "dummy",
+	"k.log":       "dummy",
+})
+
+func TestWalkTree(t *testing.T) {
+	testCases := []struct {
+		name   string
+		order  string
+		prune  string
+		skip   string
+		expSeq string
+	}{
+		{name: "Default", expSeq: ". a.log b b/c.log b/d b/d/e.log b/f.log g g/h g/h/i g/h/i/j.log k.log"},
+		{name: "Pre", order: WalkPre,
+			expSeq: ". a.log b b/c.log b/d b/d/e.log b/f.log g g/h g/h/i g/h/i/j.log k.log"},
+		{name: "Post", order: WalkPost,
+			expSeq: "a.log b/c.log b/d/e.log b/d b/f.log b g/h/i/j.log g/h/i g/h g k.log ."},
+		{name: "Breadth", order: WalkBreadth,
+			expSeq: ". a.log b g k.log b/c.log b/d b/f.log g/h b/d/e.log g/h/i g/h/i/j.log"},
+		{name: "PrePrune", order: WalkPre, prune: "b",
+			expSeq: ". a.log g g/h g/h/i g/h/i/j.log k.log"},
+		{name: "PostPrune", order: WalkPost, prune: "b",
+			expSeq: "a.log g/h/i/j.log g/h/i g/h g k.log ."},
+		{name: "BreadthPrune", order: WalkBreadth, prune: "b",
+			expSeq: ". a.log g k.log g/h g/h/i g/h/i/j.log"},
+		{name: "PreSkipDir", order: WalkPre, skip: "b/d",
+			expSeq: ". a.log b b/c.log b/d b/f.log g g/h g/h/i g/h/i/j.log k.log"},
+		{name: "BreadthSkipDir", order: WalkBreadth, skip: "b/d",
+			expSeq: ". a.log b g k.log b/c.log b/d b/f.log g/h g/h/i g/h/i/j.log"},
+		{name: "PreSkipFile", order: WalkPre, skip: "b/c.log",
+			expSeq: ". a.log b b/c.log g g/h g/h/i g/h/i/j.log k.log"},
+		{name: "PostSkipFile", order: WalkPost, skip: "b/c.log",
+			expSeq: "a.log b/c.log b g/h/i/j.log g/h/i g/h g k.log ."},
+		{name: "BreadthSkipFile", order: WalkBreadth, skip: "b/c.log",
+			expSeq: ". a.log b g k.log b/c.log g/h g/h/i g/h/i/j.log"},
+	}
+
+	tempDir := testsupport.Tree(t, walkFixture)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			prune := func(path string, d fs.DirEntry) (bool, error) {
+				rel, err := filepath.Rel(tempDir, path)
+				return filepath.ToSlash(rel) == tc.prune, err
+			}
+
+			var seq []string
+			err := walkTree(tempDir, tc.order, prune, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				rel, err := filepath.Rel(tempDir, path)
+				if err != nil {
+					return err
+				}
+				rel = filepath.ToSlash(rel)
+				seq = append(seq, rel)
+				if rel == tc.skip {
+					return filepath.SkipDir
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := strings.Join(seq, " "); res != tc.expSeq {
+				t.Errorf("expected %q, got %q instead\n", tc.expSeq, res)
+			}
+		})
+	}
+}
+
+// TestRunWalkOrder checks the filters and the listing follow the order of
+// the walk
+func TestRunWalkOrder(t *testing.T) {
+	testCases := []struct {
+		name    string
+		order   string
+		exclude []string
+		expList []string
+	}{
+		{"Pre", WalkPre, nil,
+			[]string{"a.log", "b/c.log", "b/d/e.log", "b/f.log", "g/h/i/j.log", "k.log"}},
+		{"Post", WalkPost, nil,
+			[]string{"a.log", "b/c.log", "b/d/e.log", "b/f.log", "g/h/i/j.log", "k.log"}},
+		{"Breadth", WalkBreadth, nil,
+			[]string{"a.log", "k.log", "b/c.log", "b/f.log", "b/d/e.log", "g/h/i/j.log"}},
+		{"BreadthExclude", WalkBreadth, []string{"d/"},
+			[]string{"a.log", "k.log", "b/c.log", "b/f.log", "g/h/i/j.log"}},
+		{"PostExclude", WalkPost, []string{"h/"},
+			[]string{"a.log", "b/c.log", "b/d/e.log", "b/f.log", "k.log"}},
+	}
+
+	tempDir := testsupport.Tree(t, walkFixture)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expOut strings.Builder
+			for _, name := range tc.expList {
+				expOut.WriteString(filepath.Join(tempDir, filepath.FromSlash(name)) + "\n")
+			}
+
+			var buffer bytes.Buffer
+			cfg := Config{Ext: ".log", List: true, WalkOrder: tc.order, Exclude: tc.exclude}
+			if err := NewScanner(tempDir, cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if buffer.String() != expOut.String() {
+				t.Errorf("expected %q, got %q instead\n", expOut.String(), buffer.String())
+			}
+
+			files, err := NewScanner(tempDir, cfg).Collect()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var collected strings.Builder
+			for _, f := range files {
+				collected.WriteString(f.Path + "\n")
+			}
+			if collected.String() != expOut.String() {
+				t.Errorf("expected %q, got %q instead\n", expOut.String(), collected.String())
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		var buffer bytes.Buffer
+		err := NewScanner(tempDir, Config{List: true, WalkOrder: "inorder"}).Run(&buffer)
+		if !errors.Is(err, ErrInvalidWalkOrder) {
+			t.Errorf("expected error %q, got %v instead\n", ErrInvalidWalkOrder, err)
+		}
+	})
+}
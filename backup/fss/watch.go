@@ -0,0 +1,243 @@
+package fss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch watches every directory under Root and applies the filters and
+// actions to files as they are created or written, until done is closed
+func (s *Scanner) Watch(out io.Writer, done <-chan struct{}) error {
+	root, cfg := s.Root, s.Config
+	if cfg.FilterCmd != "" {
+		return fmt.Errorf("-filter-cmd can't be used in watch mode")
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return w.Add(path)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// The watches are in place first so nothing is missed after the scan
+	if cfg.WatchInitialScan {
+		if err := s.run(context.Background(), out, nil); err != nil {
+			return err
+		}
+	}
+
+	return watchLoop(w.Events, w.Errors, w.Add, out, root, cfg, done)
+}
+
+// pendingEvent is the last event of a path waiting to be handled
+type pendingEvent struct {
+	op   fsnotify.Op
+	last time.Time
+}
+
+// watcher handles the batched events of watchLoop
+type watcher struct {
+	cfg     Config
+	act     *actor
+	ig      *ignores
+	add     func(string) error
+	out     io.Writer
+	pending map[string]pendingEvent
+
+	events  int
+	matched int
+}
+
+// watchLoop consumes filesystem events, batching them for the debounce
+// window before applying the filters and actions. Files are only handled
+// once they had no events for the settle duration. New directories are
+// passed to add so they are watched too. A summary is written when the
+// loop ends without error.
+func watchLoop(events <-chan fsnotify.Event, errs <-chan error, add func(string) error,
+	out io.Writer, root string, cfg Config, done <-chan struct{}) error {
+
+	// Each settled file is deleted as it is handled, there's no walk for
+	// the deletes to overlap with
+	cfg.DeleteWorkers = 0
+	act, err := newActor(context.Background(), root, cfg, newPacer(cfg.Pace))
+	if err != nil {
+		return err
+	}
+	defer act.Close()
+	ig, err := newIgnores(root, cfg)
+	if err != nil {
+		return err
+	}
+	w := &watcher{cfg: cfg, act: act, ig: ig, add: add, out: out, pending: map[string]pendingEvent{}}
+
+	// A stopped timer with a drained channel until the first event
+	timer := time.NewTimer(time.Hour)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+	reset := func(d time.Duration) {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(d)
+	}
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return w.stop()
+			}
+			if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Remove) {
+				continue
+			}
+			w.events++
+			w.pending[ev.Name] = pendingEvent{op: ev.Op, last: time.Now()}
+			if cfg.Debounce <= 0 && cfg.Settle <= 0 {
+				if _, err := w.flush(time.Now()); err != nil {
+					return err
+				}
+				continue
+			}
+			if cfg.Debounce > 0 {
+				reset(cfg.Debounce)
+			} else {
+				reset(cfg.Settle)
+			}
+		case <-timer.C:
+			next, err := w.flush(time.Now())
+			if err != nil {
+				return err
+			}
+			if next > 0 {
+				reset(next)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				return w.stop()
+			}
+			return err
+		case <-done:
+			return w.stop()
+		}
+	}
+}
+
+// stop handles the settled events and writes the summary. Files still
+// settling are left alone.
+func (w *watcher) stop() error {
+	if _, err := w.flush(time.Now()); err != nil {
+		return err
+	}
+	if err := w.act.Close(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w.out, "Watch summary: %d events, %d matched files, %d unsettled\n",
+		w.events, w.matched, len(w.pending))
+	return err
+}
+
+// flush handles the settled events in path order. It returns how long
+// until the next pending file settles, 0 when none is left.
+func (w *watcher) flush(now time.Time) (time.Duration, error) {
+	paths := make([]string, 0, len(w.pending))
+	for path := range w.pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var next time.Duration
+	for _, path := range paths {
+		ev := w.pending[path]
+		if wait := w.cfg.Settle - now.Sub(ev.last); wait > 0 {
+			if next == 0 || wait < next {
+				next = wait
+			}
+			continue
+		}
+		delete(w.pending, path)
+
+		if err := w.handle(path, ev.op); err != nil {
+			if w.cfg.OnError == nil || !w.cfg.OnError(path, err) {
+				return 0, err
+			}
+		}
+	}
+	return next, nil
+}
+
+// handle applies the filters and actions to the file of an event
+func (w *watcher) handle(path string, op fsnotify.Op) error {
+	if op.Has(fsnotify.Remove) {
+		_, err := fmt.Fprintf(w.out, "REMOVED: %s\n", path)
+		return err
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		// Gone again before the batch was handled
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if w.ig != nil {
+		ignored, err := w.ig.ignoredTree(path, info.IsDir())
+		if err != nil || ignored {
+			return err
+		}
+	}
+	if info.IsDir() {
+		return w.add(path)
+	}
+
+	if filterOut(path, w.cfg.Ext, w.cfg.Size, w.cfg.MaxFileSize, info) ||
+		w.cfg.ExcludeSymlinks && info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if changed, err := ctimeOut(w.cfg, info, time.Now()); err != nil || changed {
+		return err
+	}
+	if w.cfg.OnMatch != nil && !w.cfg.OnMatch(path, info) {
+		return nil
+	}
+	w.matched++
+	if keep, err := w.act.apply(match{path: path, info: info}); err != nil || !keep {
+		return err
+	}
+
+	name, err := outputPath(path, w.cfg)
+	if errors.Is(err, ErrNoPrefix) {
+		return nil
+	}
+	if w.cfg.hooked() {
+		w.cfg.notify(Result{Path: path, Info: info, Action: "list", Dest: name})
+		return nil
+	}
+	return listFile(name, w.out)
+}
@@ -0,0 +1,232 @@
+package fss
+
+import (
+	"bytes"
+	"clitools/fss/testsupport"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatchLoop(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 2, ".gz": 1}, "dummy"))
+
+	newDir := filepath.Join(tempDir, "new")
+	if err := os.Mkdir(newDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	log1 := filepath.Join(tempDir, "file1.log")
+	log2 := filepath.Join(tempDir, "file2.log")
+	gz := filepath.Join(tempDir, "file1.gz")
+	gone := filepath.Join(tempDir, "gone.log")
+
+	testCases := []struct {
+		name     string
+		debounce time.Duration
+		events   []fsnotify.Event
+		expected string
+		expAdded []string
+	}{
+		{
+			name: "CreateMatch",
+			events: []fsnotify.Event{
+				{Name: log1, Op: fsnotify.Create},
+				{Name: gz, Op: fsnotify.Create},
+			},
+			expected: log1 + "\n" + "Watch summary: 2 events, 1 matched files, 0 unsettled\n",
+		},
+		{
+			name: "Remove",
+			events: []fsnotify.Event{
+				{Name: gone, Op: fsnotify.Remove},
+			},
+			expected: "REMOVED: " + gone + "\n" + "Watch summary: 1 events, 0 matched files, 0 unsettled\n",
+		},
+		{
+			name: "IgnoreChmod",
+			events: []fsnotify.Event{
+				{Name: log1, Op: fsnotify.Chmod},
+			},
+			expected: "Watch summary: 0 events, 0 matched files, 0 unsettled\n",
+		},
+		{
+			name: "NewDirectoryWatched",
+			events: []fsnotify.Event{
+				{Name: newDir, Op: fsnotify.Create},
+			},
+			expected: "Watch summary: 1 events, 0 matched files, 0 unsettled\n",
+			expAdded: []string{newDir},
+		},
+		{
+			name:     "DebounceBatches",
+			debounce: 50 * time.Millisecond,
+			events: []fsnotify.Event{
+				{Name: log2, Op: fsnotify.Create},
+				{Name: log2, Op: fsnotify.Write},
+				{Name: log2, Op: fsnotify.Write},
+				{Name: log1, Op: fsnotify.Write},
+			},
+			expected: log1 + "\n" + log2 + "\n" + "Watch summary: 4 events, 2 matched files, 0 unsettled\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				buffer bytes.Buffer
+				added  []string
+			)
+			events := make(chan fsnotify.Event)
+			errs := make(chan error)
+			done := make(chan struct{})
+			add := func(path string) error {
+				added = append(added, path)
+				return nil
+			}
+
+			cfg := Config{Ext: ".log", Debounce: tc.debounce}
+			result := make(chan error)
+			go func() {
+				result <- watchLoop(events, errs, add, &buffer, tempDir, cfg, done)
+			}()
+
+			for _, ev := range tc.events {
+				events <- ev
+			}
+			if tc.debounce > 0 {
+				time.Sleep(3 * tc.debounce)
+			}
+			close(done)
+
+			if err := <-result; err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+			if len(added) != len(tc.expAdded) {
+				t.Errorf("expected watches %v, got %v instead\n", tc.expAdded, added)
+			}
+		})
+	}
+}
+
+func TestWatchLoopError(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	errs := make(chan error, 1)
+	errs <- fsnotify.ErrEventOverflow
+
+	var buffer bytes.Buffer
+	err := watchLoop(events, errs, func(string) error { return nil }, &buffer, ".", Config{}, nil)
+	if err != fsnotify.ErrEventOverflow {
+		t.Errorf("expected %v, got %v instead\n", fsnotify.ErrEventOverflow, err)
+	}
+}
+
+// TestWatchLoopSettle checks files are only handled once they had no
+// events for the settle duration
+func TestWatchLoopSettle(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 2}, "dummy"))
+	log1 := filepath.Join(tempDir, "file1.log")
+	log2 := filepath.Join(tempDir, "file2.log")
+
+	var buffer syncBuffer
+	events := make(chan fsnotify.Event)
+	done := make(chan struct{})
+	cfg := Config{Ext: ".log", Debounce: 10 * time.Millisecond, Settle: 200 * time.Millisecond}
+	result := make(chan error)
+	go func() {
+		result <- watchLoop(events, make(chan error), func(string) error { return nil }, &buffer, tempDir, cfg, done)
+	}()
+
+	events <- fsnotify.Event{Name: log1, Op: fsnotify.Create}
+	time.Sleep(50 * time.Millisecond)
+	if res := buffer.String(); res != "" {
+		t.Errorf("expected nothing before the file settled, got %q\n", res)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	events <- fsnotify.Event{Name: log2, Op: fsnotify.Write}
+	close(done)
+
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	expected := log1 + "\n" + "Watch summary: 2 events, 1 matched files, 1 unsettled\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestWatchLoopArchive checks the actions are applied to watched files
+func TestWatchLoopArchive(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 1}, "dummy"))
+	arcDir := t.TempDir()
+	log1 := filepath.Join(tempDir, "file1.log")
+
+	var buffer, logs bytes.Buffer
+	events := make(chan fsnotify.Event, 1)
+	events <- fsnotify.Event{Name: log1, Op: fsnotify.Create}
+	close(events)
+
+	cfg := Config{Ext: ".log", Arc: arcDir, Del: true, LogWriter: &logs}
+	if err := watchLoop(events, nil, func(string) error { return nil }, &buffer, tempDir, cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(arcDir, "file1.log.gz")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(log1); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be deleted, got %v\n", log1, err)
+	}
+	if !strings.HasPrefix(logs.String(), "DELETED FILE: ") || !strings.Contains(logs.String(), log1) {
+		t.Errorf("expected delete log, got %q instead\n", logs.String())
+	}
+	expected := "Watch summary: 1 events, 1 matched files, 0 unsettled\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// TestWatchInitialScan checks the tree is listed before watching starts
+func TestWatchInitialScan(t *testing.T) {
+	tempDir := testsupport.Tree(t, testsupport.Numbered(map[string]int{".log": 1, ".gz": 1}, "dummy"))
+
+	var buffer bytes.Buffer
+	done := make(chan struct{})
+	close(done)
+	cfg := Config{Ext: ".log", WatchInitialScan: true}
+	if err := NewScanner(tempDir, cfg).Watch(&buffer, done); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := filepath.Join(tempDir, "file1.log") + "\n" + "Watch summary: 0 events, 0 matched files, 0 unsettled\n"
+	if expected != buffer.String() {
+		t.Errorf("expected %q, got %q instead\n", expected, buffer.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to read while watchLoop writes it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
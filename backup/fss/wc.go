@@ -0,0 +1,124 @@
+package fss
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// wcProbe is the number of bytes looked at for a NUL byte before a file
+// is counted, the files holding one are skipped as binary
+const wcProbe = 8000
+
+// wcBufSize is the size of the buffer the files are counted through, the
+// memory used whatever the length of their lines
+const wcBufSize = 64 * 1024
+
+// countWC returns the number of newlines, words and bytes read from r,
+// like wc. Words are separated by Unicode white space, as with
+// -report-word-count. With linesOnly the words are not counted and the
+// newlines are found with a plain byte search. binary is true, with no
+// counts, when the first wcProbe bytes hold a NUL byte.
+func countWC(r io.Reader, linesOnly bool) (lines, words, size int64, binary bool, err error) {
+	br := bufio.NewReaderSize(r, wcBufSize)
+	head, err := br.Peek(wcProbe)
+	if err != nil && err != io.EOF {
+		return 0, 0, 0, false, err
+	}
+	if containsNullByte(head) {
+		return 0, 0, 0, true, nil
+	}
+
+	buf := make([]byte, wcBufSize)
+	carry := 0 // bytes of a rune cut by the end of the last read
+	inWord := false
+	for {
+		n, rerr := br.Read(buf[carry:])
+		size += int64(n)
+		lines += int64(bytes.Count(buf[carry:carry+n], []byte{'\n'}))
+		if !linesOnly {
+			data := buf[:carry+n]
+			i := 0
+			for i < len(data) {
+				if !utf8.FullRune(data[i:]) && rerr == nil {
+					break
+				}
+				c, width := utf8.DecodeRune(data[i:])
+				space := unicode.IsSpace(c)
+				if !space && !inWord {
+					words++
+				}
+				inWord = !space
+				i += width
+			}
+			carry = copy(buf, data[i:])
+		}
+		if rerr == io.EOF {
+			return lines, words, size, false, nil
+		}
+		if rerr != nil {
+			return 0, 0, 0, false, rerr
+		}
+	}
+}
+
+// wcCounter sums the counts of the files counted by WC, written in the
+// JSON summary as they are
+type wcCounter struct {
+	Files  int64 `json:"files"`
+	Binary int64 `json:"binary_skipped"`
+	Lines  int64 `json:"lines"`
+	Words  int64 `json:"words"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// count counts the file at path and writes its row with name to out,
+// lines, words and bytes tab separated like wc, its lines only with
+// linesOnly. A binary file is skipped with a warning. A nil out only adds
+// the counts to the totals.
+func (w *wcCounter) count(path, name string, linesOnly bool, out io.Writer) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lines, words, size, binary, err := countWC(f, linesOnly)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if binary {
+		w.Binary++
+		if out == nil {
+			return nil
+		}
+		_, err = fmt.Fprintf(out, "WARNING: skipping binary file %s\n", name)
+		return err
+	}
+	w.Files++
+	w.Lines += lines
+	w.Words += words
+	w.Bytes += size
+	if out == nil {
+		return nil
+	}
+	if linesOnly {
+		_, err = fmt.Fprintf(out, "%d\t%s\n", lines, name)
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%d\t%d\t%d\t%s\n", lines, words, size, name)
+	return err
+}
+
+// reportTotals writes the totals row, named total like the one of wc
+func (w *wcCounter) reportTotals(linesOnly bool, out io.Writer) error {
+	if linesOnly {
+		_, err := fmt.Fprintf(out, "%d\ttotal\n", w.Lines)
+		return err
+	}
+	_, err := fmt.Fprintf(out, "%d\t%d\t%d\ttotal\n", w.Lines, w.Words, w.Bytes)
+	return err
+}
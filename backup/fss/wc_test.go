@@ -0,0 +1,140 @@
+package fss
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestCountWC checks the counts of wc, words split by any Unicode space
+// even when a read cuts it, and the binary probe
+func TestCountWC(t *testing.T) {
+	long := strings.Repeat("word ", 100000) + "\n"
+	testCases := []struct {
+		name      string
+		content   string
+		oneByte   bool
+		linesOnly bool
+		expLines  int64
+		expWords  int64
+		expBinary bool
+	}{
+		{name: "Empty"},
+		{name: "NoNewlineAtEnd", content: "one two\nthree", expLines: 1, expWords: 3},
+		{name: "LongLine", content: long + "end\n", expLines: 2, expWords: 100001},
+		{name: "UnicodeSpace", content: "a\u00a0b\u2003c\n", expLines: 1, expWords: 3},
+		{name: "RuneCutByReads", content: "a\u00a0b\u2003c\n", oneByte: true, expLines: 1, expWords: 3},
+		{name: "LinesOnly", content: long + "end\n", linesOnly: true, expLines: 2},
+		{name: "Binary", content: "text\x00more\n", expBinary: true},
+		{name: "NULAfterProbe", content: strings.Repeat("x", wcProbe) + "\x00\n", expLines: 1, expWords: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := strings.NewReader(tc.content)
+			var lines, words, size int64
+			var binary bool
+			var err error
+			if tc.oneByte {
+				lines, words, size, binary, err = countWC(iotest.OneByteReader(r), tc.linesOnly)
+			} else {
+				lines, words, size, binary, err = countWC(r, tc.linesOnly)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if binary != tc.expBinary {
+				t.Fatalf("expected binary %t, got %t instead\n", tc.expBinary, binary)
+			}
+			if binary {
+				return
+			}
+			if lines != tc.expLines || words != tc.expWords || size != int64(len(tc.content)) {
+				t.Errorf("expected %d %d %d, got %d %d %d instead\n",
+					tc.expLines, tc.expWords, len(tc.content), lines, words, size)
+			}
+		})
+	}
+}
+
+// TestRunWC checks the rows and totals of WC, and the rows follow Sort
+func TestRunWC(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a.log":   "one two three\nfour\n",
+		"b.log":   "five\n",
+		"c.log":   "\x00\x01binary",
+		"d.log":   "six seven\neight nine ten\neleven\n",
+		"e.txt":   "not matched\n",
+		"sub/f.g": "",
+	})
+	path := func(name string) string { return filepath.Join(tempDir, name) }
+
+	testCases := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{
+			name: "Counts",
+			cfg:  Config{Ext: ".log", WC: true},
+			expected: "2\t4\t19\t" + path("a.log") + "\n" +
+				"1\t1\t5\t" + path("b.log") + "\n" +
+				"WARNING: skipping binary file " + path("c.log") + "\n" +
+				"3\t6\t32\t" + path("d.log") + "\n" +
+				"6\t11\t56\ttotal\n",
+		},
+		{
+			name: "LinesOnlySorted",
+			cfg:  Config{Ext: ".log", WC: true, LinesOnly: true, Sort: "size"},
+			expected: "1\t" + path("b.log") + "\n" +
+				"WARNING: skipping binary file " + path("c.log") + "\n" +
+				"2\t" + path("a.log") + "\n" +
+				"3\t" + path("d.log") + "\n" +
+				"6\ttotal\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := NewScanner(tempDir, tc.cfg).Run(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected != buffer.String() {
+				t.Errorf("expected %q, got %q instead\n", tc.expected, buffer.String())
+			}
+		})
+	}
+}
+
+// TestRunWCJSON checks the totals are the wc object of the JSON summary
+func TestRunWCJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles(t, tempDir, map[string]string{
+		"a.log": "one two three\nfour\n",
+		"b.log": "\x00binary",
+	})
+
+	s, err := New(tempDir, WithList(), WithWC(false), func(c *Config) { c.JSONReport = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err := s.Run(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	var summary struct {
+		WC wcCounter `json:"wc"`
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &summary); err != nil {
+		t.Fatalf("%v: %q", err, buffer.String())
+	}
+	expected := wcCounter{Files: 1, Binary: 1, Lines: 2, Words: 4, Bytes: 19}
+	if summary.WC != expected {
+		t.Errorf("expected %+v, got %+v instead\n", expected, summary.WC)
+	}
+}
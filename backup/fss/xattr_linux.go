@@ -0,0 +1,24 @@
+//go:build linux
+
+package fss
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// getXattr returns the value of the extended attribute name of f
+func getXattr(f *os.File, name string) ([]byte, error) {
+	buf := make([]byte, 128)
+	n, err := unix.Fgetxattr(int(f.Fd()), name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// setXattr sets the extended attribute name of f to value
+func setXattr(f *os.File, name string, value []byte) error {
+	return unix.Fsetxattr(int(f.Fd()), name, value, 0)
+}
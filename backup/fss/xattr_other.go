@@ -0,0 +1,19 @@
+//go:build !linux
+
+package fss
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoXattr = errors.New("extended attributes not supported")
+
+// getXattr is not available outside Linux, the checksums are never cached
+func getXattr(f *os.File, name string) ([]byte, error) {
+	return nil, errNoXattr
+}
+
+func setXattr(f *os.File, name string, value []byte) error {
+	return errNoXattr
+}
@@ -0,0 +1,55 @@
+package fss
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"", "ef46db3751d8e999"},
+		{"a", "d24ec4f1a98c6e5b"},
+		{"as", "1c330fb2d66be179"},
+		{"asd", "631c37ce72a97393"},
+		{"asdf", "415872f599cea71e"},
+		{"Call me Ishmael. Some years ago--never mind how long precisely-", "02a2e85470d6fd96"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%.8q", tc.input), func(t *testing.T) {
+			h := newXXH64()
+			h.Write([]byte(tc.input))
+			if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != tc.expected {
+				t.Errorf("expected %s, got %s instead\n", tc.expected, sum)
+			}
+		})
+	}
+}
+
+// TestXXH64Writes checks that the sum doesn't depend on how the input is
+// split across writes
+func TestXXH64Writes(t *testing.T) {
+	input := []byte(strings.Repeat("0123456789abcdef", 20) + "xyz")
+	whole := newXXH64()
+	whole.Write(input)
+	expected := whole.Sum(nil)
+
+	for _, size := range []int{1, 3, 7, 8, 31, 32, 33, 100} {
+		h := newXXH64()
+		for rest := input; len(rest) > 0; {
+			n := size
+			if n > len(rest) {
+				n = len(rest)
+			}
+			h.Write(rest[:n])
+			rest = rest[n:]
+		}
+		if sum := h.Sum(nil); string(sum) != string(expected) {
+			t.Errorf("writes of %d bytes: expected %x, got %x instead\n", size, expected, sum)
+		}
+	}
+}